@@ -0,0 +1,376 @@
+package nzbtouch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/audit"
+	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/groupstats"
+	"github.com/javi11/nzb-touch/internal/nzb"
+	"github.com/javi11/nzb-touch/internal/processor"
+	"github.com/javi11/nzb-touch/internal/progress"
+	"github.com/sourcegraph/conc/pool"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// auditDepthDefault is the number of directory levels rolled up in audit reports
+	auditDepthDefault = 2
+	// auditProgressInterval is how often the progress of an audit is logged
+	auditProgressInterval = time.Minute
+)
+
+var (
+	auditDirs   []string
+	auditOutput string
+	auditFormat string
+	auditJobs   int
+	auditDepth  int
+	auditGroups bool
+	auditUntil  string
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Check a whole NZB library once and write a consolidated report",
+	Long: `Walk every NZB in the library once, check it using the scanner check settings
+(check_percent, missing_percent, sampling_strategy) and write a single report with the
+overall completion, per-category statistics and the list of at-risk NZBs.
+The category of an NZB is the name of the directory containing it.
+With --until the audit tracks the time spent per NZB and defers the NZBs that are not
+expected to finish before the window end, so the run stops cleanly at the boundary.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.NewFromFile(configFile)
+		if err != nil {
+			slog.Error("Failed to load config", "error", err)
+			os.Exit(1)
+		}
+
+		switch auditFormat {
+		case "text", "json":
+		default:
+			slog.Error("Invalid report format, expected text or json", "format", auditFormat)
+			os.Exit(1)
+		}
+
+		dirs := auditDirs
+		if len(dirs) == 0 {
+			dirs = cfg.Scanner.WatchDirectories
+		}
+		if len(dirs) == 0 {
+			slog.Error("No directories to audit, use --dir or configure scanner.watch_directories")
+			os.Exit(1)
+		}
+
+		checkOptions := scannerCheckOptions(cfg)
+		if err := checkOptions.Validate(); err != nil {
+			slog.Error("Invalid check options", "error", err)
+			os.Exit(1)
+		}
+
+		var window *audit.Window
+		if auditUntil != "" {
+			end, err := parseWindowEnd(auditUntil, time.Now())
+			if err != nil {
+				slog.Error("Invalid --until", "error", err)
+				os.Exit(1)
+			}
+			window = audit.NewWindow(end)
+		}
+
+		jobs := auditJobs
+		if jobs <= 0 {
+			jobs = cfg.Scanner.ConcurrentJobs
+		}
+
+		// Create the report output before spending hours on the audit
+		out := io.Writer(os.Stdout)
+		if auditOutput != "" {
+			f, err := os.Create(auditOutput)
+			if err != nil {
+				slog.Error("Failed to create report file", "error", err)
+				os.Exit(1)
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			out = f
+		}
+
+		connPool, err := newConnectionPool(cfg)
+		if err != nil {
+			slog.Error("Error creating connection pool", "error", err)
+			os.Exit(1)
+		}
+		defer connPool.Quit()
+
+		procOpts, err := processorOptions(cfg)
+		if err != nil {
+			slog.Error("Invalid processor configuration", "error", err)
+			os.Exit(1)
+		}
+		procOpts = append(procOpts, processor.WithReporter(processor.NewNopReporter()))
+
+		// Keep the segment results and the at-risk entries on disk so the
+		// memory stays flat whatever the size of the library
+		report := audit.NewReport(auditDepth)
+		if cfg.Scanner.SpillResults {
+			segments, err := processor.NewSpillStore[processor.SegmentRecord](cfg.Scanner.SpillDirectory)
+			if err != nil {
+				slog.Error("Failed to create result spill store", "error", err)
+				os.Exit(1)
+			}
+			defer func() {
+				_ = segments.Close()
+			}()
+
+			atRisk, err := processor.NewSpillStore[audit.Entry](cfg.Scanner.SpillDirectory)
+			if err != nil {
+				slog.Error("Failed to create result spill store", "error", err)
+				os.Exit(1)
+			}
+			defer func() {
+				_ = atRisk.Close()
+			}()
+
+			slog.Info("Spilling segment results to disk", "path", segments.Path(), "at_risk_path", atRisk.Path())
+			procOpts = append(procOpts, processor.WithResultSpill(segments))
+			report.Spill(atRisk, segments)
+		}
+
+		var groupStats *groupstats.Collector
+		if auditGroups {
+			groupStats = groupstats.New()
+			procOpts = append(procOpts, processor.WithGroupStats(groupStats))
+		}
+		proc := processor.New(connPool, procOpts...)
+
+		// Stop checking on interrupt but still write the partial report
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+
+		tracker := startAuditProgress(ctx, dirs)
+		publishProgress(func() progress.Snapshot { return tracker.Snapshot(-1) })
+
+		slog.Info("Starting audit", "dirs", dirs, "nzbs", tracker.Snapshot(-1).Total, "jobs", jobs, "check_percent", checkOptions.CheckPercent, "until", window.End())
+
+		auditLibrary(ctx, proc, report, dirs, jobs, checkOptions, window, tracker)
+		report.Groups = groupStats.Snapshot()
+		report.Finish(ctx.Err() != nil)
+
+		if auditFormat == "json" {
+			err = report.WriteJSON(out)
+		} else {
+			err = report.WriteText(out)
+		}
+		if err != nil {
+			slog.Error("Failed to write audit report", "error", err)
+			os.Exit(1)
+		}
+
+		slog.Info("Audit completed",
+			"nzbs", report.Overall.NZBs,
+			"at_risk", report.Overall.AtRisk,
+			"completion", report.Overall.Completion,
+			"deferred", len(report.Deferred),
+			"average_per_nzb", window.AveragePerNZB(),
+			"duration", report.Duration)
+	},
+}
+
+// auditLibrary checks every NZB below dirs with up to jobs NZBs in parallel
+// into report, deferring the NZBs not expected to finish before the window end
+func auditLibrary(ctx context.Context, proc *processor.Processor, report *audit.Report, dirs []string, jobs int, opts processor.CheckOptions, window *audit.Window, tracker *progress.Tracker) {
+	workers := pool.New().WithMaxGoroutines(jobs)
+
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to read path, skipping", "path", path, "error", err)
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".nzb") {
+				return nil
+			}
+
+			workers.Go(func() {
+				entry, deferred := auditNZB(ctx, proc, path, opts, window, tracker)
+				if deferred {
+					report.Defer(path)
+					return
+				}
+				entry.Dir = relativeDir(dir, path)
+
+				// Interrupted checks say nothing about the NZB health
+				if ctx.Err() == nil {
+					report.Add(entry)
+				}
+			})
+
+			return nil
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.ErrorContext(ctx, "Failed to walk directory", "dir", dir, "error", err)
+		}
+	}
+
+	workers.Wait()
+}
+
+// startAuditProgress counts the NZBs below dirs, giving the audit a total to
+// estimate its end from, and logs its progress until ctx is done
+func startAuditProgress(ctx context.Context, dirs []string) *progress.Tracker {
+	tracker := progress.NewTracker()
+	tracker.SetTotal(countNZBs(ctx, dirs))
+
+	go progress.Log(ctx, auditProgressInterval, "Audit progress", func() progress.Snapshot {
+		return tracker.Snapshot(-1)
+	})
+
+	return tracker
+}
+
+// countNZBs counts the NZBs below dirs
+func countNZBs(ctx context.Context, dirs []string) int {
+	count := 0
+	for _, dir := range dirs {
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == nil && !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".nzb") {
+				count++
+			}
+
+			return nil
+		})
+	}
+
+	return count
+}
+
+// relativeDir returns the "/" separated directory of path relative to root
+func relativeDir(root, path string) string {
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil {
+		return ""
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// parseWindowEnd parses the end of the run window, either a duration from now
+// ("6h"), a time of day ("06:00", the next occurrence) or an RFC 3339 time
+func parseWindowEnd(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), nil
+	}
+
+	if t, err := time.ParseInLocation("15:04", value, now.Location()); err == nil {
+		end := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !end.After(now) {
+			end = end.AddDate(0, 0, 1)
+		}
+
+		return end, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("expected a duration, a time of day (15:04) or an RFC 3339 time, got %q", value)
+}
+
+// auditNZB checks a single NZB and describes its outcome, accounting for it
+// in the audit progress. It reports true, without checking, when the NZB is
+// not expected to finish before the window end.
+func auditNZB(ctx context.Context, proc *processor.Processor, path string, opts processor.CheckOptions, window *audit.Window, tracker *progress.Tracker) (audit.Entry, bool) {
+	entry := audit.Entry{
+		Path:     path,
+		Category: filepath.Base(filepath.Dir(path)),
+	}
+
+	// Past the window end nothing fits, skip loading the NZB
+	if !window.Fits(0) {
+		tracker.Skip()
+		return entry, true
+	}
+
+	nzbData, err := nzb.LoadFromFile(path)
+	if err != nil {
+		entry.Error = err.Error()
+		entry.ErrorCode = errcode.Of(err)
+		tracker.Record(0, 0, -1)
+		return entry, false
+	}
+
+	segments := 0
+	for _, file := range nzbData.Nzb.Files {
+		segments += len(file.Segments)
+	}
+
+	if !window.Fits(segments) {
+		slog.InfoContext(ctx, "Deferring NZB to the next window", "path", path,
+			"estimate", window.Estimate(segments).Round(time.Second), "window_end", window.End())
+		tracker.Skip()
+		return entry, true
+	}
+
+	opts.Source = path
+	result, err := proc.ProcessNZB(ctx, nzbData.Nzb, opts)
+	if err != nil {
+		entry.Error = err.Error()
+		entry.ErrorCode = errcode.Of(err)
+	}
+	if result != nil {
+		entry.Health = result.Health()
+		entry.TotalSegments = result.TotalSegments
+		entry.CheckedSegments = result.CheckedSegments
+		entry.FailedSegments = result.FailedSegments
+		entry.Par2Percent = result.Par2Percent
+		entry.Par2Thin = result.Par2Thin
+		entry.Partial = result.Partial
+		entry.Headers = result.FileHeaders
+
+		if ctx.Err() == nil {
+			window.Record(segments, result.Duration)
+			tracker.Record(result.Duration, result.BytesDownloaded, -1)
+		}
+	} else if ctx.Err() == nil {
+		tracker.Record(0, 0, -1)
+	}
+
+	slog.InfoContext(ctx, "Audited NZB", "path", path, "health", entry.Health, "partial", entry.Partial, "error", entry.Error, "error_code", entry.ErrorCode)
+
+	return entry, false
+}
+
+func init() {
+	auditCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to YAML config file (required)")
+	auditCmd.Flags().StringSliceVarP(&auditDirs, "dir", "d", nil, "Library directory to audit, may be repeated (default: scanner watch_directories)")
+	auditCmd.Flags().StringVarP(&auditOutput, "output", "o", "", "Write the report to this file instead of stdout")
+	auditCmd.Flags().StringVar(&auditFormat, "format", "text", "Report format (text or json)")
+	auditCmd.Flags().IntVarP(&auditJobs, "jobs", "j", 0, "NZBs checked in parallel (default: scanner concurrent_jobs)")
+	auditCmd.Flags().BoolVar(&auditGroups, "group-stats", false, "Report article availability per newsgroup and provider")
+	auditCmd.Flags().StringVar(&auditUntil, "until", "", "End of the run window: a duration (6h), a time of day (06:00) or an RFC 3339 time")
+	auditCmd.Flags().IntVar(&auditDepth, "depth", auditDepthDefault, "Directory levels rolled up in the report (0 to disable)")
+	_ = auditCmd.MarkFlagRequired("config")
+
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,37 @@
+package nzbtouch
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/javi11/nzb-touch/internal/api"
+	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/javi11/nzb-touch/internal/processor"
+)
+
+// runCheckerNode checks the jobs of the scanner node until interrupted, the
+// API token is the one of the scanner node
+func runCheckerNode(cfg config.Config, proc *processor.Processor) {
+	client, err := api.NewNodeClient(cfg.Scanner.ScannerNode, cfg.API.Token)
+	if err != nil {
+		slog.Error("Invalid scanner configuration", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Starting checker node...", "scanner_node", cfg.Scanner.ScannerNode, "workers", cfg.Scanner.ConcurrentJobs)
+
+	err = processor.RunChecker(ctx, proc, client, cfg.Scanner.ConcurrentJobs, cfg.Scanner.OutageRetry)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		slog.Error("Checker node error", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Checker node stopped")
+}
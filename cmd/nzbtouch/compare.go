@@ -0,0 +1,138 @@
+package nzbtouch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/javi11/nzb-touch/internal/audit"
+	"github.com/javi11/nzb-touch/internal/processor"
+	"github.com/spf13/cobra"
+)
+
+var compareFormat string
+
+var compareRunsCmd = &cobra.Command{
+	Use:   "compare-runs <old> <new>",
+	Short: "Diff two stored check results and show what changed state between them",
+	Long: `Compare two runs over the same NZBs, the older one first, and list what changed
+state between them to quantify the decay between audits.
+Both files are JSON audit reports (audit --format json), compared per NZB, category and
+directory, or session recordings (--record), compared per segment.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		switch compareFormat {
+		case "text", "json":
+		default:
+			slog.Error("Invalid format, expected text or json", "format", compareFormat)
+			os.Exit(1)
+		}
+
+		kinds := make([]string, len(args))
+		for i, path := range args {
+			kind, err := runFileKind(path)
+			if err != nil {
+				slog.Error("Failed to read run", "path", path, "error", err)
+				os.Exit(1)
+			}
+			kinds[i] = kind
+		}
+		if kinds[0] != kinds[1] {
+			slog.Error("Cannot compare an audit report with a session recording", "old", kinds[0], "new", kinds[1])
+			os.Exit(1)
+		}
+
+		var (
+			comparison interface {
+				WriteText(w io.Writer) error
+				WriteJSON(w io.Writer) error
+			}
+			err error
+		)
+		if kinds[0] == "report" {
+			comparison, err = compareReports(args[0], args[1])
+		} else {
+			comparison, err = compareSessions(args[0], args[1])
+		}
+		if err != nil {
+			slog.Error("Failed to compare runs", "error", err)
+			os.Exit(1)
+		}
+
+		if compareFormat == "json" {
+			err = comparison.WriteJSON(os.Stdout)
+		} else {
+			err = comparison.WriteText(os.Stdout)
+		}
+		if err != nil {
+			slog.Error("Failed to write comparison", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// runFileKind tells whether a file is an audit report ("report") or a
+// session recording ("session") from its first JSON value
+func runFileKind(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var first map[string]json.RawMessage
+	if err := json.NewDecoder(f).Decode(&first); err != nil {
+		return "", fmt.Errorf("not a JSON audit report or session recording: %w", err)
+	}
+
+	switch {
+	case first["overall"] != nil:
+		return "report", nil
+	case first["segment_id"] != nil:
+		return "session", nil
+	default:
+		return "", fmt.Errorf("not a JSON audit report or session recording")
+	}
+}
+
+func compareReports(oldPath, newPath string) (*audit.Comparison, error) {
+	reports := make([]*audit.Report, 2)
+	for i, path := range []string{oldPath, newPath} {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		reports[i], err = audit.LoadReport(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit report %s: %w", path, err)
+		}
+	}
+
+	return audit.Compare(reports[0], reports[1]), nil
+}
+
+func compareSessions(oldPath, newPath string) (*audit.SessionComparison, error) {
+	before, err := processor.LoadSession(oldPath)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := processor.LoadSession(newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return audit.CompareSessions(before.Outcomes(), after.Outcomes()), nil
+}
+
+func init() {
+	compareRunsCmd.Flags().StringVar(&compareFormat, "format", "text", "Output format (text or json)")
+
+	rootCmd.AddCommand(compareRunsCmd)
+}
@@ -0,0 +1,48 @@
+package nzbtouch
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/javi11/nzb-touch/internal/nntp"
+)
+
+// watchCredentials reads the configuration file and the password files it
+// names every interval until ctx is done. The connections authenticated with
+// a password that changed are replaced by the pool, while accounts added
+// since the start take a restart to be used.
+func watchCredentials(ctx context.Context, path string, interval time.Duration, creds *nntp.Credentials) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	warned := make(map[string]bool)
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		cfg, err := config.NewFromFile(path)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to reload credentials, keeping the current ones", "error", err)
+			continue
+		}
+
+		for _, p := range cfg.PoolProviders() {
+			if !creds.Known(p.Host, p.Port, p.Username) {
+				if id := p.ID(); !warned[id] {
+					warned[id] = true
+					slog.WarnContext(ctx, "Provider account added to the configuration, restart to use it", "provider", id)
+				}
+				continue
+			}
+
+			if creds.Set(p.Host, p.Port, p.Username, p.Password) {
+				slog.InfoContext(ctx, "Provider password changed, reconnecting", "provider", p.ID())
+			}
+		}
+	}
+}
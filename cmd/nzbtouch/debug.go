@@ -0,0 +1,70 @@
+package nzbtouch
+
+import (
+	"errors"
+	"expvar"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/javi11/nzb-touch/internal/progress"
+	"github.com/spf13/cobra"
+)
+
+var (
+	debugListen string
+	nntpTrace   bool
+)
+
+// startDebugServer serves pprof and expvar on addr in the background
+func startDebugServer(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Debug server stopped", "error", err)
+		}
+	}()
+
+	slog.Info("Debug endpoints enabled", "addr", listener.Addr().String(),
+		"pprof", "/debug/pprof/", "expvar", "/debug/vars")
+
+	return nil
+}
+
+// publishProgress serves the progress of the running scan or audit as the
+// "progress" expvar
+func publishProgress(snapshot func() progress.Snapshot) {
+	expvar.Publish("progress", expvar.Func(func() any {
+		return snapshot()
+	}))
+}
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+
+	rootCmd.PersistentFlags().StringVar(&debugListen, "debug-listen", "", "Serve pprof and expvar debug endpoints on this address (e.g. localhost:6060)")
+	rootCmd.PersistentFlags().BoolVar(&nntpTrace, "nntp-trace", false, "Log every NNTP command and status line, credentials redacted")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if debugListen == "" {
+			return nil
+		}
+
+		return startDebugServer(debugListen)
+	}
+}
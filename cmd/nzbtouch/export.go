@@ -0,0 +1,213 @@
+package nzbtouch
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/processor"
+	"github.com/parquet-go/parquet-go"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat string
+	exportOutput string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export <view>",
+	Short: "Export check results and history as CSV or Parquet for BI tools",
+	Long: `Export a reporting view of the queue database as CSV or Parquet, e.g. to
+analyze library health in a spreadsheet. The same views, named report_<view>,
+can be queried directly in the database, e.g. from Metabase.
+
+Views:
+  results     one row per NZB with its status, health and check counts
+  history     every operation on NZB files, checks included
+  categories  NZB, failure and health totals per category`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: reportViewNames(),
+	Run: func(cmd *cobra.Command, args []string) {
+		view, ok := processor.LookupReportView(args[0])
+		if !ok {
+			slog.Error("Unknown view", "view", args[0], "expected", strings.Join(reportViewNames(), ", "))
+			os.Exit(1)
+		}
+
+		write := writeReportCSV
+		switch exportFormat {
+		case "csv":
+		case "parquet":
+			write = writeReportParquet
+		default:
+			slog.Error("Invalid export format, expected csv or parquet", "format", exportFormat)
+			os.Exit(1)
+		}
+
+		queue := openQueue()
+		defer func() {
+			_ = queue.Close()
+		}()
+
+		out := io.Writer(os.Stdout)
+		if exportOutput != "" {
+			f, err := os.Create(exportOutput)
+			if err != nil {
+				slog.Error("Failed to create export file", "error", err)
+				os.Exit(1)
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			out = f
+		}
+
+		count, err := write(out, queue, view)
+		if err != nil {
+			slog.Error("Failed to export view", "view", view.Name, "error", err)
+			os.Exit(1)
+		}
+
+		slog.Info("View exported", "view", view.Name, "rows", count, "format", exportFormat)
+	},
+}
+
+// reportViewNames returns the names of the reporting views
+func reportViewNames() []string {
+	names := make([]string, len(processor.ReportViews))
+	for i, view := range processor.ReportViews {
+		names[i] = view.Name
+	}
+
+	return names
+}
+
+// writeReportCSV writes a view as CSV with a header row, times in RFC 3339
+// and empty fields for missing values
+func writeReportCSV(out io.Writer, queue *processor.Queue, view processor.ReportView) (int, error) {
+	w := csv.NewWriter(out)
+
+	header := make([]string, len(view.Columns))
+	for i, column := range view.Columns {
+		header[i] = column.Name
+	}
+	if err := w.Write(header); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	record := make([]string, len(view.Columns))
+	err := queue.Report(view, func(values []any) error {
+		for i, v := range values {
+			switch v := v.(type) {
+			case nil:
+				record[i] = ""
+			case time.Time:
+				record[i] = v.UTC().Format(time.RFC3339)
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+
+		count++
+		return w.Write(record)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	w.Flush()
+	return count, w.Error()
+}
+
+// writeReportParquet writes a view as a Parquet file with one optional
+// column per view column, times in milliseconds since the epoch
+func writeReportParquet(out io.Writer, queue *processor.Queue, view processor.ReportView) (int, error) {
+	group := make(parquet.Group, len(view.Columns))
+	for _, column := range view.Columns {
+		group[column.Name] = parquet.Optional(parquetNode(column.Type))
+	}
+	schema := parquet.NewSchema(view.Name, group)
+
+	// The schema orders its columns by name
+	index := make(map[string]int, len(view.Columns))
+	for i, column := range view.Columns {
+		index[column.Name] = i
+	}
+	order := make([]int, 0, len(view.Columns))
+	for _, path := range schema.Columns() {
+		order = append(order, index[path[0]])
+	}
+
+	w := parquet.NewWriter(out, schema)
+	count := 0
+	err := queue.Report(view, func(values []any) error {
+		row := make(parquet.Row, len(order))
+		for columnIndex, i := range order {
+			row[columnIndex] = parquetValue(values[i]).Level(0, 1, columnIndex)
+			if values[i] == nil {
+				row[columnIndex] = parquet.NullValue().Level(0, 0, columnIndex)
+			}
+		}
+
+		count++
+		_, err := w.WriteRows([]parquet.Row{row})
+		return err
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, w.Close()
+}
+
+// parquetNode returns the Parquet type of a report column
+func parquetNode(typ processor.ReportType) parquet.Node {
+	switch typ {
+	case processor.ReportInteger:
+		return parquet.Int(64)
+	case processor.ReportReal:
+		return parquet.Leaf(parquet.DoubleType)
+	case processor.ReportBool:
+		return parquet.Leaf(parquet.BooleanType)
+	case processor.ReportTime:
+		return parquet.Timestamp(parquet.Millisecond)
+	default:
+		return parquet.String()
+	}
+}
+
+// parquetValue converts a report value to its Parquet representation
+func parquetValue(v any) parquet.Value {
+	switch v := v.(type) {
+	case string:
+		return parquet.ByteArrayValue([]byte(v))
+	case int64:
+		return parquet.Int64Value(v)
+	case float64:
+		return parquet.DoubleValue(v)
+	case bool:
+		return parquet.BooleanValue(v)
+	case time.Time:
+		return parquet.Int64Value(v.UnixMilli())
+	default:
+		return parquet.NullValue()
+	}
+}
+
+func init() {
+	exportCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to YAML config file, the queue database is scanner.database_path")
+	exportCmd.Flags().StringVar(&queueDatabase, "db", "", "Path to the queue database (overrides the config file)")
+	exportCmd.Flags().StringVar(&exportFormat, "format", "csv", "Export format (csv or parquet)")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write the export to this file (default: stdout)")
+
+	rootCmd.AddCommand(exportCmd)
+}
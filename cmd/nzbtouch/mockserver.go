@@ -0,0 +1,77 @@
+package nzbtouch
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nzb-touch/internal/mockserver"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mockConfig   mockserver.Config
+	mockNZB      string
+	mockFiles    int
+	mockSegments int
+)
+
+var mockServerCmd = &cobra.Command{
+	Use:   "mockserver",
+	Short: "Serve synthetic articles over NNTP for testing",
+	Long: `Run an NNTP server answering every message-id with a synthetic article, some of
+them missing, corrupt, failing or slow as configured, so checks, retries and
+thresholds can be tested end to end without a usenet account. Message-ids
+containing "missing" or "corrupt" always are. With --nzb an NZB of articles
+served by the server is written first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if mockNZB != "" {
+			name := strings.TrimSuffix(filepath.Base(mockNZB), filepath.Ext(mockNZB))
+			data, err := nzbparser.Write(mockserver.SyntheticNZB(name, mockFiles, mockSegments, mockConfig.ArticleSize))
+			if err != nil {
+				slog.Error("Failed to build the NZB", "error", err)
+				os.Exit(1)
+			}
+
+			if err := os.WriteFile(mockNZB, data, 0o644); err != nil {
+				slog.Error("Failed to write the NZB", "error", err)
+				os.Exit(1)
+			}
+
+			slog.Info("NZB written", "path", mockNZB, "files", mockFiles, "segments_per_file", mockSegments)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+
+		if err := mockserver.New(mockConfig).Run(ctx); err != nil {
+			slog.Error("Mock server failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	flags := mockServerCmd.Flags()
+	flags.StringVarP(&mockConfig.Listen, "listen", "l", "localhost:1119", "Address to serve NNTP on")
+	flags.Float64Var(&mockConfig.MissingPercent, "missing", 0, "Percentage of articles answered as missing, picked by message-id")
+	flags.Float64Var(&mockConfig.CorruptPercent, "corrupt", 0, "Percentage of articles served with a wrong CRC, picked by message-id")
+	flags.Float64Var(&mockConfig.ErrorPercent, "errors", 0, "Percentage of requests failing with a transient error, picked at random")
+	flags.DurationVar(&mockConfig.Latency, "latency", 0, "Delay before answering each article request")
+	flags.DurationVar(&mockConfig.Jitter, "jitter", 0, "Random delay added to the latency")
+	flags.IntVar(&mockConfig.ArticleSize, "article-size", 750000, "Decoded bytes of each article")
+	flags.StringVar(&mockConfig.Username, "username", "", "Require this user with AUTHINFO")
+	flags.StringVar(&mockConfig.Password, "password", "", "Password of the user")
+	flags.IntVar(&mockConfig.MaxConnections, "max-connections", 0, "Refuse connections beyond this many with 502 (0 for unlimited)")
+	flags.StringVar(&mockConfig.Seed, "seed", "", "Changes which articles are missing or corrupt")
+	flags.StringVar(&mockNZB, "nzb", "", "Write an NZB of articles served by the server to this file")
+	flags.IntVar(&mockFiles, "files", 3, "Files of the NZB written with --nzb")
+	flags.IntVar(&mockSegments, "segments", 20, "Segments per file of the NZB written with --nzb")
+
+	rootCmd.AddCommand(mockServerCmd)
+}
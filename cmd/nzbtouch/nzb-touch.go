@@ -2,12 +2,17 @@ package nzbtouch
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
+	"time"
 
-	"github.com/javi11/nntppool/v2"
 	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/groupstats"
+	"github.com/javi11/nzb-touch/internal/hook"
 	"github.com/javi11/nzb-touch/internal/nzb"
+	"github.com/javi11/nzb-touch/internal/plugin"
 	"github.com/javi11/nzb-touch/internal/processor"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +22,18 @@ var (
 	configFile     string
 	checkPercent   int
 	missingPercent int
+	sampling       string
+	checkTimeout   time.Duration
+	onlyFiles      []string
+	skipFiles      []string
+	includeSamples bool
+	groupStats     bool
+	minPar2Percent float64
+	headerSamples  int
+	probeRar       bool
+	recordFile     string
+	replayFile     string
+	reportFile     string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -39,14 +56,20 @@ validate NZB files without storing the downloaded content.`,
 			os.Exit(1)
 		}
 
-		if checkPercent <= 0 || checkPercent > 100 {
-			slog.Error("Error: checkpercent must be between 1 and 100")
-			_ = cmd.Help()
-			os.Exit(1)
+		checkOptions := processor.CheckOptions{
+			CheckPercent:    checkPercent,
+			MissingPercent:  missingPercent,
+			Sampling:        processor.SamplingStrategy(sampling),
+			Timeout:         checkTimeout,
+			Only:            onlyFiles,
+			Skip:            skipFiles,
+			IncludeSamples:  includeSamples,
+			MinPar2Percent:  minPar2Percent,
+			HeaderSamples:   headerSamples,
+			EncryptionProbe: probeRar,
 		}
-
-		if missingPercent < 0 || missingPercent > 100 {
-			slog.Error("Error: missingpercent must be between 0 and 100")
+		if err := checkOptions.Validate(); err != nil {
+			slog.Error("Error: invalid check options", "error", err)
 			_ = cmd.Help()
 			os.Exit(1)
 		}
@@ -58,33 +81,112 @@ validate NZB files without storing the downloaded content.`,
 			os.Exit(2)
 		}
 
+		if err := plugin.Validate(cfg.Plugins); err != nil {
+			slog.Error("Invalid plugin configuration", "error", err)
+			os.Exit(2)
+		}
+		plugins := plugin.NewManager(cfg.Plugins)
+		hooks := hook.NewRunner(cfg.Hooks)
+
+		ctx := context.Background()
+		if err := plugins.Dispatch(ctx, plugin.Payload{Event: plugin.EventPreCheck, NzbPath: nzbFile}); errors.Is(err, plugin.ErrRejected) {
+			slog.Info("Pre-check plugin rejected the NZB, skipping", "path", nzbFile)
+			return
+		}
+
+		if err := hooks.Run(ctx, hook.EventPreCheck, hook.Info{NzbPath: nzbFile}); errors.Is(err, hook.ErrRejected) {
+			slog.Info("Pre-check hook rejected the NZB, skipping", "path", nzbFile)
+			return
+		}
+
 		// Load and parse NZB file
 		nzbData, err := nzb.LoadFromFile(nzbFile)
 		if err != nil {
-			slog.Error("Failed to load NZB file", "error", err)
+			slog.Error("Failed to load NZB file", "error", err, "error_code", errcode.Of(err))
+			plugins.DispatchResult(ctx, nzbFile, nil, err)
+			hooks.RunResult(ctx, hook.Info{NzbPath: nzbFile, Error: err.Error(), ErrorCode: string(errcode.Of(err))})
 			os.Exit(3)
 		}
 
 		// Display NZB information
 		nzbData.PrintInfo()
 
+		if recordFile != "" && replayFile != "" {
+			slog.Error("Error: --record and --replay are mutually exclusive")
+			os.Exit(1)
+		}
+
+		// Create processor with configured download workers
+		procOpts, err := processorOptions(cfg)
+		if err != nil {
+			slog.Error("Invalid processor configuration", "error", err)
+			os.Exit(2)
+		}
+
+		// Capture the segment responses, or answer them from a capture
+		newPool := newConnectionPool
+		var recorder *processor.SessionRecorder
+		if recordFile != "" {
+			recorder, err = processor.NewSessionRecorder(recordFile)
+			if err != nil {
+				slog.Error("Failed to start recording", "error", err)
+				os.Exit(2)
+			}
+			procOpts = append(procOpts, processor.WithSessionRecorder(recorder))
+		}
+		if replayFile != "" {
+			replay, err := processor.LoadSession(replayFile)
+			if err != nil {
+				slog.Error("Failed to load the session recording", "error", err)
+				os.Exit(2)
+			}
+			procOpts = append(procOpts, processor.WithSessionReplay(replay))
+			newPool = newReplayPool
+		}
+
 		// Create NNTP connection pool
-		pool, err := nntppool.NewConnectionPool(
-			nntppool.Config{Providers: cfg.DownloadProviders},
-		)
+		pool, err := newPool(cfg)
 		if err != nil {
 			slog.Error("Error creating connection pool", "error", err)
 			os.Exit(4)
 		}
 		defer pool.Quit()
-
-		// Create processor with configured download workers
-		proc := processor.New(pool, nzbData.TotalSegments, cfg.DownloadWorkers)
+		var groups *groupstats.Collector
+		if groupStats {
+			groups = groupstats.New()
+			procOpts = append(procOpts, processor.WithGroupStats(groups))
+		}
+		if reportFile != "" {
+			procOpts = append(procOpts, processor.WithProviderResults())
+		}
+		proc := processor.New(pool, procOpts...)
 
 		// Start download
-		ctx := context.Background()
-		if err := proc.ProcessNZB(ctx, nzbData.Nzb, checkPercent, missingPercent); err != nil {
-			slog.Error("Error processing NZB", "error", err)
+		checkOptions.Source = nzbFile
+		result, err := proc.ProcessNZB(ctx, nzbData.Nzb, checkOptions)
+		if recorder != nil {
+			if closeErr := recorder.Close(); closeErr != nil {
+				slog.Error("Failed to save the session recording", "error", closeErr)
+			} else {
+				slog.Info("Session recorded", "path", recordFile)
+			}
+		}
+		plugins.DispatchResult(ctx, nzbFile, result.Payload(), err)
+		hooks.RunResult(ctx, result.HookInfo(nzbFile, err))
+		processor.RetentionAlert(ctx, retentionPolicy(cfg), nzbFile, result, hooks, plugins)
+		if reportFile != "" {
+			if reportErr := processor.WriteNZBReport(reportFile, processor.NewNZBReport(nzbFile, result, err)); reportErr != nil {
+				slog.Error("Failed to write the NZB report", "path", reportFile, "error", reportErr)
+			}
+		}
+		if groups != nil {
+			_ = groupstats.WriteText(os.Stdout, groups.Snapshot())
+		}
+		if result != nil && len(result.FileHeaders) > 0 {
+			_ = processor.WriteFileHeaders(os.Stdout, result.FileHeaders)
+		}
+		if err != nil {
+			slog.Error("Error processing NZB", "error", err, "error_code", errcode.Of(err))
 			os.Exit(5)
 		}
 	},
@@ -95,6 +197,19 @@ func init() {
 	rootCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to YAML config file (required)")
 	rootCmd.Flags().IntVarP(&checkPercent, "checkpercent", "p", 100, "Percentage of NZB to download for checking (100 for full download)")
 	rootCmd.Flags().IntVarP(&missingPercent, "missingpercent", "m", 0, "Allowed percentage of missing articles before considering the NZB invalid (0 for none)")
+	rootCmd.Flags().StringVar(&sampling, "sampling", string(processor.SamplingRandom), "Segment sampling strategy when checkpercent < 100 (random or spread)")
+	rootCmd.Flags().DurationVar(&checkTimeout, "timeout", 0, "Time budget of the check, health is computed from the segments checked so far once exceeded (0 for no limit)")
+
+	rootCmd.Flags().StringSliceVar(&onlyFiles, "only", nil, "Only check files whose name matches one of these glob patterns (e.g. \"*.mkv\")")
+	rootCmd.Flags().StringSliceVar(&skipFiles, "skip", nil, "Do not check files whose name matches one of these glob patterns (e.g. \"*sample*\")")
+	rootCmd.Flags().BoolVar(&groupStats, "group-stats", false, "Print article availability per newsgroup and provider after the check")
+	rootCmd.Flags().IntVar(&headerSamples, "headers", 0, "Read the headers of the first N articles of every file and print the real subject, poster, post date and size")
+	rootCmd.Flags().BoolVar(&probeRar, "probe-rar", false, "Download the first article of the first RAR volume and report whether the archive is password protected")
+	rootCmd.Flags().Float64Var(&minPar2Percent, "min-par2", 0, "PAR2 recovery percentage of the payload below which parity is reported as thin (default 5)")
+	rootCmd.Flags().StringVar(&recordFile, "record", "", "Record the response of every segment request to this file, for replay")
+	rootCmd.Flags().StringVar(&replayFile, "replay", "", "Answer segment requests from a recording made with --record instead of the providers")
+	rootCmd.Flags().StringVar(&reportFile, "report", "", "Write a JSON report of the check, with the outcome of every file and provider, to this file")
+	rootCmd.Flags().BoolVar(&includeSamples, "include-samples", false, "Also check sample and proof files, excluded from the check by default")
 
 	_ = rootCmd.MarkFlagRequired("nzb")
 	_ = rootCmd.MarkFlagRequired("config")
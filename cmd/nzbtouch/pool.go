@@ -0,0 +1,207 @@
+package nzbtouch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/javi11/nzb-touch/internal/nntp"
+	"github.com/javi11/nzb-touch/internal/processor"
+	"github.com/javi11/nzb-touch/internal/usage"
+)
+
+// newConnectionPool creates the NNTP connection pool shared by every NZB
+// processed during the command, so warmed and authenticated connections are
+// reused across queue items instead of being re-established for each one
+func newConnectionPool(cfg config.Config) (nntppool.UsenetConnectionPool, error) {
+	poolConfig := nntppool.Config{
+		Providers:      cfg.PoolProviders(),
+		MinConnections: cfg.KeepWarmConnections,
+	}
+
+	// Servers with protocol settings the pool's client lacks are dialed by
+	// nzb-touch, every server is when the wire is traced, faults are injected,
+	// article headers are read or credentials are reloaded
+	var opts []nntp.Option
+	if nntpTrace {
+		opts = append(opts, nntp.WithTrace())
+	}
+	if cfg.Chaos.Enabled() {
+		slog.Warn("Chaos mode enabled, faults are injected into article requests",
+			"missing_percent", cfg.Chaos.MissingPercent, "error_percent", cfg.Chaos.ErrorPercent,
+			"slow_percent", cfg.Chaos.SlowPercent, "slow_delay", cfg.Chaos.SlowDelay, "drop_percent", cfg.Chaos.DropPercent)
+		opts = append(opts, nntp.WithChaos(cfg.Chaos))
+	}
+	if cfg.CheckMode == processor.CheckModeHeaders.String() || cfg.CheckMode == processor.CheckModeHead.String() || cfg.Scanner.HeaderSamples > 0 || headerSamples > 0 {
+		opts = append(opts, nntp.WithHeaders())
+	}
+
+	if cfg.CredentialReload > 0 && configFile != "" {
+		creds := nntp.NewCredentials()
+		for _, p := range cfg.PoolProviders() {
+			creds.Set(p.Host, p.Port, p.Username, p.Password)
+		}
+		opts = append(opts, nntp.WithCredentials(creds))
+
+		go watchCredentials(context.Background(), configFile, cfg.CredentialReload, creds)
+	}
+
+	if endpoints := cfg.Endpoints(); len(endpoints) > 0 || len(opts) > 0 {
+		poolConfig.NntpCli = nntp.NewDialer(endpoints, opts...)
+	}
+
+	return nntppool.NewConnectionPool(poolConfig)
+}
+
+// newReplayPool creates the connection pool of a replayed session. Providers
+// are never dialed, every segment is answered from the recording.
+func newReplayPool(cfg config.Config) (nntppool.UsenetConnectionPool, error) {
+	return nntppool.NewConnectionPool(nntppool.Config{
+		Providers:                           cfg.PoolProviders(),
+		SkipProvidersVerificationOnCreation: true,
+	})
+}
+
+// scannerCheckOptions returns the check options configured for scan and audit runs
+func scannerCheckOptions(cfg config.Config) processor.CheckOptions {
+	return processor.CheckOptions{
+		CheckPercent:    cfg.Scanner.CheckPercent,
+		MissingPercent:  cfg.Scanner.MissingPercent,
+		Sampling:        processor.SamplingStrategy(cfg.Scanner.SamplingStrategy),
+		Timeout:         cfg.Scanner.CheckTimeout,
+		IncludeSamples:  cfg.Scanner.IncludeSamples,
+		MinPar2Percent:  cfg.Scanner.MinPar2Percent,
+		HeaderSamples:   cfg.Scanner.HeaderSamples,
+		EncryptionProbe: cfg.Scanner.EncryptionProbe,
+		ErrorClasses:    errorClasses(cfg),
+		Confirmations: processor.Confirmations{
+			Attempts: cfg.Scanner.Confirmations.Attempts,
+			Window:   cfg.Scanner.Confirmations.Window,
+		},
+	}
+}
+
+// errorClasses returns the error class policies of the configuration
+func errorClasses(cfg config.Config) map[processor.ErrorClass]processor.ClassPolicy {
+	if len(cfg.Scanner.ErrorClasses) == 0 {
+		return nil
+	}
+
+	policies := make(map[processor.ErrorClass]processor.ClassPolicy, len(cfg.Scanner.ErrorClasses))
+	for class, policy := range cfg.Scanner.ErrorClasses {
+		policies[processor.ErrorClass(class)] = processor.ClassPolicy{
+			Threshold: policy.Threshold,
+			Action:    processor.ClassAction(policy.Action),
+		}
+	}
+
+	return policies
+}
+
+// retentionPolicy returns the retention alert settings of the configuration
+func retentionPolicy(cfg config.Config) processor.RetentionPolicy {
+	return processor.RetentionPolicy{
+		Retention: cfg.ShortestRetention(),
+		Warning:   time.Duration(cfg.RetentionWarningDays) * 24 * time.Hour,
+	}
+}
+
+// processorOptions returns the processor options shared by every command
+func processorOptions(cfg config.Config) ([]processor.Option, error) {
+	checkMode, err := processor.ParseCheckMode(cfg.CheckMode)
+	if err != nil {
+		return nil, err
+	}
+
+	routing, err := processor.ParseRoutingStrategy(cfg.ProviderRouting)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSpeed, err := processor.ParseSpeed(cfg.MaxSpeed)
+	if err != nil {
+		return nil, fmt.Errorf("max_speed: %w", err)
+	}
+
+	speeds, err := providerSpeeds(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger, err := openUsageLedger(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return []processor.Option{
+		processor.WithConcurrency(cfg.DownloadWorkers),
+		processor.WithCheckMode(checkMode),
+		processor.WithPartialReadSize(cfg.PartialReadBytes),
+		processor.WithRoutingStrategy(routing),
+		processor.WithProviderWeights(cfg.ProviderWeights()),
+		processor.WithConnectionHealthChecks(cfg.ProviderHealthChecks()),
+		processor.WithProviderGroups(cfg.ProviderGroups()),
+		processor.WithProviderSchedules(cfg.ProviderSchedules()),
+		processor.WithProviderAccounts(cfg.ProviderAccounts()),
+		processor.WithProviderTiers(cfg.ProviderTiers()),
+		processor.WithStatBatchSize(cfg.StatBatchSize),
+		processor.WithHeaderCheck(processor.HeaderCheck{
+			MaxGroups:   cfg.HeaderCheck.MaxGroups,
+			MaxArticles: cfg.HeaderCheck.MaxArticles,
+			DateSlack:   cfg.HeaderCheck.DateSlack,
+		}),
+		processor.WithProviderRateLimits(cfg.ProviderRateLimits()),
+		processor.WithMaxSpeed(maxSpeed),
+		processor.WithProviderSpeeds(speeds),
+		processor.WithProviderRetries(providerRetries(cfg)),
+		processor.WithUsageLedger(ledger),
+	}, nil
+}
+
+// openUsageLedger opens the provider usage ledger, nil when no block account
+// or cost is declared and usage accounting is off
+func openUsageLedger(cfg config.Config) (*usage.Ledger, error) {
+	accounts := cfg.BlockAccounts()
+	if len(accounts) == 0 && len(cfg.ProviderCosts()) == 0 && !cfg.UsageAccounting {
+		return nil, nil
+	}
+
+	return usage.Open(cfg.UsageFile, accounts)
+}
+
+// providerRetries returns the retry settings of every provider configuring them keyed by provider ID
+func providerRetries(cfg config.Config) map[string]processor.ProviderRetry {
+	retries := make(map[string]processor.ProviderRetry)
+	for _, p := range cfg.DownloadProviders {
+		if p.Retries > 0 || p.SkipOnErrors {
+			retries[p.ID()] = processor.ProviderRetry{
+				Retries:      p.Retries,
+				RetryDelay:   p.RetryDelay,
+				SkipOnErrors: p.SkipOnErrors,
+			}
+		}
+	}
+
+	return retries
+}
+
+// providerSpeeds returns the download speed cap in bytes per second of every
+// capped provider keyed by provider ID
+func providerSpeeds(cfg config.Config) (map[string]int64, error) {
+	speeds := make(map[string]int64)
+	for _, p := range cfg.DownloadProviders {
+		speed, err := processor.ParseSpeed(p.MaxSpeed)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: max_speed: %w", p.Host, err)
+		}
+
+		if speed > 0 {
+			speeds[p.ID()] = speed
+		}
+	}
+
+	return speeds, nil
+}
@@ -0,0 +1,297 @@
+package nzbtouch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/javi11/nzb-touch/internal/importer"
+	"github.com/javi11/nzb-touch/internal/processor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	queueDatabase string
+	queueFormat   string
+	queueOutput   string
+	queueLogLimit int
+	queueLogJSON  bool
+
+	importFormat  string
+	importMapping string
+	importDirs    []string
+)
+
+// sqliteHeader starts every SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Manage the scanner queue database",
+}
+
+var queueExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the queue and its check history to a portable dump",
+	Long: `Export every queue item with its check history to a JSON document or a compacted
+SQLite copy, e.g. to migrate to another host or rebuild a container.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		queue := openQueue()
+		defer func() {
+			_ = queue.Close()
+		}()
+
+		switch queueFormat {
+		case "json":
+			out := io.Writer(os.Stdout)
+			if queueOutput != "" {
+				f, err := os.Create(queueOutput)
+				if err != nil {
+					slog.Error("Failed to create export file", "error", err)
+					os.Exit(1)
+				}
+				defer func() {
+					_ = f.Close()
+				}()
+				out = f
+			}
+
+			count, err := queue.ExportJSON(out)
+			if err != nil {
+				slog.Error("Failed to export queue", "error", err)
+				os.Exit(1)
+			}
+			slog.Info("Queue exported", "items", count, "format", queueFormat)
+		case "sqlite":
+			if queueOutput == "" {
+				slog.Error("An output file is required for sqlite exports")
+				os.Exit(1)
+			}
+
+			if err := queue.ExportSQLite(queueOutput); err != nil {
+				slog.Error("Failed to export queue", "error", err)
+				os.Exit(1)
+			}
+			slog.Info("Queue exported", "path", queueOutput, "format", queueFormat)
+		default:
+			slog.Error("Invalid export format, expected json or sqlite", "format", queueFormat)
+			os.Exit(1)
+		}
+	},
+}
+
+var queueImportCmd = &cobra.Command{
+	Use:   "import <dump>",
+	Short: "Import a queue dump created by queue export",
+	Long: `Import the items of a JSON or SQLite queue dump. Items already in the queue
+with the same path are replaced by the imported ones.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		queue := openQueue()
+		defer func() {
+			_ = queue.Close()
+		}()
+
+		count, err := importQueue(queue, args[0])
+		if err != nil {
+			slog.Error("Failed to import queue", "error", err)
+			os.Exit(1)
+		}
+
+		slog.Info("Queue imported", "items", count, "from", args[0])
+	},
+}
+
+var queueImportResultsCmd = &cobra.Command{
+	Use:   "import-results <report>",
+	Short: "Seed the queue with the results of another NZB checker",
+	Long: `Import the results of an external checker so a library already verified by
+another tool is not checked again from scratch. The NZBs are recorded as
+checked when the tool checked them and are checked again on the reprocess
+interval. NZBs already checked by nzb-touch keep their own history.
+
+Formats:
+  nzbget    JSON output of the NZBGet history API method
+  nzbcheck  nzbcheck text report, one "<path>: <verdict>" line per NZB
+  csv       CSV with a header row, columns picked with --map
+
+Reports naming NZBs by file name only are matched against the NZBs below the
+--dir directories, or scanner.watch_directories.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		mapping, err := importer.ParseMapping(importMapping)
+		if err != nil {
+			slog.Error("Invalid column mapping", "error", err)
+			os.Exit(1)
+		}
+
+		dirs := importDirs
+		if len(dirs) == 0 && configFile != "" {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				os.Exit(1)
+			}
+			dirs = cfg.Scanner.WatchDirectories
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			slog.Error("Failed to open report", "error", err)
+			os.Exit(1)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+
+		results, err := importer.Parse(importer.Format(importFormat), f, mapping)
+		if err != nil {
+			slog.Error("Failed to read report", "path", args[0], "error", err)
+			os.Exit(1)
+		}
+
+		queue := openQueue()
+		defer func() {
+			_ = queue.Close()
+		}()
+
+		located, unmatched := importer.Locate(results, dirs)
+		for _, result := range unmatched {
+			slog.Warn("No single NZB matches the result, skipping", "path", result.Path)
+		}
+
+		imported := 0
+		for _, result := range located {
+			if queue.ImportResult(result, importFormat) {
+				imported++
+			}
+		}
+
+		slog.Info("Results imported",
+			"imported", imported,
+			"already_checked", len(located)-imported,
+			"unmatched", len(unmatched))
+	},
+}
+
+var queueLogCmd = &cobra.Command{
+	Use:   "log [path]",
+	Short: "Show the operations nzb-touch performed on NZB files",
+	Long: `Show the file log: every NZB queued, checked, moved, deleted, written or
+followed to another path, with the paths before and after. With a path only
+the operations on that file, or moving a file to it, are shown.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		queue := openQueue()
+		defer func() {
+			_ = queue.Close()
+		}()
+
+		var path string
+		if len(args) > 0 {
+			path = args[0]
+		}
+
+		entries, err := queue.FileLog(path, queueLogLimit)
+		if err != nil {
+			slog.Error("Failed to read the file log", "error", err)
+			os.Exit(1)
+		}
+
+		if queueLogJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			for _, e := range entries {
+				if err := encoder.Encode(e); err != nil {
+					slog.Error("Failed to write the file log", "error", err)
+					os.Exit(1)
+				}
+			}
+			return
+		}
+
+		for _, e := range entries {
+			line := fmt.Sprintf("%s  %-8s %s", e.Time.Format(time.RFC3339), e.Operation, e.Path)
+			if e.Target != "" {
+				line += " -> " + e.Target
+			}
+			if e.Detail != "" {
+				line += " (" + e.Detail + ")"
+			}
+			fmt.Println(line)
+		}
+	},
+}
+
+// openQueue opens the queue database selected by --db or the config file
+func openQueue() *processor.Queue {
+	dbPath := queueDatabase
+	if dbPath == "" {
+		if configFile == "" {
+			slog.Error("Either --db or --config is required")
+			os.Exit(1)
+		}
+
+		cfg, err := config.NewFromFile(configFile)
+		if err != nil {
+			slog.Error("Failed to load config", "error", err)
+			os.Exit(1)
+		}
+		dbPath = cfg.Scanner.DatabasePath
+	}
+
+	queue, err := processor.NewQueue(dbPath)
+	if err != nil {
+		slog.Error("Failed to open queue database", "path", dbPath, "error", err)
+		os.Exit(1)
+	}
+
+	return queue
+}
+
+// importQueue restores a dump into the queue, detecting its format from its content
+func importQueue(queue *processor.Queue, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	r := bufio.NewReader(f)
+	header, err := r.Peek(len(sqliteHeader))
+	if err == nil && bytes.Equal(header, sqliteHeader) {
+		return queue.ImportSQLite(path)
+	}
+
+	count, err := queue.ImportJSON(r)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return count, nil
+}
+
+func init() {
+	queueCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "Path to YAML config file, the queue database is scanner.database_path")
+	queueCmd.PersistentFlags().StringVar(&queueDatabase, "db", "", "Path to the queue database (overrides the config file)")
+
+	queueExportCmd.Flags().StringVar(&queueFormat, "format", "json", "Dump format (json or sqlite)")
+	queueExportCmd.Flags().StringVarP(&queueOutput, "output", "o", "", "Write the dump to this file (default: stdout, required for sqlite)")
+
+	queueImportResultsCmd.Flags().StringVar(&importFormat, "format", string(importer.FormatCSV), "Report format (nzbget, nzbcheck or csv)")
+	queueImportResultsCmd.Flags().StringVar(&importMapping, "map", "", "CSV columns as field=column pairs, e.g. path=File,status=Result (fields: path, status, health, checked)")
+	queueImportResultsCmd.Flags().StringSliceVarP(&importDirs, "dir", "d", nil, "Library directory to match file names in, may be repeated (default: scanner watch_directories)")
+
+	queueLogCmd.Flags().IntVarP(&queueLogLimit, "limit", "n", 100, "Show the latest operations only (0 for all)")
+	queueLogCmd.Flags().BoolVar(&queueLogJSON, "json", false, "Print one JSON object per operation")
+
+	queueCmd.AddCommand(queueExportCmd, queueImportCmd, queueImportResultsCmd, queueLogCmd)
+	rootCmd.AddCommand(queueCmd)
+}
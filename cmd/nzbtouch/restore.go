@@ -0,0 +1,111 @@
+package nzbtouch
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/processor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreAll   bool
+	restoreSince time.Duration
+	restoreList  bool
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [name]",
+	Short: "Restore NZBs deleted into the trash or moved out of the watch directories",
+	Long: `Move NZBs deleted by a rule into scanner.trash_directory, or moved to a failed
+directory or by a move rule while the trash was enabled, back to their original
+path. name is an original path, a file name or a glob matched against the file
+name, e.g. "*.S01E*". Without a name and --all the trash is listed.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 && !restoreAll {
+			restoreList = true
+		}
+
+		var name string
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		queue := openQueue()
+		defer func() {
+			_ = queue.Close()
+		}()
+
+		entries, err := queue.Trash(name)
+		if err != nil {
+			slog.Error("Failed to read the trash", "error", err)
+			os.Exit(1)
+		}
+
+		if restoreSince > 0 {
+			cutoff := time.Now().Add(-restoreSince)
+			recent := entries[:0]
+			for _, e := range entries {
+				if e.Time.After(cutoff) {
+					recent = append(recent, e)
+				}
+			}
+			entries = recent
+		}
+
+		if restoreList {
+			for _, e := range entries {
+				fmt.Printf("%s  %-7s %s -> %s (%s)\n", e.Time.Format(time.RFC3339), e.Operation, e.Original, e.Location, e.Reason)
+			}
+			return
+		}
+
+		if len(entries) == 0 {
+			slog.Error("Nothing to restore", "name", name)
+			os.Exit(1)
+		}
+
+		restored, failed := restoreEntries(queue, entries)
+		slog.Info("Restore completed", "restored", restored, "failed", failed)
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// restoreEntries restores the entries, newest first, so an NZB trashed
+// several times comes back from its latest location
+func restoreEntries(queue *processor.Queue, entries []processor.TrashEntry) (int, int) {
+	restored, failed := 0, 0
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if seen[e.Original] {
+			continue
+		}
+		seen[e.Original] = true
+
+		if err := queue.RestoreTrash(e); err != nil {
+			slog.Error("Failed to restore NZB", "path", e.Original, "from", e.Location, "error", err)
+			failed++
+			continue
+		}
+
+		slog.Info("Restored NZB", "path", e.Original, "from", e.Location)
+		restored++
+	}
+
+	return restored, failed
+}
+
+func init() {
+	restoreCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to YAML config file, the queue database is scanner.database_path")
+	restoreCmd.Flags().StringVar(&queueDatabase, "db", "", "Path to the queue database (overrides the config file)")
+	restoreCmd.Flags().BoolVar(&restoreAll, "all", false, "Restore every NZB in the trash")
+	restoreCmd.Flags().DurationVar(&restoreSince, "since", 0, "Only NZBs trashed or moved within this long, e.g. 2h")
+	restoreCmd.Flags().BoolVar(&restoreList, "list", false, "List the matching NZBs without restoring them")
+
+	rootCmd.AddCommand(restoreCmd)
+}
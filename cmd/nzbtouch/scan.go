@@ -8,16 +8,33 @@ import (
 	"syscall"
 
 	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nzb-touch/internal/api"
+	"github.com/javi11/nzb-touch/internal/category"
 	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/feed"
+	"github.com/javi11/nzb-touch/internal/handoff"
+	"github.com/javi11/nzb-touch/internal/hook"
+	"github.com/javi11/nzb-touch/internal/plugin"
 	"github.com/javi11/nzb-touch/internal/processor"
+	"github.com/javi11/nzb-touch/internal/reupload"
+	"github.com/javi11/nzb-touch/internal/rules"
 	"github.com/spf13/cobra"
 )
 
+var simulateMissing float64
+
 var scanCmd = &cobra.Command{
-	Use:   "scan",
+	Use:   "scan [--simulate percent nzb...]",
 	Short: "Scan directories for NZB files to process",
 	Long: `Continuously scan directories for NZB files and process them.
-The scanner will run at the configured interval and respect daily limits.`,
+The scanner will run at the configured interval and respect daily limits.
+
+With --simulate the given NZBs are checked once against the built-in mock
+server, with that percentage of articles missing, to rehearse the thresholds,
+rules, notifications and failed directories of the configuration. The NZBs
+are copied to a sandbox standing in for the watch, failed and rule
+directories, so no file is moved; hooks, plugins and notify rules run for real.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if configFile == "" {
 			slog.Error("Error: Config file is required")
@@ -32,23 +49,109 @@ The scanner will run at the configured interval and respect daily limits.`,
 			os.Exit(1)
 		}
 
+		if err := plugin.Validate(cfg.Plugins); err != nil {
+			slog.Error("Invalid plugin configuration", "error", err)
+			os.Exit(1)
+		}
+
+		if err := rules.Validate(cfg.Rules); err != nil {
+			slog.Error("Invalid rules configuration", "error", err)
+			os.Exit(1)
+		}
+
+		if err := handoff.Validate(cfg.SuccessActions); err != nil {
+			slog.Error("Invalid success_actions configuration", "error", err)
+			os.Exit(1)
+		}
+
+		if err := reupload.Validate(cfg.Reupload); err != nil {
+			slog.Error("Invalid reupload configuration", "error", err)
+			os.Exit(1)
+		}
+
+		if err := feed.Validate(cfg.RSS); err != nil {
+			slog.Error("Invalid rss configuration", "error", err)
+			os.Exit(1)
+		}
+
 		// Check if scanner is enabled in config
 		if !cfg.Scanner.Enabled {
 			slog.Error("Scanner is not enabled in config")
 			os.Exit(1)
 		}
 
-		// Check if watch directories are configured
-		if len(cfg.Scanner.WatchDirectories) == 0 {
-			slog.Error("No watch directories configured")
+		role, err := processor.ParseRole(cfg.Scanner.Role)
+		if err != nil {
+			slog.Error("Invalid scanner configuration", "error", err)
+			os.Exit(1)
+		}
+
+		switch role {
+		case processor.RoleChecker:
+			// Checker nodes only need their providers and the scanner node
+			if cfg.Scanner.ScannerNode == "" {
+				slog.Error("scanner.scanner_node is required by checker nodes")
+				os.Exit(1)
+			}
+		case processor.RoleScanner:
+			if hasAuditSchedule(cfg.Schedules) {
+				slog.Error("Scheduled audits need NNTP providers, scanner nodes do not run them")
+				os.Exit(1)
+			}
+			if cfg.API.Listen == "" {
+				slog.Error("api.listen is required by scanner nodes, checker nodes pull their jobs from the API")
+				os.Exit(1)
+			}
+			fallthrough
+		default:
+			// Check if watch directories or feeds are configured
+			if len(cfg.Scanner.WatchDirectories) == 0 && len(cfg.RSS.Feeds) == 0 && len(cfg.RSS.Newznab) == 0 {
+				slog.Error("No watch directories or rss feeds configured")
+				os.Exit(1)
+			}
+
+			if err := cfg.ValidateScanner(); err != nil {
+				slog.Error("Invalid scanner directories", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		// Rehearse the configuration on the given NZBs against the mock server
+		var sim *simulation
+		if cmd.Flags().Changed("simulate") {
+			sim, cfg, err = newSimulation(cfg, simulateMissing, args)
+			if err != nil {
+				slog.Error("Failed to start the simulation", "error", err)
+				os.Exit(1)
+			}
+			defer sim.Close()
+		} else if len(args) > 0 {
+			slog.Error("NZB arguments are only accepted with --simulate")
+			os.Exit(1)
+		}
+
+		// The simulation checks its NZBs against the mock server
+		if sim != nil {
+			role = processor.RoleAll
+		}
+
+		// Validate check options
+		checkOptions := scannerCheckOptions(cfg)
+		if err := checkOptions.Validate(); err != nil {
+			slog.Error("Invalid check options", "error", err)
 			os.Exit(1)
 		}
 
-		// Validate check percent
-		if cfg.Scanner.CheckPercent <= 0 || cfg.Scanner.CheckPercent > 100 {
-			slog.Error("Error: checkpercent must be between 1 and 100")
+		if err := category.Validate(cfg.Categories); err != nil {
+			slog.Error("Invalid categories configuration", "error", err)
 			os.Exit(1)
 		}
+		for _, c := range cfg.Categories {
+			if err := processor.CategoryCheckOptions(checkOptions, &c).Validate(); err != nil {
+				slog.Error("Invalid category check options", "category", c.Name, "error", err)
+				os.Exit(1)
+			}
+		}
 
 		// Parse scan interval
 		scanInterval, err := cfg.GetScanInterval()
@@ -64,18 +167,113 @@ The scanner will run at the configured interval and respect daily limits.`,
 			os.Exit(1)
 		}
 
-		// Create NNTP connection pool
-		pool, err := nntppool.NewConnectionPool(
-			nntppool.Config{Providers: cfg.DownloadProviders},
-		)
+		// Create NNTP connection pool, scanner nodes leave the checks to checker nodes
+		var pool nntppool.UsenetConnectionPool
+		if role != processor.RoleScanner {
+			pool, err = newConnectionPool(cfg)
+			if err != nil {
+				slog.Error("Error creating connection pool", "error", err)
+				os.Exit(1)
+			}
+			defer pool.Quit()
+		}
+
+		// Keep per-segment results on disk for large audits
+		procOpts, err := processorOptions(cfg)
 		if err != nil {
-			slog.Error("Error creating connection pool", "error", err)
+			slog.Error("Invalid processor configuration", "error", err)
 			os.Exit(1)
 		}
-		defer pool.Quit()
+
+		// Alert on providers that keep failing
+		procOpts = append(procOpts, processor.WithProviderAlerts(processor.ProviderAlertPolicy{
+			ErrorRate: cfg.ProviderAlerts.ErrorRate,
+			Window:    cfg.ProviderAlerts.Window,
+		}))
+
+		// Make way for other work on the host and its network
+		procOpts = append(procOpts, processor.WithLoadThrottle(processor.LoadThrottle{
+			CPUPercent:  cfg.Throttle.CPUPercent,
+			Interface:   cfg.Throttle.Interface,
+			NetworkMbps: cfg.Throttle.NetworkMbps,
+			MinWorkers:  cfg.Throttle.MinWorkers,
+			Interval:    cfg.Throttle.Interval,
+		}))
+
+		// Reports include the requests sent to every provider
+		if cfg.Scanner.Reports || cfg.Scanner.ReportDirectory != "" {
+			procOpts = append(procOpts, processor.WithProviderResults())
+		}
 
 		// Create processor
-		proc := processor.New(pool, 0, cfg.DownloadWorkers)
+		proc := processor.New(pool, procOpts...)
+
+		if role == processor.RoleChecker {
+			runCheckerNode(cfg, proc)
+			return
+		}
+
+		// Log provider and quota notifications published by the scanner
+		bus := events.NewBus()
+		bus.Subscribe(func(ctx context.Context, e events.Event) {
+			slog.WarnContext(ctx, "Scanner event", "type", e.Type, "provider", e.Provider, "state", e.State)
+		}, events.ProviderDegraded, events.ProviderRecovered, events.QuotaReached, events.BandwidthExhausted)
+
+		scannerOpts := []processor.ScannerOption{
+			processor.WithPlugins(plugin.NewManager(cfg.Plugins)),
+			processor.WithHooks(hook.NewRunner(cfg.Hooks)),
+			processor.WithRules(cfg.Rules),
+			processor.WithSuccessActions(cfg.SuccessActions),
+			processor.WithEventBus(bus),
+			processor.WithMinWorkers(cfg.Scanner.MinConcurrentJobs),
+			processor.WithRetentionPolicy(retentionPolicy(cfg)),
+			processor.WithTakedownDrop(cfg.Scanner.TakedownDrop),
+			processor.WithReuploader(reupload.New(cfg.Reupload)),
+			processor.WithArchiveDirectory(cfg.Scanner.ArchiveDirectory),
+			processor.WithTrash(cfg.Scanner.TrashDirectory, cfg.Scanner.TrashRetention),
+			processor.WithPasswordTagging(cfg.Scanner.TagPasswords),
+			processor.WithTouch(cfg.Scanner.TouchVerified, cfg.Scanner.VerifiedXattr),
+			processor.WithVerifiedView(cfg.Scanner.VerifiedView),
+			processor.WithReports(cfg.Scanner.Reports, cfg.Scanner.ReportDirectory),
+			processor.WithDuplicateDetection(cfg.Scanner.SkipDuplicates),
+			processor.WithMinPostAge(cfg.Scanner.MinPostAge),
+			processor.WithOutageRetryInterval(cfg.Scanner.OutageRetry),
+			processor.WithCategories(cfg.Categories),
+			processor.WithScanSchedules(cfg.ScanSchedules()),
+			processor.WithRole(role),
+		}
+		collision, err := processor.ParseCollisionPolicy(cfg.Scanner.MoveCollision)
+		if err != nil {
+			slog.Error("Invalid scanner configuration", "error", err)
+			os.Exit(1)
+		}
+		scannerOpts = append(scannerOpts, processor.WithCollisionPolicy(collision))
+		bandwidthLimit, err := processor.ParseBandwidthLimit(cfg.Scanner.BandwidthLimit)
+		if err != nil {
+			slog.Error("Invalid scanner configuration", "error", err)
+			os.Exit(1)
+		}
+		scannerOpts = append(scannerOpts, processor.WithBandwidthLimit(bandwidthLimit))
+
+		// NZBs uploaded over the socket or the API are saved in the submit directory
+		submitDir := cfg.Scanner.IPCDirectory
+		if submitDir == "" && len(cfg.Scanner.WatchDirectories) > 0 {
+			submitDir = cfg.Scanner.WatchDirectories[0]
+		}
+		scannerOpts = append(scannerOpts, processor.WithSubmitDirectory(submitDir))
+		if cfg.Scanner.IPCSocket != "" {
+			if submitDir == "" {
+				slog.Error("scanner.ipc_directory is required when no watch directory is configured")
+				os.Exit(1)
+			}
+			scannerOpts = append(scannerOpts, processor.WithIPCListener(cfg.Scanner.IPCSocket))
+		}
+		if w := feed.New(cfg.RSS); w != nil {
+			scannerOpts = append(scannerOpts, processor.WithFeedWatcher(w))
+		}
+		if cfg.Scanner.UsenetDrive {
+			scannerOpts = append(scannerOpts, processor.WithUsenetDrive(cfg.Scanner.CompanionExtensions))
+		}
 
 		// Create directory scanner
 		scanner, err := processor.NewDirectoryScanner(
@@ -87,8 +285,8 @@ The scanner will run at the configured interval and respect daily limits.`,
 			cfg.Scanner.DatabasePath,
 			reprocessInterval,
 			cfg.Scanner.FailedDirectory,
-			cfg.Scanner.CheckPercent,
-			cfg.Scanner.MissingPercent,
+			checkOptions,
+			scannerOpts...,
 		)
 		if err != nil {
 			slog.Error("Failed to create directory scanner", "error", err)
@@ -108,9 +306,54 @@ The scanner will run at the configured interval and respect daily limits.`,
 			cancel()
 		}()
 
+		// Scan right away on request, e.g. after bulk-importing a library
+		if len(rescanSignals) > 0 {
+			rescan := make(chan os.Signal, 1)
+			signal.Notify(rescan, rescanSignals...)
+			go func() {
+				for range rescan {
+					scanner.TriggerScan()
+				}
+			}()
+		}
+
+		// Toggle pause on request, e.g. during peak hours
+		if len(pauseSignals) > 0 {
+			pause := make(chan os.Signal, 1)
+			signal.Notify(pause, pauseSignals...)
+			go func() {
+				for range pause {
+					if !scanner.Pause() {
+						scanner.Resume()
+					}
+				}
+			}()
+		}
+
+		publishProgress(scanner.Progress)
+
+		if cfg.API.Listen != "" {
+			go func() {
+				if err := api.New(cfg.API, scanner, api.WithSettings(config.NewSettingsFile(configFile))).Run(ctx); err != nil {
+					slog.Error("API server stopped", "error", err)
+				}
+			}()
+		}
+
+		if sim != nil {
+			if err := sim.Run(ctx, scanner, os.Stdout); err != nil {
+				slog.Error("Simulation failed", "error", err)
+			}
+			return
+		}
+
+		// Audits and digests run alongside the scanner
+		runSchedules(ctx, cfg, proc, scanner)
+
 		// Start scanner and wait for it to complete
 		slog.Info("Starting scanner...",
 			"interval", scanInterval,
+			"schedules", len(cfg.Schedules),
 			"max_files_per_day", cfg.Scanner.MaxFilesPerDay,
 			"watch_dirs", cfg.Scanner.WatchDirectories,
 			"reprocess_interval", reprocessInterval,
@@ -126,8 +369,9 @@ The scanner will run at the configured interval and respect daily limits.`,
 }
 
 func init() {
-	scanCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to YAML config file (required)")
-	_ = scanCmd.MarkFlagRequired("config")
+	scanCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "Path to YAML config file (required)")
+	_ = scanCmd.MarkPersistentFlagRequired("config")
+	scanCmd.Flags().Float64Var(&simulateMissing, "simulate", 0, "Check the NZBs given as arguments once against the mock server with this percentage of articles missing, without touching any file")
 
 	rootCmd.AddCommand(scanCmd)
 }
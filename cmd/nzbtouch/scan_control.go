@@ -0,0 +1,138 @@
+package nzbtouch
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/api"
+	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var scanPauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause a running scanner",
+	Long: `Stop a running scanner from starting new checks through its API. Checks already
+running finish and new NZBs keep being discovered and queued.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		controlScanner((*api.Client).Pause)
+	},
+}
+
+var scanResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume a paused scanner",
+	Run: func(cmd *cobra.Command, args []string) {
+		controlScanner((*api.Client).Resume)
+	},
+}
+
+var scanStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether a running scanner is paused",
+	Run: func(cmd *cobra.Command, args []string) {
+		controlScanner((*api.Client).Status)
+	},
+}
+
+var submitUpload bool
+
+var scanSubmitCmd = &cobra.Command{
+	Use:   "submit <nzb>...",
+	Short: "Queue NZBs on a running scanner ahead of its backlog",
+	Long: `Queue NZBs on a running scanner through its API. Submitted NZBs are checked
+before the NZBs discovered by the scanner. Paths are sent as absolute paths the
+scanner must be able to read, with --upload the NZBs are sent instead and saved
+in scanner.ipc_directory.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := scannerClient()
+		failed := false
+		for _, arg := range args {
+			sub, err := submitNZB(client, arg)
+			if err != nil {
+				slog.Error("Failed to submit NZB", "path", arg, "error", err)
+				failed = true
+				continue
+			}
+
+			slog.Info("NZB queued", "path", sub.Path)
+		}
+
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// submitNZB sends the path or, with --upload, the content of an NZB to the scanner
+func submitNZB(client *api.Client, path string) (api.Submission, error) {
+	if !submitUpload {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return api.Submission{}, err
+		}
+
+		return client.Submit(context.Background(), abs)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return api.Submission{}, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return client.Upload(context.Background(), filepath.Base(path), f)
+}
+
+// scannerClient returns a client for the API of the scanner running with the config file
+func scannerClient() *api.Client {
+	cfg, err := config.NewFromFile(configFile)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	if cfg.API.Listen == "" {
+		slog.Error("api.listen must be set to control a running scanner")
+		os.Exit(1)
+	}
+
+	client, err := api.NewClient(cfg.API)
+	if err != nil {
+		slog.Error("Invalid API configuration", "error", err)
+		os.Exit(1)
+	}
+
+	return client
+}
+
+// controlScanner calls the API of the scanner running with the config file
+func controlScanner(call func(*api.Client, context.Context) (api.Status, error)) {
+	status, err := call(scannerClient(), context.Background())
+	if err != nil {
+		slog.Error("Failed to reach the scanner", "error", err)
+		os.Exit(1)
+	}
+
+	if p := status.Progress; p != nil && p.Total > 0 {
+		slog.Info("Scanner status", "paused", status.Paused,
+			"backlog_done", p.Done, "backlog_total", p.Total, "percent", int(p.Percent),
+			"average_check", time.Duration(p.AverageCheckSeconds*float64(time.Second)).Round(time.Second),
+			"eta", p.ETA.Format(time.RFC3339))
+		return
+	}
+
+	slog.Info("Scanner status", "paused", status.Paused)
+}
+
+func init() {
+	scanSubmitCmd.Flags().BoolVar(&submitUpload, "upload", false, "Send the NZBs themselves instead of their paths, for scanners on another host")
+
+	scanCmd.AddCommand(scanPauseCmd, scanResumeCmd, scanStatusCmd, scanSubmitCmd)
+}
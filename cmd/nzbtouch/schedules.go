@@ -0,0 +1,168 @@
+package nzbtouch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/audit"
+	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/javi11/nzb-touch/internal/processor"
+	"github.com/javi11/nzb-touch/internal/schedule"
+)
+
+// report is written by the scheduled audits and digests
+type report interface {
+	WriteText(w io.Writer) error
+	WriteJSON(w io.Writer) error
+}
+
+// hasAuditSchedule reports whether any schedule runs an audit
+func hasAuditSchedule(schedules []config.Schedule) bool {
+	for _, s := range schedules {
+		if s.Task == config.TaskAudit {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runSchedules runs the scheduled audits, digests and refreshes until ctx is
+// done, the scheduled scans are run by the scanner itself. A run missed while
+// the previous one of the same schedule was still going is skipped.
+func runSchedules(ctx context.Context, cfg config.Config, proc *processor.Processor, scanner *processor.DirectoryScanner) {
+	for _, s := range cfg.Schedules {
+		if s.Task == config.TaskScan {
+			continue
+		}
+
+		cron, err := schedule.ParseCron(s.Cron)
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			last := time.Now()
+			for {
+				next := cron.Next(time.Now())
+				if next.IsZero() {
+					return
+				}
+
+				slog.DebugContext(ctx, "Next scheduled run", "schedule", s.Name, "task", s.Task, "at", next)
+
+				timer := time.NewTimer(time.Until(next))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+
+				now := time.Now()
+				switch s.Task {
+				case config.TaskAudit:
+					runScheduledAudit(ctx, cfg, proc, s, now)
+				case config.TaskDigest:
+					runDigest(ctx, scanner, s, last, now)
+				case config.TaskRefresh:
+					scanner.RequestRefresh(ctx, s.BytesPerSecond)
+				}
+				last = now
+			}
+		}()
+	}
+}
+
+// runScheduledAudit audits the watch directories with the scanner check settings
+func runScheduledAudit(ctx context.Context, cfg config.Config, proc *processor.Processor, s config.Schedule, now time.Time) {
+	opts := scannerCheckOptions(cfg)
+	if s.CheckPercent > 0 {
+		opts.CheckPercent = s.CheckPercent
+	}
+
+	slog.InfoContext(ctx, "Starting scheduled audit", "schedule", s.Name, "check_percent", opts.CheckPercent)
+
+	auditCtx, stopProgress := context.WithCancel(ctx)
+	tracker := startAuditProgress(auditCtx, cfg.Scanner.WatchDirectories)
+	r := audit.NewReport(auditDepthDefault)
+	auditLibrary(ctx, proc, r, cfg.Scanner.WatchDirectories, cfg.Scanner.ConcurrentJobs, opts, nil, tracker)
+	stopProgress()
+	r.Finish(ctx.Err() != nil)
+
+	slog.InfoContext(ctx, "Scheduled audit completed",
+		"schedule", s.Name,
+		"nzbs", r.Overall.NZBs,
+		"at_risk", r.Overall.AtRisk,
+		"completion", r.Overall.Completion,
+		"duration", r.Duration)
+
+	writeScheduledReport(ctx, s, now, r)
+}
+
+// runDigest summarizes the checks since the previous digest
+func runDigest(ctx context.Context, scanner *processor.DirectoryScanner, s config.Schedule, from, to time.Time) {
+	d, err := scanner.Digest(from, to)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to build the digest", "schedule", s.Name, "error", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "NZB digest",
+		"schedule", s.Name,
+		"from", from,
+		"checked", d.Checked,
+		"failed", d.Failed,
+		"degraded", d.Degraded,
+		"average_health", fmt.Sprintf("%.1f%%", d.AverageHealth),
+		"pending", d.Pending)
+
+	writeScheduledReport(ctx, s, to, d)
+}
+
+// writeScheduledReport writes a report to the output directory of the
+// schedule, named after the schedule and the time of the run
+func writeScheduledReport(ctx context.Context, s config.Schedule, at time.Time, r report) {
+	if s.Output == "" {
+		return
+	}
+
+	ext := "json"
+	if s.Format == "text" {
+		ext = "txt"
+	}
+	path := filepath.Join(s.Output, fmt.Sprintf("%s-%s.%s", s.Name, at.Format("20060102-1504"), ext))
+
+	err := func() error {
+		if err := os.MkdirAll(s.Output, 0o755); err != nil {
+			return err
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+
+		if s.Format == "text" {
+			err = r.WriteText(f)
+		} else {
+			err = r.WriteJSON(f)
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+
+		return err
+	}()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to write the scheduled report", "schedule", s.Name, "path", path, "error", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Scheduled report written", "schedule", s.Name, "path", path)
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package nzbtouch
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	// rescanSignals trigger an immediate directory scan in scan mode
+	rescanSignals = []os.Signal{syscall.SIGUSR1}
+	// pauseSignals pause the scanner in scan mode, or resume it when paused
+	pauseSignals = []os.Signal{syscall.SIGUSR2}
+)
@@ -0,0 +1,13 @@
+//go:build windows
+
+package nzbtouch
+
+import "os"
+
+// Windows has no user signals, scans can only be triggered and paused through the API
+var (
+	// rescanSignals trigger an immediate directory scan in scan mode
+	rescanSignals []os.Signal
+	// pauseSignals pause the scanner in scan mode, or resume it when paused
+	pauseSignals []os.Signal
+)
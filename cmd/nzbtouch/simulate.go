@@ -0,0 +1,244 @@
+package nzbtouch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javi11/nzb-touch/internal/api"
+	"github.com/javi11/nzb-touch/internal/category"
+	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/feed"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+	"github.com/javi11/nzb-touch/internal/handoff"
+	"github.com/javi11/nzb-touch/internal/mockserver"
+	"github.com/javi11/nzb-touch/internal/processor"
+	"github.com/javi11/nzb-touch/internal/reupload"
+	"github.com/javi11/nzb-touch/internal/rules"
+)
+
+// simulationArticleSize keeps the articles of the mock server small, the
+// simulation is about the outcome of the checks rather than their speed
+const simulationArticleSize = 64 << 10
+
+// simulation rehearses the scanner configuration on NZBs served by the mock
+// server, inside a sandbox standing in for the watch, failed and rule
+// directories so no file of the library is touched
+type simulation struct {
+	dir     string
+	stop    context.CancelFunc
+	nzbs    []simulatedNZB
+	targets map[string]string // Sandbox directories files may be moved to, and the configured directory each stands for
+}
+
+// simulatedNZB is an NZB copied into the sandbox
+type simulatedNZB struct {
+	source  string
+	path    string
+	watched string // Path relative to its watch directory
+}
+
+// newSimulation starts the mock server with the given missing percentage and
+// returns the simulation and the configuration rewired to it and the sandbox.
+// Hooks, plugins and notify rules are kept, they are what is being verified.
+func newSimulation(cfg config.Config, missing float64, nzbs []string) (*simulation, config.Config, error) {
+	if len(nzbs) == 0 {
+		return nil, cfg, errors.New("--simulate requires the NZBs to check as arguments")
+	}
+
+	if missing < 0 || missing > 100 {
+		return nil, cfg, fmt.Errorf("--simulate must be between 0 and 100, got %g", missing)
+	}
+
+	dir, err := os.MkdirTemp("", "nzbtouch-simulate-*")
+	if err != nil {
+		return nil, cfg, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, cfg, err
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	server := mockserver.New(mockserver.Config{MissingPercent: missing, ArticleSize: simulationArticleSize})
+	go func() {
+		_ = server.Serve(ctx, listener)
+	}()
+
+	sim := &simulation{dir: dir, stop: stop, targets: make(map[string]string)}
+
+	connections := max(cfg.DownloadWorkers, 1)
+	cfg.DownloadProviders = []config.Provider{{
+		Host:                           "127.0.0.1",
+		Port:                           listener.Addr().(*net.TCPAddr).Port,
+		MaxConnections:                 connections,
+		MaxConnectionIdleTimeInSeconds: 2400,
+	}}
+	cfg.DownloadWorkers = connections
+	cfg.UsageFile = filepath.Join(dir, "usage.json")
+
+	// Only the sandbox is written to, and nothing leaves the host but the notifications
+	s := &cfg.Scanner
+	s.DatabasePath = filepath.Join(dir, "queue.db")
+	s.ArchiveDirectory = ""
+	s.VerifiedView = ""
+	s.IPCSocket = ""
+	s.IPCDirectory = ""
+	s.MinPostAge = 0
+	s.Confirmations.Window = 0
+	s.MaxFilesPerDay = max(s.MaxFilesPerDay, len(nzbs))
+	cfg.Reupload = reupload.Config{}
+	cfg.RSS = feed.Config{}
+	cfg.API = api.Config{}
+
+	watch := s.WatchDirectories
+	s.WatchDirectories = []string{filepath.Join(dir, "watch", "0")}
+	for i := 1; i < len(watch); i++ {
+		s.WatchDirectories = append(s.WatchDirectories, filepath.Join(dir, "watch", fmt.Sprint(i)))
+	}
+
+	s.FailedDirectory = sim.target(s.FailedDirectory, "failed")
+	s.TrashDirectory = sim.target(s.TrashDirectory, "trash")
+	categories := cfg.Categories
+	cfg.Categories = make([]category.Category, len(categories))
+	for i, c := range categories {
+		c.FailedDirectory = sim.target(c.FailedDirectory, fmt.Sprintf("category-%d", i))
+		cfg.Categories[i] = c
+	}
+
+	ruleSet := cfg.Rules
+	cfg.Rules = make([]rules.Rule, len(ruleSet))
+	for i, r := range ruleSet {
+		r.Actions = append([]rules.Action(nil), r.Actions...)
+		for j, a := range r.Actions {
+			if a.Type == rules.ActionMove {
+				r.Actions[j].Target = sim.target(a.Target, fmt.Sprintf("rule-%d-%d", i, j))
+			}
+		}
+		cfg.Rules[i] = r
+	}
+
+	actions := cfg.SuccessActions
+	cfg.SuccessActions = make([]handoff.Action, len(actions))
+	for i, a := range actions {
+		// Copies are not where the NZB went, they are not reported
+		if a.Type == handoff.ActionCopy {
+			a.Target = filepath.Join(sim.dir, "copies", fmt.Sprint(i))
+		}
+		cfg.SuccessActions[i] = a
+	}
+
+	// NZBs keep their path below the watch directory holding them, categories depend on it
+	for _, source := range nzbs {
+		index, rel := watchedPath(watch, source)
+		nzb := simulatedNZB{source: source, path: filepath.Join(s.WatchDirectories[index], rel), watched: rel}
+		if err := os.MkdirAll(filepath.Dir(nzb.path), 0o755); err == nil {
+			err = fsutil.Copy(source, nzb.path)
+		}
+		if err != nil {
+			sim.Close()
+			return nil, cfg, fmt.Errorf("failed to copy %s to the sandbox: %w", source, err)
+		}
+		sim.nzbs = append(sim.nzbs, nzb)
+	}
+
+	return sim, cfg, nil
+}
+
+// target returns the sandbox directory standing for a configured one, empty when not configured
+func (sim *simulation) target(configured, name string) string {
+	if configured == "" {
+		return ""
+	}
+
+	dir := filepath.Join(sim.dir, "targets", name)
+	sim.targets[dir] = configured
+
+	return dir
+}
+
+// watchedPath returns the index of the watch directory holding path and the
+// path relative to it, or the first one and the file name
+func watchedPath(watch []string, path string) (int, string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return 0, filepath.Base(path)
+	}
+
+	for i, dir := range watch {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+
+		if rel, err := filepath.Rel(absDir, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			return i, rel
+		}
+	}
+
+	return 0, filepath.Base(path)
+}
+
+// Run checks every NZB and writes what happened to each of them
+func (sim *simulation) Run(ctx context.Context, scanner *processor.DirectoryScanner, out io.Writer) error {
+	results := make(map[string]*processor.Result)
+	unsubscribe := scanner.Events().Subscribe(func(_ context.Context, e events.Event) {
+		result, _ := e.Result.(*processor.Result)
+		results[e.Path] = result
+	}, events.CheckFinished)
+	defer unsubscribe()
+
+	slog.WarnContext(ctx, "Simulating checks against the mock server, hooks, plugins and notify rules run for real", "sandbox", sim.dir)
+
+	for _, nzb := range sim.nzbs {
+		checkErr := scanner.CheckFile(ctx, nzb.path)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		outcome := "passed"
+		if checkErr != nil {
+			outcome = "failed: " + checkErr.Error()
+		}
+
+		if result := results[nzb.path]; result != nil {
+			outcome += fmt.Sprintf(" (health %.1f%%, %d/%d segments failed)", result.Health(), result.FailedSegments, result.TotalSegments)
+		}
+
+		if _, err := fmt.Fprintf(out, "%s: %s\n  %s\n", nzb.source, outcome, sim.whereabouts(nzb)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// whereabouts tells where the NZB would be after the check
+func (sim *simulation) whereabouts(nzb simulatedNZB) string {
+	if _, err := os.Stat(nzb.path); err == nil {
+		return "left in place"
+	}
+
+	for dir, configured := range sim.targets {
+		if _, err := os.Stat(filepath.Join(dir, nzb.watched)); err == nil {
+			return "moved to " + filepath.Join(configured, nzb.watched)
+		}
+	}
+
+	return "deleted"
+}
+
+// Close stops the mock server and removes the sandbox
+func (sim *simulation) Close() {
+	sim.stop()
+	_ = os.RemoveAll(sim.dir)
+}
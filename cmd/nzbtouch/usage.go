@@ -0,0 +1,76 @@
+package nzbtouch
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/config"
+	"github.com/javi11/nzb-touch/internal/usage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	usageReport bool
+	usageMonths int
+	usageJSON   bool
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show the bytes downloaded from each provider and the block account balances",
+	Long: `Show the bytes downloaded from each provider and the block account balances.
+With --report, show month by month the requests sent to each provider, the
+articles it had, its share of the articles found, the GB downloaded and what
+it cost according to cost_per_gb and cost_per_month.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.NewFromFile(configFile)
+		if err != nil {
+			slog.Error("Failed to load config", "error", err)
+			os.Exit(1)
+		}
+
+		ledger, err := usage.Open(cfg.UsageFile, cfg.BlockAccounts())
+		if err != nil {
+			slog.Error("Failed to open usage file", "error", err)
+			os.Exit(1)
+		}
+
+		if !usageReport {
+			if err := usage.WriteText(os.Stdout, ledger.Snapshot()); err != nil {
+				slog.Error("Failed to write usage", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		if usageMonths < 1 {
+			slog.Error("--months must be at least 1")
+			os.Exit(1)
+		}
+
+		rows := usage.Report(ledger.Snapshot(), cfg.ProviderCosts(), usage.Months(time.Now(), usageMonths))
+		if usageJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(rows)
+		} else {
+			err = usage.WriteReport(os.Stdout, rows)
+		}
+		if err != nil {
+			slog.Error("Failed to write usage report", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	usageCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to YAML config file (required)")
+	usageCmd.Flags().BoolVar(&usageReport, "report", false, "Show the monthly cost and contribution report")
+	usageCmd.Flags().IntVar(&usageMonths, "months", 3, "Months covered by the report, the current one included")
+	usageCmd.Flags().BoolVar(&usageJSON, "json", false, "Write the report as JSON")
+	_ = usageCmd.MarkFlagRequired("config")
+
+	rootCmd.AddCommand(usageCmd)
+}
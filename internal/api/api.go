@@ -0,0 +1,371 @@
+// Package api serves the HTTP API used to control a running scanner
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/progress"
+)
+
+// Config of the HTTP API
+type Config struct {
+	Listen string `yaml:"listen"` // Address to serve the API on, e.g. "localhost:8089" (empty to disable)
+	Token  string `yaml:"token"`  // Required in the X-Api-Key header or as a bearer token when set
+	UI     bool   `yaml:"ui"`     // Serve the web UI at the root of the API address, requires Token
+}
+
+// Scanner is the part of the directory scanner driven by the API
+type Scanner interface {
+	// TriggerScan requests an immediate directory scan, returning false when one is already pending
+	TriggerScan() bool
+	// Pause stops new checks from starting, returning false when already paused
+	Pause() bool
+	// Resume lets checks start again, returning false when not paused
+	Resume() bool
+	// Paused reports whether the scanner is paused
+	Paused() bool
+	// Progress reports how far the checks of the backlog got
+	Progress() progress.Snapshot
+	// Checks returns the checks in progress
+	Checks() []Check
+	// QueueItems lists the items of the queue matching a filter
+	QueueItems(filter QueueFilter) ([]QueueItem, error)
+	// Stats summarizes the queue, the checks of the last days and the
+	// directories up to depth levels below the watch directories
+	Stats(days, depth int) (*Stats, error)
+	// Retry checks a queued NZB again ahead of the backlog, returning its queued path
+	Retry(ctx context.Context, path string) (string, error)
+	// Remove deletes an NZB from the queue, and the NZB itself when
+	// deleteFile is set, returning its queued path
+	Remove(ctx context.Context, path string, deleteFile bool) (string, error)
+	// Submit queues an NZB already on the scanner's disk ahead of the backlog
+	Submit(ctx context.Context, path string) (string, error)
+	// Upload saves an NZB and queues it ahead of the backlog, returning its path
+	Upload(ctx context.Context, name string, r io.Reader) (string, error)
+	// ClaimJob hands a check to a checker node, waiting until ctx is done for
+	// one, nil when none came
+	ClaimJob(ctx context.Context, worker string) (*Job, error)
+	// RenewJob extends the lease of a claimed job
+	RenewJob(id string) error
+	// CompleteJob reports the outcome of a claimed job
+	CompleteJob(id string, outcome JobOutcome) error
+}
+
+// claimWait is how long a job claim waits for a job, below the client timeout
+const claimWait = 20 * time.Second
+
+// Job is a check handed by a scanner node to a checker node
+type Job struct {
+	ID      string          `json:"id"`
+	Path    string          `json:"path"`    // Path of the NZB on the scanner node
+	NZB     []byte          `json:"nzb"`     // Content of the NZB
+	Options json.RawMessage `json:"options"` // Check options of the NZB, as set on the scanner node
+}
+
+// JobClaim is the body of a job claim
+type JobClaim struct {
+	Worker string `json:"worker"` // Identifies the checker node in the scanner logs
+}
+
+// JobOutcome is the outcome of a job reported by a checker node
+type JobOutcome struct {
+	Result json.RawMessage `json:"result,omitempty"` // Check result, absent when no check ran
+	Error  string          `json:"error,omitempty"`
+	Code   errcode.Code    `json:"code,omitempty"`
+}
+
+// Submission is the body of a request queueing an NZB by path, and the response to every submission
+type Submission struct {
+	Path string `json:"path"`
+}
+
+// Error is the body of every failed request, Code is stable and meant for
+// clients to branch on, Message is for humans
+type Error struct {
+	Message string       `json:"error"`
+	Code    errcode.Code `json:"code"`
+}
+
+// Status is the state of the scanner returned by the API
+type Status struct {
+	Paused   bool               `json:"paused"`
+	Progress *progress.Snapshot `json:"progress,omitempty"` // Progress of the backlog, only returned by the status request
+	Checks   []Check            `json:"checks,omitempty"`   // Checks in progress, only returned by the status request
+}
+
+// Server serves the API of a scanner
+type Server struct {
+	cfg      Config
+	scanner  Scanner
+	settings SettingsStore // Settings edited in the web UI, nil when they cannot be
+	mux      *http.ServeMux
+}
+
+// Option configures optional behaviour of a Server
+type Option func(*Server)
+
+// New creates an API server for a scanner
+func New(cfg Config, scanner Scanner, opts ...Option) *Server {
+	s := &Server{cfg: cfg, scanner: scanner, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mux.HandleFunc("POST /api/v1/scan", s.handleScan)
+	s.mux.HandleFunc("POST /api/v1/pause", s.handlePause)
+	s.mux.HandleFunc("POST /api/v1/resume", s.handleResume)
+	s.mux.HandleFunc("GET /api/v1/status", s.handleStatus)
+	s.mux.HandleFunc("POST /api/v1/nzbs", s.handleSubmit)
+	s.mux.HandleFunc("GET /api/v1/queue", s.handleQueue)
+	s.mux.HandleFunc("POST /api/v1/queue/retry", s.handleRetry)
+	s.mux.HandleFunc("DELETE /api/v1/queue", s.handleRemove)
+	s.mux.HandleFunc("GET /api/v1/stats", s.handleStats)
+	s.mux.HandleFunc("POST /api/v1/jobs/claim", s.handleClaimJob)
+	s.mux.HandleFunc("POST /api/v1/jobs/{id}/renew", s.handleRenewJob)
+	s.mux.HandleFunc("POST /api/v1/jobs/{id}/result", s.handleCompleteJob)
+
+	// The settings hold the provider credentials, they are only edited in
+	// the web UI and never without a token
+	if s.cfg.UI && s.cfg.Token != "" {
+		s.mux.HandleFunc("GET /api/v1/settings", s.handleSettings)
+		s.mux.HandleFunc("PUT /api/v1/settings", s.handleSaveSettings)
+	}
+
+	return s
+}
+
+// Run serves the API until ctx is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	slog.InfoContext(ctx, "API enabled", "addr", listener.Addr().String())
+	if s.cfg.UI {
+		slog.InfoContext(ctx, "Web UI enabled", "url", "http://"+listener.Addr().String()+"/")
+	}
+
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// handler routes the API requests through the token check, the web UI is
+// served without it since the page holds no data of its own
+func (s *Server) handler() http.Handler {
+	api := s.authorize(s.mux)
+	if !s.cfg.UI {
+		return api
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", api)
+	mux.HandleFunc("GET /{$}", handleUI)
+
+	return mux
+}
+
+// authorize rejects requests without the configured token
+func (s *Server) authorize(next http.Handler) http.Handler {
+	if s.cfg.Token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Api-Key")
+		if token == "" {
+			token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, Error{Message: "invalid or missing API token", Code: errcode.Unauthorized})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleScan triggers an immediate directory scan
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	status := "scan scheduled"
+	if !s.scanner.TriggerScan() {
+		status = "scan already pending"
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": status})
+}
+
+// handlePause stops new checks from starting
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.scanner.Pause()
+	writeJSON(w, http.StatusOK, Status{Paused: true})
+}
+
+// handleResume lets checks start again
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.scanner.Resume()
+	writeJSON(w, http.StatusOK, Status{Paused: false})
+}
+
+// handleStatus returns the state of the scanner
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	progress := s.scanner.Progress()
+	writeJSON(w, http.StatusOK, Status{Paused: s.scanner.Paused(), Progress: &progress, Checks: s.scanner.Checks()})
+}
+
+// handleSubmit queues an NZB ahead of the backlog. A JSON body names an NZB
+// on the scanner's disk, a multipart form uploads the NZB of its file field
+// and any other body is the NZB itself. The "name" query parameter names
+// uploaded NZBs, by default the file name of the form.
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var (
+		path string
+		err  error
+	)
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		var req Submission
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, Error{Message: "invalid JSON body: " + err.Error(), Code: errcode.InvalidRequest})
+			return
+		}
+		path, err = s.scanner.Submit(r.Context(), req.Path)
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		path, err = s.uploadForm(r)
+	default:
+		path, err = s.scanner.Upload(r.Context(), r.URL.Query().Get("name"), r.Body)
+	}
+
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Error{Message: err.Error(), Code: errcode.Of(err)})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, Submission{Path: path})
+}
+
+// uploadForm uploads the NZB of the file field of a multipart form
+func (s *Server) uploadForm(r *http.Request) (string, error) {
+	form, err := r.MultipartReader()
+	if err != nil {
+		return "", errcode.Wrap(errcode.InvalidRequest, err)
+	}
+
+	for {
+		part, err := form.NextPart()
+		if errors.Is(err, io.EOF) {
+			return "", errcode.New(errcode.InvalidRequest, "the form has no file field")
+		}
+		if err != nil {
+			return "", errcode.Wrap(errcode.InvalidRequest, err)
+		}
+
+		if part.FormName() != "file" {
+			_ = part.Close()
+			continue
+		}
+
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = part.FileName()
+		}
+
+		defer func() {
+			_ = part.Close()
+		}()
+		return s.scanner.Upload(r.Context(), name, part)
+	}
+}
+
+// handleClaimJob hands a check to a checker node, with 204 when none came
+// while the claim waited
+func (s *Server) handleClaimJob(w http.ResponseWriter, r *http.Request) {
+	var claim JobClaim
+	if err := json.NewDecoder(r.Body).Decode(&claim); err != nil {
+		writeJSON(w, http.StatusBadRequest, Error{Message: "invalid JSON body: " + err.Error(), Code: errcode.InvalidRequest})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), claimWait)
+	defer cancel()
+
+	job, err := s.scanner.ClaimJob(ctx, claim.Worker)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	if job == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+// handleRenewJob extends the lease of a claimed job
+func (s *Server) handleRenewJob(w http.ResponseWriter, r *http.Request) {
+	if err := s.scanner.RenewJob(r.PathValue("id")); err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "renewed"})
+}
+
+// handleCompleteJob reports the outcome of a claimed job
+func (s *Server) handleCompleteJob(w http.ResponseWriter, r *http.Request) {
+	var outcome JobOutcome
+	if err := json.NewDecoder(r.Body).Decode(&outcome); err != nil {
+		writeJSON(w, http.StatusBadRequest, Error{Message: "invalid JSON body: " + err.Error(), Code: errcode.InvalidRequest})
+		return
+	}
+
+	if err := s.scanner.CompleteJob(r.PathValue("id"), outcome); err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "accepted"})
+}
+
+// writeJobError writes the failure of a job request
+func writeJobError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch errcode.Of(err) {
+	case errcode.JobsDisabled:
+		status = http.StatusConflict
+	case errcode.UnknownJob:
+		status = http.StatusNotFound
+	}
+
+	writeJSON(w, status, Error{Message: err.Error(), Code: errcode.Of(err)})
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
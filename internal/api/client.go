@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/errcode"
+)
+
+// Client calls the API of a running scanner
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient creates a client for the API served with cfg, an address without
+// host (e.g. ":8089") is reached on localhost
+func NewClient(cfg Config) (*Client, error) {
+	host, port, err := net.SplitHostPort(cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api listen address %q: %w", cfg.Listen, err)
+	}
+
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+
+	return newClient("http://"+net.JoinHostPort(host, port), cfg.Token), nil
+}
+
+// NewNodeClient creates a client for the API of another node, e.g. the
+// scanner node a checker node pulls its jobs from
+func NewNodeClient(baseURL, token string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid node URL %q, expected e.g. http://nas:8089", baseURL)
+	}
+
+	return newClient(strings.TrimSuffix(baseURL, "/"), token), nil
+}
+
+// newClient creates a client for the API served at baseURL
+func newClient(baseURL, token string) *Client {
+	return &Client{
+		baseURL: baseURL,
+		token:   token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Pause stops new checks from starting
+func (c *Client) Pause(ctx context.Context) (Status, error) {
+	var status Status
+	return status, c.do(ctx, http.MethodPost, "/api/v1/pause", &status)
+}
+
+// Resume lets checks start again
+func (c *Client) Resume(ctx context.Context) (Status, error) {
+	var status Status
+	return status, c.do(ctx, http.MethodPost, "/api/v1/resume", &status)
+}
+
+// Status returns the state of the scanner
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var status Status
+	return status, c.do(ctx, http.MethodGet, "/api/v1/status", &status)
+}
+
+// Submit queues an NZB on the scanner's disk ahead of the backlog
+func (c *Client) Submit(ctx context.Context, path string) (Submission, error) {
+	body, err := json.Marshal(Submission{Path: path})
+	if err != nil {
+		return Submission{}, err
+	}
+
+	var sub Submission
+	return sub, c.send(ctx, http.MethodPost, "/api/v1/nzbs", "application/json", bytes.NewReader(body), &sub)
+}
+
+// Upload sends an NZB to the scanner, which saves and queues it ahead of the backlog
+func (c *Client) Upload(ctx context.Context, name string, r io.Reader) (Submission, error) {
+	var sub Submission
+	return sub, c.send(ctx, http.MethodPost, "/api/v1/nzbs?name="+url.QueryEscape(name), "application/x-nzb", r, &sub)
+}
+
+// ClaimJob asks the scanner node for a check to run, nil when none came
+// while the claim waited
+func (c *Client) ClaimJob(ctx context.Context, worker string) (*Job, error) {
+	body, err := json.Marshal(JobClaim{Worker: worker})
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	if err := c.send(ctx, http.MethodPost, "/api/v1/jobs/claim", "application/json", bytes.NewReader(body), &job); err != nil {
+		return nil, err
+	}
+	if job.ID == "" {
+		return nil, nil
+	}
+
+	return &job, nil
+}
+
+// RenewJob extends the lease of a claimed job
+func (c *Client) RenewJob(ctx context.Context, id string) error {
+	var status map[string]string
+	return c.do(ctx, http.MethodPost, "/api/v1/jobs/"+url.PathEscape(id)+"/renew", &status)
+}
+
+// CompleteJob reports the outcome of a claimed job
+func (c *Client) CompleteJob(ctx context.Context, id string, outcome JobOutcome) error {
+	body, err := json.Marshal(outcome)
+	if err != nil {
+		return err
+	}
+
+	var status map[string]string
+	return c.send(ctx, http.MethodPost, "/api/v1/jobs/"+url.PathEscape(id)+"/result", "application/json", bytes.NewReader(body), &status)
+}
+
+// do sends a request without body and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	return c.send(ctx, method, path, "", nil, out)
+}
+
+// send sends a request and decodes the JSON response into out
+func (c *Client) send(ctx context.Context, method, path, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("X-Api-Key", c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= 300 {
+		var apiErr Error
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		if apiErr.Code == "" {
+			apiErr.Code = errcode.Unknown
+		}
+
+		// The code of the server is kept for callers to branch on
+		return fmt.Errorf("%s %s: %w", method, path, errcode.New(apiErr.Code, apiErr.Message))
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
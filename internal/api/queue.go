@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/errcode"
+)
+
+// Default and maximum items returned by a queue listing
+const (
+	defaultQueueLimit = 100
+	maxQueueLimit     = 1000
+)
+
+// Default and maximum days of check history returned by the stats request,
+// and directory levels rolled up
+const (
+	defaultStatsDays  = 14
+	maxStatsDays      = 366
+	defaultStatsDepth = 2
+	maxStatsDepth     = 10
+)
+
+// QueueFilter selects the items of a queue listing
+type QueueFilter struct {
+	Status string // pending, processing, completed or failed, empty for every item
+	Search string // Part of the path, case insensitive, empty for every item
+	Limit  int    // Items returned, the most recently checked or added first
+}
+
+// QueueItem is an NZB of the scanner queue
+type QueueItem struct {
+	Path         string    `json:"path"`
+	Status       string    `json:"status"` // pending, processing, completed or failed
+	Added        time.Time `json:"added"`
+	CheckedAt    time.Time `json:"checked_at,omitzero"`   // Latest check, zero when never checked
+	Checks       int       `json:"checks"`                // Times the NZB was checked
+	Health       *float64  `json:"health,omitempty"`      // Health of the latest check, nil when never checked
+	Degradation  string    `json:"degradation,omitempty"` // How a previously healthy NZB degraded
+	FailedChecks int       `json:"failed_checks,omitempty"`
+	Priority     int       `json:"priority,omitempty"`
+	Category     string    `json:"category,omitempty"`
+	NotBefore    time.Time `json:"not_before,omitzero"`    // Pending NZBs are not checked before this time
+	DuplicateOf  string    `json:"duplicate_of,omitempty"` // Queued NZB with the same content, duplicates are never checked
+	MovedTo      string    `json:"moved_to,omitempty"`
+}
+
+// Check is a check in progress
+type Check struct {
+	Path     string    `json:"path"`
+	Started  time.Time `json:"started"`
+	Segments int64     `json:"segments"` // Segments to check in the files started so far
+	Checked  int64     `json:"checked"`
+	Failed   int64     `json:"failed"`
+}
+
+// Stats summarizes the queue and the checks of the last days
+type Stats struct {
+	Items         int            `json:"items"`          // NZBs in the queue
+	ByStatus      map[string]int `json:"by_status"`      // NZBs per status
+	Degraded      int            `json:"degraded"`       // NZBs flagged as taken down or decaying
+	AverageHealth float64        `json:"average_health"` // Health of the latest checks, averaged
+	Days          []DayStats     `json:"days"`           // Oldest first, today included
+	// Rollup of every directory up to DirectoryDepth levels below the watch
+	// directories, e.g. "Movies" and "Movies/UHD", keyed by "/" separated path
+	Directories    map[string]*DirectoryStats `json:"directories"`
+	DirectoryDepth int                        `json:"directory_depth"`
+}
+
+// DirectoryStats are the latest checks of the NZBs queued below a directory
+type DirectoryStats struct {
+	NZBs          int     `json:"nzbs"`
+	Checked       int     `json:"checked"` // NZBs checked at least once
+	Failed        int     `json:"failed"`
+	Degraded      int     `json:"degraded"`       // NZBs flagged as taken down or decaying
+	AtRisk        int     `json:"at_risk"`        // NZBs failed, degraded or missing segments on their latest check
+	AverageHealth float64 `json:"average_health"` // Health of the latest checks, averaged
+}
+
+// DayStats are the checks of a day. Only the latest check of an NZB is kept,
+// an NZB checked again is counted on the day of its latest check.
+type DayStats struct {
+	Day           string  `json:"day"` // YYYY-MM-DD, local time
+	Checked       int     `json:"checked"`
+	Failed        int     `json:"failed"`
+	AverageHealth float64 `json:"average_health"`
+}
+
+// handleQueue lists the queue items matching the status, search and limit
+// query parameters
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, ok := intParam(w, query.Get("limit"), "limit", defaultQueueLimit, maxQueueLimit)
+	if !ok {
+		return
+	}
+
+	status := query.Get("status")
+	switch status {
+	case "", "pending", "processing", "completed", "failed":
+	default:
+		writeJSON(w, http.StatusBadRequest, Error{Message: "status must be pending, processing, completed or failed", Code: errcode.InvalidRequest})
+		return
+	}
+
+	items, err := s.scanner.QueueItems(QueueFilter{Status: status, Search: query.Get("search"), Limit: limit})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Error{Message: err.Error(), Code: errcode.Of(err)})
+		return
+	}
+
+	if items == nil {
+		items = []QueueItem{}
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+// handleRetry checks a queued NZB again ahead of the backlog
+func (s *Server) handleRetry(w http.ResponseWriter, r *http.Request) {
+	var req Submission
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Error{Message: "invalid JSON body: " + err.Error(), Code: errcode.InvalidRequest})
+		return
+	}
+
+	path, err := s.scanner.Retry(r.Context(), req.Path)
+	if err != nil {
+		writeQueueError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, Submission{Path: path})
+}
+
+// handleRemove deletes the NZB of the path query parameter from the queue,
+// and the NZB itself when the delete_file query parameter is true
+func (s *Server) handleRemove(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var deleteFile bool
+	if value := query.Get("delete_file"); value != "" {
+		var err error
+		if deleteFile, err = strconv.ParseBool(value); err != nil {
+			writeJSON(w, http.StatusBadRequest, Error{Message: "delete_file must be true or false", Code: errcode.InvalidRequest})
+			return
+		}
+	}
+
+	path, err := s.scanner.Remove(r.Context(), query.Get("path"), deleteFile)
+	if err != nil {
+		writeQueueError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Submission{Path: path})
+}
+
+// writeQueueError writes the failure of a request on a queued NZB
+func writeQueueError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch errcode.Of(err) {
+	case errcode.InvalidRequest:
+		status = http.StatusBadRequest
+	case errcode.NotQueued:
+		status = http.StatusNotFound
+	case errcode.CheckInProgress:
+		status = http.StatusConflict
+	}
+
+	writeJSON(w, status, Error{Message: err.Error(), Code: errcode.Of(err)})
+}
+
+// handleStats summarizes the queue, the checks of the number of days of the
+// days query parameter and the directories up to the depth query parameter
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	days, ok := intParam(w, r.URL.Query().Get("days"), "days", defaultStatsDays, maxStatsDays)
+	if !ok {
+		return
+	}
+
+	depth, ok := intParam(w, r.URL.Query().Get("depth"), "depth", defaultStatsDepth, maxStatsDepth)
+	if !ok {
+		return
+	}
+
+	stats, err := s.scanner.Stats(days, depth)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Error{Message: err.Error(), Code: errcode.Of(err)})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// intParam parses a positive query parameter capped at upper, writing the
+// failure when it is invalid
+func intParam(w http.ResponseWriter, value, name string, fallback, upper int) (int, bool) {
+	if value == "" {
+		return fallback, true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		writeJSON(w, http.StatusBadRequest, Error{Message: name + " must be a positive integer", Code: errcode.InvalidRequest})
+		return 0, false
+	}
+
+	return min(n, upper), true
+}
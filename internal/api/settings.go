@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/javi11/nzb-touch/internal/errcode"
+)
+
+// Settings are the parts of the configuration edited in the web UI. Zero
+// values leave a setting to its default.
+type Settings struct {
+	DownloadWorkers   int                `json:"download_workers"`
+	Providers         []ProviderSettings `json:"providers"`
+	WatchDirectories  []string           `json:"watch_directories"`
+	ScanInterval      string             `json:"scan_interval"`      // Duration, e.g. "5m"
+	ReprocessInterval string             `json:"reprocess_interval"` // Duration, e.g. "168h"
+	ConcurrentJobs    int                `json:"concurrent_jobs"`
+	MaxFilesPerDay    int                `json:"max_files_per_day"`
+	CheckPercent      int                `json:"check_percent"`
+	MissingPercent    int                `json:"missing_percent"`
+}
+
+// ProviderSettings are the settings of a download provider edited in the
+// web UI, its other settings are kept as they are
+type ProviderSettings struct {
+	// Position of the provider in the configuration file, nil for a new provider
+	Index          *int   `json:"index,omitempty"`
+	Host           string `json:"host"`
+	Port           int    `json:"port"`
+	Username       string `json:"username"`
+	Password       string `json:"password,omitempty"` // Never returned, empty keeps the current password
+	HasPassword    bool   `json:"has_password"`       // A password or a password file is set
+	TLS            bool   `json:"tls"`
+	MaxConnections int    `json:"max_connections"`
+	Role           string `json:"role"` // "primary" (default) or "backup"
+	Tier           int    `json:"tier"`
+}
+
+// SettingsStore reads and writes the settings edited in the web UI
+type SettingsStore interface {
+	// Settings returns the settings as written in the configuration
+	Settings() (*Settings, error)
+	// SaveSettings validates the settings and writes them to the
+	// configuration, they apply once the scanner restarts
+	SaveSettings(settings *Settings) error
+}
+
+// WithSettings lets the web UI edit the settings of store
+func WithSettings(store SettingsStore) Option {
+	return func(s *Server) {
+		s.settings = store
+	}
+}
+
+// handleSettings returns the settings edited in the web UI
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		writeSettingsDisabled(w)
+		return
+	}
+
+	settings, err := s.settings.Settings()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Error{Message: err.Error(), Code: errcode.Of(err)})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// handleSaveSettings writes the settings edited in the web UI to the
+// configuration
+func (s *Server) handleSaveSettings(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		writeSettingsDisabled(w)
+		return
+	}
+
+	var settings Settings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeJSON(w, http.StatusBadRequest, Error{Message: "invalid JSON body: " + err.Error(), Code: errcode.InvalidRequest})
+		return
+	}
+
+	if err := s.settings.SaveSettings(&settings); err != nil {
+		status := http.StatusInternalServerError
+		if errcode.Of(err) == errcode.InvalidRequest {
+			status = http.StatusBadRequest
+		}
+
+		writeJSON(w, status, Error{Message: err.Error(), Code: errcode.Of(err)})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "saved, restart the scanner to apply the settings"})
+}
+
+// writeSettingsDisabled writes the failure of a settings request to a
+// scanner without a configuration file
+func writeSettingsDisabled(w http.ResponseWriter) {
+	writeJSON(w, http.StatusConflict, Error{Message: "the settings cannot be edited without a configuration file", Code: errcode.SettingsDisabled})
+}
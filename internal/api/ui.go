@@ -0,0 +1,18 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// uiPage is the web UI, a single page polling the API
+//
+//go:embed ui/index.html
+var uiPage []byte
+
+// handleUI serves the web UI
+func handleUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(uiPage)
+}
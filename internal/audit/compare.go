@@ -0,0 +1,363 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/processor"
+)
+
+// Change is how the state of an NZB or segment differs between two runs
+type Change string
+
+const (
+	ChangeAtRisk    Change = "at_risk"   // Healthy before, at risk now
+	ChangeRecovered Change = "recovered" // At risk before, healthy now
+	ChangeWorse     Change = "worse"     // At risk in both runs, less healthy now
+	ChangeBetter    Change = "better"    // At risk in both runs, healthier now
+	ChangeUnchecked Change = "unchecked" // At risk before, not checked by the new run
+	ChangeLost      Change = "lost"      // Segment found before, failing now
+	ChangeClass     Change = "class"     // Segment failing in both runs with another error class
+)
+
+// healthEpsilon is the health difference, in percent, below which an NZB is unchanged
+const healthEpsilon = 0.01
+
+// EntryChange is an NZB whose state differs between two audits
+type EntryChange struct {
+	Path      string  `json:"path"`
+	Change    Change  `json:"change"`
+	OldHealth float64 `json:"old_health"`
+	NewHealth float64 `json:"new_health"`
+	OldFailed int     `json:"old_failed_segments"`
+	NewFailed int     `json:"new_failed_segments"`
+	Error     string  `json:"error,omitempty"` // Error of the new run
+}
+
+// StatsChange compares the statistics of a category or directory, Old or
+// New is nil when it is missing from that audit
+type StatsChange struct {
+	Name            string  `json:"name"`
+	Old             *Stats  `json:"old"`
+	New             *Stats  `json:"new"`
+	CompletionDelta float64 `json:"completion_delta"` // Percentage points gained, negative when decaying
+}
+
+// Comparison is the difference between two audits of the same library
+type Comparison struct {
+	OldStartedAt time.Time      `json:"old_started_at"`
+	NewStartedAt time.Time      `json:"new_started_at"`
+	Overall      StatsChange    `json:"overall"`
+	Categories   []StatsChange  `json:"categories"`
+	Directories  []StatsChange  `json:"directories,omitempty"`
+	NZBs         []EntryChange  `json:"nzbs"`
+	Counts       map[Change]int `json:"counts"`
+}
+
+// LoadReport reads a report written with WriteJSON
+func LoadReport(r io.Reader) (*Report, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// Compare diffs two audits, before being the earlier one. Reports only keep the
+// at-risk NZBs, so an NZB at risk before and absent from the new at-risk list
+// recovered, unless the new audit deferred it or was interrupted.
+func Compare(before, after *Report) *Comparison {
+	c := &Comparison{
+		OldStartedAt: before.StartedAt,
+		NewStartedAt: after.StartedAt,
+		Overall:      compareStats("", &before.Overall, &after.Overall),
+		Categories:   compareStatsMaps(before.Categories, after.Categories),
+		Directories:  compareStatsMaps(before.Directories, after.Directories),
+		NZBs:         []EntryChange{},
+		Counts:       make(map[Change]int),
+	}
+
+	previous := make(map[string]Entry, len(before.AtRisk))
+	for _, e := range before.AtRisk {
+		previous[e.Path] = e
+	}
+
+	deferred := make(map[string]bool, len(after.Deferred))
+	for _, path := range after.Deferred {
+		deferred[path] = true
+	}
+
+	now := make(map[string]bool, len(after.AtRisk))
+	for _, e := range after.AtRisk {
+		now[e.Path] = true
+
+		prev, ok := previous[e.Path]
+		if !ok {
+			// Healthy NZBs are not kept in a report, assume it was complete
+			c.add(EntryChange{Path: e.Path, Change: ChangeAtRisk, OldHealth: 100, NewHealth: e.Health, NewFailed: e.FailedSegments, Error: e.Error})
+			continue
+		}
+
+		change := EntryChange{Path: e.Path, OldHealth: prev.Health, NewHealth: e.Health, OldFailed: prev.FailedSegments, NewFailed: e.FailedSegments, Error: e.Error}
+		switch {
+		case e.Health < prev.Health-healthEpsilon:
+			change.Change = ChangeWorse
+		case e.Health > prev.Health+healthEpsilon:
+			change.Change = ChangeBetter
+		default:
+			continue
+		}
+		c.add(change)
+	}
+
+	for _, prev := range before.AtRisk {
+		if now[prev.Path] {
+			continue
+		}
+
+		change := EntryChange{Path: prev.Path, Change: ChangeRecovered, OldHealth: prev.Health, NewHealth: 100, OldFailed: prev.FailedSegments}
+		if deferred[prev.Path] || after.Incomplete {
+			change.Change = ChangeUnchecked
+			change.NewHealth = 0
+		}
+		c.add(change)
+	}
+
+	// Decaying NZBs first, then by the health lost
+	order := map[Change]int{ChangeAtRisk: 0, ChangeWorse: 1, ChangeBetter: 2, ChangeRecovered: 3, ChangeUnchecked: 4}
+	sort.SliceStable(c.NZBs, func(i, j int) bool {
+		a, b := c.NZBs[i], c.NZBs[j]
+		if order[a.Change] != order[b.Change] {
+			return order[a.Change] < order[b.Change]
+		}
+		if da, db := a.NewHealth-a.OldHealth, b.NewHealth-b.OldHealth; da != db {
+			return da < db
+		}
+		return a.Path < b.Path
+	})
+
+	return c
+}
+
+func (c *Comparison) add(change EntryChange) {
+	c.NZBs = append(c.NZBs, change)
+	c.Counts[change.Change]++
+}
+
+func compareStats(name string, before, after *Stats) StatsChange {
+	change := StatsChange{Name: name, Old: before, New: after}
+	if before != nil && after != nil {
+		change.CompletionDelta = after.Completion - before.Completion
+	}
+
+	return change
+}
+
+// compareStatsMaps compares the categories or directories of two audits, by name
+func compareStatsMaps(before, after map[string]*Stats) []StatsChange {
+	names := make(map[string]bool, len(before)+len(after))
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+
+	changes := make([]StatsChange, 0, len(names))
+	for name := range names {
+		changes = append(changes, compareStats(name, before[name], after[name]))
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes
+}
+
+// WriteJSON writes the comparison as indented JSON
+func (c *Comparison) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(c)
+}
+
+// WriteText writes a human readable summary of the comparison
+func (c *Comparison) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Comparing the audit of %s with the audit of %s\n",
+		c.OldStartedAt.Format(time.RFC3339), c.NewStartedAt.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Completion: %s, newly at risk: %d, worse: %d, better: %d, recovered: %d, unchecked: %d\n\n",
+		formatCompletionChange(c.Overall), c.Counts[ChangeAtRisk], c.Counts[ChangeWorse],
+		c.Counts[ChangeBetter], c.Counts[ChangeRecovered], c.Counts[ChangeUnchecked])
+
+	fmt.Fprintln(tw, "CATEGORY\tNZBS\tAT RISK\tCOMPLETION")
+	for _, s := range c.Categories {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, formatCountChange(s, nzbsOf), formatCountChange(s, atRiskOf), formatCompletionChange(s))
+	}
+
+	if len(c.Directories) > 0 {
+		fmt.Fprintln(tw, "\nDIRECTORY\tNZBS\tAT RISK\tCOMPLETION")
+		for _, s := range c.Directories {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, formatCountChange(s, nzbsOf), formatCountChange(s, atRiskOf), formatCompletionChange(s))
+		}
+	}
+
+	if len(c.NZBs) > 0 {
+		fmt.Fprintln(tw, "\nCHANGE\tNZB\tHEALTH\tFAILED\tERROR")
+		for _, e := range c.NZBs {
+			newHealth := fmt.Sprintf("%.2f%%", e.NewHealth)
+			newFailed := fmt.Sprintf("%d", e.NewFailed)
+			if e.Change == ChangeUnchecked {
+				newHealth, newFailed = "?", "?"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%.2f%% -> %s\t%d -> %s\t%s\n",
+				e.Change, e.Path, e.OldHealth, newHealth, e.OldFailed, newFailed, e.Error)
+		}
+	}
+
+	return tw.Flush()
+}
+
+func nzbsOf(s *Stats) int   { return s.NZBs }
+func atRiskOf(s *Stats) int { return s.AtRisk }
+
+// formatCountChange renders a counter as "old -> new", "-" standing for a missing side
+func formatCountChange(s StatsChange, count func(*Stats) int) string {
+	side := func(stats *Stats) string {
+		if stats == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%d", count(stats))
+	}
+
+	return side(s.Old) + " -> " + side(s.New)
+}
+
+// formatCompletionChange renders a completion as "old -> new (delta)"
+func formatCompletionChange(s StatsChange) string {
+	side := func(stats *Stats) string {
+		if stats == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f%%", stats.Completion)
+	}
+
+	text := side(s.Old) + " -> " + side(s.New)
+	if s.Old != nil && s.New != nil {
+		text += fmt.Sprintf(" (%+.2f)", s.CompletionDelta)
+	}
+
+	return text
+}
+
+// SegmentChange is a segment whose outcome differs between two session recordings
+type SegmentChange struct {
+	SegmentID string               `json:"segment_id"`
+	Change    Change               `json:"change"`
+	Old       processor.ErrorClass `json:"old,omitempty"` // Empty when the segment was found
+	New       processor.ErrorClass `json:"new,omitempty"`
+}
+
+// SessionComparison is the difference between two session recordings of the same NZB
+type SessionComparison struct {
+	Segments  int             `json:"segments"` // Segments recorded in both sessions
+	OnlyOld   int             `json:"only_old"` // Segments only in the old recording, e.g. not sampled again
+	OnlyNew   int             `json:"only_new"`
+	Lost      int             `json:"lost"`
+	Recovered int             `json:"recovered"`
+	Decay     float64         `json:"decay"` // Percentage of the segments found before that fail now
+	Changes   []SegmentChange `json:"changes"`
+}
+
+// CompareSessions diffs the segment outcomes of two session recordings,
+// before being the earlier one. Only segments recorded in both are compared.
+func CompareSessions(before, after map[string]processor.ErrorClass) *SessionComparison {
+	c := &SessionComparison{Changes: []SegmentChange{}}
+
+	foundBefore := 0
+	for id, was := range before {
+		now, ok := after[id]
+		if !ok {
+			c.OnlyOld++
+			continue
+		}
+
+		c.Segments++
+		if was == "" {
+			foundBefore++
+		}
+
+		switch {
+		case was == now:
+			continue
+		case was == "":
+			c.Lost++
+			c.Changes = append(c.Changes, SegmentChange{SegmentID: id, Change: ChangeLost, New: now})
+		case now == "":
+			c.Recovered++
+			c.Changes = append(c.Changes, SegmentChange{SegmentID: id, Change: ChangeRecovered, Old: was})
+		default:
+			c.Changes = append(c.Changes, SegmentChange{SegmentID: id, Change: ChangeClass, Old: was, New: now})
+		}
+	}
+
+	for id := range after {
+		if _, ok := before[id]; !ok {
+			c.OnlyNew++
+		}
+	}
+
+	if foundBefore > 0 {
+		c.Decay = math.Round(float64(c.Lost)*10000/float64(foundBefore)) / 100
+	}
+
+	sort.Slice(c.Changes, func(i, j int) bool {
+		if c.Changes[i].Change != c.Changes[j].Change {
+			return c.Changes[i].Change < c.Changes[j].Change
+		}
+		return c.Changes[i].SegmentID < c.Changes[j].SegmentID
+	})
+
+	return c
+}
+
+// WriteJSON writes the comparison as indented JSON
+func (c *SessionComparison) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(c)
+}
+
+// WriteText writes a human readable summary of the comparison
+func (c *SessionComparison) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Segments in both recordings: %d, only in the old one: %d, only in the new one: %d\n", c.Segments, c.OnlyOld, c.OnlyNew)
+	fmt.Fprintf(tw, "Lost: %d, recovered: %d, decay: %.2f%%\n", c.Lost, c.Recovered, c.Decay)
+
+	if len(c.Changes) > 0 {
+		fmt.Fprintln(tw, "\nCHANGE\tSEGMENT\tOLD\tNEW")
+		for _, s := range c.Changes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Change, s.SegmentID, outcomeText(s.Old), outcomeText(s.New))
+		}
+	}
+
+	return tw.Flush()
+}
+
+func outcomeText(class processor.ErrorClass) string {
+	if class == "" {
+		return "found"
+	}
+
+	return string(class)
+}
@@ -0,0 +1,411 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+	"github.com/javi11/nzb-touch/internal/groupstats"
+	"github.com/javi11/nzb-touch/internal/processor"
+)
+
+// Entry describes the outcome of checking a single NZB during an audit
+type Entry struct {
+	Path            string  `json:"path"`
+	Category        string  `json:"category"`
+	Dir             string  `json:"dir"` // Directory relative to the audited root, "/" separated
+	Health          float64 `json:"health"`
+	TotalSegments   int     `json:"total_segments"`
+	CheckedSegments int     `json:"checked_segments"`
+	FailedSegments  int     `json:"failed_segments"`
+	Par2Percent     float64 `json:"par2_percent"`
+	Par2Thin        bool    `json:"par2_thin,omitempty"` // Parity coverage too thin to survive typical article loss
+	Partial         bool    `json:"partial,omitempty"`   // The time budget ran out before every segment was checked
+	Error           string  `json:"error,omitempty"`
+	// Stable code of the error, e.g. E_MISSING_THRESHOLD
+	ErrorCode errcode.Code `json:"error_code,omitempty"`
+	// Real metadata read from the article headers, set with scanner.header_samples
+	Headers []processor.FileHeaders `json:"headers,omitempty"`
+}
+
+// AtRisk reports whether the NZB failed its check, has missing segments or thin parity coverage
+func (e Entry) AtRisk() bool {
+	return e.Error != "" || e.FailedSegments > 0 || e.Par2Thin
+}
+
+// Stats aggregates the entries of a category or directory
+type Stats struct {
+	NZBs            int     `json:"nzbs"`
+	AtRisk          int     `json:"at_risk"`
+	TotalSegments   int     `json:"total_segments"`
+	CheckedSegments int     `json:"checked_segments"`
+	FailedSegments  int     `json:"failed_segments"`
+	ThinParity      int     `json:"thin_parity"` // NZBs with parity coverage too thin to survive typical article loss
+	Completion      float64 `json:"completion"`  // Percentage of checked segments that were available
+}
+
+// spilledRowsPerFlush is how many rows of the spilled lists the text report
+// buffers before writing them
+const spilledRowsPerFlush = 1000
+
+// Report is the consolidated result of an audit. Only at-risk entries are
+// kept so libraries with many thousands of NZBs fit in memory, and with
+// Spill they are kept on disk, along with the outcome of every segment.
+type Report struct {
+	mu         sync.Mutex
+	StartedAt  time.Time         `json:"started_at"`
+	Duration   time.Duration     `json:"duration"`
+	Overall    Stats             `json:"overall"`
+	Categories map[string]*Stats `json:"categories"`
+	// Rollup of every directory up to DirectoryDepth levels below the audited roots
+	Directories    map[string]*Stats `json:"directories"`
+	DirectoryDepth int               `json:"directory_depth"`
+	AtRisk         []Entry           `json:"at_risk"`
+	// Article availability per newsgroup and provider, worst first, when collected
+	Groups     []groupstats.Availability `json:"groups,omitempty"`
+	Incomplete bool                      `json:"incomplete,omitempty"` // The audit was interrupted before every NZB was checked
+	// NZBs left for the next run because they were not expected to finish before the window end
+	Deferred []string `json:"deferred,omitempty"`
+	// Segments found missing, only reported when the segment results are spilled
+	MissingSegments []processor.SegmentRecord `json:"missing_segments,omitempty"`
+
+	// On-disk stores of the at-risk entries and of the segment results, see Spill
+	atRisk   *processor.SpillStore[Entry]
+	segments *processor.SpillStore[processor.SegmentRecord]
+}
+
+// NewReport creates an empty report starting now, rolling entries up into
+// their directories up to dirDepth levels deep (0 disables the rollup)
+func NewReport(dirDepth int) *Report {
+	return &Report{
+		StartedAt:      time.Now(),
+		Categories:     make(map[string]*Stats),
+		Directories:    make(map[string]*Stats),
+		DirectoryDepth: dirDepth,
+		AtRisk:         []Entry{},
+	}
+}
+
+// Spill keeps the at-risk entries in atRisk instead of memory and reports the
+// missing segments from segments, the store the processor spills its segment
+// results to. The at-risk entries are then listed in the order they were
+// checked, the stores are read when the report is written.
+func (r *Report) Spill(atRisk *processor.SpillStore[Entry], segments *processor.SpillStore[processor.SegmentRecord]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.atRisk, r.segments = atRisk, segments
+}
+
+// Add accounts for a checked NZB, it is safe for concurrent use
+func (r *Report) Add(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := r.Categories[e.Category]
+	if stats == nil {
+		stats = &Stats{}
+		r.Categories[e.Category] = stats
+	}
+
+	for _, s := range append([]*Stats{&r.Overall, stats}, r.directoryStats(e.Dir)...) {
+		s.add(e)
+	}
+
+	if !e.AtRisk() {
+		return
+	}
+
+	// Kept in memory when the spill file cannot be written
+	if r.atRisk == nil || r.atRisk.Append(e) != nil {
+		r.AtRisk = append(r.AtRisk, e)
+	}
+}
+
+// directoryStats returns the stats of dir and each of its ancestors within the rollup depth
+func (r *Report) directoryStats(dir string) []*Stats {
+	keys := fsutil.DirectoryKeys(dir, r.DirectoryDepth)
+
+	stats := make([]*Stats, 0, len(keys))
+	for _, key := range keys {
+		s := r.Directories[key]
+		if s == nil {
+			s = &Stats{}
+			r.Directories[key] = s
+		}
+		stats = append(stats, s)
+	}
+
+	return stats
+}
+
+// Defer records an NZB left for the next run, it is safe for concurrent use
+func (r *Report) Defer(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Deferred = append(r.Deferred, path)
+}
+
+// Finish records the duration and sorts the at-risk entries, least healthy first
+func (r *Report) Finish(incomplete bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Duration = time.Since(r.StartedAt)
+	r.Incomplete = incomplete
+	sort.SliceStable(r.AtRisk, func(i, j int) bool {
+		return r.AtRisk[i].Health < r.AtRisk[j].Health
+	})
+	sort.Strings(r.Deferred)
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.atRisk != nil {
+		return r.writeSpilledJSON(w)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// report has the fields of Report without its methods
+type report Report
+
+// writeSpilledJSON writes the report as WriteJSON does, streaming the at-risk
+// entries and the missing segments from the spill files after the other fields
+func (r *Report) writeSpilledJSON(w io.Writer) error {
+	// The nil fields hide the lists of the same name, written afterwards
+	header, err := json.MarshalIndent(struct {
+		*report
+		AtRisk          *struct{} `json:"at_risk,omitempty"`
+		MissingSegments *struct{} `json:"missing_segments,omitempty"`
+	}{report: (*report)(r)}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	_, _ = bw.Write(bytes.TrimSuffix(header, []byte("\n}")))
+
+	if err := writeJSONList(bw, "at_risk", func(add func(any) error) error {
+		return r.eachAtRisk(func(e Entry) error { return add(e) })
+	}); err != nil {
+		return err
+	}
+
+	if r.segments != nil {
+		if err := writeJSONList(bw, "missing_segments", func(add func(any) error) error {
+			return r.eachMissingSegment(func(rec processor.SegmentRecord) error { return add(rec) })
+		}); err != nil {
+			return err
+		}
+	}
+
+	_, _ = bw.WriteString("\n}\n")
+
+	return bw.Flush()
+}
+
+// writeJSONList writes a field of the top level object holding the list of
+// the values passed to add by each
+func writeJSONList(w *bufio.Writer, key string, each func(add func(any) error) error) error {
+	_, _ = fmt.Fprintf(w, ",\n  %q: [", key)
+
+	first := true
+	err := each(func(v any) error {
+		data, err := json.MarshalIndent(v, "    ", "  ")
+		if err != nil {
+			return err
+		}
+
+		if !first {
+			_ = w.WriteByte(',')
+		}
+		first = false
+
+		_, _ = w.WriteString("\n    ")
+		_, err = w.Write(data)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if !first {
+		_, _ = w.WriteString("\n  ")
+	}
+	_, err = w.WriteString("]")
+
+	return err
+}
+
+// eachAtRisk calls fn for every at-risk entry, those kept in memory first
+func (r *Report) eachAtRisk(fn func(Entry) error) error {
+	for _, e := range r.AtRisk {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	if r.atRisk == nil {
+		return nil
+	}
+
+	return r.atRisk.Iterate(fn)
+}
+
+// eachMissingSegment calls fn for every missing segment of the segment spill
+func (r *Report) eachMissingSegment(fn func(processor.SegmentRecord) error) error {
+	if r.segments == nil {
+		return nil
+	}
+
+	return r.segments.Iterate(func(rec processor.SegmentRecord) error {
+		if !rec.Missing {
+			return nil
+		}
+
+		return fn(rec)
+	})
+}
+
+// hasAtRisk reports whether any entry is at risk
+func (r *Report) hasAtRisk() bool {
+	return len(r.AtRisk) > 0 || r.atRisk != nil && r.atRisk.Len() > 0
+}
+
+// WriteText writes a human readable summary of the report
+func (r *Report) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Audit started %s, took %s\n", r.StartedAt.Format(time.RFC3339), r.Duration.Round(time.Second))
+	if r.Incomplete {
+		fmt.Fprintln(tw, "WARNING: the audit was interrupted, not every NZB was checked")
+	}
+	if len(r.Deferred) > 0 {
+		fmt.Fprintf(tw, "Deferred to the next window: %d NZBs\n", len(r.Deferred))
+	}
+	fmt.Fprintf(tw, "NZBs checked: %d, at risk: %d, thin parity: %d, completion: %.2f%%\n\n",
+		r.Overall.NZBs, r.Overall.AtRisk, r.Overall.ThinParity, r.Overall.Completion)
+
+	categories := make([]string, 0, len(r.Categories))
+	for name := range r.Categories {
+		categories = append(categories, name)
+	}
+	sort.Strings(categories)
+
+	fmt.Fprintln(tw, "CATEGORY\tNZBS\tAT RISK\tCHECKED\tFAILED\tCOMPLETION")
+	for _, name := range categories {
+		s := r.Categories[name]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.2f%%\n",
+			name, s.NZBs, s.AtRisk, s.CheckedSegments, s.FailedSegments, s.Completion)
+	}
+
+	if len(r.Directories) > 0 {
+		dirs := make([]string, 0, len(r.Directories))
+		for dir := range r.Directories {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+
+		fmt.Fprintln(tw, "\nDIRECTORY\tNZBS\tAT RISK\tCHECKED\tFAILED\tCOMPLETION")
+		for _, dir := range dirs {
+			s := r.Directories[dir]
+			// Indent nested directories below their parent
+			depth := strings.Count(dir, "/")
+			fmt.Fprintf(tw, "%s%s\t%d\t%d\t%d\t%d\t%.2f%%\n",
+				strings.Repeat("  ", depth), dir, s.NZBs, s.AtRisk, s.CheckedSegments, s.FailedSegments, s.Completion)
+		}
+	}
+
+	if len(r.Groups) > 0 {
+		fmt.Fprintln(tw)
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		if err := groupstats.WriteText(w, r.Groups); err != nil {
+			return err
+		}
+	}
+
+	// The spilled lists are flushed every few rows to keep memory flat,
+	// their columns are aligned within each block
+	rows := 0
+	flushSpilled := func() error {
+		rows++
+		if r.atRisk == nil || rows%spilledRowsPerFlush != 0 {
+			return nil
+		}
+
+		return tw.Flush()
+	}
+
+	if r.hasAtRisk() {
+		fmt.Fprintln(tw, "\nAT RISK\tHEALTH\tFAILED\tPAR2\tERROR")
+		err := r.eachAtRisk(func(e Entry) error {
+			fmt.Fprintf(tw, "%s\t%.2f%%\t%d/%d\t%.1f%%\t%s\n", e.Path, e.Health, e.FailedSegments, e.TotalSegments, e.Par2Percent, e.Error)
+			return flushSpilled()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(r.Deferred) > 0 {
+		fmt.Fprintln(tw, "\nDEFERRED")
+		for _, path := range r.Deferred {
+			fmt.Fprintln(tw, path)
+		}
+	}
+
+	if r.segments != nil {
+		fmt.Fprintln(tw, "\nMISSING SEGMENT\tNZB\tFILE\tERROR")
+		err := r.eachMissingSegment(func(rec processor.SegmentRecord) error {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", rec.SegmentID, rec.Source, rec.File, rec.Error)
+			return flushSpilled()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
+
+func (s *Stats) add(e Entry) {
+	s.NZBs++
+	if e.AtRisk() {
+		s.AtRisk++
+	}
+	if e.Par2Thin {
+		s.ThinParity++
+	}
+	s.TotalSegments += e.TotalSegments
+	s.CheckedSegments += e.CheckedSegments
+	s.FailedSegments += e.FailedSegments
+
+	s.Completion = 100
+	if s.CheckedSegments > 0 {
+		s.Completion = float64(s.CheckedSegments-s.FailedSegments) * 100 / float64(s.CheckedSegments)
+	}
+}
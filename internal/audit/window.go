@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"sync"
+	"time"
+)
+
+// Window tracks the time spent checking NZBs during a run and decides whether
+// another NZB can still be checked before the run window ends. A nil Window
+// has no end and accepts every NZB.
+type Window struct {
+	mu       sync.Mutex
+	end      time.Time
+	nzbs     int
+	segments int
+	elapsed  time.Duration
+}
+
+// NewWindow creates a window ending at end
+func NewWindow(end time.Time) *Window {
+	return &Window{end: end}
+}
+
+// End returns when the window closes
+func (w *Window) End() time.Time {
+	if w == nil {
+		return time.Time{}
+	}
+
+	return w.end
+}
+
+// Record accounts for an NZB with segments segments checked in took
+func (w *Window) Record(segments int, took time.Duration) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.nzbs++
+	w.segments += segments
+	w.elapsed += took
+}
+
+// AveragePerNZB returns the average time spent checking an NZB so far
+func (w *Window) AveragePerNZB() time.Duration {
+	if w == nil {
+		return 0
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.nzbs == 0 {
+		return 0
+	}
+
+	return w.elapsed / time.Duration(w.nzbs)
+}
+
+// Estimate returns the expected time to check an NZB with segments segments,
+// scaling the average time per segment measured so far
+func (w *Window) Estimate(segments int) time.Duration {
+	if w == nil {
+		return 0
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.segments == 0 {
+		if w.nzbs == 0 {
+			return 0
+		}
+
+		return w.elapsed / time.Duration(w.nzbs)
+	}
+
+	return time.Duration(float64(w.elapsed) / float64(w.segments) * float64(segments))
+}
+
+// Fits reports whether an NZB with segments segments is expected to be
+// checked before the window ends. Until a first NZB was measured only the
+// window end itself is taken into account.
+func (w *Window) Fits(segments int) bool {
+	if w == nil {
+		return true
+	}
+
+	return !time.Now().Add(w.Estimate(segments)).After(w.end)
+}
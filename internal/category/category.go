@@ -0,0 +1,122 @@
+// Package category maps NZBs to user defined categories carrying their own
+// check thresholds, reprocessing schedule and destinations
+package category
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// Category overrides the scanner settings for the NZBs it matches. Zero
+// values inherit the scanner settings.
+type Category struct {
+	Name string `yaml:"name"`
+	// Glob patterns of the watch subdirectories in this category, relative to
+	// the watch directory and "/" separated (default: the category name).
+	// Subdirectories of a matching directory belong to the category too.
+	Directories       []string      `yaml:"directories"`
+	CheckPercent      int           `yaml:"check_percent"`
+	MissingPercent    *int          `yaml:"missing_percent"`
+	SamplingStrategy  string        `yaml:"sampling_strategy"`
+	ReprocessInterval time.Duration `yaml:"reprocess_interval"`
+	FailedDirectory   string        `yaml:"failed_directory"`
+}
+
+// Validate checks the category mapping
+func Validate(categories []Category) error {
+	names := make(map[string]bool, len(categories))
+	for _, c := range categories {
+		if c.Name == "" {
+			return errors.New("categories require a name")
+		}
+
+		key := strings.ToLower(c.Name)
+		if names[key] {
+			return fmt.Errorf("duplicate category %q", c.Name)
+		}
+		names[key] = true
+
+		for _, pattern := range c.directories() {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("category %s: invalid directory pattern %q: %w", c.Name, pattern, err)
+			}
+		}
+
+		if c.CheckPercent < 0 || c.CheckPercent > 100 {
+			return fmt.Errorf("category %s: check_percent must be between 1 and 100", c.Name)
+		}
+
+		if c.MissingPercent != nil && (*c.MissingPercent < 0 || *c.MissingPercent > 100) {
+			return fmt.Errorf("category %s: missing_percent must be between 0 and 100", c.Name)
+		}
+
+		if c.ReprocessInterval < 0 {
+			return fmt.Errorf("category %s: reprocess_interval must not be negative", c.Name)
+		}
+	}
+
+	return nil
+}
+
+func (c Category) directories() []string {
+	if len(c.Directories) == 0 {
+		return []string{c.Name}
+	}
+
+	return c.Directories
+}
+
+// matchDir reports whether dir, or one of its parents, matches a directory pattern of the category
+func (c Category) matchDir(dir string) bool {
+	for ; dir != "." && dir != "" && dir != "/"; dir = path.Dir(dir) {
+		for _, pattern := range c.directories() {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(dir)); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Infer returns the category of the NZB at nzbPath: the first category
+// matching its directory below one of the watch directories, else the
+// category named by the NZB "category" meta. It returns nil when none match.
+func Infer(categories []Category, watchDirs []string, nzbPath string, meta map[string]string) *Category {
+	for _, root := range watchDirs {
+		rel, ok := fsutil.RelativePath(root, filepath.Dir(nzbPath))
+		if !ok {
+			continue
+		}
+
+		for i := range categories {
+			if categories[i].matchDir(filepath.ToSlash(rel)) {
+				return &categories[i]
+			}
+		}
+	}
+
+	return Named(categories, meta["category"])
+}
+
+// Named returns the category with the given name, case-insensitively, nil when there is none
+func Named(categories []Category, name string) *Category {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil
+	}
+
+	for i := range categories {
+		if strings.EqualFold(categories[i].Name, name) {
+			return &categories[i]
+		}
+	}
+
+	return nil
+}
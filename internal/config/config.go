@@ -2,10 +2,20 @@ package config
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"time"
 
-	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nzb-touch/internal/api"
+	"github.com/javi11/nzb-touch/internal/category"
+	"github.com/javi11/nzb-touch/internal/feed"
+	"github.com/javi11/nzb-touch/internal/handoff"
+	"github.com/javi11/nzb-touch/internal/hook"
+	"github.com/javi11/nzb-touch/internal/nntp"
+	"github.com/javi11/nzb-touch/internal/plugin"
+	"github.com/javi11/nzb-touch/internal/reupload"
+	"github.com/javi11/nzb-touch/internal/rules"
 	"gopkg.in/yaml.v3"
 )
 
@@ -23,11 +33,91 @@ type Logger interface {
 
 type Config struct {
 	// By default the number of connections for download providers is the sum of all MaxConnections
-	DownloadWorkers   int                             `yaml:"download_workers"`
-	DownloadProviders []nntppool.UsenetProviderConfig `yaml:"download_providers"`
+	DownloadWorkers   int        `yaml:"download_workers"`
+	DownloadProviders []Provider `yaml:"download_providers"`
+	// Bytes downloaded per second by every check together, e.g. "50MB/s" (empty for unlimited)
+	MaxSpeed string `yaml:"max_speed"`
+	// How often the password files and passwords of the providers are read again while scanning or auditing, connections
+	// authenticated with a changed password are replaced (0 to disable)
+	CredentialReload time.Duration `yaml:"credential_reload"`
+	// Idle connections kept open between NZBs to avoid reconnecting and re-authenticating (0 to disable)
+	KeepWarmConnections int `yaml:"keep_warm_connections"`
+	// How segment requests are distributed among providers: "pool" (configuration order, also "failover"),
+	// "speed" (fastest first), "round_robin", "least_loaded" or "weighted" (by provider weight)
+	ProviderRouting string `yaml:"provider_routing"`
+	// How articles are checked: "body" (full download), "partial" (first bytes only), "head" (article headers),
+	// "stat" or "headers" (message-id listings of the groups, STAT for the rest)
+	CheckMode string `yaml:"check_mode"`
+	// Alias of check_mode, only one of them may be set
+	CheckMethod string `yaml:"check_method"`
+	// Limits of the header listings in headers check mode
+	HeaderCheck HeaderCheck `yaml:"header_check"`
+	// Bytes read from each article in partial check mode (default: 8192)
+	PartialReadBytes int64 `yaml:"partial_read_bytes"`
+	// Message-ids verified on one connection before returning it to the pool in STAT mode (1 disables batching)
+	StatBatchSize int `yaml:"stat_batch_size"`
+	// Days before the shortest provider retention at which an NZB is flagged for re-upload (default: 30)
+	RetentionWarningDays int `yaml:"retention_warning_days"`
+	// File keeping the bytes and requests of each provider per month when block accounts or costs are declared (default: usage.json)
+	UsageFile string `yaml:"usage_file"`
+	// Keep the usage file even when no provider declares a block account or a cost
+	UsageAccounting bool `yaml:"usage_accounting"`
+	// Alert when the error rate of a provider exceeds a threshold in scan mode
+	ProviderAlerts ProviderAlerts `yaml:"provider_alerts"`
+	// Reduce the download workers while other work keeps the host or its network busy in scan mode
+	Throttle Throttle `yaml:"throttle"`
 
 	// Scanner configuration
 	Scanner Scanner `yaml:"scanner"`
+
+	// Scans, audits, digest reports and library refreshes run at the times of cron expressions in scan mode
+	Schedules []Schedule `yaml:"schedules"`
+
+	// External executables invoked with a JSON payload around each check
+	Plugins []plugin.Config `yaml:"plugins"`
+
+	// Scripts executed with NZBTOUCH_* environment variables around each check
+	Hooks hook.Config `yaml:"hooks"`
+
+	// Rules evaluated after each check in scan mode
+	Rules []rules.Rule `yaml:"rules"`
+
+	// Actions handing NZBs that pass their check over to downstream systems in scan mode
+	SuccessActions []handoff.Action `yaml:"success_actions"`
+
+	// Per-category thresholds, reprocessing intervals and failed directories in scan mode
+	Categories []category.Category `yaml:"categories"`
+
+	// Command re-uploading the local data of failed NZBs in scan mode
+	Reupload reupload.Config `yaml:"reupload"`
+
+	// Indexer RSS/Atom feeds whose NZBs are downloaded and queued in scan mode
+	RSS feed.Config `yaml:"rss"`
+
+	// HTTP API controlling the scanner in scan mode
+	API api.Config `yaml:"api"`
+
+	// Faults injected into article requests, for testing only
+	Chaos nntp.Chaos `yaml:"chaos"`
+}
+
+// Throttle reduces the download workers while other work keeps the host or its network busy
+type Throttle struct {
+	CPUPercent  float64       `yaml:"cpu_percent"`  // CPU usage of other processes, in percent of every core, above which workers are reduced (0 to ignore)
+	Interface   string        `yaml:"interface"`    // Network interface whose traffic is watched, e.g. "eth0" (empty to ignore)
+	NetworkMbps float64       `yaml:"network_mbps"` // Traffic on the interface other than the checks, in Mbit/s, above which workers are reduced
+	MinWorkers  int           `yaml:"min_workers"`  // Download workers kept while throttled (default: 1)
+	Interval    time.Duration `yaml:"interval"`     // How often the load is sampled (default: 10s)
+}
+
+// HeaderCheck limits the header listings of the headers check mode
+type HeaderCheck struct {
+	// NZBs posted in more groups are checked with STAT (default: 2)
+	MaxGroups int `yaml:"max_groups"`
+	// Largest range of articles listed in a group, larger ones are checked with STAT (default: 500000)
+	MaxArticles int `yaml:"max_articles"`
+	// Margin around the posting dates of the NZB when looking for its articles (default: 1h)
+	DateSlack time.Duration `yaml:"date_slack"`
 }
 
 type Scanner struct {
@@ -35,23 +125,75 @@ type Scanner struct {
 	WatchDirectories  []string      `yaml:"watch_directories"`
 	ScanInterval      time.Duration `yaml:"scan_interval"` // duration string like "5m", "1h"
 	MaxFilesPerDay    int           `yaml:"max_files_per_day"`
+	BandwidthLimit    string        `yaml:"bandwidth_limit"` // Bytes the checks may download per day or week, e.g. "200GB/day" (empty for unlimited)
 	ConcurrentJobs    int           `yaml:"concurrent_jobs"`
-	DatabasePath      string        `yaml:"database_path"`      // Path to SQLite database file
-	ReprocessInterval time.Duration `yaml:"reprocess_interval"` // Duration after which to reprocess an item ("0" to disable)
-	FailedDirectory   string        `yaml:"failed_directory"`   // Directory where failed NZBs are moved to
-	CheckPercent      int           `yaml:"check_percent"`      // Percentage of NZB to download for checking (1-100, default: 100)
-	MissingPercent    int           `yaml:"missing_percent"`    // Allowed percentage of missing articles (0-100, default: 0)
+	MinConcurrentJobs int           `yaml:"min_concurrent_jobs"` // Jobs kept while the queue is idle, scaling up to concurrent_jobs (default: concurrent_jobs)
+	DatabasePath      string        `yaml:"database_path"`       // Path to SQLite database file
+	ReprocessInterval time.Duration `yaml:"reprocess_interval"`  // Duration after which to reprocess an item ("0" to disable)
+	FailedDirectory   string        `yaml:"failed_directory"`    // Directory where failed NZBs are moved to
+	MoveCollision     string        `yaml:"move_collision"`      // When a moved NZB lands on an existing file: "suffix" (default), "overwrite", "skip" or "timestamp"
+	ArchiveDirectory  string        `yaml:"archive_directory"`   // Directory where pruned queue items are archived as compressed NDJSON (default: deleted)
+	TrashDirectory    string        `yaml:"trash_directory"`     // Deleted NZBs are kept here and moves recorded, so both can be restored (default: deleted for good)
+	TrashRetention    time.Duration `yaml:"trash_retention"`     // How long trashed and moved NZBs can be restored (default: 720h)
+	CheckPercent      int           `yaml:"check_percent"`       // Percentage of NZB to download for checking (1-100, default: 100)
+	MissingPercent    int           `yaml:"missing_percent"`     // Allowed percentage of missing articles (0-100, default: 0)
+	SamplingStrategy  string        `yaml:"sampling_strategy"`   // How segments are picked when check_percent < 100 ("random" or "spread")
+	CheckTimeout      time.Duration `yaml:"check_timeout"`       // Time budget per NZB, health is computed from the sample so far once exceeded ("0" to disable)
+	IncludeSamples    bool          `yaml:"include_samples"`     // Also check sample/proof files, excluded by default
+	TagPasswords      bool          `yaml:"tag_passwords"`       // Mark password protected NZBs in the queue database
+	TouchVerified     bool          `yaml:"touch_verified"`      // Set the modification time of NZBs passing their check to the verification time
+	VerifiedXattr     string        `yaml:"verified_xattr"`      // Extended attribute set to the verification time of NZBs passing their check (empty to disable)
+	VerifiedView      string        `yaml:"verified_view"`       // Directory kept as a tree of symlinks to the NZBs whose latest check passed (empty to disable)
+	SkipDuplicates    bool          `yaml:"skip_duplicates"`     // Skip NZBs with the same content as a file already queued under another path
+	MinPostAge        time.Duration `yaml:"min_post_age"`        // Postpone the check of NZBs whose newest article is younger than this ("0" to disable)
+	OutageRetry       time.Duration `yaml:"outage_retry"`        // Pause when every provider is unreachable before checking again (default: 5m)
+	MinPar2Percent    float64       `yaml:"min_par2_percent"`    // PAR2 recovery data, as a percentage of the payload, below which parity is reported as thin (default: 5)
+	HeaderSamples     int           `yaml:"header_samples"`      // Articles at the start of each file whose headers are read into the result ("0" to disable)
+	EncryptionProbe   bool          `yaml:"encryption_probe"`    // Read the headers of the first RAR volume to detect password protected releases
+	Reports           bool          `yaml:"reports"`             // Write a JSON report of every check next to the NZB as <name>.report.json
+	ReportDirectory   string        `yaml:"report_directory"`    // Write the reports in this directory instead, mirroring the watch directories (implies reports)
+	SpillResults      bool          `yaml:"spill_results"`       // Keep the segment results and at-risk NZBs of audits in temporary files instead of memory
+	SpillDirectory    string        `yaml:"spill_directory"`     // Directory for the spill files (default: OS temporary directory)
+	TakedownDrop      float64       `yaml:"takedown_drop"`       // Health drop in percentage points between checks reported as a takedown instead of decay (default: 20)
+	IPCSocket         string        `yaml:"ipc_socket"`          // Unix socket accepting NZB paths and payloads from local tools (empty to disable)
+	IPCDirectory      string        `yaml:"ipc_directory"`       // Where NZBs uploaded over the socket or the API are saved (default: first watch directory)
+	Role              string        `yaml:"role"`                // "all" (default), "scanner" to hand the checks to checker nodes or "checker" to run the checks of a scanner node
+	ScannerNode       string        `yaml:"scanner_node"`        // API URL of the scanner node a checker node pulls its jobs from, e.g. "http://nas:8089"
+	// Usenet-drive library: check companion NZBs (nfo, jpg, strm, ...) with their main NZB and never move or delete files
+	UsenetDrive         bool     `yaml:"usenet_drive"`
+	CompanionExtensions []string `yaml:"companion_extensions"` // Inner extensions of companion NZBs (default: nfo, jpg, jpeg, png, strm, srt, sub, idx, txt)
+	// Thresholds and actions per error class (missing, corrupt, throttled, network, auth), classes not listed share missing_percent
+	ErrorClasses map[string]ErrorClass `yaml:"error_classes"`
+	// A segment counts as missing only after this many attempts report it missing
+	Confirmations Confirmations `yaml:"confirmations"`
+}
+
+// Confirmations spreads the attempts confirming a missing segment over a window
+type Confirmations struct {
+	Attempts int           `yaml:"attempts"` // Attempts reporting the segment missing (0 or 1: the first answer counts)
+	Window   time.Duration `yaml:"window"`   // Period the attempts are spread over, e.g. "10m"
+}
+
+// ErrorClass sets how failed segments of an error class are handled
+type ErrorClass struct {
+	Threshold float64 `yaml:"threshold"` // Percentage of segments of the class allowed before acting (0-100)
+	Action    string  `yaml:"action"`    // "fail" (default), "warn" or "ignore"
 }
 
 type Option func(*Config)
 
 var (
-	providerConfigDefault = nntppool.Provider{
+	providerConfigDefault = Provider{
 		MaxConnections:                 10,
 		MaxConnectionIdleTimeInSeconds: 2400,
 	}
-	downloadWorkersDefault = 10
-	scannerDefault         = Scanner{
+	downloadWorkersDefault      = 10
+	retentionWarningDaysDefault = 30
+	usageFileDefault            = "usage.json"
+	alertWindowDefault          = 30 * time.Minute
+	chaosSlowDelayDefault       = 5 * time.Second
+	headerCheckDefault          = HeaderCheck{MaxGroups: 2, MaxArticles: 500000, DateSlack: time.Hour}
+	scannerDefault              = Scanner{
 		Enabled:           false,
 		ScanInterval:      30 * time.Minute, // Default: 30 minutes
 		MaxFilesPerDay:    50,               // Default: 50 files per day
@@ -61,14 +203,20 @@ var (
 		FailedDirectory:   "",               // Default: no failed directory
 		CheckPercent:      100,              // Default: check 100% of the file
 		MissingPercent:    0,                // Default: no missing articles allowed
+		SamplingStrategy:  "random",         // Default: random segment sampling
+		CheckTimeout:      0,                // Default: no time limit
+		TakedownDrop:      20,               // Default: losing 20% of the segments at once is a takedown
 	}
 )
 
 func mergeWithDefault(config ...Config) Config {
 	if len(config) == 0 {
 		return Config{
-			DownloadProviders: []nntppool.UsenetProviderConfig{},
-			DownloadWorkers:   downloadWorkersDefault,
+			DownloadProviders:    []Provider{},
+			DownloadWorkers:      downloadWorkersDefault,
+			RetentionWarningDays: retentionWarningDaysDefault,
+			UsageFile:            usageFileDefault,
+			HeaderCheck:          headerCheckDefault,
 			Scanner: Scanner{
 				Enabled:           scannerDefault.Enabled,
 				ScanInterval:      scannerDefault.ScanInterval,
@@ -79,6 +227,9 @@ func mergeWithDefault(config ...Config) Config {
 				FailedDirectory:   scannerDefault.FailedDirectory,
 				CheckPercent:      scannerDefault.CheckPercent,
 				MissingPercent:    scannerDefault.MissingPercent,
+				SamplingStrategy:  scannerDefault.SamplingStrategy,
+				CheckTimeout:      scannerDefault.CheckTimeout,
+				TakedownDrop:      scannerDefault.TakedownDrop,
 			},
 		}
 	}
@@ -95,6 +246,14 @@ func mergeWithDefault(config ...Config) Config {
 			p.MaxConnectionIdleTimeInSeconds = providerConfigDefault.MaxConnectionIdleTimeInSeconds
 		}
 
+		for j, account := range p.Accounts {
+			if account.MaxConnections == 0 {
+				p.Accounts[j].MaxConnections = providerConfigDefault.MaxConnections
+			}
+
+			downloadWorkers += p.Accounts[j].MaxConnections
+		}
+
 		cfg.DownloadProviders[i] = p
 		downloadWorkers += p.MaxConnections
 	}
@@ -103,6 +262,53 @@ func mergeWithDefault(config ...Config) Config {
 		cfg.DownloadWorkers = downloadWorkers
 	}
 
+	// Never keep more warm connections than the providers allow
+	if cfg.KeepWarmConnections > downloadWorkers {
+		cfg.KeepWarmConnections = downloadWorkers
+	}
+
+	if cfg.KeepWarmConnections < 0 {
+		cfg.KeepWarmConnections = 0
+	}
+
+	if cfg.RetentionWarningDays <= 0 {
+		cfg.RetentionWarningDays = retentionWarningDaysDefault
+	}
+
+	if cfg.UsageFile == "" {
+		cfg.UsageFile = usageFileDefault
+	}
+
+	if cfg.ProviderAlerts.Window <= 0 {
+		cfg.ProviderAlerts.Window = alertWindowDefault
+	}
+
+	if cfg.Chaos.SlowDelay <= 0 {
+		cfg.Chaos.SlowDelay = chaosSlowDelayDefault
+	}
+
+	if cfg.HeaderCheck.MaxGroups <= 0 {
+		cfg.HeaderCheck.MaxGroups = headerCheckDefault.MaxGroups
+	}
+
+	if cfg.HeaderCheck.MaxArticles <= 0 {
+		cfg.HeaderCheck.MaxArticles = headerCheckDefault.MaxArticles
+	}
+
+	if cfg.HeaderCheck.DateSlack <= 0 {
+		cfg.HeaderCheck.DateSlack = headerCheckDefault.DateSlack
+	}
+
+	for i, s := range cfg.Schedules {
+		if s.Name == "" {
+			cfg.Schedules[i].Name = s.Task
+		}
+
+		if s.Format == "" {
+			cfg.Schedules[i].Format = "json"
+		}
+	}
+
 	// Apply scanner defaults if not set
 	if cfg.Scanner.ScanInterval == 0 {
 		cfg.Scanner.ScanInterval = scannerDefault.ScanInterval
@@ -132,6 +338,14 @@ func mergeWithDefault(config ...Config) Config {
 		cfg.Scanner.MissingPercent = scannerDefault.MissingPercent
 	}
 
+	if cfg.Scanner.SamplingStrategy == "" {
+		cfg.Scanner.SamplingStrategy = scannerDefault.SamplingStrategy
+	}
+
+	if cfg.Scanner.TakedownDrop <= 0 {
+		cfg.Scanner.TakedownDrop = scannerDefault.TakedownDrop
+	}
+
 	return cfg
 }
 
@@ -141,14 +355,57 @@ func NewFromFile(path string) (Config, error) {
 		return Config{}, err
 	}
 
+	return parse(path, data)
+}
+
+// parse validates the configuration read from path and merges it with the defaults
+func parse(path string, data []byte) (Config, error) {
 	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := validateProviders(cfg.DownloadProviders); err != nil {
+		return Config{}, err
+	}
+
+	if err := resolveCheckMethod(&cfg); err != nil {
+		return Config{}, err
+	}
+
+	if err := readPasswordFiles(cfg.DownloadProviders); err != nil {
+		return Config{}, err
+	}
+
+	if err := validateRanges(cfg); err != nil {
+		return Config{}, err
+	}
+
+	if err := validateSchedules(cfg.Schedules); err != nil {
+		return Config{}, err
+	}
+
+	if err := validateAPI(cfg.API); err != nil {
 		return Config{}, err
 	}
 
 	return mergeWithDefault(cfg), nil
 }
 
+// resolveCheckMethod moves check_method, an alias, into check_mode
+func resolveCheckMethod(cfg *Config) error {
+	if cfg.CheckMethod == "" {
+		return nil
+	}
+
+	if cfg.CheckMode != "" {
+		return errors.New("check_method is an alias of check_mode, set only one of them")
+	}
+
+	cfg.CheckMode, cfg.CheckMethod = cfg.CheckMethod, ""
+	return nil
+}
+
 // GetScanInterval returns the scan interval duration
 func (c *Config) GetScanInterval() (time.Duration, error) {
 	return c.Scanner.ScanInterval, nil
@@ -0,0 +1,439 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nzb-touch/internal/nntp"
+	"github.com/javi11/nzb-touch/internal/schedule"
+	"github.com/javi11/nzb-touch/internal/usage"
+)
+
+// Provider roles
+const (
+	RolePrimary = "primary"
+	RoleBackup  = "backup"
+)
+
+// Provider is the configuration of a Usenet provider
+type Provider struct {
+	Host                           string   `yaml:"host"`
+	Port                           int      `yaml:"port"`
+	Username                       string   `yaml:"username"`
+	Password                       string   `yaml:"password"`
+	PasswordFile                   string   `yaml:"password_file"`
+	TLS                            bool     `yaml:"tls"`
+	InsecureSSL                    bool     `yaml:"insecure_ssl"`
+	MaxConnections                 int      `yaml:"max_connections"`
+	MaxConnectionIdleTimeInSeconds int      `yaml:"max_connection_idle_time_in_seconds"`
+	MaxConnectionTTLInSeconds      int      `yaml:"max_connection_ttl_in_seconds"`
+	IsBackupProvider               bool     `yaml:"is_backup_provider"`
+	VerifyCapabilities             []string `yaml:"verify_capabilities"`
+
+	// "primary" (default) or "backup": backup providers are never used on the first
+	// pass and only consulted when the primary providers fail a segment
+	Role string `yaml:"role"`
+	// Primary providers of the lowest tier are asked first, those of the next tier only for the
+	// segments none of them has (default: 0)
+	Tier int `yaml:"tier"`
+
+	// Host name sent with SNI and verified against the certificate when host is an IP or a load balancer
+	TLSServerName string `yaml:"tls_server_name"`
+	// Upgrade plain text connections with STARTTLS when the server supports it, e.g. on port 119
+	StartTLS bool `yaml:"starttls"`
+	// Negotiate COMPRESS DEFLATE with the server to save bandwidth, servers not supporting it are used uncompressed
+	Compress bool `yaml:"compress"`
+	// Further accounts on the same server pooled with this one and counted as a single provider
+	Accounts []ProviderAccount `yaml:"accounts"`
+	// Daily time windows in local time during which this provider is used, e.g. "02:00-06:00" (default: always)
+	ActiveHours []string `yaml:"active_hours"`
+	// Newsgroup patterns this provider carries, e.g. "alt.binaries.*" (default: every group)
+	Groups []string `yaml:"groups"`
+	// Interval at which idle connections are pinged in scan mode, dead ones are closed (0 to disable)
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+	// Share of requests sent to this provider relative to the others with weighted routing (default: 1)
+	Weight int `yaml:"weight"`
+	// Maximum articles requested per second from this provider (0 for unlimited)
+	MaxRequestsPerSecond float64 `yaml:"max_requests_per_second"`
+	// Bytes downloaded per second from this provider, e.g. "20MB/s" (empty for unlimited)
+	MaxSpeed string `yaml:"max_speed"`
+	// Days articles are kept by this provider (0 if unknown)
+	RetentionDays int `yaml:"retention_days"`
+	// Times a request failing with an error other than a missing article is retried on this provider (0 for none)
+	Retries int `yaml:"retries"`
+	// Wait time between retries on this provider
+	RetryDelay time.Duration `yaml:"retry_delay"`
+	// Move on to the next provider once the retries are exhausted instead of failing the segment
+	SkipOnErrors bool `yaml:"skip_on_errors"`
+	// GB left on this block account, the downloaded bytes are counted against it (0 if not a block account)
+	BlockGB float64 `yaml:"block_gb"`
+	// Remaining GB below which a warning is logged (default: 10% of block_gb)
+	BlockWarnGB float64 `yaml:"block_warn_gb"`
+	// Remaining GB below which the provider is no longer used (0 to keep using it)
+	BlockStopGB float64 `yaml:"block_stop_gb"`
+	// Price of every GB downloaded from this provider, for the usage report
+	CostPerGB float64 `yaml:"cost_per_gb"`
+	// Subscription price of this provider per month, for the usage report
+	CostPerMonth float64 `yaml:"cost_per_month"`
+}
+
+// ProviderAlerts is the error rate above which a provider raises an alert
+type ProviderAlerts struct {
+	// Percentage of failed requests raising the alert (0 to disable)
+	ErrorRate float64 `yaml:"error_rate"`
+	// Period over which the error rate is computed (default: 30m)
+	Window time.Duration `yaml:"window"`
+}
+
+// ProviderAccount is an extra account on the server of a provider
+type ProviderAccount struct {
+	Username       string `yaml:"username"`
+	Password       string `yaml:"password"`
+	PasswordFile   string `yaml:"password_file"`
+	MaxConnections int    `yaml:"max_connections"`
+}
+
+// ID returns the identifier used by the connection pool for this provider
+func (p Provider) ID() string {
+	return fmt.Sprintf("%s_%s", p.Host, p.Username)
+}
+
+// IsBackup reports whether the provider is only consulted when the primary providers fail a segment
+func (p Provider) IsBackup() bool {
+	return p.IsBackupProvider || p.Role == RoleBackup
+}
+
+// validate checks the provider settings the connection pool does not
+func (p Provider) validate() error {
+	switch p.Role {
+	case "", RolePrimary, RoleBackup:
+	default:
+		return fmt.Errorf("provider %s: unknown role %q, expected primary or backup", p.Host, p.Role)
+	}
+
+	if p.Role == RolePrimary && p.IsBackupProvider {
+		return fmt.Errorf("provider %s: role primary conflicts with is_backup_provider", p.Host)
+	}
+
+	if p.StartTLS && p.TLS {
+		return fmt.Errorf("provider %s: starttls upgrades plain text connections, it conflicts with tls", p.Host)
+	}
+
+	if p.TLSServerName != "" && !p.TLS && !p.StartTLS {
+		return fmt.Errorf("provider %s: tls_server_name requires tls or starttls", p.Host)
+	}
+
+	if p.Weight < 0 {
+		return fmt.Errorf("provider %s: weight must not be negative", p.Host)
+	}
+
+	if p.Tier < 0 {
+		return fmt.Errorf("provider %s: tier must not be negative", p.Host)
+	}
+
+	if p.CostPerGB < 0 || p.CostPerMonth < 0 {
+		return fmt.Errorf("provider %s: cost_per_gb and cost_per_month must not be negative", p.Host)
+	}
+
+	if p.Password != "" && p.PasswordFile != "" {
+		return fmt.Errorf("provider %s: password conflicts with password_file", p.Host)
+	}
+
+	for _, account := range p.Accounts {
+		if account.Username == "" || account.Username == p.Username {
+			return fmt.Errorf("provider %s: every account needs its own username", p.Host)
+		}
+
+		if account.Password != "" && account.PasswordFile != "" {
+			return fmt.Errorf("provider %s: account %s: password conflicts with password_file", p.Host, account.Username)
+		}
+	}
+
+	if _, err := schedule.ParseAll(p.ActiveHours); err != nil {
+		return fmt.Errorf("provider %s: %w", p.Host, err)
+	}
+
+	for _, pattern := range p.Groups {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("provider %s: invalid group pattern %q: %w", p.Host, pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// validateProviders checks every provider and that at least one is used on the first pass
+func validateProviders(providers []Provider) error {
+	primaries := 0
+	for _, p := range providers {
+		if err := p.validate(); err != nil {
+			return err
+		}
+
+		if !p.IsBackup() {
+			primaries++
+		}
+	}
+
+	if len(providers) > 0 && primaries == 0 {
+		return fmt.Errorf("every provider is a backup provider, at least one must have the primary role")
+	}
+
+	return nil
+}
+
+// readPasswordFiles sets the password of every provider and account with a
+// password file to the content of the file, e.g. a Docker secret
+func readPasswordFiles(providers []Provider) error {
+	for i := range providers {
+		p := &providers[i]
+		if err := readPasswordFile(p.PasswordFile, &p.Password); err != nil {
+			return fmt.Errorf("provider %s: %w", p.Host, err)
+		}
+
+		for j := range p.Accounts {
+			account := &p.Accounts[j]
+			if err := readPasswordFile(account.PasswordFile, &account.Password); err != nil {
+				return fmt.Errorf("provider %s: account %s: %w", p.Host, account.Username, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readPasswordFile reads a password from the first line of a file, nothing
+// when the file name is empty
+func readPasswordFile(name string, password *string) error {
+	if name == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("failed to read password_file: %w", err)
+	}
+
+	*password, _, _ = strings.Cut(string(data), "\n")
+	*password = strings.TrimSuffix(*password, "\r")
+	return nil
+}
+
+// PoolConfig converts the provider to the connection pool configuration
+func (p Provider) PoolConfig() nntppool.UsenetProviderConfig {
+	return nntppool.UsenetProviderConfig{
+		Host:                           p.Host,
+		Port:                           p.Port,
+		Username:                       p.Username,
+		Password:                       p.Password,
+		TLS:                            p.TLS,
+		InsecureSSL:                    p.InsecureSSL,
+		MaxConnections:                 p.MaxConnections,
+		MaxConnectionIdleTimeInSeconds: p.MaxConnectionIdleTimeInSeconds,
+		MaxConnectionTTLInSeconds:      p.MaxConnectionTTLInSeconds,
+		IsBackupProvider:               p.IsBackup(),
+		VerifyCapabilities:             p.VerifyCapabilities,
+	}
+}
+
+// accountProviders returns the provider settings of each extra account
+func (p Provider) accountProviders() []Provider {
+	providers := make([]Provider, len(p.Accounts))
+	for i, account := range p.Accounts {
+		providers[i] = p
+		providers[i].Username = account.Username
+		providers[i].Password = account.Password
+		providers[i].MaxConnections = account.MaxConnections
+		providers[i].Accounts = nil
+	}
+
+	return providers
+}
+
+// PoolProviders returns the connection pool configuration of every provider and account
+func (c *Config) PoolProviders() []nntppool.UsenetProviderConfig {
+	providers := make([]nntppool.UsenetProviderConfig, 0, len(c.DownloadProviders))
+	for _, p := range c.DownloadProviders {
+		providers = append(providers, p.PoolConfig())
+		for _, account := range p.accountProviders() {
+			providers = append(providers, account.PoolConfig())
+		}
+	}
+
+	return providers
+}
+
+// ProviderAccounts returns the provider ID every extra account is counted under keyed by the account pool ID
+func (c *Config) ProviderAccounts() map[string]string {
+	aliases := make(map[string]string)
+	for _, p := range c.DownloadProviders {
+		for _, account := range p.accountProviders() {
+			aliases[account.ID()] = p.ID()
+		}
+	}
+
+	return aliases
+}
+
+// Endpoints returns the protocol settings of every server with non-default ones keyed by host:port
+func (c *Config) Endpoints() map[string]nntp.Endpoint {
+	endpoints := make(map[string]nntp.Endpoint)
+	for _, p := range c.DownloadProviders {
+		if !p.Compress && !p.StartTLS && p.TLSServerName == "" {
+			continue
+		}
+
+		address := nntp.Address(p.Host, p.Port)
+		endpoint := endpoints[address]
+		endpoint.Compress = endpoint.Compress || p.Compress
+		endpoint.StartTLS = endpoint.StartTLS || p.StartTLS
+		endpoint.InsecureSSL = endpoint.InsecureSSL || p.InsecureSSL
+		if p.TLSServerName != "" {
+			endpoint.ServerName = p.TLSServerName
+		}
+		endpoints[address] = endpoint
+	}
+
+	return endpoints
+}
+
+// ProviderRateLimits returns the request rate limit of every rate limited provider keyed by provider ID
+func (c *Config) ProviderRateLimits() map[string]float64 {
+	limits := make(map[string]float64)
+	for _, p := range c.DownloadProviders {
+		if p.MaxRequestsPerSecond > 0 {
+			limits[p.ID()] = p.MaxRequestsPerSecond
+		}
+	}
+
+	return limits
+}
+
+// ProviderWeights returns the routing weight of every provider with an explicit weight keyed by provider ID
+func (c *Config) ProviderWeights() map[string]int {
+	weights := make(map[string]int)
+	for _, p := range c.DownloadProviders {
+		if p.Weight > 0 {
+			weights[p.ID()] = p.Weight
+		}
+	}
+
+	return weights
+}
+
+// ProviderTiers returns the tier of every primary provider keyed by provider ID, nil when they all share one
+func (c *Config) ProviderTiers() map[string]int {
+	tiers := make(map[string]int)
+	distinct := make(map[int]bool)
+	for _, p := range c.DownloadProviders {
+		if !p.IsBackup() {
+			tiers[p.ID()] = p.Tier
+			distinct[p.Tier] = true
+		}
+	}
+
+	if len(distinct) < 2 {
+		return nil
+	}
+
+	return tiers
+}
+
+// ProviderGroups returns the newsgroup patterns of every provider restricted to some groups keyed by provider ID
+func (c *Config) ProviderGroups() map[string][]string {
+	groups := make(map[string][]string)
+	for _, p := range c.DownloadProviders {
+		if len(p.Groups) > 0 {
+			groups[p.ID()] = p.Groups
+		}
+	}
+
+	return groups
+}
+
+// ProviderSchedules returns the daily time windows of every scheduled provider keyed by provider ID
+func (c *Config) ProviderSchedules() map[string][]schedule.Window {
+	schedules := make(map[string][]schedule.Window)
+	for _, p := range c.DownloadProviders {
+		// The windows were validated when the configuration was loaded
+		if windows, err := schedule.ParseAll(p.ActiveHours); err == nil && len(windows) > 0 {
+			schedules[p.ID()] = windows
+		}
+	}
+
+	return schedules
+}
+
+// ProviderHealthChecks returns the connection health check interval of every provider with one keyed by provider ID
+func (c *Config) ProviderHealthChecks() map[string]time.Duration {
+	intervals := make(map[string]time.Duration)
+	for _, p := range c.DownloadProviders {
+		if p.HealthCheckInterval <= 0 {
+			continue
+		}
+
+		intervals[p.ID()] = p.HealthCheckInterval
+		for _, account := range p.accountProviders() {
+			intervals[account.ID()] = p.HealthCheckInterval
+		}
+	}
+
+	return intervals
+}
+
+// BlockAccounts returns the usage accounts of the providers declared as block accounts
+func (c *Config) BlockAccounts() []usage.Account {
+	var accounts []usage.Account
+	for _, p := range c.DownloadProviders {
+		if p.BlockGB <= 0 {
+			continue
+		}
+
+		warn := p.BlockWarnGB
+		if warn <= 0 {
+			warn = p.BlockGB / 10
+		}
+
+		accounts = append(accounts, usage.Account{
+			ProviderID: p.ID(),
+			Balance:    int64(p.BlockGB * usage.GB),
+			Warn:       int64(warn * usage.GB),
+			Stop:       int64(p.BlockStopGB * usage.GB),
+		})
+	}
+
+	return accounts
+}
+
+// ProviderCosts returns the cost of the providers declaring one keyed by provider ID
+func (c *Config) ProviderCosts() map[string]usage.Cost {
+	costs := make(map[string]usage.Cost)
+	for _, p := range c.DownloadProviders {
+		if p.CostPerGB > 0 || p.CostPerMonth > 0 {
+			costs[p.ID()] = usage.Cost{PerGB: p.CostPerGB, PerMonth: p.CostPerMonth}
+		}
+	}
+
+	return costs
+}
+
+// ShortestRetention returns the smallest retention among providers declaring one, 0 if none does
+func (c *Config) ShortestRetention() time.Duration {
+	var shortest time.Duration
+	for _, p := range c.DownloadProviders {
+		if p.RetentionDays <= 0 {
+			continue
+		}
+
+		retention := time.Duration(p.RetentionDays) * 24 * time.Hour
+		if shortest == 0 || retention < shortest {
+			shortest = retention
+		}
+	}
+
+	return shortest
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/schedule"
+)
+
+// Tasks run by the schedules in scan mode
+const (
+	TaskScan    = "scan"    // Scan the watch directories
+	TaskAudit   = "audit"   // Audit the watch directories and write a report
+	TaskDigest  = "digest"  // Summarize the checks since the previous digest
+	TaskRefresh = "refresh" // Re-check every known item regardless of the reprocess interval
+)
+
+// Schedule runs a task at the times matching a cron expression in scan mode
+type Schedule struct {
+	Name string `yaml:"name"` // Names the reports written (default: the task)
+	Task string `yaml:"task"` // "scan", "audit", "digest" or "refresh"
+	// Minute, hour, day of month, month and day of week in local time, e.g. "0 3 * * sun#1"
+	Cron string `yaml:"cron"`
+	// Directory receiving the audit and digest reports (default: only a summary is logged)
+	Output string `yaml:"output"`
+	// Format of the reports, "text" or "json" (default: "json")
+	Format string `yaml:"format"`
+	// Audits: percentage of segments checked, overriding scanner.check_percent
+	CheckPercent int `yaml:"check_percent"`
+	// Refreshes: average download rate of the refresh checks in bytes per second (0 = no cap)
+	BytesPerSecond int64 `yaml:"bytes_per_second"`
+}
+
+// validateSchedules checks the task, cron expression and report settings of every schedule
+func validateSchedules(schedules []Schedule) error {
+	for _, s := range schedules {
+		name := s.Name
+		if name == "" {
+			name = s.Task
+		}
+
+		switch s.Task {
+		case TaskScan, TaskAudit, TaskDigest, TaskRefresh:
+		default:
+			return fmt.Errorf("schedule %s: unknown task %q, expected scan, audit, digest or refresh", name, s.Task)
+		}
+
+		cron, err := schedule.ParseCron(s.Cron)
+		if err != nil {
+			return fmt.Errorf("schedule %s: %w", name, err)
+		}
+		if cron.Next(time.Now()).IsZero() {
+			return fmt.Errorf("schedule %s: cron expression %q never matches", name, s.Cron)
+		}
+
+		switch s.Format {
+		case "", "text", "json":
+		default:
+			return fmt.Errorf("schedule %s: unknown format %q, expected text or json", name, s.Format)
+		}
+
+		if s.CheckPercent < 0 || s.CheckPercent > 100 {
+			return fmt.Errorf("schedule %s: check_percent must be between 0 and 100, got %d", name, s.CheckPercent)
+		}
+		if s.CheckPercent > 0 && s.Task != TaskAudit {
+			return fmt.Errorf("schedule %s: check_percent only applies to audits", name)
+		}
+
+		if s.BytesPerSecond < 0 {
+			return fmt.Errorf("schedule %s: bytes_per_second must not be negative, got %d", name, s.BytesPerSecond)
+		}
+		if s.BytesPerSecond > 0 && s.Task != TaskRefresh {
+			return fmt.Errorf("schedule %s: bytes_per_second only applies to refreshes", name)
+		}
+	}
+
+	return nil
+}
+
+// ScanSchedules returns the cron expressions of the scheduled scans, which
+// replace scanner.scan_interval when there is any
+func (c *Config) ScanSchedules() []schedule.Cron {
+	var crons []schedule.Cron
+	for _, s := range c.Schedules {
+		if s.Task != TaskScan {
+			continue
+		}
+
+		if cron, err := schedule.ParseCron(s.Cron); err == nil {
+			crons = append(crons, cron)
+		}
+	}
+
+	return crons
+}
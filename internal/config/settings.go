@@ -0,0 +1,361 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/api"
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// SettingsFile edits the settings of the web UI in a configuration file.
+// Only the keys of the settings that changed are written, the comments and
+// every other key of the file are kept.
+type SettingsFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewSettingsFile edits the settings of the configuration file at path
+func NewSettingsFile(path string) *SettingsFile {
+	return &SettingsFile{path: path}
+}
+
+// Settings returns the settings as written in the file, without defaults
+func (f *SettingsFile) Settings() (*api.Settings, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, cfg, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	s := cfg.Scanner
+	settings := &api.Settings{
+		DownloadWorkers:   cfg.DownloadWorkers,
+		Providers:         make([]api.ProviderSettings, len(cfg.DownloadProviders)),
+		WatchDirectories:  s.WatchDirectories,
+		ScanInterval:      durationSetting(s.ScanInterval),
+		ReprocessInterval: durationSetting(s.ReprocessInterval),
+		ConcurrentJobs:    s.ConcurrentJobs,
+		MaxFilesPerDay:    s.MaxFilesPerDay,
+		CheckPercent:      s.CheckPercent,
+		MissingPercent:    s.MissingPercent,
+	}
+	for i, p := range cfg.DownloadProviders {
+		settings.Providers[i] = providerSettings(i, p)
+	}
+
+	return settings, nil
+}
+
+// SaveSettings writes the settings that changed to the file, once the
+// configuration they make is valid
+func (f *SettingsFile) SaveSettings(settings *api.Settings) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	doc, cfg, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	root, err := documentMapping(doc)
+	if err != nil {
+		return err
+	}
+
+	if err := setProviders(root, cfg.DownloadProviders, settings.Providers); err != nil {
+		return errcode.Wrap(errcode.InvalidRequest, err)
+	}
+
+	setInt(root, "download_workers", cfg.DownloadWorkers, settings.DownloadWorkers)
+
+	scanner := mappingValue(root, "scanner")
+	if scanner == nil {
+		scanner = &yaml.Node{Kind: yaml.MappingNode}
+		setValue(root, "scanner", scanner)
+	}
+
+	s := cfg.Scanner
+	if !slices.Equal(s.WatchDirectories, settings.WatchDirectories) {
+		if len(settings.WatchDirectories) == 0 {
+			deleteKey(scanner, "watch_directories")
+		} else {
+			setValue(scanner, "watch_directories", encodeNode(settings.WatchDirectories))
+		}
+	}
+	setInt(scanner, "concurrent_jobs", s.ConcurrentJobs, settings.ConcurrentJobs)
+	setInt(scanner, "max_files_per_day", s.MaxFilesPerDay, settings.MaxFilesPerDay)
+	setInt(scanner, "check_percent", s.CheckPercent, settings.CheckPercent)
+	setInt(scanner, "missing_percent", s.MissingPercent, settings.MissingPercent)
+	if err := setDuration(scanner, "scan_interval", s.ScanInterval, settings.ScanInterval); err != nil {
+		return errcode.Wrap(errcode.InvalidRequest, err)
+	}
+	if err := setDuration(scanner, "reprocess_interval", s.ReprocessInterval, settings.ReprocessInterval); err != nil {
+		return errcode.Wrap(errcode.InvalidRequest, err)
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode the configuration: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to encode the configuration: %w", err)
+	}
+
+	if _, err := parse(f.path, out.Bytes()); err != nil {
+		return errcode.Wrap(errcode.InvalidRequest, err)
+	}
+
+	perm := os.FileMode(0o600)
+	if info, err := os.Stat(f.path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	if err := fsutil.WriteFile(f.path, out.Bytes(), perm); err != nil {
+		return fmt.Errorf("failed to write the configuration: %w", err)
+	}
+
+	return nil
+}
+
+// read returns the document of the file and the configuration written in
+// it, without defaults
+func (f *SettingsFile) read() (*yaml.Node, Config, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, Config{}, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, Config{}, fmt.Errorf("%s: %w", f.path, err)
+	}
+
+	var cfg Config
+	if doc.Kind != 0 {
+		if err := doc.Decode(&cfg); err != nil {
+			return nil, Config{}, fmt.Errorf("%s: %w", f.path, err)
+		}
+	}
+
+	return &doc, cfg, nil
+}
+
+// providerSettings returns the settings of the provider at index i
+func providerSettings(i int, p Provider) api.ProviderSettings {
+	role := ""
+	if p.IsBackup() {
+		role = RoleBackup
+	}
+
+	return api.ProviderSettings{
+		Index:          &i,
+		Host:           p.Host,
+		Port:           p.Port,
+		Username:       p.Username,
+		HasPassword:    p.Password != "" || p.PasswordFile != "",
+		TLS:            p.TLS,
+		MaxConnections: p.MaxConnections,
+		Role:           role,
+		Tier:           p.Tier,
+	}
+}
+
+// setProviders replaces the download providers with those of the settings,
+// keeping the other keys of the providers they were read from
+func setProviders(root *yaml.Node, current []Provider, settings []api.ProviderSettings) error {
+	var previous []*yaml.Node
+	if seq := mappingValue(root, "download_providers"); seq != nil && seq.Kind == yaml.SequenceNode {
+		previous = seq.Content
+	}
+
+	used := make(map[int]bool)
+	nodes := make([]*yaml.Node, 0, len(settings))
+	for n, p := range settings {
+		if p.Host == "" {
+			return fmt.Errorf("provider %d: host is required", n+1)
+		}
+
+		var cur Provider
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		if p.Index != nil {
+			i := *p.Index
+			if i < 0 || i >= len(current) || i >= len(previous) || used[i] {
+				return fmt.Errorf("provider %s: unknown provider index %d", p.Host, i)
+			}
+			used[i] = true
+			cur, node = current[i], previous[i]
+		}
+
+		setString(node, "host", cur.Host, p.Host)
+		setInt(node, "port", cur.Port, p.Port)
+		setString(node, "username", cur.Username, p.Username)
+		switch {
+		case p.Password != "" && p.Password != cur.Password:
+			setValue(node, "password", encodeNode(p.Password))
+			deleteKey(node, "password_file")
+		case p.Password == "" && (p.Host != cur.Host || p.Port != cur.Port):
+			// The stored password is not sent to a server it was not set for
+			deleteKey(node, "password")
+			deleteKey(node, "password_file")
+		}
+		if p.TLS != cur.TLS {
+			setValue(node, "tls", encodeNode(p.TLS))
+		}
+		setInt(node, "max_connections", cur.MaxConnections, p.MaxConnections)
+		setInt(node, "tier", cur.Tier, p.Tier)
+
+		switch p.Role {
+		case "", RolePrimary:
+			if cur.IsBackup() {
+				deleteKey(node, "is_backup_provider")
+				deleteKey(node, "role")
+			}
+		case RoleBackup:
+			if !cur.IsBackup() {
+				setValue(node, "role", encodeNode(RoleBackup))
+			}
+		default:
+			return fmt.Errorf("provider %s: unknown role %q, expected primary or backup", p.Host, p.Role)
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 0 {
+		deleteKey(root, "download_providers")
+		return nil
+	}
+
+	setValue(root, "download_providers", &yaml.Node{Kind: yaml.SequenceNode, Content: nodes})
+	return nil
+}
+
+// durationSetting formats a duration setting, empty when unset
+func durationSetting(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+
+	return d.String()
+}
+
+// documentMapping returns the top level mapping of a document, created when
+// the document is empty
+func documentMapping(doc *yaml.Node) (*yaml.Node, error) {
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+	}
+
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("the configuration is not a YAML mapping")
+	}
+
+	return root, nil
+}
+
+// mappingValue returns the value of a key of a mapping node, nil when absent
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// setValue sets the value of a key of a mapping node, appending the key when
+// absent
+func setValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			// Keep the comments of the value replaced
+			value.LineComment, value.HeadComment = m.Content[i+1].LineComment, m.Content[i+1].HeadComment
+			m.Content[i+1] = value
+			return
+		}
+	}
+
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// deleteKey removes a key of a mapping node
+func deleteKey(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = slices.Delete(m.Content, i, i+2)
+			return
+		}
+	}
+}
+
+// setInt sets a numeric key that changed, removing it when it goes back to
+// zero, the value of an unset key
+func setInt(m *yaml.Node, key string, current, value int) {
+	switch {
+	case value == current:
+	case value == 0:
+		deleteKey(m, key)
+	default:
+		setValue(m, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(value)})
+	}
+}
+
+// setString sets a string key that changed, removing it when emptied
+func setString(m *yaml.Node, key string, current, value string) {
+	switch {
+	case value == current:
+	case value == "":
+		deleteKey(m, key)
+	default:
+		setValue(m, key, encodeNode(value))
+	}
+}
+
+// setDuration sets a duration key that changed, as written in the
+// settings, removing it when emptied
+func setDuration(m *yaml.Node, key string, current time.Duration, value string) error {
+	var d time.Duration
+	if value != "" {
+		var err error
+		if d, err = time.ParseDuration(value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	switch {
+	case d == current:
+	case value == "":
+		deleteKey(m, key)
+	default:
+		setValue(m, key, encodeNode(value))
+	}
+
+	return nil
+}
+
+// encodeNode returns the node of a value
+func encodeNode(v any) *yaml.Node {
+	var n yaml.Node
+	_ = n.Encode(v)
+	return &n
+}
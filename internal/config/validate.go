@@ -0,0 +1,226 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/api"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// validateRanges checks the numeric and duration settings as written in the
+// file, before the defaults replace the unset ones
+func validateRanges(cfg Config) error {
+	s := cfg.Scanner
+
+	var errs []error
+	percent := func(key string, value, low float64) {
+		if value < low || value > 100 {
+			errs = append(errs, fmt.Errorf("%s must be between %g and 100, got %g", key, low, value))
+		}
+	}
+	notNegative := func(key string, value int) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %d", key, value))
+		}
+	}
+	duration := func(key string, value time.Duration) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %s", key, value))
+		}
+	}
+
+	// 0 leaves check_percent to its default
+	if s.CheckPercent != 0 {
+		percent("scanner.check_percent", float64(s.CheckPercent), 1)
+	}
+	percent("scanner.missing_percent", float64(s.MissingPercent), 0)
+	percent("scanner.takedown_drop", s.TakedownDrop, 0)
+	percent("scanner.min_par2_percent", s.MinPar2Percent, 0)
+	percent("provider_alerts.error_rate", cfg.ProviderAlerts.ErrorRate, 0)
+	percent("throttle.cpu_percent", cfg.Throttle.CPUPercent, 0)
+	percent("chaos.missing_percent", cfg.Chaos.MissingPercent, 0)
+	percent("chaos.error_percent", cfg.Chaos.ErrorPercent, 0)
+	percent("chaos.slow_percent", cfg.Chaos.SlowPercent, 0)
+	percent("chaos.drop_percent", cfg.Chaos.DropPercent, 0)
+
+	notNegative("download_workers", cfg.DownloadWorkers)
+	notNegative("keep_warm_connections", cfg.KeepWarmConnections)
+	notNegative("scanner.max_files_per_day", s.MaxFilesPerDay)
+	notNegative("scanner.concurrent_jobs", s.ConcurrentJobs)
+	notNegative("scanner.min_concurrent_jobs", s.MinConcurrentJobs)
+	notNegative("scanner.header_samples", s.HeaderSamples)
+	notNegative("scanner.confirmations.attempts", s.Confirmations.Attempts)
+	notNegative("header_check.max_groups", cfg.HeaderCheck.MaxGroups)
+	notNegative("header_check.max_articles", cfg.HeaderCheck.MaxArticles)
+	notNegative("throttle.min_workers", cfg.Throttle.MinWorkers)
+
+	if s.ConcurrentJobs > 0 && s.MinConcurrentJobs > s.ConcurrentJobs {
+		errs = append(errs, fmt.Errorf("scanner.min_concurrent_jobs (%d) must not exceed scanner.concurrent_jobs (%d)", s.MinConcurrentJobs, s.ConcurrentJobs))
+	}
+
+	duration("credential_reload", cfg.CredentialReload)
+	duration("provider_alerts.window", cfg.ProviderAlerts.Window)
+	duration("scanner.scan_interval", s.ScanInterval)
+	duration("scanner.reprocess_interval", s.ReprocessInterval)
+	duration("scanner.check_timeout", s.CheckTimeout)
+	duration("scanner.min_post_age", s.MinPostAge)
+	duration("scanner.outage_retry", s.OutageRetry)
+	duration("scanner.trash_retention", s.TrashRetention)
+	duration("scanner.confirmations.window", s.Confirmations.Window)
+	duration("chaos.slow_delay", cfg.Chaos.SlowDelay)
+	duration("header_check.date_slack", cfg.HeaderCheck.DateSlack)
+	duration("throttle.interval", cfg.Throttle.Interval)
+
+	if cfg.Throttle.NetworkMbps < 0 {
+		errs = append(errs, fmt.Errorf("throttle.network_mbps must not be negative, got %g", cfg.Throttle.NetworkMbps))
+	}
+
+	for _, class := range slices.Sorted(maps.Keys(s.ErrorClasses)) {
+		percent("scanner.error_classes."+class+".threshold", s.ErrorClasses[class].Threshold, 0)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateAPI refuses a web UI without a token, it edits the configuration
+// file and its provider credentials
+func validateAPI(cfg api.Config) error {
+	if cfg.UI && cfg.Token == "" {
+		return errors.New("api.ui requires api.token, the web UI edits the configuration")
+	}
+
+	return nil
+}
+
+// ValidateScanner checks the directories of the scanner against the file
+// system: watch directories must exist and must not overlap, the directories
+// written to must be writable, and failed, trashed or linked NZBs must not be
+// placed back into a watch directory where they would be picked up again.
+func (c Config) ValidateScanner() error {
+	s := c.Scanner
+
+	var errs []error
+
+	var watch, watchNames []string
+	for _, dir := range s.WatchDirectories {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("scanner.watch_directories: %s: %w", dir, err))
+			continue
+		}
+
+		info, err := os.Stat(abs)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("scanner.watch_directories: %w", err))
+			continue
+		case !info.IsDir():
+			errs = append(errs, fmt.Errorf("scanner.watch_directories: %s is not a directory", dir))
+			continue
+		}
+
+		for i, other := range watch {
+			if within(abs, other) || within(other, abs) {
+				errs = append(errs, fmt.Errorf("scanner.watch_directories: %s and %s overlap", watchNames[i], dir))
+			}
+		}
+		watch, watchNames = append(watch, abs), append(watchNames, dir)
+	}
+
+	failed := []setting{{"scanner.failed_directory", s.FailedDirectory}}
+	for _, cat := range c.Categories {
+		failed = append(failed, setting{"categories." + cat.Name + ".failed_directory", cat.FailedDirectory})
+	}
+	failed = append(failed,
+		setting{"scanner.trash_directory", s.TrashDirectory},
+		setting{"scanner.verified_view", s.VerifiedView},
+	)
+
+	for _, f := range failed {
+		if f.dir == "" {
+			continue
+		}
+
+		abs, err := filepath.Abs(f.dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", f.key, f.dir, err))
+			continue
+		}
+
+		for i, w := range watch {
+			if within(abs, w) {
+				errs = append(errs, fmt.Errorf("%s: %s is inside the watch directory %s, the NZBs placed there would be scanned again", f.key, f.dir, watchNames[i]))
+			}
+		}
+	}
+
+	writable := append(failed,
+		setting{"scanner.archive_directory", s.ArchiveDirectory},
+		setting{"scanner.spill_directory", s.SpillDirectory},
+		setting{"scanner.ipc_directory", s.IPCDirectory},
+		setting{"scanner.database_path", filepath.Dir(s.DatabasePath)},
+	)
+	for _, sched := range c.Schedules {
+		writable = append(writable, setting{"schedules." + sched.Name + ".output", sched.Output})
+	}
+
+	for _, w := range writable {
+		if w.dir == "" {
+			continue
+		}
+
+		if err := checkWritable(w.dir); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", w.key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// setting is a directory setting and the key naming it in the file
+type setting struct {
+	key string
+	dir string
+}
+
+// within reports whether path is dir or lies below it, whatever their spelling
+func within(path, dir string) bool {
+	_, ok := fsutil.RelativePath(dir, path)
+
+	return ok
+}
+
+// checkWritable verifies that files can be created in dir. A directory not
+// created yet is checked through its closest existing parent, the scanner
+// creates it on first use.
+func checkWritable(dir string) error {
+	for probe := filepath.Clean(dir); ; probe = filepath.Dir(probe) {
+		info, err := os.Stat(probe)
+		if errors.Is(err, os.ErrNotExist) && filepath.Dir(probe) != probe {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", probe)
+		}
+
+		f, err := os.CreateTemp(probe, ".nzbtouch-*")
+		if err != nil {
+			return fmt.Errorf("%s is not writable: %w", probe, err)
+		}
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+
+		return nil
+	}
+}
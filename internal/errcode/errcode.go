@@ -0,0 +1,106 @@
+// Package errcode assigns stable machine-readable codes to failures, so
+// plugins, hook scripts and API clients can branch on the kind of a failure
+// without parsing its message. Codes are never renamed once released.
+package errcode
+
+import (
+	"context"
+	"errors"
+)
+
+// Code identifies a kind of failure
+type Code string
+
+const (
+	// MissingThreshold is a check failed by missing articles beyond the allowed percentage
+	MissingThreshold Code = "E_MISSING_THRESHOLD"
+	// CorruptThreshold is a check failed by corrupt articles beyond the allowed percentage
+	CorruptThreshold Code = "E_CORRUPT_THRESHOLD"
+	// ProviderThrottled is a check failed by providers refusing requests, e.g. too many connections
+	ProviderThrottled Code = "E_PROVIDER_THROTTLED"
+	// Network is a check failed by requests lost to DNS, connect, TLS or connection failures
+	Network Code = "E_NETWORK"
+	// ProviderAuth is a check failed by providers rejecting the credentials
+	ProviderAuth Code = "E_PROVIDER_AUTH"
+	// ProvidersDown is a check interrupted because no provider could be reached, it runs again later
+	ProvidersDown Code = "E_PROVIDERS_DOWN"
+	// NZBUnreadable is an NZB file that could not be opened
+	NZBUnreadable Code = "E_NZB_UNREADABLE"
+	// Parse is an NZB file that is not valid NZB XML
+	Parse Code = "E_PARSE"
+	// TimeBudget is a check whose time budget ran out before any segment was checked
+	TimeBudget Code = "E_TIME_BUDGET"
+	// Canceled is a check interrupted by a shutdown
+	Canceled Code = "E_CANCELED"
+	// InvalidOptions is a check refused because of invalid check options
+	InvalidOptions Code = "E_INVALID_OPTIONS"
+	// InvalidRequest is an API request or submission that is malformed or names an invalid NZB
+	InvalidRequest Code = "E_INVALID_REQUEST"
+	// Unauthorized is an API request without the configured token
+	Unauthorized Code = "E_UNAUTHORIZED"
+	// AlreadyQueued is a submission of an NZB the queue already holds
+	AlreadyQueued Code = "E_ALREADY_QUEUED"
+	// FileExists is an upload named like a file already in the submit directory
+	FileExists Code = "E_FILE_EXISTS"
+	// UploadsDisabled is an upload while no submit directory is configured
+	UploadsDisabled Code = "E_UPLOADS_DISABLED"
+	// JobsDisabled is a job request to a scanner not handing its checks to checker nodes
+	JobsDisabled Code = "E_JOBS_DISABLED"
+	// UnknownJob is a job that is not claimed, e.g. taken back after its lease expired
+	UnknownJob Code = "E_UNKNOWN_JOB"
+	// NotQueued is a queue request naming an NZB the queue does not hold
+	NotQueued Code = "E_NOT_QUEUED"
+	// CheckInProgress is a queue request on an NZB being checked
+	CheckInProgress Code = "E_CHECK_IN_PROGRESS"
+	// SettingsDisabled is a settings request to a scanner started without a configuration file
+	SettingsDisabled Code = "E_SETTINGS_DISABLED"
+	// Unknown is any failure without a code
+	Unknown Code = "E_UNKNOWN"
+)
+
+// codedError attaches a code to an error without changing its message
+type codedError struct {
+	code Code
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// Wrap attaches a code to err, nil stays nil
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &codedError{code: code, err: err}
+}
+
+// New returns an error with a message and a code
+func New(code Code, msg string) error {
+	return Wrap(code, errors.New(msg))
+}
+
+// Of returns the code of err: the outermost code attached to it, Canceled
+// for interrupted work, Unknown otherwise and empty for nil
+func Of(err error) Code {
+	if err == nil {
+		return ""
+	}
+
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return Canceled
+	}
+
+	return Unknown
+}
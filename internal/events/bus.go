@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Type identifies the kind of an event
+type Type string
+
+const (
+	// NZBQueued is published when a new NZB file is added to the queue
+	NZBQueued Type = "nzb_queued"
+	// CheckStarted is published before an NZB is checked
+	CheckStarted Type = "check_started"
+	// CheckFinished is published after an NZB was checked, Err is set when the check failed
+	CheckFinished Type = "check_finished"
+	// ProviderDegraded is published when a provider leaves the active state
+	ProviderDegraded Type = "provider_degraded"
+	// ProviderRecovered is published when a degraded provider becomes active again
+	ProviderRecovered Type = "provider_recovered"
+	// QuotaReached is published when the daily processing limit is reached
+	QuotaReached Type = "quota_reached"
+	// BandwidthExhausted is published when the checks downloaded the bandwidth budget of the period
+	BandwidthExhausted Type = "bandwidth_exhausted"
+	// NZBDegraded is published when a previously healthy NZB falls below the
+	// allowed missing segments, State is "takedown" or "decay"
+	NZBDegraded Type = "nzb_degraded"
+	// RetentionWarning is published when the oldest articles of an NZB are close to the provider retention
+	RetentionWarning Type = "retention_warning"
+	// ProviderAlert is published when the error rate of a provider exceeds the alert threshold
+	ProviderAlert Type = "provider_alert"
+	// ProviderAlertCleared is published when the error rate of an alerting provider drops below the threshold
+	ProviderAlertCleared Type = "provider_alert_cleared"
+	// ProvidersDown is published when every provider is unreachable and the scanner pauses, Err is the network error
+	ProvidersDown Type = "providers_down"
+)
+
+// Event is a notification published on the bus, only the fields relevant
+// to the event type are set
+type Event struct {
+	Type     Type
+	Time     time.Time
+	Path     string // NZB file path
+	Result   any    // Check result for CheckFinished
+	Err      error  // Check error for CheckFinished
+	Provider string // Provider ID for provider events
+	State    string // Provider state for provider events
+}
+
+// Handler receives published events
+type Handler func(ctx context.Context, e Event)
+
+type subscription struct {
+	id      int
+	types   map[Type]bool
+	handler Handler
+}
+
+// Bus is a synchronous publish/subscribe event bus. Handlers are invoked in
+// subscription order on the publisher goroutine and must not block for long.
+type Bus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   []subscription
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers a handler for the given event types, or for every event
+// when no types are given. The returned function removes the subscription.
+func (b *Bus) Subscribe(handler Handler, types ...Type) func() {
+	if b == nil {
+		return func() {}
+	}
+
+	sub := subscription{handler: handler}
+	if len(types) > 0 {
+		sub.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.nextID++
+	sub.id = b.nextID
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		for i, s := range b.subs {
+			if s.id == sub.id {
+				b.subs = append(b.subs[:i], b.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish delivers the event to every matching subscriber
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if b == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	subs := make([]subscription, len(b.subs))
+	copy(subs, b.subs)
+	b.mu.RUnlock()
+
+	for _, s := range subs {
+		if s.types != nil && !s.types[e.Type] {
+			continue
+		}
+
+		s.handler(ctx, e)
+	}
+}
@@ -0,0 +1,283 @@
+// Package feed polls RSS and Atom indexer feeds and downloads the NZBs of
+// the items matching the configured filters
+package feed
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var intervalDefault = 15 * time.Minute
+
+// Feed is an RSS or Atom feed of an indexer
+type Feed struct {
+	Name       string   `yaml:"name"`
+	URL        string   `yaml:"url"`
+	Include    string   `yaml:"include"`      // Only download items whose title matches this regular expression
+	Exclude    string   `yaml:"exclude"`      // Skip items whose title matches this regular expression
+	Categories []string `yaml:"categories"`   // Only download items in one of these categories (case-insensitive)
+	MinSizeMB  int64    `yaml:"min_size_mb"`  // Skip items smaller than this when the feed reports sizes (0 for no limit)
+	MaxSizeMB  int64    `yaml:"max_size_mb"`  // Skip items larger than this when the feed reports sizes (0 for no limit)
+	MaxAgeDays int      `yaml:"max_age_days"` // Skip items published longer ago when the feed reports dates (0 for no limit)
+}
+
+// Config describes the feeds polled in scan mode
+type Config struct {
+	DownloadDirectory string        `yaml:"download_directory"` // NZBs are saved in a subdirectory per feed
+	Interval          time.Duration `yaml:"interval"`           // Time between polls (default: 15m)
+	Feeds             []Feed        `yaml:"feeds"`
+	Newznab           []Indexer     `yaml:"newznab"` // Newznab APIs polled with saved searches
+}
+
+// sources returns the configured feeds followed by the saved Newznab searches
+func (c Config) sources() []Feed {
+	feeds := append([]Feed(nil), c.Feeds...)
+	for _, ix := range c.Newznab {
+		feeds = append(feeds, ix.feeds()...)
+	}
+
+	return feeds
+}
+
+// Validate checks the feed configuration
+func Validate(cfg Config) error {
+	for _, ix := range cfg.Newznab {
+		if err := validateIndexer(ix); err != nil {
+			return fmt.Errorf("rss: %w", err)
+		}
+	}
+
+	feeds := cfg.sources()
+	if len(feeds) == 0 {
+		return nil
+	}
+
+	if cfg.DownloadDirectory == "" {
+		return errors.New("rss: download_directory is required")
+	}
+
+	names := make(map[string]bool, len(feeds))
+	for _, f := range feeds {
+		if f.Name == "" || f.URL == "" {
+			return errors.New("rss: feeds require a name and a url")
+		}
+
+		if names[f.Name] {
+			return fmt.Errorf("rss: duplicate feed name %q", f.Name)
+		}
+		names[f.Name] = true
+
+		if _, err := newFilter(f); err != nil {
+			return fmt.Errorf("rss: feed %s: %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Item is an entry of a feed pointing to an NZB
+type Item struct {
+	Title      string
+	GUID       string
+	URL        string // Where the NZB is downloaded from
+	Categories []string
+	Size       int64 // Size of the release in bytes, 0 when unknown
+	Published  time.Time
+}
+
+// filter selects the feed items to download
+type filter struct {
+	include    *regexp.Regexp
+	exclude    *regexp.Regexp
+	categories []string
+	minSize    int64
+	maxSize    int64
+	maxAge     time.Duration
+}
+
+func newFilter(f Feed) (*filter, error) {
+	flt := &filter{
+		categories: f.Categories,
+		minSize:    f.MinSizeMB * 1024 * 1024,
+		maxSize:    f.MaxSizeMB * 1024 * 1024,
+		maxAge:     time.Duration(f.MaxAgeDays) * 24 * time.Hour,
+	}
+
+	var err error
+	if f.Include != "" {
+		if flt.include, err = regexp.Compile(f.Include); err != nil {
+			return nil, fmt.Errorf("invalid include pattern: %w", err)
+		}
+	}
+
+	if f.Exclude != "" {
+		if flt.exclude, err = regexp.Compile(f.Exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+		}
+	}
+
+	return flt, nil
+}
+
+// match reports whether an item passes the filter
+func (f *filter) match(item Item) bool {
+	if f.include != nil && !f.include.MatchString(item.Title) {
+		return false
+	}
+
+	if f.exclude != nil && f.exclude.MatchString(item.Title) {
+		return false
+	}
+
+	if len(f.categories) > 0 && !hasCategory(item.Categories, f.categories) {
+		return false
+	}
+
+	if f.maxAge > 0 && !item.Published.IsZero() && time.Since(item.Published) > f.maxAge {
+		return false
+	}
+
+	if item.Size > 0 {
+		if f.minSize > 0 && item.Size < f.minSize {
+			return false
+		}
+
+		if f.maxSize > 0 && item.Size > f.maxSize {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasCategory reports whether one of the item categories is wanted
+func hasCategory(categories, wanted []string) bool {
+	for _, c := range categories {
+		for _, w := range wanted {
+			if strings.EqualFold(strings.TrimSpace(c), strings.TrimSpace(w)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// document covers the RSS 2.0 and Atom elements used to find NZBs. Newznab
+// indexers add their attributes as <newznab:attr name="..." value="..."/>.
+type document struct {
+	Items []struct {
+		Title      string   `xml:"title"`
+		GUID       string   `xml:"guid"`
+		Link       string   `xml:"link"`
+		PubDate    string   `xml:"pubDate"`
+		Categories []string `xml:"category"`
+		Enclosure  struct {
+			URL    string `xml:"url,attr"`
+			Length int64  `xml:"length,attr"`
+		} `xml:"enclosure"`
+		Attrs []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"attr"`
+	} `xml:"channel>item"`
+	Entries []struct {
+		Title     string `xml:"title"`
+		ID        string `xml:"id"`
+		Updated   string `xml:"updated"`
+		Published string `xml:"published"`
+		Links     []struct {
+			Href   string `xml:"href,attr"`
+			Rel    string `xml:"rel,attr"`
+			Length int64  `xml:"length,attr"`
+		} `xml:"link"`
+		Categories []struct {
+			Term  string `xml:"term,attr"`
+			Label string `xml:"label,attr"`
+		} `xml:"category"`
+	} `xml:"entry"`
+}
+
+// Parse reads the items of an RSS 2.0 or Atom document
+func Parse(r io.Reader) ([]Item, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid feed: %w", err)
+	}
+
+	items := make([]Item, 0, len(doc.Items)+len(doc.Entries))
+	for _, it := range doc.Items {
+		item := Item{
+			Title:      strings.TrimSpace(it.Title),
+			GUID:       strings.TrimSpace(it.GUID),
+			URL:        strings.TrimSpace(it.Enclosure.URL),
+			Categories: it.Categories,
+			Size:       it.Enclosure.Length,
+			Published:  parseTime(it.PubDate),
+		}
+		if item.URL == "" {
+			item.URL = strings.TrimSpace(it.Link)
+		}
+
+		for _, attr := range it.Attrs {
+			switch attr.Name {
+			case "size":
+				if size, err := strconv.ParseInt(attr.Value, 10, 64); err == nil {
+					item.Size = size
+				}
+			case "category":
+				item.Categories = append(item.Categories, attr.Value)
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	for _, e := range doc.Entries {
+		item := Item{
+			Title:     strings.TrimSpace(e.Title),
+			GUID:      strings.TrimSpace(e.ID),
+			Published: parseTime(e.Published),
+		}
+		if item.Published.IsZero() {
+			item.Published = parseTime(e.Updated)
+		}
+
+		// Prefer the enclosure, the NZB itself, over the alternate page
+		for _, l := range e.Links {
+			if l.Rel == "enclosure" || (item.URL == "" && (l.Rel == "" || l.Rel == "alternate")) {
+				item.URL = l.Href
+				item.Size = l.Length
+			}
+		}
+
+		for _, c := range e.Categories {
+			item.Categories = append(item.Categories, c.Term)
+			if c.Label != "" {
+				item.Categories = append(item.Categories, c.Label)
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// parseTime parses RSS and Atom dates, zero when the date is missing or invalid
+func parseTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
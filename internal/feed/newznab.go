@@ -0,0 +1,102 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Indexer is a Newznab compatible API polled with saved searches
+type Indexer struct {
+	Name     string   `yaml:"name"`
+	URL      string   `yaml:"url"` // Base URL of the API, e.g. https://api.indexer.example.com
+	APIKey   string   `yaml:"api_key"`
+	Searches []Search `yaml:"searches"`
+}
+
+// Search is a saved Newznab search
+type Search struct {
+	Name       string `yaml:"name"`
+	Query      string `yaml:"query"`        // Search terms, empty for the latest releases
+	Categories []int  `yaml:"categories"`   // Newznab category ids, e.g. 2040 for HD movies
+	MaxAgeDays int    `yaml:"max_age_days"` // Skip releases posted longer ago (0 for no limit)
+	Include    string `yaml:"include"`
+	Exclude    string `yaml:"exclude"`
+	MinSizeMB  int64  `yaml:"min_size_mb"`
+	MaxSizeMB  int64  `yaml:"max_size_mb"`
+}
+
+// validateIndexer checks an indexer and its searches
+func validateIndexer(ix Indexer) error {
+	if ix.Name == "" || ix.URL == "" || ix.APIKey == "" {
+		return errors.New("newznab indexers require a name, a url and an api_key")
+	}
+
+	if _, err := url.Parse(ix.URL); err != nil {
+		return fmt.Errorf("indexer %s: invalid url: %w", ix.Name, err)
+	}
+
+	if len(ix.Searches) == 0 {
+		return fmt.Errorf("indexer %s: at least one search is required", ix.Name)
+	}
+
+	for _, s := range ix.Searches {
+		if s.Name == "" {
+			return fmt.Errorf("indexer %s: searches require a name", ix.Name)
+		}
+	}
+
+	return nil
+}
+
+// feeds turns the saved searches of the indexer into feeds of the search API
+func (ix Indexer) feeds() []Feed {
+	feeds := make([]Feed, 0, len(ix.Searches))
+	for _, s := range ix.Searches {
+		feeds = append(feeds, Feed{
+			Name:       ix.Name + "-" + s.Name,
+			URL:        ix.searchURL(s),
+			Include:    s.Include,
+			Exclude:    s.Exclude,
+			MinSizeMB:  s.MinSizeMB,
+			MaxSizeMB:  s.MaxSizeMB,
+			MaxAgeDays: s.MaxAgeDays,
+		})
+	}
+
+	return feeds
+}
+
+// searchURL returns the API request of a saved search
+func (ix Indexer) searchURL(s Search) string {
+	u, _ := url.Parse(ix.URL)
+	if !strings.HasSuffix(u.Path, "/api") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/api"
+	}
+
+	q := u.Query()
+	q.Set("t", "search")
+	q.Set("apikey", ix.APIKey)
+	q.Set("extended", "1")
+	q.Set("o", "xml")
+	if s.Query != "" {
+		q.Set("q", s.Query)
+	}
+
+	if len(s.Categories) > 0 {
+		cats := make([]string, len(s.Categories))
+		for i, c := range s.Categories {
+			cats[i] = strconv.Itoa(c)
+		}
+		q.Set("cat", strings.Join(cats, ","))
+	}
+
+	if s.MaxAgeDays > 0 {
+		q.Set("maxage", strconv.Itoa(s.MaxAgeDays))
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
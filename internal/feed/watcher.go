@@ -0,0 +1,195 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// maxNZBSize bounds downloaded NZBs so a misbehaving indexer cannot fill the disk
+var maxNZBSize int64 = 64 * 1024 * 1024
+
+// unsafeName matches the characters replaced in file names built from titles
+var unsafeName = regexp.MustCompile(`[^\w.()\[\] -]+`)
+
+// Watcher polls the configured feeds and downloads the NZBs of new matching items
+type Watcher struct {
+	cfg     Config
+	feeds   []Feed
+	filters map[string]*filter
+	client  *http.Client
+}
+
+// New creates a watcher, it returns nil when no feed is configured. The
+// configuration must have been validated.
+func New(cfg Config) *Watcher {
+	feeds := cfg.sources()
+	if len(feeds) == 0 {
+		return nil
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = intervalDefault
+	}
+
+	w := &Watcher{
+		cfg:     cfg,
+		feeds:   feeds,
+		filters: make(map[string]*filter, len(feeds)),
+		client:  &http.Client{Timeout: time.Minute},
+	}
+	for _, f := range feeds {
+		w.filters[f.Name], _ = newFilter(f)
+	}
+
+	return w
+}
+
+// Run polls every feed until ctx is done. known reports whether an NZB was
+// already downloaded, found is called with the path of every new NZB.
+func (w *Watcher) Run(ctx context.Context, known func(path string) bool, found func(ctx context.Context, path string)) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, f := range w.feeds {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err := w.poll(ctx, f, known, found); err != nil {
+				slog.ErrorContext(ctx, "Failed to poll feed", "feed", f.Name, "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll downloads the NZBs of the new items of a feed matching its filter
+func (w *Watcher) poll(ctx context.Context, f Feed, known func(string) bool, found func(context.Context, string)) error {
+	body, err := w.get(ctx, f.URL)
+	if err != nil {
+		return err
+	}
+
+	items, err := Parse(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(w.cfg.DownloadDirectory, fileName(f.Name, f.Name))
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if item.URL == "" || !w.filters[f.Name].match(item) {
+			continue
+		}
+
+		path := filepath.Join(dir, fileName(item.Title, item.GUID+item.URL)+".nzb")
+		if known(path) {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		if err := w.download(ctx, item.URL, path); err != nil {
+			slog.WarnContext(ctx, "Failed to download NZB from feed", "feed", f.Name, "title", item.Title, "error", err)
+			continue
+		}
+
+		slog.InfoContext(ctx, "Downloaded NZB from feed", "feed", f.Name, "title", item.Title, "path", path)
+		found(ctx, path)
+	}
+
+	return nil
+}
+
+// download saves the NZB at rawURL to path
+func (w *Watcher) download(ctx context.Context, rawURL, path string) error {
+	data, err := w.get(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Contains(data, []byte("<nzb")) {
+		return fmt.Errorf("the response is not an NZB")
+	}
+
+	return fsutil.WriteFile(path, data, 0o644)
+}
+
+// get fetches rawURL, failing on non 2xx responses
+func (w *Watcher) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "nzb-touch")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// Do not log the URL, it usually contains the indexer API key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxNZBSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > maxNZBSize {
+		return nil, fmt.Errorf("response larger than %d bytes", maxNZBSize)
+	}
+
+	return data, nil
+}
+
+// fileName turns a title into a safe file name, falling back to a hash of
+// key when nothing usable is left
+func fileName(title, key string) string {
+	name := strings.Trim(unsafeName.ReplaceAllString(title, "_"), " ._")
+	if len(name) > 200 {
+		name = name[:200]
+	}
+
+	if name == "" {
+		sum := sha1.Sum([]byte(key))
+		name = hex.EncodeToString(sum[:8])
+	}
+
+	return name
+}
@@ -0,0 +1,182 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// windowsPaths is set where paths take the Windows forms: drive letters, UNC
+// shares and extended-length prefixes
+var windowsPaths = runtime.GOOS == "windows"
+
+// FoldCase is set where file systems ignore case by default, the same file
+// may then be seen with several spellings of its path
+var FoldCase = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// Extended-length prefixes lifting the 260 characters limit of Windows paths
+const (
+	extendedPrefix    = `\\?\`
+	extendedUNCPrefix = `\\?\UNC\`
+)
+
+// CleanPath cleans path like filepath.Clean. On Windows the extended-length
+// prefix is dropped, "\\?\UNC\server\share" becoming "\\server\share", and
+// the drive letter is upper-cased, so the spellings of a path only differ by
+// case.
+func CleanPath(path string) string {
+	if !windowsPaths {
+		return filepath.Clean(path)
+	}
+
+	path = filepath.FromSlash(path)
+	switch {
+	case strings.HasPrefix(path, extendedUNCPrefix):
+		path = `\\` + path[len(extendedUNCPrefix):]
+	case strings.HasPrefix(path, extendedPrefix) && hasDriveLetter(path[len(extendedPrefix):]):
+		path = path[len(extendedPrefix):]
+	}
+
+	path = filepath.Clean(path)
+	if hasDriveLetter(path) {
+		path = strings.ToUpper(path[:1]) + path[1:]
+	}
+
+	return path
+}
+
+// LongPath returns the extended-length form of path on Windows, absolute and
+// prefixed with "\\?\", so files deep below it can be reached whatever the
+// length of their path. Elsewhere path is returned as is.
+func LongPath(path string) string {
+	if !windowsPaths {
+		return path
+	}
+
+	abs, err := filepath.Abs(CleanPath(path))
+	if err != nil {
+		return path
+	}
+
+	switch {
+	case strings.HasPrefix(abs, `\\`):
+		return extendedUNCPrefix + abs[2:]
+	case hasDriveLetter(abs):
+		return extendedPrefix + abs
+	default:
+		return path
+	}
+}
+
+// RelativePath returns path relative to base when it is base or lies below
+// it. Both are cleaned with CleanPath and made absolute, and their elements
+// are compared in Unicode NFC form, ignoring case where file systems do.
+func RelativePath(base, path string) (string, bool) {
+	absBase, err := filepath.Abs(CleanPath(base))
+	if err != nil {
+		return "", false
+	}
+
+	absPath, err := filepath.Abs(CleanPath(path))
+	if err != nil {
+		return "", false
+	}
+
+	baseParts, pathParts := splitPath(absBase), splitPath(absPath)
+	if len(pathParts) < len(baseParts) {
+		return "", false
+	}
+
+	for i, part := range baseParts {
+		if !samePathElement(part, pathParts[i]) {
+			return "", false
+		}
+	}
+
+	if len(pathParts) == len(baseParts) {
+		return ".", true
+	}
+
+	return filepath.Join(pathParts[len(baseParts):]...), true
+}
+
+// DirectoryKeys returns the keys a relative directory is rolled up into: the
+// "/" separated directory and each of its ancestors, outermost first, cut
+// depth levels deep. A root directory, "." or "", and a depth below 1 have
+// none.
+func DirectoryKeys(dir string, depth int) []string {
+	dir = filepath.ToSlash(dir)
+	if depth <= 0 || dir == "" || dir == "." {
+		return nil
+	}
+
+	parts := strings.Split(dir, "/")
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+
+	keys := make([]string, len(parts))
+	for i := range parts {
+		keys[i] = strings.Join(parts[:i+1], "/")
+	}
+
+	return keys
+}
+
+// DiskPath returns the spelling of path on disk. Paths are stored in Unicode
+// NFC form while a name copied from macOS may still be decomposed, NFD, on
+// disk: the names that differ between both forms are then looked up in their
+// directory. path is returned as is when it exists.
+func DiskPath(path string) string {
+	if _, err := os.Lstat(path); err == nil {
+		return path
+	}
+
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	if dir == path {
+		return path
+	}
+
+	dir = DiskPath(dir)
+	if norm.NFC.String(name) != norm.NFD.String(name) {
+		if entries, err := os.ReadDir(dir); err == nil {
+			want := norm.NFC.String(name)
+			for _, entry := range entries {
+				if norm.NFC.String(entry.Name()) == want {
+					return filepath.Join(dir, entry.Name())
+				}
+			}
+		}
+	}
+
+	return filepath.Join(dir, name)
+}
+
+// splitPath splits a clean absolute path into its elements, the root being
+// the first one
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimSuffix(path, string(filepath.Separator)), string(filepath.Separator))
+}
+
+// samePathElement reports whether two path elements name the same entry
+func samePathElement(a, b string) bool {
+	a, b = norm.NFC.String(a), norm.NFC.String(b)
+	if FoldCase {
+		return strings.EqualFold(a, b)
+	}
+
+	return a == b
+}
+
+// hasDriveLetter reports whether path starts with a drive letter, e.g. "c:"
+func hasDriveLetter(path string) bool {
+	if len(path) < 2 || path[1] != ':' {
+		return false
+	}
+
+	c := path[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
@@ -0,0 +1,176 @@
+// Package fsutil provides the file operations used to relocate and write
+// NZB files without leaving truncated copies behind
+package fsutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Move relocates src to dst. A rename is used when both are on the same
+// filesystem; otherwise the file is copied with WriteFile semantics and the
+// source is only removed once the copy has been verified. The source is kept
+// when it changed during the copy, e.g. because it was still being written,
+// since the copy may then be truncated. On Windows long paths are supported,
+// src may be spelled in another Unicode form than on disk.
+func Move(src, dst string) error {
+	src, dst = LongPath(DiskPath(src)), LongPath(dst)
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(src, dst); err == nil {
+		return syncDir(filepath.Dir(dst))
+	}
+
+	before, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if err := Copy(src, dst); err != nil {
+		return err
+	}
+
+	after, err := os.Stat(src)
+	if err == nil && (after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime())) {
+		err = fmt.Errorf("%s changed while it was copied to %s", src, dst)
+	}
+
+	if err == nil {
+		err = os.Remove(src)
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		// The source is already gone, the verified copy is all that is left
+		return nil
+	}
+
+	if err != nil {
+		// Never leave the file in both places
+		_ = os.Remove(dst)
+		return err
+	}
+
+	return nil
+}
+
+// Copy copies src to dst through a temporary file in the destination
+// directory that is fsynced, verified against the source size and checksum
+// and then atomically renamed, so dst is either complete or absent
+func Copy(src, dst string) error {
+	src, dst = LongPath(DiskPath(src)), LongPath(dst)
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	srcHash := sha256.New()
+
+	return writeAtomic(dst, info.Mode().Perm(), io.TeeReader(in, srcHash), info.Size(), srcHash)
+}
+
+// WriteFile atomically writes data to path: the data is written to a
+// temporary file, fsynced, verified and renamed over path
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	path = LongPath(path)
+
+	hash := sha256.New()
+	hash.Write(data)
+
+	return writeAtomic(path, perm, bytes.NewReader(data), int64(len(data)), hash)
+}
+
+// writeAtomic writes r to a temporary file next to dst, checks that size
+// bytes with the checksum accumulated by srcHash landed on disk and renames it to dst.
+// srcHash must have seen every byte of r once r is drained.
+func writeAtomic(dst string, perm os.FileMode, r io.Reader, size int64, srcHash interface{ Sum([]byte) []byte }) (err error) {
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	written, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+
+	if written != size {
+		return fmt.Errorf("short write to %s: %d of %d bytes", tmpPath, written, size)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+
+	// Read the data back to make sure what is on disk matches the source
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	dstHash := sha256.New()
+	if _, err = io.Copy(dstHash, tmp); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(dstHash.Sum(nil), srcHash.Sum(nil)) {
+		return errors.New("checksum mismatch after writing " + tmpPath)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmpPath, dst); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(dst))
+}
+
+// syncDir flushes a directory entry change (create, rename) to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+
+	// Some filesystems do not support syncing directories, the rename is done anyway
+	_ = d.Sync()
+
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd
+
+package fsutil
+
+import "errors"
+
+// SetXattr is not supported on this platform
+func SetXattr(path, name, value string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,10 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package fsutil
+
+import "golang.org/x/sys/unix"
+
+// SetXattr sets the extended attribute name of path to value
+func SetXattr(path, name, value string) error {
+	return unix.Setxattr(path, name, []byte(value), 0)
+}
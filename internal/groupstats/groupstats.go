@@ -0,0 +1,101 @@
+// Package groupstats aggregates article availability by newsgroup and provider
+package groupstats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+// Availability is the outcome of the articles of a newsgroup requested from a provider
+type Availability struct {
+	Group        string  `json:"group"`
+	Provider     string  `json:"provider"`
+	Checked      int     `json:"checked"`
+	Missing      int     `json:"missing"`
+	Availability float64 `json:"availability"` // Percentage of checked articles found
+}
+
+type key struct {
+	group    string
+	provider string
+}
+
+// Collector counts found and missing articles per newsgroup and provider.
+// It is safe for concurrent use and a nil collector ignores every record.
+type Collector struct {
+	mu    sync.Mutex
+	stats map[key]*Availability
+}
+
+// New creates an empty collector
+func New() *Collector {
+	return &Collector{stats: make(map[key]*Availability)}
+}
+
+// Record accounts for an article of the given newsgroups requested from a provider
+func (c *Collector) Record(groups []string, provider string, missing bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, group := range groups {
+		k := key{group: group, provider: provider}
+		a := c.stats[k]
+		if a == nil {
+			a = &Availability{Group: group, Provider: provider}
+			c.stats[k] = a
+		}
+
+		a.Checked++
+		if missing {
+			a.Missing++
+		}
+		a.Availability = float64(a.Checked-a.Missing) * 100 / float64(a.Checked)
+	}
+}
+
+// Snapshot returns the statistics sorted by availability, worst first
+func (c *Collector) Snapshot() []Availability {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]Availability, 0, len(c.stats))
+	for _, a := range c.stats {
+		out = append(out, *a)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Availability != out[j].Availability {
+			return out[i].Availability < out[j].Availability
+		}
+		if out[i].Group != out[j].Group {
+			return out[i].Group < out[j].Group
+		}
+
+		return out[i].Provider < out[j].Provider
+	})
+
+	return out
+}
+
+// WriteText writes the statistics as a table, worst availability first
+func WriteText(w io.Writer, stats []Availability) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NEWSGROUP\tPROVIDER\tCHECKED\tMISSING\tAVAILABILITY")
+	for _, a := range stats {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f%%\n", a.Group, a.Provider, a.Checked, a.Missing, a.Availability)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,133 @@
+// Package handoff describes the actions handing NZBs that passed their check
+// over to downstream systems: copies, ownership, permissions, modification
+// times and commands
+package handoff
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// ActionType identifies what a post-success action does
+type ActionType string
+
+const (
+	ActionCopy    ActionType = "copy"    // Copy the NZB into Target, the following actions apply to the copy
+	ActionChown   ActionType = "chown"   // Change the owner to Owner
+	ActionChmod   ActionType = "chmod"   // Change the permissions to Mode
+	ActionMtime   ActionType = "mtime"   // Set the modification time to Time
+	ActionCommand ActionType = "command" // Run the Target command with NZBTOUCH_* variables
+)
+
+// Times accepted by the mtime action
+const (
+	TimeNow    = "now"    // Time of the check
+	TimePosted = "posted" // Post date of the oldest file of the NZB, the check time when unknown
+)
+
+// Action is applied to every NZB passing its check, in order
+type Action struct {
+	Type   ActionType `yaml:"type"`
+	Target string     `yaml:"target"` // Directory for copy, command for command
+	Owner  string     `yaml:"owner"`  // "user", "user:group", ":group" or numeric ids for chown
+	Mode   string     `yaml:"mode"`   // Octal permissions for chmod, e.g. "0644"
+	Time   string     `yaml:"time"`   // "now" (default) or "posted" for mtime
+}
+
+// Validate checks the actions for unknown types, missing targets, unknown
+// users or groups and malformed modes
+func Validate(actions []Action) error {
+	for i, a := range actions {
+		switch a.Type {
+		case ActionCopy, ActionCommand:
+			if a.Target == "" {
+				return fmt.Errorf("success_actions #%d: action %s requires a target", i+1, a.Type)
+			}
+		case ActionChown:
+			if _, _, err := ParseOwner(a.Owner); err != nil {
+				return fmt.Errorf("success_actions #%d: %w", i+1, err)
+			}
+		case ActionChmod:
+			if _, err := ParseMode(a.Mode); err != nil {
+				return fmt.Errorf("success_actions #%d: %w", i+1, err)
+			}
+		case ActionMtime:
+			switch a.Time {
+			case "", TimeNow, TimePosted:
+			default:
+				return fmt.Errorf("success_actions #%d: unknown time %q, expected now or posted", i+1, a.Time)
+			}
+		default:
+			return fmt.Errorf("success_actions #%d: unknown action %q", i+1, a.Type)
+		}
+	}
+
+	return nil
+}
+
+// ParseOwner resolves "user", "user:group" or ":group", by name or numeric
+// id, to the ids passed to os.Chown. An id left out is -1, unchanged.
+func ParseOwner(owner string) (int, int, error) {
+	userName, groupName, _ := strings.Cut(owner, ":")
+	if userName == "" && groupName == "" {
+		return 0, 0, fmt.Errorf("chown requires an owner, e.g. \"media:media\"")
+	}
+
+	uid, gid := -1, -1
+	if userName != "" {
+		id, err := lookupID(userName, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("unknown user %q: %w", userName, err)
+		}
+		uid = id
+	}
+
+	if groupName != "" {
+		id, err := lookupID(groupName, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("unknown group %q: %w", groupName, err)
+		}
+		gid = id
+	}
+
+	return uid, gid, nil
+}
+
+// lookupID returns a numeric id as is and resolves a name with lookup
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(id)
+}
+
+// ParseMode parses octal permissions such as "0644" or "640"
+func ParseMode(mode string) (os.FileMode, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0o777 {
+		return 0, fmt.Errorf("invalid mode %q, expected octal permissions such as 0644", mode)
+	}
+
+	return os.FileMode(perm), nil
+}
@@ -0,0 +1,221 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event identifies when a hook script runs
+type Event string
+
+const (
+	EventPreCheck  Event = "pre_check"
+	EventPostCheck Event = "post_check"
+	EventOnSuccess Event = "on_success"
+	EventOnFailure Event = "on_failure"
+	// EventDegraded runs when a previously healthy NZB falls below the allowed missing segments
+	EventDegraded Event = "degraded"
+	// EventRetentionWarning runs when the NZB is close to the provider retention horizon
+	EventRetentionWarning Event = "retention_warning"
+	// EventProviderAlert runs when the error rate of a provider exceeds the alert threshold, no NZB is involved
+	EventProviderAlert Event = "provider_alert"
+	// EventRule is used when a script is run by a rules engine action
+	EventRule Event = "rule"
+)
+
+var (
+	timeoutDefault = 60 * time.Second
+	// maxMissingSegmentsInEnv caps the message-ids exported to avoid exceeding the environment size limit
+	maxMissingSegmentsInEnv = 100
+
+	// ErrRejected is returned by Run when the script exits with a non-zero
+	// status. A script that cannot be run or times out does not reject.
+	ErrRejected = errors.New("rejected by the hook")
+)
+
+// Config maps each event to the script executed for it
+type Config struct {
+	PreCheck  string `yaml:"pre_check"`
+	PostCheck string `yaml:"post_check"`
+	OnSuccess string `yaml:"on_success"`
+	OnFailure string `yaml:"on_failure"`
+	// Run when a previously healthy NZB is taken down or decays
+	Degraded string `yaml:"degraded"`
+	// Run when the oldest articles of an NZB approach the shortest provider retention
+	RetentionWarning string `yaml:"retention_warning"`
+	// Run when the error rate of a provider exceeds the provider_alerts threshold
+	ProviderAlert string        `yaml:"provider_alert"`
+	Timeout       time.Duration `yaml:"timeout"` // Maximum execution time per script (default: 60s)
+}
+
+// Info describes the NZB and check outcome exposed to hook scripts
+type Info struct {
+	NzbPath         string
+	Health          float64
+	TotalSegments   int
+	CheckedSegments int
+	FailedSegments  int
+	MissingSegments []string
+	Error           string
+	ErrorCode       string // Stable code of the error, e.g. E_MISSING_THRESHOLD
+	// PAR2 recovery data as a percentage of the payload
+	Par2Percent float64
+	// Whether the time budget ran out and health reflects the segments checked so far
+	Partial bool
+	// Whether the release looks password protected and its password when known
+	PasswordProtected bool
+	Password          string
+	// Health of the previous check and "takedown" or "decay", set for degraded NZBs
+	PreviousHealth float64
+	Degradation    string
+	// Days until the oldest articles pass the shortest provider retention, set for retention warnings
+	RetentionDaysLeft int
+	// Provider ID and its error rate as a percentage, set for provider alerts
+	Provider          string
+	ProviderErrorRate float64
+	// Consecutive failed checks and the time of the first one, set for rule actions
+	FailedChecks int
+	FailingSince time.Time
+	// Whether the action escalates an NZB confirmed dead by its failed checks
+	ConfirmedDead bool
+}
+
+// Runner executes the configured hook scripts
+type Runner struct {
+	cfg Config
+}
+
+// NewRunner creates a hook runner for the given configuration
+func NewRunner(cfg Config) *Runner {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = timeoutDefault
+	}
+
+	return &Runner{cfg: cfg}
+}
+
+// script returns the script configured for the event
+func (r *Runner) script(event Event) string {
+	switch event {
+	case EventPreCheck:
+		return r.cfg.PreCheck
+	case EventPostCheck:
+		return r.cfg.PostCheck
+	case EventOnSuccess:
+		return r.cfg.OnSuccess
+	case EventOnFailure:
+		return r.cfg.OnFailure
+	case EventDegraded:
+		return r.cfg.Degraded
+	case EventRetentionWarning:
+		return r.cfg.RetentionWarning
+	case EventProviderAlert:
+		return r.cfg.ProviderAlert
+	default:
+		return ""
+	}
+}
+
+// Run executes the script configured for the event, if any. For pre_check
+// a non-zero exit status is returned as ErrRejected so the caller can skip the NZB.
+func (r *Runner) Run(ctx context.Context, event Event, info Info) error {
+	if r == nil {
+		return nil
+	}
+
+	script := r.script(event)
+	if script == "" {
+		return nil
+	}
+
+	if err := Exec(ctx, script, r.cfg.Timeout, event, info); err != nil {
+		slog.WarnContext(ctx, "Hook script failed", "event", event, "script", script, "path", info.NzbPath, "error", err)
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && ctx.Err() == nil {
+			return fmt.Errorf("hook %s: %w: %w", event, ErrRejected, err)
+		}
+
+		return fmt.Errorf("hook %s: %w", event, err)
+	}
+
+	return nil
+}
+
+// RunResult runs the post_check hook followed by on_success or on_failure
+func (r *Runner) RunResult(ctx context.Context, info Info) {
+	_ = r.Run(ctx, EventPostCheck, info)
+
+	if info.Error != "" {
+		_ = r.Run(ctx, EventOnFailure, info)
+	} else {
+		_ = r.Run(ctx, EventOnSuccess, info)
+	}
+}
+
+// Exec runs a script with the NZBTOUCH_* variables describing the event and
+// the given arguments, lifecycle hooks get none
+func Exec(ctx context.Context, script string, timeout time.Duration, event Event, info Info, args ...string) error {
+	if timeout <= 0 {
+		timeout = timeoutDefault
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, script, args...)
+	cmd.Env = append(os.Environ(), environment(event, info)...)
+
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		slog.DebugContext(ctx, "Hook output", "event", event, "script", script, "output", strings.TrimSpace(string(out)))
+	}
+
+	return err
+}
+
+// environment builds the NZBTOUCH_* variables passed to hook scripts
+func environment(event Event, info Info) []string {
+	missing := info.MissingSegments
+	if len(missing) > maxMissingSegmentsInEnv {
+		missing = missing[:maxMissingSegmentsInEnv]
+	}
+
+	var failingSince string
+	if !info.FailingSince.IsZero() {
+		failingSince = info.FailingSince.Format(time.RFC3339)
+	}
+
+	return []string{
+		"NZBTOUCH_EVENT=" + string(event),
+		"NZBTOUCH_NZB_PATH=" + info.NzbPath,
+		"NZBTOUCH_NZB_NAME=" + filepath.Base(info.NzbPath),
+		"NZBTOUCH_HEALTH=" + strconv.FormatFloat(info.Health, 'f', 2, 64),
+		"NZBTOUCH_TOTAL_SEGMENTS=" + strconv.Itoa(info.TotalSegments),
+		"NZBTOUCH_CHECKED_SEGMENTS=" + strconv.Itoa(info.CheckedSegments),
+		"NZBTOUCH_FAILED_SEGMENTS=" + strconv.Itoa(info.FailedSegments),
+		"NZBTOUCH_MISSING_SEGMENTS=" + strings.Join(missing, ","),
+		"NZBTOUCH_ERROR=" + info.Error,
+		"NZBTOUCH_ERROR_CODE=" + info.ErrorCode,
+		"NZBTOUCH_PARTIAL=" + strconv.FormatBool(info.Partial),
+		"NZBTOUCH_PAR2_PERCENT=" + strconv.FormatFloat(info.Par2Percent, 'f', 2, 64),
+		"NZBTOUCH_PASSWORD_PROTECTED=" + strconv.FormatBool(info.PasswordProtected),
+		"NZBTOUCH_PASSWORD=" + info.Password,
+		"NZBTOUCH_PREVIOUS_HEALTH=" + strconv.FormatFloat(info.PreviousHealth, 'f', 2, 64),
+		"NZBTOUCH_DEGRADATION=" + info.Degradation,
+		"NZBTOUCH_RETENTION_DAYS_LEFT=" + strconv.Itoa(info.RetentionDaysLeft),
+		"NZBTOUCH_PROVIDER=" + info.Provider,
+		"NZBTOUCH_PROVIDER_ERROR_RATE=" + strconv.FormatFloat(info.ProviderErrorRate, 'f', 2, 64),
+		"NZBTOUCH_FAILED_CHECKS=" + strconv.Itoa(info.FailedChecks),
+		"NZBTOUCH_FAILING_SINCE=" + failingSince,
+		"NZBTOUCH_CONFIRMED_DEAD=" + strconv.FormatBool(info.ConfirmedDead),
+	}
+}
@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// nzbgetItem is an entry of the NZBGet history, health values are per mille
+type nzbgetItem struct {
+	Kind           string `json:"Kind"`
+	NZBName        string `json:"NZBName"`
+	NZBFilename    string `json:"NZBFilename"`
+	Status         string `json:"Status"`
+	Health         int    `json:"Health"`
+	CriticalHealth int    `json:"CriticalHealth"`
+	HistoryTime    int64  `json:"HistoryTime"`
+}
+
+// parseNZBGet reads the response of the history JSON-RPC method, or only its
+// result array. An entry passes when its health is at least its critical
+// health, or, without a critical health, when its status is a success.
+func parseNZBGet(r io.Reader) ([]Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []nzbgetItem
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &items)
+	} else {
+		var response struct {
+			Result []nzbgetItem `json:"result"`
+		}
+		err = json.Unmarshal(trimmed, &response)
+		items = response.Result
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid NZBGet history: %w", err)
+	}
+
+	var results []Result
+	for _, item := range items {
+		// URLs and duplicates hidden from the queue never had an NZB checked
+		if item.Kind != "" && item.Kind != "NZB" {
+			continue
+		}
+
+		name := item.NZBFilename
+		if name == "" && item.NZBName != "" {
+			name = item.NZBName + ".nzb"
+		}
+		if name == "" {
+			continue
+		}
+
+		passed := strings.HasPrefix(item.Status, "SUCCESS")
+		if item.CriticalHealth > 0 {
+			passed = item.Health >= item.CriticalHealth
+		}
+
+		result := Result{Path: name, Passed: passed, Health: float64(item.Health) / 10}
+		if item.HistoryTime > 0 {
+			result.Checked = time.Unix(item.HistoryTime, 0)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// percentPattern finds the health in a verdict, e.g. "FAILED (87.5% available)"
+var percentPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`)
+
+// parseNZBCheck reads a text report of "<path>: <verdict>" lines. Verdicts
+// starting with OK, PASS, HEALTHY or COMPLETE pass, a percentage in the
+// verdict is the health. Empty lines and "#" comments are ignored.
+func parseNZBCheck(r io.Reader) ([]Result, error) {
+	var results []Result
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// Paths may contain ": ", the verdict follows the last one
+		i := strings.LastIndex(text, ": ")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected \"<path>: <verdict>\"", line)
+		}
+		path, verdict := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:])
+
+		result := Result{Path: path, Passed: passedVerdict(verdict), Health: -1}
+		if m := percentPattern.FindStringSubmatch(verdict); m != nil {
+			if health, err := parseHealth(m[1]); err == nil {
+				result.Health = health
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, scanner.Err()
+}
+
+// Mapping names the CSV columns holding each field of a result
+type Mapping struct {
+	Path    string // Path or file name of the NZB (default "path")
+	Status  string // Verdict, e.g. OK or FAILED (default "status")
+	Health  string // Percentage of available articles, optional (default "health")
+	Checked string // Time of the check, optional (default "checked")
+}
+
+// DefaultMapping is the mapping of CSV reports without --map
+var DefaultMapping = Mapping{Path: "path", Status: "status", Health: "health", Checked: "checked"}
+
+// ParseMapping parses "field=column" pairs separated by commas, e.g.
+// "path=File,status=Result". Fields left out keep their default column.
+func ParseMapping(s string) (Mapping, error) {
+	m := DefaultMapping
+	if strings.TrimSpace(s) == "" {
+		return m, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || column == "" {
+			return m, fmt.Errorf("invalid mapping %q, expected field=column", pair)
+		}
+
+		switch strings.ToLower(field) {
+		case "path":
+			m.Path = column
+		case "status":
+			m.Status = column
+		case "health":
+			m.Health = column
+		case "checked":
+			m.Checked = column
+		default:
+			return m, fmt.Errorf("unknown field %q, expected path, status, health or checked", field)
+		}
+	}
+
+	return m, nil
+}
+
+// parseCSV reads a CSV report with a header row. The path column and either
+// the status or the health column are required, without a status an NZB
+// passes when its health is 100%.
+func parseCSV(r io.Reader, mapping Mapping) ([]Result, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	column := func(name string) int {
+		if i, ok := columns[strings.ToLower(name)]; ok && name != "" {
+			return i
+		}
+		return -1
+	}
+
+	pathCol, statusCol, healthCol, checkedCol := column(mapping.Path), column(mapping.Status), column(mapping.Health), column(mapping.Checked)
+	if pathCol < 0 {
+		return nil, fmt.Errorf("no %q column in the CSV header", mapping.Path)
+	}
+	if statusCol < 0 && healthCol < 0 {
+		return nil, fmt.Errorf("neither a %q nor a %q column in the CSV header", mapping.Status, mapping.Health)
+	}
+
+	var results []Result
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return results, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		result := Result{Path: field(pathCol), Health: -1}
+		if result.Path == "" {
+			continue
+		}
+
+		if value := field(healthCol); value != "" {
+			if result.Health, err = parseHealth(value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+
+		if statusCol >= 0 {
+			result.Passed = passedVerdict(field(statusCol))
+		} else {
+			result.Passed = result.Health >= 100
+		}
+
+		if value := field(checkedCol); value != "" {
+			if result.Checked, err = parseTime(value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+
+		results = append(results, result)
+	}
+}
@@ -0,0 +1,178 @@
+// Package importer reads the results of external NZB checkers, NZBGet health
+// checks, nzbcheck reports or any CSV export, so a library already verified
+// by another tool is not checked again from scratch
+package importer
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/fsutil"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Format identifies the tool a report comes from
+type Format string
+
+const (
+	FormatNZBGet   Format = "nzbget"   // JSON output of the NZBGet history API method
+	FormatNZBCheck Format = "nzbcheck" // nzbcheck text report, one "<path>: <verdict>" line per NZB
+	FormatCSV      Format = "csv"      // CSV with a header row, columns picked by a Mapping
+)
+
+// Result is the outcome of a check run by another tool
+type Result struct {
+	Path    string    // Path of the NZB, or only its file name
+	Passed  bool      // Whether the NZB was found healthy
+	Health  float64   // Percentage of available articles, -1 when unknown
+	Checked time.Time // When the check ran, zero when unknown
+}
+
+// Parse reads the results of a report. mapping only applies to FormatCSV.
+func Parse(format Format, r io.Reader, mapping Mapping) ([]Result, error) {
+	switch format {
+	case FormatNZBGet:
+		return parseNZBGet(r)
+	case FormatNZBCheck:
+		return parseNZBCheck(r)
+	case FormatCSV:
+		return parseCSV(r, mapping)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected nzbget, nzbcheck or csv", format)
+	}
+}
+
+// passedVerdicts are the verdicts of healthy NZBs in text and CSV reports
+var passedVerdicts = []string{"ok", "pass", "passed", "healthy", "good", "complete", "completed", "success", "true", "yes", "1"}
+
+// passedVerdict reports whether a verdict is one of passedVerdicts, only its
+// first word is considered, e.g. "OK (100%)"
+func passedVerdict(verdict string) bool {
+	word, _, _ := strings.Cut(strings.TrimSpace(verdict), " ")
+	word = strings.ToLower(strings.TrimRight(word, ",;:."))
+	for _, v := range passedVerdicts {
+		if word == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseHealth parses a percentage such as "98.5" or "98.5%"
+func parseHealth(s string) (float64, error) {
+	health, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || health < 0 || health > 100 {
+		return 0, fmt.Errorf("invalid health %q, expected a percentage", s)
+	}
+
+	return health, nil
+}
+
+// timeLayouts are the layouts accepted for check times, Unix seconds are accepted too
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseTime parses a check time, times without a zone are local
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339, \"2006-01-02 15:04:05\" or Unix seconds", s)
+}
+
+// Locate maps the results to NZBs on disk. Existing paths are kept, relative
+// paths are looked up below dirs and the other ones by file name among the
+// NZBs below dirs. The results matching no NZB, or several NZBs of the same
+// name, are returned apart.
+func Locate(results []Result, dirs []string) (located, unmatched []Result) {
+	var names map[string][]string
+	for _, result := range results {
+		if path, ok := locatePath(result.Path, dirs); ok {
+			result.Path = path
+			located = append(located, result)
+			continue
+		}
+
+		if names == nil {
+			names = nzbNames(dirs)
+		}
+
+		if paths := names[nameKey(filepath.Base(result.Path))]; len(paths) == 1 {
+			result.Path = paths[0]
+			located = append(located, result)
+			continue
+		}
+
+		unmatched = append(unmatched, result)
+	}
+
+	return located, unmatched
+}
+
+// locatePath returns the path of an existing NZB, relative paths being
+// resolved against each directory
+func locatePath(path string, dirs []string) (string, bool) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = candidates[:0]
+		for _, dir := range dirs {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(fsutil.DiskPath(candidate)); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
+
+// nzbNames indexes the NZBs below dirs by file name
+func nzbNames(dirs []string) map[string][]string {
+	names := make(map[string][]string)
+	for _, dir := range dirs {
+		_ = filepath.WalkDir(fsutil.LongPath(dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				slog.Warn("Failed to read path, skipping", "path", path, "error", err)
+				return nil
+			}
+			if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".nzb") {
+				return nil
+			}
+
+			key := nameKey(d.Name())
+			names[key] = append(names[key], fsutil.CleanPath(path))
+			return nil
+		})
+	}
+
+	return names
+}
+
+// nameKey identifies a file name whatever its Unicode form, and case where
+// file systems ignore it
+func nameKey(name string) string {
+	name = norm.NFC.String(name)
+	if fsutil.FoldCase {
+		name = strings.ToLower(name)
+	}
+
+	return name
+}
@@ -0,0 +1,115 @@
+package mockserver
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"math/rand/v2"
+	"strings"
+)
+
+// yencLineLength is the length of the encoded lines of an article body
+const yencLineLength = 128
+
+// fate tells what becomes of an article
+type fate int
+
+const (
+	fateServed fate = iota
+	fateMissing
+	fateCorrupt
+)
+
+// fateOf decides deterministically, from the seed and the message-id, whether
+// an article is missing or corrupt, so every connection and every retry sees
+// the same article the same way. Message-ids containing "missing" or
+// "corrupt" always are.
+func (s *Server) fateOf(id string) fate {
+	switch {
+	case strings.Contains(id, "missing"):
+		return fateMissing
+	case strings.Contains(id, "corrupt"):
+		return fateCorrupt
+	}
+
+	roll := float64(s.hash(id)%10000) / 100
+	switch {
+	case roll < s.cfg.MissingPercent:
+		return fateMissing
+	case roll < s.cfg.MissingPercent+s.cfg.CorruptPercent:
+		return fateCorrupt
+	}
+
+	return fateServed
+}
+
+// hash mixes the seed and a message-id
+func (s *Server) hash(id string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s.cfg.Seed))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(id))
+
+	return h.Sum64()
+}
+
+// body returns the yEnc encoded body of an article, its data derived from the
+// message-id. A corrupt article announces the checksum of other data.
+func (s *Server) body(id string, corrupt bool) []byte {
+	data := make([]byte, s.cfg.ArticleSize)
+	rng := rand.New(rand.NewPCG(s.hash(id), 0))
+	for i := range data {
+		data[i] = byte(rng.Uint32())
+	}
+
+	crc := crc32.ChecksumIEEE(data)
+	if corrupt {
+		crc = ^crc
+	}
+
+	return yencEncode(data, articleName(id), crc)
+}
+
+// articleName is the file name announced in the yEnc header of an article
+func articleName(id string) string {
+	name, _, _ := strings.Cut(id, "@")
+
+	return name + ".bin"
+}
+
+// yencEncode encodes data as a single part yEnc body, lines ending in CRLF
+func yencEncode(data []byte, name string, crc uint32) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "=ybegin part=1 total=1 line=%d size=%d name=%s\r\n", yencLineLength, len(data), name)
+	fmt.Fprintf(&buf, "=ypart begin=1 end=%d\r\n", len(data))
+
+	column := 0
+	for _, b := range data {
+		c := b + 42
+		escape := c == 0 || c == '\n' || c == '\r' || c == '=' ||
+			// Leading dots are escaped too, sparing the dot stuffing
+			(column == 0 && c == '.') ||
+			// Whitespace is escaped at the edges of a line, where servers may strip it
+			((column == 0 || column >= yencLineLength-1) && (c == ' ' || c == '\t'))
+		if escape {
+			buf.WriteByte('=')
+			c += 64
+			column++
+		}
+		buf.WriteByte(c)
+		column++
+
+		if column >= yencLineLength {
+			buf.WriteString("\r\n")
+			column = 0
+		}
+	}
+	if column > 0 {
+		buf.WriteString("\r\n")
+	}
+
+	fmt.Fprintf(&buf, "=yend size=%d part=1 pcrc32=%08x\r\n", len(data), crc)
+
+	return buf.Bytes()
+}
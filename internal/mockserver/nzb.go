@@ -0,0 +1,42 @@
+package mockserver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+)
+
+// SyntheticNZB returns an NZB of files made of segments articles, every one
+// served by the mock server. Message-ids are derived from name, so NZBs of
+// different names share no article.
+func SyntheticNZB(name string, files, segments, articleSize int) *nzbparser.Nzb {
+	if articleSize <= 0 {
+		articleSize = articleSizeDefault
+	}
+
+	nzb := &nzbparser.Nzb{Meta: map[string]string{"name": name}}
+	for f := 1; f <= files; f++ {
+		fileName := fmt.Sprintf("%s.part%02d.rar", name, f)
+		file := nzbparser.NzbFile{
+			Groups:  []string{"alt.binaries.test"},
+			Poster:  "mock@nzbtouch",
+			Date:    int(time.Now().Unix()),
+			Subject: fmt.Sprintf("[%d/%d] - \"%s\" yEnc (1/%d)", f, files, fileName, segments),
+		}
+
+		for n := 1; n <= segments; n++ {
+			file.Segments = append(file.Segments, nzbparser.NzbSegment{
+				Bytes:  articleSize,
+				Number: n,
+				Id:     fmt.Sprintf("%s.%d.%d@mock.nzbtouch", name, f, n),
+			})
+		}
+
+		nzb.Files = append(nzb.Files, file)
+	}
+
+	nzbparser.ScanNzbFile(nzb)
+
+	return nzb
+}
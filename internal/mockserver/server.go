@@ -0,0 +1,269 @@
+// Package mockserver is an NNTP server serving synthetic articles, some of them
+// missing, corrupt, failing or slow on demand, to exercise the checker end to
+// end without a usenet account
+package mockserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config of the mock server
+type Config struct {
+	Listen         string        // Address to serve NNTP on, e.g. "localhost:1119"
+	MissingPercent float64       // Articles answered with 430, picked by message-id
+	CorruptPercent float64       // Articles served with a wrong CRC, picked by message-id
+	ErrorPercent   float64       // Requests failing with a transient 503, picked at random
+	Latency        time.Duration // Delay before answering each article request
+	Jitter         time.Duration // Random delay added to the latency
+	ArticleSize    int           // Decoded bytes of each article (default: 750000)
+	Username       string        // Required with AUTHINFO when set
+	Password       string        // Password of Username
+	MaxConnections int           // Connections beyond this are refused with 502 (0 for unlimited)
+	Seed           string        // Changes which articles are missing or corrupt
+}
+
+// articleSizeDefault is the size of a typical article
+const articleSizeDefault = 750000
+
+// Server serves synthetic articles over NNTP
+type Server struct {
+	cfg         Config
+	connections atomic.Int64
+	wg          sync.WaitGroup
+}
+
+// New creates a mock server
+func New(cfg Config) *Server {
+	if cfg.ArticleSize <= 0 {
+		cfg.ArticleSize = articleSizeDefault
+	}
+
+	return &Server{cfg: cfg}
+}
+
+// Run serves NNTP on the configured address until ctx is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Mock NNTP server listening", "addr", listener.Addr().String())
+
+	return s.Serve(ctx, listener)
+}
+
+// Serve answers the connections of listener until ctx is cancelled, then
+// closes the open connections
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	defer s.wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+// session is the state of a client connection
+type session struct {
+	conn          *textproto.Conn
+	user          string
+	authenticated bool
+}
+
+// handle answers the commands of a connection
+func (s *Server) handle(ctx context.Context, netConn net.Conn) {
+	stop := context.AfterFunc(ctx, func() { _ = netConn.Close() })
+	defer stop()
+
+	conn := textproto.NewConn(netConn)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	open := s.connections.Add(1)
+	defer s.connections.Add(-1)
+
+	if s.cfg.MaxConnections > 0 && open > int64(s.cfg.MaxConnections) {
+		_ = conn.PrintfLine("502 too many connections")
+		return
+	}
+
+	if err := conn.PrintfLine("200 nzbtouch mock server ready"); err != nil {
+		return
+	}
+
+	sess := &session{conn: conn, authenticated: s.cfg.Username == ""}
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command, args, _ := strings.Cut(line, " ")
+		if !s.command(ctx, sess, strings.ToUpper(command), strings.Fields(args)) {
+			return
+		}
+	}
+}
+
+// command answers a command, returning false once the connection must close
+func (s *Server) command(ctx context.Context, sess *session, command string, args []string) bool {
+	conn := sess.conn
+
+	switch command {
+	case "QUIT":
+		_ = conn.PrintfLine("205 bye")
+		return false
+	case "CAPABILITIES":
+		return writeBlock(conn, "101 capability list follows", "VERSION 2\r\nREADER\r\nAUTHINFO USER\r\n")
+	case "AUTHINFO":
+		return s.authinfo(sess, args)
+	}
+
+	if !sess.authenticated {
+		return conn.PrintfLine("480 authentication required") == nil
+	}
+
+	switch command {
+	case "MODE":
+		return conn.PrintfLine("200 reader mode, posting prohibited") == nil
+	case "DATE":
+		return conn.PrintfLine("111 %s", time.Now().UTC().Format("20060102150405")) == nil
+	case "GROUP":
+		if len(args) == 0 {
+			return conn.PrintfLine("501 missing group") == nil
+		}
+
+		return conn.PrintfLine("211 1000000 1 1000000 %s", args[0]) == nil
+	case "STAT", "HEAD", "BODY", "ARTICLE":
+		if len(args) == 0 || !strings.HasPrefix(args[0], "<") {
+			return conn.PrintfLine("501 message-id required") == nil
+		}
+
+		return s.article(ctx, conn, command, args[0])
+	}
+
+	return conn.PrintfLine("500 unknown command") == nil
+}
+
+// authinfo answers AUTHINFO USER and AUTHINFO PASS
+func (s *Server) authinfo(sess *session, args []string) bool {
+	conn := sess.conn
+	if len(args) < 2 {
+		return conn.PrintfLine("501 syntax error") == nil
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "USER":
+		sess.user = args[1]
+		if s.cfg.Username == "" {
+			sess.authenticated = true
+			return conn.PrintfLine("281 authentication accepted") == nil
+		}
+
+		return conn.PrintfLine("381 password required") == nil
+	case "PASS":
+		if sess.authenticated {
+			return conn.PrintfLine("281 authentication accepted") == nil
+		}
+
+		if sess.user != s.cfg.Username || args[1] != s.cfg.Password {
+			return conn.PrintfLine("481 authentication failed") == nil
+		}
+
+		sess.authenticated = true
+
+		return conn.PrintfLine("281 authentication accepted") == nil
+	}
+
+	return conn.PrintfLine("501 syntax error") == nil
+}
+
+// article answers STAT, HEAD, BODY and ARTICLE after the configured delay
+func (s *Server) article(ctx context.Context, conn *textproto.Conn, command, messageID string) bool {
+	if delay := s.delay(); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if s.cfg.ErrorPercent > 0 && rand.Float64()*100 < s.cfg.ErrorPercent {
+		return conn.PrintfLine("503 temporary failure") == nil
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(messageID, "<"), ">")
+	fate := s.fateOf(id)
+	if fate == fateMissing {
+		return conn.PrintfLine("430 no such article") == nil
+	}
+
+	headers := fmt.Sprintf("Message-ID: %s\r\nSubject: %s\r\nFrom: mock@nzbtouch\r\nNewsgroups: alt.binaries.test\r\n", messageID, articleName(id))
+
+	switch command {
+	case "STAT":
+		return conn.PrintfLine("223 0 %s", messageID) == nil
+	case "HEAD":
+		return writeBlock(conn, fmt.Sprintf("221 0 %s", messageID), headers)
+	case "BODY":
+		return writeBlock(conn, fmt.Sprintf("222 0 %s", messageID), string(s.body(id, fate == fateCorrupt)))
+	default:
+		return writeBlock(conn, fmt.Sprintf("220 0 %s", messageID), headers+"\r\n"+string(s.body(id, fate == fateCorrupt)))
+	}
+}
+
+// delay returns the latency of an article request
+func (s *Server) delay() time.Duration {
+	delay := s.cfg.Latency
+	if s.cfg.Jitter > 0 {
+		delay += rand.N(s.cfg.Jitter)
+	}
+
+	return delay
+}
+
+// writeBlock writes a status line and a dot terminated block
+func writeBlock(conn *textproto.Conn, status, block string) bool {
+	if err := conn.PrintfLine("%s", status); err != nil {
+		return false
+	}
+
+	w := conn.DotWriter()
+	if _, err := w.Write([]byte(block)); err != nil {
+		return false
+	}
+
+	return w.Close() == nil
+}
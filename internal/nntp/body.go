@@ -0,0 +1,103 @@
+package nntp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+	"github.com/mnightingale/rapidyenc"
+)
+
+// yencHeaderReadSize is read ahead to parse the yEnc headers of a body
+const yencHeaderReadSize = 4096
+
+// bodyReader reads the decoded body of an article, the response ends when it is closed
+type bodyReader struct {
+	mu         sync.Mutex
+	decoder    *rapidyenc.Decoder
+	conn       *conn
+	responseID uint
+	// buffer holds the data read ahead to parse the yEnc headers
+	buffer  *bytes.Buffer
+	headers *nntpcli.YencHeaders
+	closed  bool
+}
+
+// Read reads the decoded body
+func (r *bodyReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, io.EOF
+	}
+
+	if r.buffer != nil {
+		n, _ := r.buffer.Read(p)
+		if r.buffer.Len() == 0 {
+			r.buffer = nil
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+
+	return r.decoder.Read(p)
+}
+
+// GetYencHeaders returns the yEnc headers of the article, reading ahead of the body if needed
+func (r *bodyReader) GetYencHeaders() (nntpcli.YencHeaders, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.headers != nil {
+		return *r.headers, nil
+	}
+
+	if r.closed {
+		return nntpcli.YencHeaders{}, io.ErrClosedPipe
+	}
+
+	buf := make([]byte, yencHeaderReadSize)
+	n, err := r.decoder.Read(buf)
+	if n > 0 {
+		r.buffer = bytes.NewBuffer(buf[:n])
+	}
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nntpcli.YencHeaders{}, err
+	}
+
+	meta := r.decoder.Meta
+	r.headers = &nntpcli.YencHeaders{
+		FileName:   meta.FileName,
+		FileSize:   meta.FileSize,
+		PartNumber: meta.PartNumber,
+		TotalParts: meta.TotalParts,
+		Offset:     meta.Offset,
+		PartSize:   meta.PartSize,
+		Hash:       meta.Hash,
+	}
+
+	return *r.headers, nil
+}
+
+// Close drains the rest of the body so the connection can be reused
+func (r *bodyReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+
+	r.closed = true
+	_, _ = io.Copy(io.Discard, r.decoder)
+	rapidyenc.ReleaseDecoder(r.decoder)
+	r.conn.text.EndResponse(r.responseID)
+
+	return nil
+}
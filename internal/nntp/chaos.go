@@ -0,0 +1,67 @@
+package nntp
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/textproto"
+	"time"
+
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+)
+
+// Chaos injects faults into the article requests of every connection, to
+// verify thresholds, retries and provider circuit breakers behave as designed
+// against real or mock servers. Each fault is drawn independently per request.
+type Chaos struct {
+	MissingPercent float64       `yaml:"missing_percent"` // Requests answered as a missing article (430)
+	ErrorPercent   float64       `yaml:"error_percent"`   // Requests failing with a transient error (503)
+	SlowPercent    float64       `yaml:"slow_percent"`    // Requests delayed by slow_delay before being sent
+	SlowDelay      time.Duration `yaml:"slow_delay"`      // Delay of slow requests (default: 5s)
+	DropPercent    float64       `yaml:"drop_percent"`    // Requests whose connection is closed under them
+}
+
+// Enabled tells whether any fault is injected
+func (c Chaos) Enabled() bool {
+	return c.MissingPercent > 0 || c.ErrorPercent > 0 || c.SlowPercent > 0 || c.DropPercent > 0
+}
+
+// WithChaos injects faults into the article requests. Every server is dialed
+// by the Dialer, the requests of the pool's client cannot be altered.
+func WithChaos(chaos Chaos) Option {
+	return func(d *Dialer) {
+		d.chaos = chaos
+	}
+}
+
+// roll returns true with the given percent chance
+func roll(percent float64) bool {
+	return percent > 0 && rand.Float64()*100 < percent
+}
+
+// inject applies the faults drawn for an article request. A dropped
+// connection is closed and left to fail the request on its own, the missing
+// and transient errors are returned instead of sending the request.
+func (c *conn) inject(command, msgID string) error {
+	if !c.chaos.Enabled() {
+		return nil
+	}
+
+	if roll(c.chaos.SlowPercent) {
+		time.Sleep(c.chaos.SlowDelay)
+	}
+
+	if roll(c.chaos.DropPercent) {
+		_ = c.netconn.Close()
+		return nil
+	}
+
+	if roll(c.chaos.MissingPercent) {
+		return fmt.Errorf("%s <%s>: %w", command, msgID, formatError(&textproto.Error{Code: nntpcli.ArticleNotFoundErrCode, Msg: "no such article (chaos)"}))
+	}
+
+	if roll(c.chaos.ErrorPercent) {
+		return fmt.Errorf("%s <%s>: %w", command, msgID, &textproto.Error{Code: 503, Msg: "temporary failure (chaos)"})
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package nntp
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+)
+
+// statusCompressionActive is the answer to a successful COMPRESS command
+const statusCompressionActive = 206
+
+// startCompression negotiates COMPRESS DEFLATE (RFC 8054). Servers refusing
+// it keep answering uncompressed, only a broken connection is an error.
+func (c *conn) startCompression() error {
+	if _, _, err := c.cmd(statusCompressionActive, "COMPRESS DEFLATE"); err != nil {
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) {
+			slog.Debug("NNTP compression not available", "error", err)
+			return nil
+		}
+
+		return fmt.Errorf("COMPRESS DEFLATE: %w", err)
+	}
+
+	c.text = textproto.NewConn(newDeflateConn(c.netconn))
+
+	return nil
+}
+
+// deflateConn compresses what is written to a connection and decompresses
+// what is read from it, every write is flushed so commands are sent at once
+type deflateConn struct {
+	net.Conn
+	r io.ReadCloser
+	w *flate.Writer
+}
+
+// newDeflateConn adds a DEFLATE layer to c
+func newDeflateConn(c net.Conn) *deflateConn {
+	// The error is only returned for an invalid level
+	w, _ := flate.NewWriter(c, flate.DefaultCompression)
+
+	return &deflateConn{
+		Conn: c,
+		r:    flate.NewReader(c),
+		w:    w,
+	}
+}
+
+// Read reads decompressed data
+func (d *deflateConn) Read(p []byte) (int, error) {
+	return d.r.Read(p)
+}
+
+// Write compresses p and flushes it to the connection
+func (d *deflateConn) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	return n, d.w.Flush()
+}
+
+// Close closes the connection
+func (d *deflateConn) Close() error {
+	_ = d.r.Close()
+
+	return d.Conn.Close()
+}
@@ -0,0 +1,412 @@
+// Package nntp dials NNTP connections for the connection pool when a
+// provider needs protocol features the pool's own client lacks, such as
+// COMPRESS DEFLATE, STARTTLS or a TLS server name override
+package nntp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+	"github.com/mnightingale/rapidyenc"
+)
+
+// statusDate is the answer to DATE, the pool pings connections with it
+const statusDate = 111
+
+var _ nntpcli.Connection = (*conn)(nil)
+
+// conn is an NNTP connection speaking the same protocol as the pool's own
+// client, optionally over a compression layer negotiated after authentication
+type conn struct {
+	// netconn is the TCP or TLS connection, deadlines are set on it
+	netconn          net.Conn
+	text             *textproto.Conn
+	maxAgeTime       time.Time
+	operationTimeout time.Duration
+	joinedGroup      string
+	// trace logs the commands and status lines when set
+	trace *tracer
+	// chaos holds the faults injected into article requests
+	chaos Chaos
+	// compress is set until COMPRESS DEFLATE has been attempted
+	compress bool
+	// headerCommand is the header listing command the server answered, HDR, OVER or XOVER
+	headerCommand string
+	// server is the host:port the connection was dialed to
+	server string
+	// credentials holds the current passwords, nil to use the ones given
+	credentials *Credentials
+	// username and passwordChanges identify the password the connection
+	// authenticated with, see Credentials
+	username        string
+	passwordChanges uint64
+}
+
+// newConn reads the server greeting and returns the connection
+func newConn(netconn net.Conn, maxAgeTime time.Time, operationTimeout time.Duration, trace *tracer) (*conn, error) {
+	c := &conn{
+		netconn:          netconn,
+		text:             textproto.NewConn(netconn),
+		maxAgeTime:       maxAgeTime,
+		operationTimeout: operationTimeout,
+		trace:            trace,
+	}
+
+	if err := c.setDeadline(); err != nil {
+		_ = netconn.Close()
+		return nil, err
+	}
+
+	code, line, err := c.text.ReadCodeLine(0)
+	c.trace.response(code, line, err)
+	if err == nil && code != nntpcli.StatusReady && code != nntpcli.StatusReadyNoPosting {
+		err = &textproto.Error{Code: code, Msg: line}
+	}
+
+	if err != nil {
+		_ = netconn.Close()
+		return nil, fmt.Errorf("greeting: %w", err)
+	}
+
+	if err := c.clearDeadline(); err != nil {
+		_ = netconn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close quits the session and closes the connection
+func (c *conn) Close() error {
+	_ = c.setDeadline()
+	_, _, err := c.cmd(nntpcli.StatusQuit, "QUIT")
+	if closeErr := c.text.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Authenticate logs in with AUTHINFO USER/PASS
+func (c *conn) Authenticate(username, password string) (err error) {
+	if c.credentials != nil {
+		if current, changes, ok := c.credentials.current(c.server, username); ok {
+			password = current
+			c.username, c.passwordChanges = username, changes
+		}
+	}
+
+	if err := c.setDeadline(); err != nil {
+		return err
+	}
+	defer c.endOperation(&err)
+
+	code, _, err := c.cmd(0, "AUTHINFO USER %s", username)
+	if err != nil {
+		return fmt.Errorf("AUTHINFO USER %s: %w", username, err)
+	}
+
+	switch code {
+	case nntpcli.StatusAuthenticated:
+		return nil
+	case nntpcli.StatusMoreAuthInfoRequired:
+	default:
+		return fmt.Errorf("AUTHINFO USER %s: authentication failed with code %d", username, code)
+	}
+
+	if _, _, err := c.cmd(nntpcli.StatusAuthenticated, "AUTHINFO PASS %s", password); err != nil {
+		return fmt.Errorf("AUTHINFO PASS (user %s): %w", username, err)
+	}
+
+	return nil
+}
+
+// Ping checks the connection is alive with DATE
+func (c *conn) Ping() (err error) {
+	if err := c.begin(); err != nil {
+		return err
+	}
+	defer c.endOperation(&err)
+
+	if _, _, err := c.cmd(statusDate, "DATE"); err != nil {
+		return fmt.Errorf("DATE: %w", err)
+	}
+
+	return nil
+}
+
+// JoinGroup selects a newsgroup
+func (c *conn) JoinGroup(group string) (err error) {
+	if group == c.joinedGroup {
+		return nil
+	}
+
+	if err := c.begin(); err != nil {
+		return err
+	}
+	defer c.endOperation(&err)
+
+	if _, _, err := c.cmd(nntpcli.StatusGroupSelected, "GROUP %s", group); err != nil {
+		return fmt.Errorf("GROUP %s: %w", group, err)
+	}
+
+	c.joinedGroup = group
+
+	return nil
+}
+
+// CurrentJoinedGroup returns the selected newsgroup
+func (c *conn) CurrentJoinedGroup() string {
+	return c.joinedGroup
+}
+
+// BodyDecoded writes the yEnc decoded body of an article to w, skipping the first discard bytes
+func (c *conn) BodyDecoded(msgID string, w io.Writer, discard int64) (n int64, err error) {
+	if err := c.begin(); err != nil {
+		return 0, err
+	}
+	defer c.endOperation(&err)
+
+	if err := c.inject("BODY", msgID); err != nil {
+		return 0, err
+	}
+
+	id, err := c.startBody(msgID)
+	if err != nil {
+		return 0, err
+	}
+	defer c.text.EndResponse(id)
+
+	dec := rapidyenc.AcquireDecoder(c.text.R)
+	defer rapidyenc.ReleaseDecoder(dec)
+
+	if discard > 0 {
+		if _, err := io.CopyN(io.Discard, dec, discard); err != nil {
+			_, _ = io.Copy(io.Discard, dec)
+			return 0, fmt.Errorf("BODY <%s>: discard %d bytes failed: %w", msgID, discard, err)
+		}
+	}
+
+	n, err = io.Copy(w, dec)
+	if err != nil {
+		// Drain the rest of the body so the connection stays usable
+		_, _ = io.Copy(io.Discard, dec)
+		return n, fmt.Errorf("BODY <%s>: copy failed: %w", msgID, err)
+	}
+
+	return n, nil
+}
+
+// BodyReader returns a reader of the yEnc decoded body of an article, the
+// caller controls the read pace so no deadline applies once the body follows
+func (c *conn) BodyReader(msgID string) (nntpcli.ArticleBodyReader, error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+
+	if err := c.inject("BODY", msgID); err != nil {
+		_ = c.clearDeadline()
+		return nil, err
+	}
+
+	id, err := c.startBody(msgID)
+	if err != nil {
+		_ = c.clearDeadline()
+		return nil, err
+	}
+
+	if err := c.clearDeadline(); err != nil {
+		c.text.EndResponse(id)
+		return nil, err
+	}
+
+	return &bodyReader{
+		decoder:    rapidyenc.AcquireDecoder(c.text.R),
+		conn:       c,
+		responseID: id,
+	}, nil
+}
+
+// Post sends an article, r holds its headers and body
+func (c *conn) Post(r io.Reader) (n int64, err error) {
+	if err := c.begin(); err != nil {
+		return 0, err
+	}
+	defer c.endOperation(&err)
+
+	if _, _, err := c.cmd(nntpcli.StatusPasswordRequired, "POST"); err != nil {
+		return 0, fmt.Errorf("POST: %w", err)
+	}
+
+	w := c.text.DotWriter()
+	n, err = io.Copy(w, r)
+	if err != nil {
+		return 0, fmt.Errorf("POST: copy article content failed: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return 0, fmt.Errorf("POST: close writer failed: %w", err)
+	}
+
+	code, line, err := c.text.ReadCodeLine(nntpcli.StatusArticlePosted)
+	c.trace.response(code, line, err)
+	if err != nil {
+		return 0, fmt.Errorf("POST: %w", err)
+	}
+
+	return n, nil
+}
+
+// MaxAgeTime returns when the connection must be replaced, right away once
+// the password it authenticated with changed
+func (c *conn) MaxAgeTime() time.Time {
+	if c.credentials != nil && c.username != "" && c.credentials.changed(c.server, c.username, c.passwordChanges) {
+		return time.Time{}
+	}
+
+	return c.maxAgeTime
+}
+
+// Stat checks an article exists and returns its number
+func (c *conn) Stat(msgID string) (number int, err error) {
+	if err := c.begin(); err != nil {
+		return 0, err
+	}
+	defer c.endOperation(&err)
+
+	if err := c.inject("STAT", msgID); err != nil {
+		return 0, err
+	}
+
+	_, line, err := c.cmd(nntpcli.StatusStatSuccess, "STAT <%s>", msgID)
+	if err != nil {
+		return 0, fmt.Errorf("STAT <%s>: %w", msgID, formatError(err))
+	}
+
+	number, err = strconv.Atoi(strings.SplitN(line, " ", 2)[0])
+	if err != nil {
+		return 0, fmt.Errorf("STAT <%s>: invalid article number in response: %w", msgID, err)
+	}
+
+	return number, nil
+}
+
+// Capabilities returns the capabilities advertised by the server
+func (c *conn) Capabilities() (caps []string, err error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.endOperation(&err)
+
+	return c.capabilities()
+}
+
+// capabilities sends CAPABILITIES and reads the list
+func (c *conn) capabilities() ([]string, error) {
+	const statusCapabilities = 101
+	if _, _, err := c.cmd(statusCapabilities, "CAPABILITIES"); err != nil {
+		return nil, err
+	}
+
+	return c.text.ReadDotLines()
+}
+
+// startBody sends BODY and reads the status line
+func (c *conn) startBody(msgID string) (uint, error) {
+	c.trace.command("BODY <%s>", msgID)
+	id, err := c.text.Cmd("BODY <%s>", msgID)
+	if err != nil {
+		c.trace.response(0, "", err)
+		return 0, fmt.Errorf("BODY <%s>: %w", msgID, err)
+	}
+
+	c.text.StartResponse(id)
+	code, line, err := c.text.ReadCodeLine(nntpcli.StatusBodyFollows)
+	c.trace.response(code, line, err)
+	if err != nil {
+		c.text.EndResponse(id)
+		return 0, fmt.Errorf("BODY <%s>: %w", msgID, formatError(err))
+	}
+
+	return id, nil
+}
+
+// cmd sends a command and reads its status line, any code is accepted when expectCode is 0
+func (c *conn) cmd(expectCode int, format string, args ...any) (int, string, error) {
+	c.trace.command(format, args...)
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		c.trace.response(0, "", err)
+		return 0, "", err
+	}
+
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+
+	code, line, err := c.text.ReadCodeLine(expectCode)
+	c.trace.response(code, line, err)
+
+	return code, line, err
+}
+
+// begin starts an operation after authentication, negotiating compression first if pending
+func (c *conn) begin() error {
+	if err := c.setDeadline(); err != nil {
+		return err
+	}
+
+	if c.compress {
+		c.compress = false
+		if err := c.startCompression(); err != nil {
+			_ = c.clearDeadline()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// endOperation clears the deadline of an operation, reporting the failure in err
+func (c *conn) endOperation(err *error) {
+	if clearErr := c.clearDeadline(); clearErr != nil && *err == nil {
+		*err = clearErr
+	}
+}
+
+// setDeadline bounds the current operation with the operation timeout
+func (c *conn) setDeadline() error {
+	if c.operationTimeout <= 0 {
+		return nil
+	}
+
+	if err := c.netconn.SetDeadline(time.Now().Add(c.operationTimeout)); err != nil {
+		return fmt.Errorf("set deadline: %w", err)
+	}
+
+	return nil
+}
+
+// clearDeadline removes the deadline of the finished operation
+func (c *conn) clearDeadline() error {
+	if err := c.netconn.SetDeadline(time.Time{}); err != nil {
+		return fmt.Errorf("clear deadline: %w", err)
+	}
+
+	return nil
+}
+
+// formatError marks missing articles the way the pool's client does
+func formatError(err error) error {
+	if nntpcli.IsArticleNotFoundError(err) {
+		return errors.Join(err, nntpcli.ErrArticleNotFound)
+	}
+
+	return err
+}
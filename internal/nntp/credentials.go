@@ -0,0 +1,85 @@
+package nntp
+
+import "sync"
+
+// Credentials holds the passwords of the provider accounts, which may change
+// while connections are open. A connection authenticated with a password
+// that changed since reports itself expired, so the pool replaces it with a
+// connection authenticated with the new one.
+type Credentials struct {
+	mu        sync.RWMutex
+	passwords map[string]string // By account, see accountKey
+	changes   map[string]uint64 // Times the password of an account changed
+}
+
+// NewCredentials returns an empty credential store
+func NewCredentials() *Credentials {
+	return &Credentials{
+		passwords: make(map[string]string),
+		changes:   make(map[string]uint64),
+	}
+}
+
+// WithCredentials authenticates with the passwords of creds instead of the
+// ones the pool was created with. Every server is dialed by the Dialer, as
+// the connections of the pool's client cannot be expired on a change.
+func WithCredentials(creds *Credentials) Option {
+	return func(d *Dialer) {
+		d.credentials = creds
+	}
+}
+
+// accountKey identifies an account on a server
+func accountKey(address, username string) string {
+	return username + "@" + address
+}
+
+// Set stores the password of an account, reporting whether it replaced a
+// different one
+func (c *Credentials) Set(host string, port int, username, password string) bool {
+	key := accountKey(Address(host, port), username)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, known := c.passwords[key]
+	if known && previous == password {
+		return false
+	}
+
+	c.passwords[key] = password
+	if known {
+		c.changes[key]++
+	}
+
+	return known
+}
+
+// Known reports whether the store holds the password of an account
+func (c *Credentials) Known(host string, port int, username string) bool {
+	_, _, ok := c.current(Address(host, port), username)
+	return ok
+}
+
+// current returns the password of an account and how many times it changed,
+// false when the account is unknown
+func (c *Credentials) current(address, username string) (string, uint64, bool) {
+	key := accountKey(address, username)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	password, ok := c.passwords[key]
+	return password, c.changes[key], ok
+}
+
+// changed reports whether the password of an account changed more than
+// seen times
+func (c *Credentials) changed(address, username string, seen uint64) bool {
+	key := accountKey(address, username)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.changes[key] != seen
+}
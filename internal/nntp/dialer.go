@@ -0,0 +1,200 @@
+package nntp
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+)
+
+var (
+	// keepAliveDefault is used when the provider has no connection TTL
+	keepAliveDefault = 10 * time.Minute
+	// operationTimeoutDefault bounds every command, as in the pool's client
+	operationTimeoutDefault = 30 * time.Second
+)
+
+// Endpoint is the protocol settings of the providers on a server
+type Endpoint struct {
+	// Compress negotiates COMPRESS DEFLATE after authentication
+	Compress bool
+	// StartTLS upgrades plain text connections to TLS when the server supports it
+	StartTLS bool
+	// InsecureSSL skips the verification of the certificate presented after STARTTLS
+	InsecureSSL bool
+	// ServerName is sent with SNI and verified against the certificate instead of the dialed host
+	ServerName string
+}
+
+var _ nntpcli.Client = (*Dialer)(nil)
+
+// Dialer dials the servers with custom endpoint settings itself and leaves
+// the others to the pool's client
+type Dialer struct {
+	base      nntpcli.Client
+	endpoints map[string]Endpoint
+	// trace dials every server itself to log the commands of its connections
+	trace bool
+	// connections numbers the traced connections
+	connections atomic.Uint64
+	// chaos holds the faults injected into article requests
+	chaos Chaos
+	// headers dials every server itself so article headers can be read
+	headers bool
+	// credentials holds the current passwords, every server is dialed
+	// itself so connections can be replaced when they change
+	credentials *Credentials
+}
+
+// Option configures a Dialer
+type Option func(*Dialer)
+
+// WithTrace logs every command sent and every status line received, with the
+// connection number and the server, AUTHINFO arguments redacted. Every server
+// is dialed by the Dialer, the pool's client cannot be traced.
+func WithTrace() Option {
+	return func(d *Dialer) {
+		d.trace = true
+	}
+}
+
+// WithHeaders dials every server with connections able to read article
+// headers with HEAD and to list those of article ranges with HDR or OVER,
+// which the pool's client cannot
+func WithHeaders() Option {
+	return func(d *Dialer) {
+		d.headers = true
+	}
+}
+
+// NewDialer returns a dialer applying endpoints, keyed by host:port
+func NewDialer(endpoints map[string]Endpoint, opts ...Option) *Dialer {
+	d := &Dialer{
+		base:      nntpcli.New(),
+		endpoints: endpoints,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// dialsAll tells whether the servers without endpoint settings are dialed by
+// the Dialer too, as tracing, fault injection, reading headers and reloading
+// credentials require
+func (d *Dialer) dialsAll() bool {
+	return d.trace || d.chaos.Enabled() || d.headers || d.credentials != nil
+}
+
+// Address returns the endpoint key of a server
+func Address(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// Dial connects to a server in plain text
+func (d *Dialer) Dial(ctx context.Context, host string, port int, config ...nntpcli.DialConfig) (nntpcli.Connection, error) {
+	endpoint, ok := d.endpoints[Address(host, port)]
+	if !ok && !d.dialsAll() {
+		return d.base.Dial(ctx, host, port, config...)
+	}
+
+	c, err := d.dial(ctx, host, port, endpoint, nil, config)
+	if err != nil || !endpoint.StartTLS {
+		return c, err
+	}
+
+	if err := c.startTLS(ctx, tlsConfig(host, endpoint, endpoint.InsecureSSL)); err != nil {
+		_ = c.netconn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// DialTLS connects to a server over TLS
+func (d *Dialer) DialTLS(ctx context.Context, host string, port int, insecureSSL bool, config ...nntpcli.DialConfig) (nntpcli.Connection, error) {
+	endpoint, ok := d.endpoints[Address(host, port)]
+	if !ok && !d.dialsAll() {
+		return d.base.DialTLS(ctx, host, port, insecureSSL, config...)
+	}
+
+	return d.dial(ctx, host, port, endpoint, tlsConfig(host, endpoint, insecureSSL), config)
+}
+
+// tlsConfig returns the TLS settings used to connect to host
+func tlsConfig(host string, endpoint Endpoint, insecureSSL bool) *tls.Config {
+	serverName := host
+	if endpoint.ServerName != "" {
+		serverName = endpoint.ServerName
+	}
+
+	return &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSSL,
+	}
+}
+
+// dial opens the connection, over TLS when tlsConfig is set, and reads the greeting
+func (d *Dialer) dial(
+	ctx context.Context,
+	host string,
+	port int,
+	endpoint Endpoint,
+	tlsConfig *tls.Config,
+	config []nntpcli.DialConfig,
+) (*conn, error) {
+	var cfg nntpcli.DialConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	keepAlive := cfg.KeepAliveTime
+	if keepAlive == 0 {
+		keepAlive = keepAliveDefault
+	}
+
+	dialer := net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: keepAlive}
+	netconn, err := dialer.DialContext(ctx, "tcp", Address(host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	if tcpConn, ok := netconn.(*net.TCPConn); ok {
+		_ = tcpConn.SetNoDelay(true)
+	}
+
+	if tlsConfig != nil {
+		tlsConn := tls.Client(netconn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = netconn.Close()
+			return nil, err
+		}
+
+		netconn = tlsConn
+	}
+
+	var trace *tracer
+	if d.trace {
+		trace = &tracer{id: d.connections.Add(1), server: Address(host, port)}
+		slog.Info("NNTP connected", "conn", trace.id, "server", trace.server, "tls", tlsConfig != nil)
+	}
+
+	c, err := newConn(netconn, time.Now().Add(keepAlive), operationTimeoutDefault, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	c.compress = endpoint.Compress
+	c.chaos = d.chaos
+	c.server = Address(host, port)
+	c.credentials = d.credentials
+
+	return c, nil
+}
@@ -0,0 +1,229 @@
+package nntp
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+)
+
+const (
+	statusHeadFollows    = 221
+	statusHeadersFollow  = 225
+	statusOverviewFollow = 224
+	statusNoArticles     = 423
+	statusUnknownCommand = 500
+)
+
+// overviewFields is the position of the headers in an OVER line, after the article number
+var overviewFields = map[string]int{
+	"subject":    1,
+	"from":       2,
+	"date":       3,
+	"message-id": 4,
+	"references": 5,
+}
+
+// Group selects a newsgroup and returns the numbers of its first and last articles
+func (c *conn) Group(group string) (low, high int, err error) {
+	if err := c.begin(); err != nil {
+		return 0, 0, err
+	}
+	defer c.endOperation(&err)
+
+	_, line, err := c.cmd(nntpcli.StatusGroupSelected, "GROUP %s", group)
+	if err != nil {
+		return 0, 0, fmt.Errorf("GROUP %s: %w", group, err)
+	}
+
+	// 211 count low high group
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return 0, 0, fmt.Errorf("GROUP %s: invalid response %q", group, line)
+	}
+
+	low, lowErr := strconv.Atoi(fields[1])
+	high, highErr := strconv.Atoi(fields[2])
+	if lowErr != nil || highErr != nil {
+		return 0, 0, fmt.Errorf("GROUP %s: invalid response %q", group, line)
+	}
+
+	c.joinedGroup = group
+
+	return low, high, nil
+}
+
+// Headers calls fn with the number and the value of a header field of every
+// article numbered from low to high in the selected group, skipping missing
+// articles. HDR is used when the server knows it, OVER or XOVER otherwise,
+// which only carry the overview fields (subject, from, date, message-id, references).
+func (c *conn) Headers(field string, low, high int, fn func(number int, value string)) (err error) {
+	if err := c.begin(); err != nil {
+		return err
+	}
+	defer c.endOperation(&err)
+
+	var unsupported error
+	for _, command := range c.headerCommands() {
+		var lines []string
+		if command == "HDR" {
+			lines, err = c.list(statusHeadersFollow, "HDR %s %d-%d", field, low, high)
+		} else {
+			lines, err = c.list(statusOverviewFollow, "%s %d-%d", command, low, high)
+		}
+
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) && protoErr.Code == statusUnknownCommand {
+			unsupported = err
+			continue
+		}
+		if errors.As(err, &protoErr) && protoErr.Code == statusNoArticles {
+			c.headerCommand = command
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s %d-%d: %w", command, low, high, err)
+		}
+
+		c.headerCommand = command
+		if command == "HDR" {
+			parseHeaders(lines, fn)
+		} else if err := parseOverview(lines, field, fn); err != nil {
+			return fmt.Errorf("%s %d-%d: %w", command, low, high, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("HDR %d-%d: the server supports neither HDR nor OVER: %w", low, high, unsupported)
+}
+
+// headerCommands returns the listing commands to try, the one known to work first
+func (c *conn) headerCommands() []string {
+	if c.headerCommand != "" {
+		return []string{c.headerCommand}
+	}
+
+	return []string{"HDR", "OVER", "XOVER"}
+}
+
+// list sends a command answered with a multi-line block and reads the block
+func (c *conn) list(expectCode int, format string, args ...any) ([]string, error) {
+	c.trace.command(format, args...)
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		c.trace.response(0, "", err)
+		return nil, err
+	}
+
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+
+	code, line, err := c.text.ReadCodeLine(expectCode)
+	c.trace.response(code, line, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.text.ReadDotLines()
+}
+
+// parseHeaders reads HDR lines, "number value"
+func parseHeaders(lines []string, fn func(number int, value string)) {
+	for _, line := range lines {
+		number, value, _ := strings.Cut(line, " ")
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			continue
+		}
+
+		fn(n, strings.TrimSpace(value))
+	}
+}
+
+// parseOverview reads OVER lines, tab separated fields after the article number
+func parseOverview(lines []string, field string, fn func(number int, value string)) error {
+	index, ok := overviewFields[strings.ToLower(field)]
+	if !ok {
+		return fmt.Errorf("header %s is not an overview field", field)
+	}
+
+	for _, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) <= index {
+			continue
+		}
+
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+
+		fn(n, strings.TrimSpace(fields[index]))
+	}
+
+	return nil
+}
+
+// Head returns the headers of an article
+func (c *conn) Head(msgID string) (header textproto.MIMEHeader, err error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.endOperation(&err)
+
+	if err := c.inject("HEAD", msgID); err != nil {
+		return nil, err
+	}
+
+	c.trace.command("HEAD <%s>", msgID)
+	id, err := c.text.Cmd("HEAD <%s>", msgID)
+	if err != nil {
+		c.trace.response(0, "", err)
+		return nil, fmt.Errorf("HEAD <%s>: %w", msgID, err)
+	}
+
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+
+	code, line, err := c.text.ReadCodeLine(statusHeadFollows)
+	c.trace.response(code, line, err)
+	if err != nil {
+		return nil, fmt.Errorf("HEAD <%s>: %w", msgID, formatError(err))
+	}
+
+	// The headers end with the terminating dot line instead of a blank line
+	lines, err := c.text.ReadDotLines()
+	if err != nil {
+		return nil, fmt.Errorf("HEAD <%s>: %w", msgID, err)
+	}
+
+	return parseHead(lines), nil
+}
+
+// parseHead reads header lines, continuation lines are folded into the previous header
+func parseHead(lines []string) textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+
+	var key string
+	for _, line := range lines {
+		if key != "" && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			values := header[key]
+			values[len(values)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		key = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		header.Add(key, strings.TrimSpace(value))
+	}
+
+	return header
+}
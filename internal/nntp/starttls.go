@@ -0,0 +1,42 @@
+package nntp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/textproto"
+)
+
+// statusContinueWithTLS is the answer to a STARTTLS command the server accepts
+const statusContinueWithTLS = 382
+
+// startTLS upgrades the connection to TLS with STARTTLS (RFC 4642). It is
+// opportunistic: servers refusing it keep being used in plain text.
+func (c *conn) startTLS(ctx context.Context, config *tls.Config) (err error) {
+	if err := c.setDeadline(); err != nil {
+		return err
+	}
+	defer c.endOperation(&err)
+
+	if _, _, err := c.cmd(statusContinueWithTLS, "STARTTLS"); err != nil {
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) {
+			slog.Warn("NNTP server does not support STARTTLS, continuing in plain text", "server", config.ServerName, "error", err)
+			return nil
+		}
+
+		return fmt.Errorf("STARTTLS: %w", err)
+	}
+
+	tlsConn := tls.Client(c.netconn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("STARTTLS: %w", err)
+	}
+
+	c.netconn = tlsConn
+	c.text = textproto.NewConn(tlsConn)
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package nntp
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tracer logs the commands sent on a connection and the status lines
+// answering them. Article data is not logged, only its status line.
+type tracer struct {
+	id     uint64
+	server string
+	sent   time.Time
+}
+
+// command logs a command line, with the arguments of AUTHINFO redacted
+func (t *tracer) command(format string, args ...any) {
+	if t == nil {
+		return
+	}
+
+	t.sent = time.Now()
+	slog.Info("NNTP >", "conn", t.id, "server", t.server, "line", redact(fmt.Sprintf(format, args...)))
+}
+
+// response logs the status line answering the last command, or the error
+// reading it when the server did not answer one
+func (t *tracer) response(code int, msg string, err error) {
+	if t == nil {
+		return
+	}
+
+	var elapsed time.Duration
+	if !t.sent.IsZero() {
+		elapsed = time.Since(t.sent).Round(time.Microsecond)
+	}
+
+	if code == 0 && err != nil {
+		slog.Info("NNTP <", "conn", t.id, "server", t.server, "error", err, "elapsed", elapsed)
+		return
+	}
+
+	line := strconv.Itoa(code)
+	if msg != "" {
+		line += " " + msg
+	}
+
+	slog.Info("NNTP <", "conn", t.id, "server", t.server, "line", line, "elapsed", elapsed)
+}
+
+// redact hides the user name and password of AUTHINFO commands
+func redact(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.EqualFold(fields[0], "AUTHINFO") {
+		return line
+	}
+
+	return fields[0] + " " + fields[1] + " [redacted]"
+}
@@ -2,9 +2,11 @@ package nzb
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nzb-touch/internal/errcode"
 )
 
 // NZB represents a parsed NZB file with access to its details
@@ -16,15 +18,20 @@ type NZB struct {
 func LoadFromFile(nzbFilePath string) (*NZB, error) {
 	file, err := os.Open(nzbFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open NZB file: %w", err)
+		return nil, errcode.Wrap(errcode.NZBUnreadable, fmt.Errorf("failed to open NZB file: %w", err))
 	}
 	defer func() {
 		_ = file.Close()
 	}()
 
-	nzb, err := nzbparser.Parse(file)
+	return Parse(file)
+}
+
+// Parse parses an NZB, e.g. received over the network
+func Parse(r io.Reader) (*NZB, error) {
+	nzb, err := nzbparser.Parse(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse NZB file: %w", err)
+		return nil, errcode.Wrap(errcode.Parse, fmt.Errorf("failed to parse NZB file: %w", err))
 	}
 
 	// Scan for additional information
@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/errcode"
+)
+
+// Event identifies the point at which plugins are invoked
+type Event string
+
+const (
+	// EventPreCheck is dispatched before an NZB is checked. A plugin exiting
+	// with a non-zero status causes the check to be skipped.
+	EventPreCheck Event = "pre_check"
+	// EventPostCheck is dispatched after every check, successful or not
+	EventPostCheck Event = "post_check"
+	// EventOnFailure is dispatched after a check that failed
+	EventOnFailure Event = "on_failure"
+	// EventDegraded is dispatched when a previously healthy NZB is taken down or decays
+	EventDegraded Event = "degraded"
+	// EventRetentionWarning is dispatched when the NZB is close to the provider retention horizon
+	EventRetentionWarning Event = "retention_warning"
+	// EventProviderAlert is dispatched when the error rate of a provider exceeds the alert threshold
+	EventProviderAlert Event = "provider_alert"
+)
+
+var timeoutDefault = 30 * time.Second
+
+// ErrRejected is returned by Dispatch when a plugin exits with a non-zero
+// status. A plugin that cannot be run or times out does not reject.
+var ErrRejected = errors.New("rejected by the plugin")
+
+// Config describes an external executable invoked at the configured events
+type Config struct {
+	Name    string        `yaml:"name"`
+	Command string        `yaml:"command"` // Path to the executable
+	Args    []string      `yaml:"args"`    // Extra arguments passed to the executable
+	Events  []Event       `yaml:"events"`  // Events the plugin subscribes to
+	Timeout time.Duration `yaml:"timeout"` // Maximum execution time (default: 30s)
+}
+
+// Payload is the JSON document written to the plugin's stdin
+type Payload struct {
+	Event     Event     `json:"event"`
+	NzbPath   string    `json:"nzb_path"`
+	Timestamp time.Time `json:"timestamp"`
+	Result    any       `json:"result,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	// Stable code of the error, e.g. E_MISSING_THRESHOLD, to branch on instead of the message
+	ErrorCode errcode.Code `json:"error_code,omitempty"`
+}
+
+// Manager runs the configured plugins
+type Manager struct {
+	plugins []Config
+}
+
+// NewManager creates a plugin manager, plugins without a command are ignored
+func NewManager(plugins []Config) *Manager {
+	m := &Manager{}
+	for _, p := range plugins {
+		if p.Command == "" {
+			continue
+		}
+
+		if p.Name == "" {
+			p.Name = p.Command
+		}
+
+		if p.Timeout <= 0 {
+			p.Timeout = timeoutDefault
+		}
+
+		m.plugins = append(m.plugins, p)
+	}
+
+	return m
+}
+
+// Validate checks that every plugin subscribes to known events
+func Validate(plugins []Config) error {
+	for _, p := range plugins {
+		if p.Command == "" {
+			return fmt.Errorf("plugin %q: command is required", p.Name)
+		}
+
+		for _, e := range p.Events {
+			switch e {
+			case EventPreCheck, EventPostCheck, EventOnFailure, EventDegraded, EventRetentionWarning, EventProviderAlert:
+			default:
+				return fmt.Errorf("plugin %q: unknown event %q", p.Name, e)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Dispatch invokes every plugin subscribed to the payload event, in order.
+// All plugins are run even if one fails; the returned error joins all failures.
+func (m *Manager) Dispatch(ctx context.Context, payload Payload) error {
+	if m == nil || len(m.plugins) == 0 {
+		return nil
+	}
+
+	if payload.Timestamp.IsZero() {
+		payload.Timestamp = time.Now()
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode plugin payload: %w", err)
+	}
+
+	var errs []error
+	for _, p := range m.plugins {
+		if !slices.Contains(p.Events, payload.Event) {
+			continue
+		}
+
+		if err := run(ctx, p, data); err != nil {
+			slog.WarnContext(ctx, "Plugin execution failed",
+				"plugin", p.Name,
+				"event", payload.Event,
+				"path", payload.NzbPath,
+				"error", err)
+			errs = append(errs, fmt.Errorf("plugin %s: %w", p.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DispatchResult dispatches the post-check event and, when err is not nil,
+// the on-failure event for a finished check
+func (m *Manager) DispatchResult(ctx context.Context, nzbPath string, result any, err error) {
+	payload := Payload{Event: EventPostCheck, NzbPath: nzbPath, Result: result}
+	if err != nil {
+		payload.Error = err.Error()
+		payload.ErrorCode = errcode.Of(err)
+	}
+
+	_ = m.Dispatch(ctx, payload)
+
+	if err != nil {
+		payload.Event = EventOnFailure
+		_ = m.Dispatch(ctx, payload)
+	}
+}
+
+// run executes a single plugin writing the payload to its stdin
+func run(ctx context.Context, p Config, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if len(out) > 0 {
+		slog.DebugContext(ctx, "Plugin output", "plugin", p.Name, "output", string(out))
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && ctx.Err() == nil {
+			err = fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+
+		if stderr.Len() > 0 {
+			return fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/events"
+)
+
+// BandwidthPeriod is the period a bandwidth budget is granted for
+type BandwidthPeriod string
+
+const (
+	// PeriodDay grants the budget every day, from midnight local time
+	PeriodDay BandwidthPeriod = "day"
+	// PeriodWeek grants the budget every week, from Monday midnight local time
+	PeriodWeek BandwidthPeriod = "week"
+)
+
+// BandwidthLimit is the bytes the checks may download per period
+type BandwidthLimit struct {
+	Bytes  int64 // 0 for no limit
+	Period BandwidthPeriod
+}
+
+// byteUnits are the sizes of the units of bandwidth limits and speeds, decimal as sold
+// by providers or binary
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// parseSize returns the bytes of a size made of a number and a unit of byteUnits
+func parseSize(number, unit string) (int64, error) {
+	size, ok := byteUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q, expected B, KB, MB, GB, TB or KiB, MiB, GiB, TiB", unit)
+	}
+
+	value, _ := strconv.ParseFloat(number, 64)
+	bytes := value * size
+	if bytes < 1 || bytes > math.MaxInt64 {
+		return 0, errors.New("out of range")
+	}
+
+	return int64(bytes), nil
+}
+
+// bandwidthLimitPattern matches a bandwidth limit, e.g. "200GB/day"
+var bandwidthLimitPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-z]*)\s*/\s*([a-z]+)$`)
+
+// ParseBandwidthLimit parses a bandwidth limit such as "200GB/day" or
+// "1.5TiB/week", empty means no limit
+func ParseBandwidthLimit(s string) (BandwidthLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return BandwidthLimit{}, nil
+	}
+
+	m := bandwidthLimitPattern.FindStringSubmatch(strings.ToLower(s))
+	if m == nil {
+		return BandwidthLimit{}, fmt.Errorf("invalid bandwidth limit %q, expected a size per day or week, e.g. 200GB/day", s)
+	}
+
+	period := BandwidthPeriod(m[3])
+	switch period {
+	case PeriodDay, PeriodWeek:
+	default:
+		return BandwidthLimit{}, fmt.Errorf("invalid bandwidth limit %q, unknown period %q, expected day or week", s, m[3])
+	}
+
+	bytes, err := parseSize(m[1], m[2])
+	if err != nil {
+		return BandwidthLimit{}, fmt.Errorf("invalid bandwidth limit %q, %w", s, err)
+	}
+
+	return BandwidthLimit{Bytes: bytes, Period: period}, nil
+}
+
+// String formats the limit as parsed by ParseBandwidthLimit
+func (l BandwidthLimit) String() string {
+	if l.Bytes == 0 {
+		return ""
+	}
+
+	return formatBytes(l.Bytes) + "/" + string(l.Period)
+}
+
+// formatBytes formats a size in the largest decimal unit it fills
+func formatBytes(n int64) string {
+	for _, u := range []struct {
+		name string
+		size float64
+	}{{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3}} {
+		if float64(n) >= u.size {
+			return strconv.FormatFloat(math.Round(float64(n)/u.size*100)/100, 'f', -1, 64) + u.name
+		}
+	}
+
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+// periodStart returns the start of the period containing t
+func (l BandwidthLimit) periodStart(t time.Time) time.Time {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if l.Period == PeriodWeek {
+		// Weeks start on Monday
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	}
+
+	return start
+}
+
+// periodEnd returns the end of the period containing t
+func (l BandwidthLimit) periodEnd(t time.Time) time.Time {
+	if l.Period == PeriodWeek {
+		return l.periodStart(t).AddDate(0, 0, 7)
+	}
+
+	return l.periodStart(t).AddDate(0, 0, 1)
+}
+
+// WithBandwidthLimit stops starting checks once they downloaded the bytes of
+// the limit during its period, until the next period
+func WithBandwidthLimit(limit BandwidthLimit) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.bandwidthLimit = limit
+	}
+}
+
+// createBandwidth creates the table counting the bytes downloaded each day
+func createBandwidth(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS bandwidth (
+			day TEXT PRIMARY KEY,
+			bytes INTEGER NOT NULL DEFAULT 0
+		)
+	`)
+	return err
+}
+
+// AddBandwidth counts bytes downloaded at t
+func (q *Queue) AddBandwidth(t time.Time, bytes int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, err := q.db.Exec(
+		"INSERT INTO bandwidth (day, bytes) VALUES (?, ?) ON CONFLICT(day) DO UPDATE SET bytes = bytes + excluded.bytes",
+		t.Format(dayLayout), bytes,
+	)
+	if err != nil {
+		slog.Error("Failed to count downloaded bytes", "error", err)
+	}
+}
+
+// BandwidthSince returns the bytes downloaded since the day of t, that day included
+func (q *Queue) BandwidthSince(t time.Time) int64 {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var bytes int64
+	err := q.db.QueryRow("SELECT COALESCE(SUM(bytes), 0) FROM bandwidth WHERE day >= ?", t.Format(dayLayout)).Scan(&bytes)
+	if err != nil {
+		slog.Error("Failed to sum downloaded bytes", "error", err)
+	}
+
+	return bytes
+}
+
+// recordBandwidth counts the bytes downloaded by a finished check against
+// the bandwidth limit
+func (s *DirectoryScanner) recordBandwidth(_ context.Context, e events.Event) {
+	if s.bandwidthLimit.Bytes == 0 {
+		return
+	}
+
+	if result := eventResult(e); result != nil && result.BytesDownloaded > 0 {
+		s.queue.AddBandwidth(time.Now(), result.BytesDownloaded)
+	}
+}
+
+// bandwidthExhausted reports whether the checks downloaded the bytes of the
+// bandwidth limit during the current period, publishing BandwidthExhausted
+// the first time it happens each period
+func (s *DirectoryScanner) bandwidthExhausted(ctx context.Context) bool {
+	if s.bandwidthLimit.Bytes == 0 {
+		return false
+	}
+
+	now := time.Now()
+	start := s.bandwidthLimit.periodStart(now)
+	used := s.queue.BandwidthSince(start)
+	if used < s.bandwidthLimit.Bytes {
+		return false
+	}
+
+	period := start.Format(dayLayout)
+
+	s.quotaMu.Lock()
+	alreadyPublished := s.bandwidthExhaustedPeriod == period
+	s.bandwidthExhaustedPeriod = period
+	s.quotaMu.Unlock()
+
+	if !alreadyPublished {
+		slog.WarnContext(ctx, "Bandwidth budget exhausted, no check starts until the next period",
+			"used_bytes", used, "limit", s.bandwidthLimit.String(), "resumes", s.bandwidthLimit.periodEnd(now).Format(time.RFC3339))
+		s.bus.Publish(ctx, events.Event{Type: events.BandwidthExhausted})
+	}
+
+	return true
+}
+
+// limitReached reports whether the daily processing limit or the bandwidth
+// budget stops new checks
+func (s *DirectoryScanner) limitReached(ctx context.Context) bool {
+	return s.dailyLimitReached(ctx) || s.bandwidthExhausted(ctx)
+}
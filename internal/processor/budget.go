@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// connectionBudget limits the segment requests in flight across every NZB
+// processed concurrently by the same Processor, so parallel jobs share the
+// provider connections instead of each assuming the full worker count
+type connectionBudget struct {
+	slots  chan struct{}
+	active atomic.Int32 // NZBs currently being processed
+}
+
+func newConnectionBudget(size int) *connectionBudget {
+	return &connectionBudget{slots: make(chan struct{}, size)}
+}
+
+// acquire blocks until a request slot is free or ctx is done
+func (b *connectionBudget) acquire(ctx context.Context) error {
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a request slot
+func (b *connectionBudget) release() {
+	<-b.slots
+}
+
+// join registers a new NZB and returns its fair share of the budget, the
+// returned function must be called once the NZB is done
+func (b *connectionBudget) join() (int, func()) {
+	active := int(b.active.Add(1))
+	size := cap(b.slots)
+
+	share := (size + active - 1) / active
+	if share < 1 {
+		share = 1
+	}
+
+	return share, func() {
+		b.active.Add(-1)
+	}
+}
@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/category"
+)
+
+// WithCategories applies per-category thresholds, reprocessing intervals and
+// failed directories to the NZBs matching each category
+func WithCategories(categories []category.Category) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.categories = categories
+	}
+}
+
+// CategoryCheckOptions returns opts with the overrides of category c, opts when c is nil
+func CategoryCheckOptions(opts CheckOptions, c *category.Category) CheckOptions {
+	if c == nil {
+		return opts
+	}
+
+	if c.CheckPercent > 0 {
+		opts.CheckPercent = c.CheckPercent
+	}
+
+	if c.MissingPercent != nil {
+		opts.MissingPercent = *c.MissingPercent
+	}
+
+	if c.SamplingStrategy != "" {
+		opts.Sampling = SamplingStrategy(c.SamplingStrategy)
+	}
+
+	return opts
+}
+
+// reprocessIntervalFor returns the reprocessing interval of the items of a category
+func (s *DirectoryScanner) reprocessIntervalFor(name string) time.Duration {
+	if c := category.Named(s.categories, name); c != nil && c.ReprocessInterval > 0 {
+		return c.ReprocessInterval
+	}
+
+	return s.reprocessInterval
+}
+
+// shortestReprocessInterval returns the smallest reprocessing interval in use, 0 when reprocessing is disabled
+func (s *DirectoryScanner) shortestReprocessInterval() time.Duration {
+	shortest := s.reprocessInterval
+	for _, c := range s.categories {
+		if c.ReprocessInterval > 0 && (shortest <= 0 || c.ReprocessInterval < shortest) {
+			shortest = c.ReprocessInterval
+		}
+	}
+
+	return shortest
+}
+
+// failedDirectoryFor returns where a failed NZB is moved to, following its category
+func (s *DirectoryScanner) failedDirectoryFor(filePath string) string {
+	if len(s.categories) > 0 {
+		if c := category.Named(s.categories, s.queue.Category(filePath)); c != nil && c.FailedDirectory != "" {
+			return c.FailedDirectory
+		}
+	}
+
+	return s.failedDirectory
+}
@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// CheckFile queues an NZB and checks it right away, outside the workers, the
+// daily limit and the bandwidth budget, then handles the outcome like a worker: a failed NZB is
+// moved to its failed directory. It returns the check error.
+func (s *DirectoryScanner) CheckFile(ctx context.Context, filePath string) error {
+	filePath = s.canonicalPath(ctx, filePath)
+	s.queue.Add(filePath)
+
+	if !s.queue.Start(filePath, time.Time{}) {
+		return fmt.Errorf("%s is already being checked", filePath)
+	}
+
+	diskPath := fsutil.DiskPath(filePath)
+	err := s.processFile(ctx, diskPath)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if errors.Is(err, ErrProvidersDown) || errors.Is(err, errVetoed) {
+		s.queue.Requeue(filePath)
+		return err
+	}
+
+	if err != nil {
+		s.moveFailed(ctx, diskPath)
+	}
+	s.queue.Finish(filePath, err != nil)
+
+	return err
+}
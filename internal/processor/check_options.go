@@ -0,0 +1,242 @@
+package processor
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+)
+
+// SamplingStrategy selects which segments are checked when only a
+// percentage of the NZB is verified
+type SamplingStrategy string
+
+const (
+	// SamplingRandom picks segments at random
+	SamplingRandom SamplingStrategy = "random"
+	// SamplingSpread picks segments evenly spaced across the file
+	SamplingSpread SamplingStrategy = "spread"
+)
+
+// CheckOptions holds the per-run settings of an NZB check
+type CheckOptions struct {
+	CheckPercent   int              // Percentage of segments to check (1-100)
+	MissingPercent int              // Allowed percentage of missing segments (0-100)
+	Sampling       SamplingStrategy // How segments are selected when CheckPercent < 100
+	Timeout        time.Duration    // Time budget of a single NZB check, the result is partial once exceeded (0 = no limit)
+	Source         string           // Identifies the NZB in spilled segment results, usually its path
+	Only           []string         // Glob patterns, when set only files whose name matches one are checked
+	Skip           []string         // Glob patterns of file names that are not checked
+	IncludeSamples bool             // Check sample/proof files, by default they are excluded from the check
+	MinPar2Percent float64          // PAR2 recovery data, as a percentage of the payload, below which the result is flagged (0 = default 5%)
+	HeaderSamples  int              // Articles at the start of each file whose headers are read into the result (0 = disabled)
+	// Download the first article of the first RAR volume to read from the
+	// archive headers whether the release is password protected
+	EncryptionProbe bool
+	// Thresholds and actions of the error classes handled apart from MissingPercent
+	ErrorClasses map[ErrorClass]ClassPolicy
+	// Attempts required before a segment reported missing counts as missing
+	Confirmations Confirmations
+}
+
+// samplePattern recognizes sample and proof files by a "sample" or "proof"
+// word in their name, e.g. "movie-sample.mkv" or "Proof/proof.jpg"
+var samplePattern = regexp.MustCompile(`(?i)(^|[^a-z0-9])(sample|proof)([^a-z0-9]|$)`)
+
+// DefaultCheckOptions returns options that check every segment and allow none to be missing
+func DefaultCheckOptions() CheckOptions {
+	return CheckOptions{
+		CheckPercent:   100,
+		MissingPercent: 0,
+		Sampling:       SamplingRandom,
+	}
+}
+
+// Validate checks that the options are within their allowed ranges
+func (o CheckOptions) Validate() error {
+	if o.CheckPercent <= 0 || o.CheckPercent > 100 {
+		return fmt.Errorf("checkpercent must be between 1 and 100")
+	}
+
+	if o.MissingPercent < 0 || o.MissingPercent > 100 {
+		return fmt.Errorf("missingpercent must be between 0 and 100")
+	}
+
+	switch o.Sampling {
+	case "", SamplingRandom, SamplingSpread:
+	default:
+		return fmt.Errorf("unknown sampling strategy %q", o.Sampling)
+	}
+
+	if o.MinPar2Percent < 0 {
+		return fmt.Errorf("minimum par2 percent must not be negative")
+	}
+
+	if o.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+
+	if o.HeaderSamples < 0 {
+		return fmt.Errorf("header samples must not be negative")
+	}
+
+	if err := o.validateErrorClasses(); err != nil {
+		return err
+	}
+
+	if err := o.Confirmations.validate(); err != nil {
+		return err
+	}
+
+	for _, pattern := range append(slices.Clone(o.Only), o.Skip...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// minPar2Percent returns the parity coverage below which a result is flagged
+func (o CheckOptions) minPar2Percent() float64 {
+	if o.MinPar2Percent > 0 {
+		return o.MinPar2Percent
+	}
+
+	return par2MinPercentDefault
+}
+
+// matchesAny reports whether the file name matches one of the glob patterns, ignoring case
+func matchesAny(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fileName returns the name of a file, its subject when no name was parsed
+func fileName(file nzbparser.NzbFile) string {
+	if file.Filename != "" {
+		return file.Filename
+	}
+
+	return file.Subject
+}
+
+// selectFiles returns the files of the NZB selected by the Only and Skip
+// patterns, without sample/proof files unless IncludeSamples is set
+func (o CheckOptions) selectFiles(files []nzbparser.NzbFile) []nzbparser.NzbFile {
+	if len(o.Only) > 0 || len(o.Skip) > 0 {
+		selected := make([]nzbparser.NzbFile, 0, len(files))
+		for _, file := range files {
+			name := fileName(file)
+			if len(o.Only) > 0 && !matchesAny(o.Only, name) {
+				continue
+			}
+
+			if matchesAny(o.Skip, name) {
+				continue
+			}
+
+			selected = append(selected, file)
+		}
+		files = selected
+	}
+
+	if o.IncludeSamples {
+		return files
+	}
+
+	withoutSamples := make([]nzbparser.NzbFile, 0, len(files))
+	for _, file := range files {
+		if !samplePattern.MatchString(fileName(file)) {
+			withoutSamples = append(withoutSamples, file)
+		}
+	}
+
+	// An NZB holding nothing but a sample is checked as is
+	if len(withoutSamples) == 0 {
+		return files
+	}
+
+	return withoutSamples
+}
+
+// segmentsToCheck returns how many of totalSegments will be checked
+func (o CheckOptions) segmentsToCheck(totalSegments int) int {
+	if o.CheckPercent >= 100 || totalSegments == 0 {
+		return totalSegments
+	}
+
+	segmentsToCheck := (totalSegments * o.CheckPercent) / 100
+	if segmentsToCheck == 0 {
+		segmentsToCheck = 1 // Always check at least one segment
+	}
+
+	return segmentsToCheck
+}
+
+// segmentSelector decides, one index at a time, whether a segment is checked.
+// It keeps O(1) state so files with millions of segments do not need a
+// selection set held in memory.
+type segmentSelector struct {
+	sampling   SamplingStrategy
+	total      int // Segments in the file
+	wanted     int // Segments to select
+	seen       int // Indices visited so far
+	selected   int // Indices selected so far
+	nextSpread int // Next index selected by the spread strategy
+}
+
+// newSegmentSelector creates a selector over totalSegments indices
+func (o CheckOptions) newSegmentSelector(totalSegments int) *segmentSelector {
+	return &segmentSelector{
+		sampling: o.Sampling,
+		total:    totalSegments,
+		wanted:   o.segmentsToCheck(totalSegments),
+	}
+}
+
+// next reports whether the next index in order is selected
+func (s *segmentSelector) next() bool {
+	if s.seen >= s.total || s.selected >= s.wanted {
+		s.seen++
+		return false
+	}
+
+	idx := s.seen
+	s.seen++
+
+	var selected bool
+	switch {
+	case s.wanted >= s.total:
+		// Check all segments
+		selected = true
+	case s.sampling == SamplingSpread:
+		selected = idx == s.nextSpread
+	default:
+		// Selection sampling (Knuth's algorithm S): every subset of size
+		// wanted is equally likely without storing the chosen indices
+		remaining := s.total - idx
+		needed := s.wanted - s.selected
+		selected = rand.Intn(remaining) < needed
+	}
+
+	if selected {
+		s.selected++
+		if s.sampling == SamplingSpread && s.selected < s.wanted {
+			s.nextSpread = s.selected * s.total / s.wanted
+		}
+	}
+
+	return selected
+}
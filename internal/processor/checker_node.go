@@ -0,0 +1,155 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/api"
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/nzb"
+)
+
+// checkerRetryDelay is how long a checker node waits before claiming again
+// after the scanner node could not be reached
+var checkerRetryDelay = 10 * time.Second
+
+// RunChecker runs workers concurrent checks of the jobs pulled from a scanner
+// node until ctx is done. The scanner node keeps the queue and handles the
+// outcomes, the checker node only needs its NNTP providers. After an outage
+// of every provider no job is claimed for outageRetry.
+func RunChecker(ctx context.Context, proc *Processor, client *api.Client, workers int, outageRetry time.Duration) error {
+	if outageRetry <= 0 {
+		outageRetry = outageRetryIntervalDefault
+	}
+
+	owner := newLeaseOwner()
+
+	// Leave the host and its network to other work while they are busy
+	proc.runLoadThrottle(ctx)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	for i := range max(workers, 1) {
+		wg.Go(func() {
+			worker := fmt.Sprintf("%s/%d", owner, i)
+			if err := runCheckerWorker(ctx, proc, client, worker, outageRetry); err != nil {
+				cancel(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if err := context.Cause(ctx); !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// runCheckerWorker claims and checks jobs one at a time, it returns an error
+// when the scanner node does not hand jobs out
+func runCheckerWorker(ctx context.Context, proc *Processor, client *api.Client, worker string, outageRetry time.Duration) error {
+	for ctx.Err() == nil {
+		j, err := client.ClaimJob(ctx, worker)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case errcode.Of(err) == errcode.JobsDisabled:
+			return err
+		case err != nil:
+			slog.WarnContext(ctx, "Failed to claim a job from the scanner node", "retry_in", checkerRetryDelay, "error", err)
+			_ = sleepContext(ctx, checkerRetryDelay)
+			continue
+		case j == nil:
+			continue
+		}
+
+		outcome := runJob(ctx, proc, client, j)
+
+		// The scanner node hands the job out again once its lease expires
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := client.CompleteJob(ctx, j.ID, outcome); err != nil {
+			slog.WarnContext(ctx, "Failed to report a job to the scanner node", "path", j.Path, "job", j.ID, "error", err)
+		}
+
+		if outcome.Code == errcode.ProvidersDown {
+			slog.WarnContext(ctx, "Every provider is unreachable, pausing the checker", "retry_in", outageRetry, "error", outcome.Error)
+			_ = sleepContext(ctx, outageRetry)
+		}
+	}
+
+	return nil
+}
+
+// runJob checks the NZB of a job while renewing its lease. The check is
+// cancelled when the scanner node took the job back.
+func runJob(ctx context.Context, proc *Processor, client *api.Client, j *api.Job) api.JobOutcome {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(leaseDuration / 4)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := client.RenewJob(ctx, j.ID)
+			if errcode.Of(err) == errcode.UnknownJob {
+				slog.WarnContext(ctx, "Job taken back by the scanner node, cancelling its check", "path", j.Path, "job", j.ID)
+				cancel()
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				slog.WarnContext(ctx, "Failed to renew a job", "path", j.Path, "job", j.ID, "error", err)
+			}
+		}
+	}()
+
+	failed := func(err error) api.JobOutcome {
+		return api.JobOutcome{Error: err.Error(), Code: errcode.Of(err)}
+	}
+
+	nzbData, err := nzb.Parse(bytes.NewReader(j.NZB))
+	if err != nil {
+		return failed(err)
+	}
+
+	opts := DefaultCheckOptions()
+	if err := json.Unmarshal(j.Options, &opts); err != nil {
+		return failed(errcode.Wrap(errcode.InvalidOptions, fmt.Errorf("invalid check options: %w", err)))
+	}
+
+	slog.InfoContext(ctx, "Checking job of the scanner node", "path", j.Path, "job", j.ID)
+
+	result, err := proc.ProcessNZB(ctx, nzbData.Nzb, opts)
+
+	var outcome api.JobOutcome
+	if err != nil {
+		outcome = failed(err)
+	}
+	if result != nil {
+		if outcome.Result, err = json.Marshal(result); err != nil {
+			return failed(err)
+		}
+	}
+
+	slog.InfoContext(ctx, "Job checked", "path", j.Path, "job", j.ID, "health", fmt.Sprintf("%.1f%%", result.Health()), "error", outcome.Error)
+
+	return outcome
+}
@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CollisionPolicy decides what happens when an NZB is moved to a path that already exists
+type CollisionPolicy string
+
+const (
+	// CollisionSuffix numbers the moved file, "name.nzb" becomes "name-1.nzb"
+	CollisionSuffix CollisionPolicy = "suffix"
+	// CollisionOverwrite replaces the existing file
+	CollisionOverwrite CollisionPolicy = "overwrite"
+	// CollisionSkip leaves the NZB where it is
+	CollisionSkip CollisionPolicy = "skip"
+	// CollisionTimestamp moves the file into a subfolder named after the current time
+	CollisionTimestamp CollisionPolicy = "timestamp"
+)
+
+// collisionTimestampLayout names the subfolders of the timestamp policy
+const collisionTimestampLayout = "20060102-150405"
+
+// ParseCollisionPolicy parses a collision policy, empty means suffix
+func ParseCollisionPolicy(s string) (CollisionPolicy, error) {
+	switch policy := CollisionPolicy(s); policy {
+	case "":
+		return CollisionSuffix, nil
+	case CollisionSuffix, CollisionOverwrite, CollisionSkip, CollisionTimestamp:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown collision policy %q, expected suffix, overwrite, skip or timestamp", s)
+	}
+}
+
+// WithCollisionPolicy sets what happens when a moved NZB lands on an existing file
+func WithCollisionPolicy(policy CollisionPolicy) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.collisionPolicy = policy
+	}
+}
+
+// resolveCollision returns where a file moved to targetPath under targetRoot
+// ends up according to the policy, ok is false when it must not be moved
+func resolveCollision(policy CollisionPolicy, targetRoot, targetPath string, now time.Time) (string, bool) {
+	if _, err := os.Lstat(targetPath); os.IsNotExist(err) || policy == CollisionOverwrite {
+		return targetPath, true
+	}
+
+	switch policy {
+	case CollisionSkip:
+		return "", false
+	case CollisionTimestamp:
+		relPath, err := filepath.Rel(targetRoot, targetPath)
+		if err != nil {
+			relPath = filepath.Base(targetPath)
+		}
+
+		return resolveCollision(CollisionSuffix, targetRoot,
+			filepath.Join(targetRoot, now.Format(collisionTimestampLayout), relPath), now)
+	default:
+		ext := filepath.Ext(targetPath)
+		base := strings.TrimSuffix(targetPath, ext)
+		for i := 1; ; i++ {
+			candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+			if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+				return candidate, true
+			}
+		}
+	}
+}
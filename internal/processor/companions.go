@@ -0,0 +1,159 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/javi11/nzb-touch/internal/nzb"
+)
+
+// companionExtensionsDefault are the extensions, before ".nzb", of the
+// metadata files stored next to the main NZB in usenet-drive libraries
+var companionExtensionsDefault = []string{".nfo", ".jpg", ".jpeg", ".png", ".strm", ".srt", ".sub", ".idx", ".txt"}
+
+// WithUsenetDrive enables the usenet-drive integration. Companion NZBs
+// (e.g. movie.nfo.nzb, poster.jpg.nzb) are checked together with the main NZB
+// of their directory owning them instead of on their own, and NZBs are never
+// moved or deleted so the mounted library is left intact. An empty extension
+// list selects the default companion extensions.
+func WithUsenetDrive(companionExtensions []string) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.usenetDrive = true
+		s.companionExts = companionExtensionsDefault
+		if len(companionExtensions) > 0 {
+			s.companionExts = make([]string, len(companionExtensions))
+			for i, ext := range companionExtensions {
+				s.companionExts[i] = "." + strings.TrimPrefix(strings.ToLower(ext), ".")
+			}
+		}
+	}
+}
+
+// stem returns the NZB file name without ".nzb" and without the inner extension
+func stem(nzbPath string) string {
+	name := strings.TrimSuffix(filepath.Base(nzbPath), filepath.Ext(nzbPath))
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// isCompanion reports whether the NZB stores a metadata file
+func (s *DirectoryScanner) isCompanion(nzbPath string) bool {
+	name := strings.TrimSuffix(filepath.Base(nzbPath), filepath.Ext(nzbPath))
+	return slices.Contains(s.companionExts, strings.ToLower(filepath.Ext(name)))
+}
+
+// nzbsInDir splits the NZBs stored next to nzbPath into main and companion NZBs
+func (s *DirectoryScanner) nzbsInDir(nzbPath string) (mains, companions []string) {
+	dir := filepath.Dir(nzbPath)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".nzb") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if s.isCompanion(path) {
+			companions = append(companions, path)
+		} else {
+			mains = append(mains, path)
+		}
+	}
+
+	return mains, companions
+}
+
+// checkedWithMain reports whether a companion NZB is checked as part of a
+// main NZB in its directory and must not be queued on its own
+func (s *DirectoryScanner) checkedWithMain(nzbPath string) bool {
+	if !s.usenetDrive || !s.isCompanion(nzbPath) {
+		return false
+	}
+
+	mains, _ := s.nzbsInDir(nzbPath)
+
+	return ownerOf(nzbPath, mains) != ""
+}
+
+// companionsOf returns the companion NZBs belonging to a main NZB, see ownerOf
+func (s *DirectoryScanner) companionsOf(mainPath string) []string {
+	if !s.usenetDrive || s.isCompanion(mainPath) {
+		return nil
+	}
+
+	mains, companions := s.nzbsInDir(mainPath)
+
+	var owned []string
+	for _, c := range companions {
+		if ownerOf(c, mains) == mainPath {
+			owned = append(owned, c)
+		}
+	}
+
+	return owned
+}
+
+// ownerOf returns the main NZB a companion NZB belongs to among the main NZBs
+// of its directory: the only one, otherwise the one with the longest name the
+// name of the companion starts with. It returns "" when no main NZB claims
+// the companion, which is then checked on its own.
+func ownerOf(companion string, mains []string) string {
+	if len(mains) == 1 {
+		return mains[0]
+	}
+
+	owner, longest := "", -1
+	for _, main := range mains {
+		name := stem(main)
+		if strings.HasPrefix(stem(companion), name) && len(name) > longest {
+			owner, longest = main, len(name)
+		}
+	}
+
+	return owner
+}
+
+// checkCompanions checks the companion NZBs of a main NZB with its check
+// options and merges their outcome into its result, so the NZBs succeed or
+// fail as a unit
+func (s *DirectoryScanner) checkCompanions(ctx context.Context, mainPath string, mainOpts CheckOptions, result *Result, mainErr error) error {
+	companions := s.companionsOf(mainPath)
+	if len(companions) == 0 || result == nil {
+		return mainErr
+	}
+
+	err := mainErr
+	for _, companion := range companions {
+		if ctx.Err() != nil {
+			break
+		}
+
+		nzbData, loadErr := nzb.LoadFromFile(companion)
+		if loadErr != nil {
+			slog.WarnContext(ctx, "Failed to load companion NZB", "path", companion, "error", loadErr)
+			if err == nil {
+				err = fmt.Errorf("companion %s: %w", filepath.Base(companion), loadErr)
+			}
+			continue
+		}
+
+		opts := mainOpts
+		opts.Source = companion
+		companionResult, checkErr := s.check(ctx, companion, nzbData, opts)
+		result.merge(companionResult)
+		if checkErr != nil && err == nil {
+			err = fmt.Errorf("companion %s: %w", filepath.Base(companion), checkErr)
+		}
+	}
+
+	slog.InfoContext(ctx, "Checked companion NZBs", "path", mainPath, "companions", len(companions))
+
+	return err
+}
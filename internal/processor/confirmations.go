@@ -0,0 +1,115 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/sourcegraph/conc/pool"
+)
+
+// errUnconfirmed records a segment reported missing whose confirmations were cut short by the time budget
+var errUnconfirmed = errors.New("segment reported missing, confirmations cut short by the time budget")
+
+// Confirmations requires a segment to be reported missing on several attempts
+// spread over a window before it counts as missing, so articles still
+// replicating between servers are not mistaken for missing ones. Every
+// attempt asks the providers again.
+type Confirmations struct {
+	Attempts int           // Attempts reporting the segment missing, 0 or 1 counts the first answer
+	Window   time.Duration // Period the attempts are spread over
+}
+
+// enabled reports whether missing segments are confirmed
+func (c Confirmations) enabled() bool {
+	return c.Attempts > 1
+}
+
+// validate checks the confirmation settings
+func (c Confirmations) validate() error {
+	if c.Attempts < 0 {
+		return fmt.Errorf("confirmation attempts must not be negative")
+	}
+
+	if c.Window < 0 {
+		return fmt.Errorf("confirmation window must not be negative")
+	}
+
+	return nil
+}
+
+// unconfirmedSegment is a segment reported missing that awaits its confirmations
+type unconfirmedSegment struct {
+	seg    nzbparser.NzbSegment
+	groups []string
+	record segmentRecorder
+}
+
+// confirmMissing checks the unconfirmed segments again at even intervals of
+// the window. A segment found meanwhile is recorded as found, the others are
+// recorded missing after the last attempt. Once the time budget of the check
+// is spent the remaining segments are recorded missing without waiting.
+func (p *Processor) confirmMissing(ctx context.Context, c Confirmations, pending []unconfirmedSegment, workers int, outOfTime func() bool) error {
+	interval := c.Window / time.Duration(c.Attempts-1)
+
+	for attempt := 2; attempt <= c.Attempts && len(pending) > 0; attempt++ {
+		if outOfTime() {
+			break
+		}
+
+		slog.InfoContext(ctx, "Confirming missing segments", "segments", len(pending), "attempt", attempt, "attempts", c.Attempts, "in", interval)
+		if err := sleepContext(ctx, interval); err != nil {
+			return nil
+		}
+
+		var (
+			mu    sync.Mutex
+			still []unconfirmedSegment
+			last  = attempt == c.Attempts
+		)
+
+		confirmPool := pool.New().WithMaxGoroutines(workers).WithContext(ctx).WithCancelOnError()
+		for _, u := range pending {
+			confirmPool.Go(func(ctx context.Context) error {
+				if err := p.budget.acquire(ctx); err != nil {
+					return nil
+				}
+				defer p.budget.release()
+
+				bytes, err := p.checkSegment(ctx, u.seg.Id, u.groups, "")
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+
+				if err != nil && !last && p.classify(err) == ErrorMissing {
+					mu.Lock()
+					still = append(still, u)
+					mu.Unlock()
+
+					return nil
+				}
+
+				return u.record(ctx, u.seg, bytes, err)
+			})
+		}
+
+		if err := confirmPool.Wait(); err != nil {
+			return err
+		}
+
+		pending = still
+	}
+
+	// Out of time, the first answer stands
+	for _, u := range pending {
+		if err := u.record(ctx, u.seg, 0, errUnconfirmed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
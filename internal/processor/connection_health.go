@@ -0,0 +1,127 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/textproto"
+	"time"
+
+	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+)
+
+var (
+	// healthCheckAcquireTimeout bounds the wait for a connection during a health
+	// check, when every connection is busy checking segments there is nothing idle to ping
+	healthCheckAcquireTimeout = time.Second
+	// healthCheckMessageID is requested to ping a connection, any answer from the server proves it alive
+	healthCheckMessageID = "<nzb-touch.health-check@invalid>"
+)
+
+// WithConnectionHealthChecks pings the idle connections of each provider at
+// its interval, keyed by provider ID, closing the ones that no longer answer
+func WithConnectionHealthChecks(intervals map[string]time.Duration) Option {
+	return func(p *Processor) {
+		p.healthChecks = intervals
+	}
+}
+
+// runHealthChecks pings the idle connections of every provider with a health check interval until ctx is done
+func (p *Processor) runHealthChecks(ctx context.Context) {
+	for providerID, interval := range p.healthChecks {
+		if interval > 0 {
+			go p.healthCheckLoop(ctx, providerID, interval)
+		}
+	}
+}
+
+// healthCheckLoop pings the idle connections of a provider every interval
+func (p *Processor) healthCheckLoop(ctx context.Context, providerID string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.pingConnections(ctx, providerID)
+		}
+	}
+}
+
+// pingConnections pings the open connections of a provider that are not in
+// use, closing the dead ones so long runs do not accumulate half-open
+// sessions. It never opens connections: it stops at the first connection the
+// pool had to create, and holds the pinged ones so each is pinged once.
+func (p *Processor) pingConnections(ctx context.Context, providerID string) {
+	info, ok := p.nntpClient.GetProviderStatus(providerID)
+	if !ok || info.State != nntppool.ProviderStateActive || info.UsedConnections == 0 {
+		return
+	}
+
+	var skip []string
+	for _, other := range p.nntpClient.GetProvidersInfo() {
+		if other.ID() != providerID {
+			skip = append(skip, other.ID())
+		}
+	}
+
+	var (
+		start   = time.Now()
+		held    []nntppool.PooledConnection
+		pinged  int
+		dropped int
+	)
+	defer func() {
+		for _, conn := range held {
+			_ = conn.Free()
+		}
+	}()
+
+	for range info.UsedConnections {
+		acquireCtx, cancel := context.WithTimeout(ctx, healthCheckAcquireTimeout)
+		conn, err := p.nntpClient.GetConnection(acquireCtx, skip, true)
+		cancel()
+		if err != nil {
+			break
+		}
+
+		if !conn.CreatedAt().Before(start) {
+			// Every idle connection was pinged already
+			held = append(held, conn)
+			break
+		}
+
+		if err := pingConnection(conn.Connection()); err != nil {
+			slog.DebugContext(ctx, "Closing dead connection", "provider", providerID, "error", err)
+			_ = conn.Close()
+			dropped++
+			continue
+		}
+
+		held = append(held, conn)
+		pinged++
+	}
+
+	if dropped > 0 {
+		slog.InfoContext(ctx, "Closed dead provider connections", "provider", providerID, "closed", dropped, "healthy", pinged)
+	} else {
+		slog.DebugContext(ctx, "Provider connections healthy", "provider", providerID, "pinged", pinged)
+	}
+}
+
+// pingConnection checks that the server still answers on a connection. It
+// asks for an article that does not exist rather than sending DATE, whose
+// 111 reply the client library does not accept.
+func pingConnection(conn nntpcli.Connection) error {
+	_, err := conn.Stat(healthCheckMessageID)
+
+	var protoErr *textproto.Error
+	if err == nil || errors.As(err, &protoErr) {
+		return nil
+	}
+
+	return err
+}
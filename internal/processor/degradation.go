@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/hook"
+	"github.com/javi11/nzb-touch/internal/plugin"
+)
+
+// DegradationKind tells how a previously healthy NZB lost its articles
+type DegradationKind string
+
+const (
+	// DegradationTakedown is a sudden loss of articles, typically a DMCA takedown
+	DegradationTakedown DegradationKind = "takedown"
+	// DegradationDecay is a gradual loss of articles between checks
+	DegradationDecay DegradationKind = "decay"
+)
+
+// takedownDropDefault is the health drop in percentage points between two
+// checks above which a degradation is reported as a takedown
+var takedownDropDefault = 20.0
+
+// Degradation is the plugin payload describing a degraded NZB
+type Degradation struct {
+	Kind           DegradationKind `json:"kind"`
+	PreviousHealth float64         `json:"previous_health"`
+	Health         float64         `json:"health"`
+	Result         *Result         `json:"result"`
+}
+
+// WithTakedownDrop sets the health drop in percentage points between two
+// checks above which a degradation is reported as a takedown instead of decay
+func WithTakedownDrop(drop float64) ScannerOption {
+	return func(s *DirectoryScanner) {
+		if drop > 0 {
+			s.takedownDrop = drop
+		}
+	}
+}
+
+// classifyDegradation compares two checks and reports whether a healthy NZB
+// became unhealthy, given the minimum health considered healthy
+func classifyDegradation(previous, current, minHealth, takedownDrop float64) (DegradationKind, bool) {
+	if previous < minHealth || current >= minHealth {
+		return "", false
+	}
+
+	if previous-current >= takedownDrop {
+		return DegradationTakedown, true
+	}
+
+	return DegradationDecay, true
+}
+
+// detectDegradation compares a finished check with the previous check of the
+// same NZB, marks degraded NZBs in the queue and raises the degraded notifications
+func (s *DirectoryScanner) detectDegradation(ctx context.Context, e events.Event) {
+	result := eventResult(e)
+	if result == nil || result.CheckedSegments == 0 || e.Err != nil && result.FailedSegments == 0 {
+		// Nothing was verified, e.g. the check was interrupted
+		return
+	}
+
+	health := result.Health()
+	minHealth := float64(100 - s.checkOptions.MissingPercent)
+
+	previous, ok := s.queue.RecordHealth(e.Path, health)
+	if health >= minHealth {
+		s.queue.SetDegradation(e.Path, "")
+		return
+	}
+	if !ok {
+		return
+	}
+
+	kind, degraded := classifyDegradation(previous, health, minHealth, s.takedownDrop)
+	if !degraded {
+		return
+	}
+
+	s.queue.SetDegradation(e.Path, string(kind))
+
+	slog.ErrorContext(ctx, "Previously healthy NZB degraded",
+		"path", e.Path,
+		"kind", kind,
+		"previous_health", previous,
+		"health", health)
+
+	info := result.HookInfo(e.Path, e.Err)
+	info.PreviousHealth = previous
+	info.Degradation = string(kind)
+	_ = s.hooks.Run(ctx, hook.EventDegraded, info)
+
+	_ = s.plugins.Dispatch(ctx, plugin.Payload{
+		Event:   plugin.EventDegraded,
+		NzbPath: e.Path,
+		Result: Degradation{
+			Kind:           kind,
+			PreviousHealth: previous,
+			Health:         health,
+			Result:         result,
+		},
+	})
+
+	s.bus.Publish(ctx, events.Event{Type: events.NZBDegraded, Path: e.Path, Result: result, State: string(kind)})
+}
@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// digestMaxPaths bounds the failed and degraded NZBs listed in a digest
+const digestMaxPaths = 100
+
+// Digest summarizes the checks of a period, for scheduled digest reports
+type Digest struct {
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Checked       int       `json:"checked"`        // NZBs checked in the period
+	Failed        int       `json:"failed"`         // Checked NZBs that failed
+	Degraded      int       `json:"degraded"`       // Checked NZBs flagged as taken down or decaying
+	AverageHealth float64   `json:"average_health"` // Average health of the checked NZBs
+	Pending       int       `json:"pending"`        // NZBs waiting for a check at the end of the period
+	// Paths of the failed and degraded NZBs, capped at digestMaxPaths each
+	FailedNZBs   []string `json:"failed_nzbs,omitempty"`
+	DegradedNZBs []string `json:"degraded_nzbs,omitempty"`
+}
+
+// Digest summarizes the NZBs checked between from and to
+func (q *Queue) Digest(from, to time.Time) (*Digest, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	rows, err := q.db.Query(`
+		SELECT file_path, status, last_health, degradation
+		FROM queue
+		WHERE processed = 1 AND processed_at >= ? AND processed_at < ?
+		ORDER BY processed_at ASC
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checked items: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	d := &Digest{From: from, To: to}
+	var healthSum float64
+	var healthCount int
+	for rows.Next() {
+		var (
+			path, status, degradation string
+			health                    *float64
+		)
+		if err := rows.Scan(&path, &status, &health, &degradation); err != nil {
+			return nil, fmt.Errorf("failed to read checked item: %w", err)
+		}
+
+		d.Checked++
+		if health != nil {
+			healthSum += *health
+			healthCount++
+		}
+
+		if status == StatusFailed {
+			d.Failed++
+			if len(d.FailedNZBs) < digestMaxPaths {
+				d.FailedNZBs = append(d.FailedNZBs, path)
+			}
+		}
+
+		if degradation != "" {
+			d.Degraded++
+			if len(d.DegradedNZBs) < digestMaxPaths {
+				d.DegradedNZBs = append(d.DegradedNZBs, fmt.Sprintf("%s (%s)", path, degradation))
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checked items: %w", err)
+	}
+
+	if healthCount > 0 {
+		d.AverageHealth = healthSum / float64(healthCount)
+	}
+
+	if err := q.db.QueryRow("SELECT COUNT(*) FROM queue WHERE processed = 0").Scan(&d.Pending); err != nil {
+		return nil, fmt.Errorf("failed to count pending items: %w", err)
+	}
+
+	return d, nil
+}
+
+// Digest summarizes the NZBs the scanner checked between from and to
+func (s *DirectoryScanner) Digest(from, to time.Time) (*Digest, error) {
+	return s.queue.Digest(from, to)
+}
+
+// WriteJSON writes the digest as indented JSON
+func (d *Digest) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(d)
+}
+
+// WriteText writes the digest in a human readable form
+func (d *Digest) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "NZB digest from %s to %s\n\n", d.From.Format(time.RFC3339), d.To.Format(time.RFC3339))
+	fmt.Fprintf(w, "Checked:        %d\n", d.Checked)
+	fmt.Fprintf(w, "Failed:         %d\n", d.Failed)
+	fmt.Fprintf(w, "Degraded:       %d\n", d.Degraded)
+	fmt.Fprintf(w, "Average health: %.1f%%\n", d.AverageHealth)
+	fmt.Fprintf(w, "Pending:        %d\n", d.Pending)
+
+	for _, list := range []struct {
+		title string
+		paths []string
+		total int
+	}{
+		{"Failed NZBs", d.FailedNZBs, d.Failed},
+		{"Degraded NZBs", d.DegradedNZBs, d.Degraded},
+	} {
+		if len(list.paths) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s:\n", list.title)
+		for _, path := range list.paths {
+			fmt.Fprintf(w, "  %s\n", path)
+		}
+		if list.total > len(list.paths) {
+			fmt.Fprintf(w, "  ... and %d more\n", list.total-len(list.paths))
+		}
+	}
+
+	_, err := fmt.Fprintln(w)
+
+	return err
+}
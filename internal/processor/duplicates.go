@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// WithDuplicateDetection hashes every NZB when it is queued and skips files
+// with the same content as a file already in the queue under another path
+func WithDuplicateDetection(enabled bool) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.skipDuplicates = enabled
+	}
+}
+
+// contentHash returns the hex encoded SHA-256 of a file
+func contentHash(path string) (string, error) {
+	f, err := os.Open(fsutil.DiskPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// duplicateOf returns the queued file with the same content hash as path.
+// Files that no longer exist on disk are ignored, so an NZB moved away by a
+// failed check or deleted by its owner does not hide a new copy.
+func (s *DirectoryScanner) duplicateOf(path, hash string) (string, bool) {
+	for _, original := range s.queue.FindByHash(hash) {
+		if original == path {
+			continue
+		}
+
+		if _, err := os.Stat(fsutil.DiskPath(original)); err == nil {
+			return original, true
+		}
+	}
+
+	return "", false
+}
+
+// skipDuplicate records path as a duplicate when a queued file has the same
+// content, returning the hash to store with a new item otherwise
+func (s *DirectoryScanner) skipDuplicate(ctx context.Context, path string) (string, bool) {
+	hash, err := contentHash(path)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to hash NZB, duplicate detection skipped", "path", path, "error", err)
+		return "", false
+	}
+
+	original, found := s.duplicateOf(path, hash)
+	if !found {
+		return hash, false
+	}
+
+	if s.queue.AddDuplicate(path, original, hash) {
+		slog.InfoContext(ctx, "Skipping duplicate NZB", "path", path, "duplicate_of", original)
+	}
+
+	return "", true
+}
@@ -0,0 +1,222 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+
+	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/mnightingale/rapidyenc"
+)
+
+// ErrorClass groups the reasons a segment could not be verified
+type ErrorClass string
+
+const (
+	// ErrorMissing is an article the providers do not have, and any error not classified otherwise
+	ErrorMissing ErrorClass = "missing"
+	// ErrorCorrupt is an article whose yEnc data is damaged
+	ErrorCorrupt ErrorClass = "corrupt"
+	// ErrorThrottled is a provider refusing requests for now, e.g. too many connections or a depleted account
+	ErrorThrottled ErrorClass = "throttled"
+	// ErrorNetwork is a request lost to DNS, connect, TLS or connection failures
+	ErrorNetwork ErrorClass = "network"
+	// ErrorAuth is a provider rejecting the credentials
+	ErrorAuth ErrorClass = "auth"
+)
+
+// errorClasses lists every class, in the order thresholds are evaluated
+var errorClasses = []ErrorClass{ErrorMissing, ErrorCorrupt, ErrorThrottled, ErrorNetwork, ErrorAuth}
+
+// ClassAction is what happens when the failed segments of a class exceed its threshold
+type ClassAction string
+
+const (
+	// ClassActionFail fails the check
+	ClassActionFail ClassAction = "fail"
+	// ClassActionWarn logs a warning and records it in the result
+	ClassActionWarn ClassAction = "warn"
+	// ClassActionIgnore only counts the segments
+	ClassActionIgnore ClassAction = "ignore"
+)
+
+// ClassPolicy sets the threshold and action of an error class. Classes
+// without a policy share the MissingPercent threshold of the check.
+type ClassPolicy struct {
+	Threshold float64     // Percentage of segments of the class allowed before acting
+	Action    ClassAction // "fail" (default), "warn" or "ignore"
+}
+
+// ErrorClassifier tells the class of a segment error
+type ErrorClassifier func(err error) ErrorClass
+
+// WithErrorClassifier replaces the classification of segment errors
+func WithErrorClassifier(classifier ErrorClassifier) Option {
+	return func(p *Processor) {
+		p.classifier = classifier
+	}
+}
+
+// ClassifyError is the default classifier, based on the NNTP status codes and
+// the errors of the network, TLS and yEnc layers
+func ClassifyError(err error) ErrorClass {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		switch protoErr.Code {
+		case 480, 481, 482:
+			return ErrorAuth
+		case 400, nntppool.ToManyConnectionsErrCode:
+			return ErrorThrottled
+		}
+	}
+
+	switch {
+	case nntpcli.IsArticleNotFoundError(err), errors.Is(err, nntppool.ErrArticleNotFoundInProviders):
+		return ErrorMissing
+	case errors.Is(err, rapidyenc.ErrCrcMismatch), errors.Is(err, rapidyenc.ErrDataCorruption), errors.Is(err, rapidyenc.ErrDataMissing):
+		return ErrorCorrupt
+	case errors.Is(err, errBlockAccountsDepleted), errors.Is(err, nntppool.ErrNoProviderAvailable):
+		return ErrorThrottled
+	case isNetworkError(err):
+		return ErrorNetwork
+	}
+
+	return ErrorMissing
+}
+
+// classify returns the class of a segment error
+func (p *Processor) classify(err error) ErrorClass {
+	// Replayed errors keep the class they were recorded with
+	var replayed *replayedError
+	if errors.As(err, &replayed) {
+		return replayed.class
+	}
+
+	if p.classifier != nil {
+		return p.classifier(err)
+	}
+
+	return ClassifyError(err)
+}
+
+// classFailure describes failed segments beyond their threshold, Class is
+// empty for the classes sharing MissingPercent
+type classFailure struct {
+	Class     ErrorClass
+	Failed    int
+	Threshold float64
+	// Dominant is the class with the most failed segments among the shared ones
+	Dominant ErrorClass
+}
+
+// exceeds reports whether failed segments out of base are beyond threshold percent
+func exceeds(failed, base int, threshold float64) bool {
+	return float64(failed) > float64(base)*threshold/100
+}
+
+// validateErrorClasses checks the class policies of the options
+func (o CheckOptions) validateErrorClasses() error {
+	for class, policy := range o.ErrorClasses {
+		switch class {
+		case ErrorMissing, ErrorCorrupt, ErrorThrottled, ErrorNetwork, ErrorAuth:
+		default:
+			return fmt.Errorf("unknown error class %q", class)
+		}
+
+		if policy.Threshold < 0 || policy.Threshold > 100 {
+			return fmt.Errorf("threshold of error class %s must be between 0 and 100", class)
+		}
+
+		switch policy.Action {
+		case "", ClassActionFail, ClassActionWarn, ClassActionIgnore:
+		default:
+			return fmt.Errorf("unknown action %q for error class %s", policy.Action, class)
+		}
+	}
+
+	return nil
+}
+
+// failure returns the failed segments breaking a failing threshold out of
+// base segments, checking the classes sharing MissingPercent first
+func (o CheckOptions) failure(r *Result, base int) (classFailure, bool) {
+	shared, most := 0, 0
+	dominant := ErrorMissing
+	for _, class := range errorClasses {
+		if _, ok := o.ErrorClasses[class]; !ok {
+			shared += r.ErrorClasses[class]
+			if r.ErrorClasses[class] > most {
+				dominant, most = class, r.ErrorClasses[class]
+			}
+		}
+	}
+
+	if exceeds(shared, base, float64(o.MissingPercent)) {
+		return classFailure{Failed: shared, Threshold: float64(o.MissingPercent), Dominant: dominant}, true
+	}
+
+	for _, class := range errorClasses {
+		policy, ok := o.ErrorClasses[class]
+		if !ok || (policy.Action != "" && policy.Action != ClassActionFail) {
+			continue
+		}
+
+		if failed := r.ErrorClasses[class]; exceeds(failed, base, policy.Threshold) {
+			return classFailure{Class: class, Failed: failed, Threshold: policy.Threshold}, true
+		}
+	}
+
+	return classFailure{}, false
+}
+
+// warnings returns the warn classes whose failed segments out of base are
+// beyond their threshold and not reported in the result yet
+func (o CheckOptions) warnings(r *Result, base int) []classFailure {
+	var warnings []classFailure
+	for _, class := range errorClasses {
+		policy, ok := o.ErrorClasses[class]
+		if !ok || policy.Action != ClassActionWarn || r.warned(class) {
+			continue
+		}
+
+		if failed := r.ErrorClasses[class]; exceeds(failed, base, policy.Threshold) {
+			warnings = append(warnings, classFailure{Class: class, Failed: failed, Threshold: policy.Threshold})
+		}
+	}
+
+	return warnings
+}
+
+// describe formats the failure against base segments
+func (f classFailure) describe(base int) string {
+	what := "failed"
+	if f.Class != "" {
+		what = string(f.Class)
+	}
+
+	return fmt.Sprintf("%d/%d segments %s (%.1f%% > %g%%)", f.Failed, base, what, float64(f.Failed)*100/float64(base), f.Threshold)
+}
+
+// code returns the error code of the failure, after its class or, for the
+// shared threshold, the class most segments failed with
+func (f classFailure) code() errcode.Code {
+	class := f.Class
+	if class == "" {
+		class = f.Dominant
+	}
+
+	switch class {
+	case ErrorCorrupt:
+		return errcode.CorruptThreshold
+	case ErrorThrottled:
+		return errcode.ProviderThrottled
+	case ErrorNetwork:
+		return errcode.Network
+	case ErrorAuth:
+		return errcode.ProviderAuth
+	}
+
+	return errcode.MissingThreshold
+}
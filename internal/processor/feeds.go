@@ -0,0 +1,12 @@
+package processor
+
+import (
+	"github.com/javi11/nzb-touch/internal/feed"
+)
+
+// WithFeedWatcher queues the NZBs downloaded from indexer feeds
+func WithFeedWatcher(w *feed.Watcher) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.feeds = w
+	}
+}
@@ -0,0 +1,246 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+)
+
+// errBlockAccountsDepleted is returned when the only providers left are block
+// accounts that were stopped because their balance ran out
+var errBlockAccountsDepleted = errors.New("no provider left, the remaining block accounts are depleted")
+
+// directFetch reports whether segments must be checked on connections
+// acquired by the processor instead of the pool helpers, which is needed
+// whenever per-provider policies apply
+func (p *Processor) directFetch() bool {
+	return len(p.rateLimiters) > 0 || len(p.providerSpeeds) > 0 || len(p.providerRetries) > 0 || p.checkMode == CheckModePartial || p.checkMode == CheckModeHead ||
+		p.groupStats != nil || p.usage != nil || len(p.providerGroups) > 0 || len(p.accountAliases) > 0 ||
+		p.errors != nil || len(p.providerSchedules) > 0 || len(p.providerTiers) > 0 ||
+		p.providerResults
+}
+
+// fetchDirect checks a segment acquiring connections itself so per-provider
+// policies can be applied to the provider serving each request. Like the pool
+// it moves on to the next provider, tier after tier then backups, when the
+// article is not found, and when a provider configured to skip on errors
+// keeps failing. The provider missedIn, which was already asked for the
+// article, is skipped unless it is "".
+func (p *Processor) fetchDirect(ctx context.Context, segmentID string, groups []string, missedIn string) (int64, error) {
+	return p.fetchOnProviders(ctx, segmentID, groups, missedIn, func(conn nntpcli.Connection) (int64, error) {
+		return p.checkOnConnection(conn, segmentID, groups)
+	})
+}
+
+// fetchOnProviders runs fetch on connections acquired provider by provider
+// with the policies of fetchDirect, until a provider has the article
+func (p *Processor) fetchOnProviders(ctx context.Context, segmentID string, groups []string, missedIn string, fetch func(nntpcli.Connection) (int64, error)) (int64, error) {
+	var (
+		useBackup  bool
+		tier       = p.firstTier()
+		tiersLeft  = len(p.providerTiers) > 0
+		notFoundIn int
+		retried    map[string]int
+		skippedErr error
+	)
+
+	// Depleted block accounts, providers not carrying the groups and providers
+	// outside of their time windows are never asked
+	stopped := p.usage.Stopped()
+	uncarried := p.notCarrying(groups)
+	unscheduled := p.unscheduled()
+	skip := p.members(slices.Concat(stopped, uncarried, unscheduled))
+	if missedIn != "" {
+		skip = append(skip, p.members([]string{missedIn})...)
+		notFoundIn++
+		useBackup = true
+	}
+
+	for {
+		excluded, withBackups := skip, useBackup
+		if tiersLeft {
+			// Backup providers wait for every tier to be tried
+			excluded, withBackups = slices.Concat(skip, p.outsideTier(tier)), false
+		}
+
+		conn, err := p.nntpClient.GetConnection(ctx, excluded, withBackups)
+		if err != nil {
+			if errors.Is(err, nntppool.ErrArticleNotFoundInProviders) {
+				if tiersLeft {
+					// Every provider of the tier was tried, move on to the next one
+					tier, tiersLeft = p.nextTier(tier)
+					continue
+				}
+
+				if !useBackup {
+					// Every primary provider was tried, fall back to backups
+					useBackup = true
+					continue
+				}
+
+				// A provider skipped on errors may still hold the article
+				if skippedErr != nil {
+					return 0, skippedErr
+				}
+
+				if notFoundIn > 0 {
+					return 0, nntppool.ErrArticleNotFoundInProviders
+				}
+
+				if len(stopped) > 0 {
+					return 0, errBlockAccountsDepleted
+				}
+
+				if len(uncarried) > 0 {
+					return 0, fmt.Errorf("%w: %s", errGroupsNotCarried, strings.Join(groups, ", "))
+				}
+
+				if len(unscheduled) > 0 {
+					return 0, errOutsideSchedule
+				}
+			}
+
+			return 0, err
+		}
+
+		poolID := conn.Provider().ID()
+		providerID := p.logical(poolID)
+		if err := p.waitProvider(ctx, providerID); err != nil {
+			_ = conn.Free()
+			return 0, err
+		}
+
+		bytes, err := fetch(conn.Connection())
+		p.releaseConnection(conn, err)
+		p.providerSpeeds[providerID].take(bytes)
+		p.recordOutcome(providerID, err)
+		tallyRequest(ctx, providerID, bytes, err)
+		p.usage.Record(providerID, bytes, err == nil)
+		if err == nil {
+			p.groupStats.Record(groups, providerID, false)
+			return bytes, nil
+		}
+
+		if !nntpcli.IsArticleNotFoundError(err) {
+			retry, ok := p.providerRetries[providerID]
+			if !ok {
+				return 0, err
+			}
+
+			if retried[providerID] < retry.Retries {
+				if retried == nil {
+					retried = make(map[string]int)
+				}
+				retried[providerID]++
+
+				if err := sleepContext(ctx, retry.RetryDelay); err != nil {
+					return 0, err
+				}
+				continue
+			}
+
+			if !retry.SkipOnErrors {
+				return 0, err
+			}
+
+			// Only the failing account is skipped, the others may still answer
+			skippedErr = err
+			skip = append(skip, poolID)
+			useBackup = true
+			continue
+		}
+
+		p.groupStats.Record(groups, providerID, true)
+		notFoundIn++
+		// Accounts of the same provider share its articles
+		skip = append(skip, p.members([]string{providerID})...)
+		useBackup = true
+	}
+}
+
+// checkOnConnection verifies a segment using an already acquired connection
+func (p *Processor) checkOnConnection(conn nntpcli.Connection, segmentID string, groups []string) (int64, error) {
+	return checkOnConnection(conn, p.checkMode, p.partialReadSize, segmentID, groups)
+}
+
+// checkOnConnection verifies a segment on conn with the given check mode
+func checkOnConnection(conn nntpcli.Connection, mode CheckMode, partialReadSize int64, segmentID string, groups []string) (int64, error) {
+	if err := joinGroups(conn, groups); err != nil {
+		return 0, err
+	}
+
+	switch mode {
+	case CheckModeStat:
+		_, err := conn.Stat(segmentID)
+		return 0, err
+	case CheckModeHead:
+		reader, ok := conn.(headReader)
+		if !ok {
+			_, err := conn.Stat(segmentID)
+			return 0, err
+		}
+
+		_, err := reader.Head(segmentID)
+		return 0, err
+	case CheckModePartial:
+		reader, err := conn.BodyReader(segmentID)
+		if err != nil {
+			return 0, err
+		}
+
+		// The reader is deliberately not closed: closing drains the rest of
+		// the article. The connection is dropped by releaseConnection instead.
+		if _, err := reader.GetYencHeaders(); err != nil {
+			return 0, err
+		}
+
+		n, err := io.CopyN(io.Discard, reader, partialReadSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return n, err
+		}
+
+		return n, nil
+	default:
+		return conn.BodyDecoded(segmentID, io.Discard, 0)
+	}
+}
+
+// joinGroups joins the first of the groups the server carries, unless conn
+// already is in one of them
+func joinGroups(conn nntpcli.Connection, groups []string) error {
+	if len(groups) == 0 || slices.Contains(groups, conn.CurrentJoinedGroup()) {
+		return nil
+	}
+
+	var err error
+	for _, g := range groups {
+		if err = conn.JoinGroup(g); err == nil {
+			break
+		}
+	}
+
+	return err
+}
+
+// releaseConnection returns a connection to the pool when it is still in a
+// clean state and closes it otherwise
+func (p *Processor) releaseConnection(conn nntppool.PooledConnection, err error) {
+	if nntpcli.IsArticleNotFoundError(err) {
+		_ = conn.Free()
+		return
+	}
+
+	if err != nil || p.checkMode == CheckModePartial {
+		// Partial reads leave the rest of the article on the wire
+		_ = conn.Close()
+		return
+	}
+
+	_ = conn.Free()
+}
@@ -0,0 +1,162 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+)
+
+// FileHeaders is the metadata read from the headers of the first articles
+// of a file next to what the NZB claims, which obfuscated NZBs often get
+// wrong or leave out
+type FileHeaders struct {
+	File       string    `json:"file"`
+	Subject    string    `json:"subject"`            // Subject of the first article read, usually naming the real file
+	Poster     string    `json:"poster"`             // From of the first article read
+	NZBPoster  string    `json:"nzb_poster"`         // Poster claimed by the NZB
+	PostedAt   time.Time `json:"posted_at,omitzero"` // Earliest Date of the articles read
+	NZBDate    time.Time `json:"nzb_date,omitzero"`  // Post date claimed by the NZB
+	DateDelta  int64     `json:"date_delta_seconds"` // PostedAt minus NZBDate, 0 when either is unknown
+	Bytes      int64     `json:"bytes"`              // Sum of the Bytes headers of the articles read, 0 when the server sends none
+	NZBBytes   int64     `json:"nzb_bytes"`          // Sum of the NZB sizes of the same articles
+	BytesDelta int64     `json:"bytes_delta"`        // Bytes minus NZBBytes, 0 when Bytes is unknown
+	Samples    int       `json:"samples"`            // Articles whose headers were read
+}
+
+// headReader reads article headers, the connections dialed by nntp.Dialer
+// with headers enabled implement it
+type headReader interface {
+	Head(msgID string) (textproto.MIMEHeader, error)
+}
+
+// readFileHeaders reads the headers of the first samples articles of every
+// file on one connection. Articles the provider does not have are skipped,
+// files without any article read are left out.
+func (p *Processor) readFileHeaders(ctx context.Context, files []nzbparser.NzbFile, samples int) []FileHeaders {
+	if samples <= 0 || p.replay != nil || len(files) == 0 {
+		return nil
+	}
+
+	var groups []string
+	for _, file := range files {
+		groups = append(groups, file.Groups...)
+	}
+
+	if err := p.budget.acquire(ctx); err != nil {
+		return nil
+	}
+	defer p.budget.release()
+
+	conn, err := p.nntpClient.GetConnection(ctx, p.members(append(p.notCarrying(groups), p.unscheduled()...)), false)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read article headers", "error", err)
+		return nil
+	}
+
+	reader, ok := conn.Connection().(headReader)
+	if !ok {
+		_ = conn.Free()
+		slog.WarnContext(ctx, "The connection cannot read article headers")
+		return nil
+	}
+
+	var headers []FileHeaders
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+
+		fh := FileHeaders{File: file.Filename, NZBPoster: file.Poster}
+		if file.Date > 0 {
+			fh.NZBDate = time.Unix(int64(file.Date), 0).UTC()
+		}
+
+		for _, seg := range file.Segments[:min(samples, len(file.Segments))] {
+			header, err := reader.Head(seg.Id)
+			if err != nil {
+				if nntpcli.IsArticleNotFoundError(err) {
+					continue
+				}
+
+				// The connection is no longer usable
+				_ = conn.Close()
+				slog.WarnContext(ctx, "Failed to read article headers", "segment", seg.Id, "error", err)
+				return append(headers, fh.finish()...)
+			}
+
+			fh.add(header, seg)
+		}
+
+		headers = append(headers, fh.finish()...)
+	}
+
+	_ = conn.Free()
+
+	return headers
+}
+
+// add accounts for the headers of an article
+func (fh *FileHeaders) add(header textproto.MIMEHeader, seg nzbparser.NzbSegment) {
+	if fh.Samples == 0 {
+		fh.Subject = header.Get("Subject")
+		fh.Poster = header.Get("From")
+	}
+	fh.Samples++
+
+	if date, err := mail.ParseDate(header.Get("Date")); err == nil && (fh.PostedAt.IsZero() || date.Before(fh.PostedAt)) {
+		fh.PostedAt = date.UTC()
+	}
+
+	if bytes, err := strconv.ParseInt(header.Get("Bytes"), 10, 64); err == nil {
+		fh.Bytes += bytes
+		fh.NZBBytes += int64(seg.Bytes)
+	}
+}
+
+// finish computes the deltas, returning nothing when no article was read
+func (fh FileHeaders) finish() []FileHeaders {
+	if fh.Samples == 0 {
+		return nil
+	}
+
+	if !fh.PostedAt.IsZero() && !fh.NZBDate.IsZero() {
+		fh.DateDelta = int64(fh.PostedAt.Sub(fh.NZBDate).Seconds())
+	}
+	if fh.Bytes > 0 {
+		fh.BytesDelta = fh.Bytes - fh.NZBBytes
+	}
+
+	return []FileHeaders{fh}
+}
+
+// WriteFileHeaders writes the article headers read for each file as a table
+func WriteFileHeaders(w io.Writer, headers []FileHeaders) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "FILE\tPOSTER\tPOSTED\tDATE DELTA\tBYTES DELTA\tSUBJECT")
+	for _, fh := range headers {
+		posted := "-"
+		if !fh.PostedAt.IsZero() {
+			posted = fh.PostedAt.Format(time.RFC3339)
+		}
+
+		bytesDelta := "-"
+		if fh.Bytes > 0 {
+			bytesDelta = fmt.Sprintf("%+d", fh.BytesDelta)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			fh.File, fh.Poster, posted, time.Duration(fh.DateDelta)*time.Second, bytesDelta, fh.Subject)
+	}
+
+	return tw.Flush()
+}
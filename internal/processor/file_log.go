@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/events"
+)
+
+// FileOperation is an action taken on an NZB file, recorded in the file log
+type FileOperation string
+
+const (
+	FileQueued   FileOperation = "queued"   // Added to the queue
+	FileChecked  FileOperation = "checked"  // Checked, Detail holds the outcome
+	FileMoved    FileOperation = "moved"    // Moved to Target, e.g. into the failed directory
+	FileDeleted  FileOperation = "deleted"  // Deleted by a rule, into the trash at Target when there is one
+	FileWritten  FileOperation = "written"  // Created by nzb-touch, e.g. uploaded or downloaded from a feed
+	FileRenamed  FileOperation = "renamed"  // Seen under another path, the queue item followed it to Target
+	FileRestored FileOperation = "restored" // Brought back from the trash or a target directory to Target
+	FilePurged   FileOperation = "purged"   // Deleted from the trash once its retention expired
+)
+
+// FileLogEntry is a recorded file operation
+type FileLogEntry struct {
+	ID        int64         `json:"id"`
+	Time      time.Time     `json:"time"`
+	Operation FileOperation `json:"operation"`
+	Path      string        `json:"path"`
+	Target    string        `json:"target,omitempty"` // Path after the operation, when it changed
+	Detail    string        `json:"detail,omitempty"` // Why, or what came out of it
+}
+
+// createFileLog creates the append-only table recording the operations on NZB files
+func createFileLog(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS file_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			at TIMESTAMP NOT NULL,
+			operation TEXT NOT NULL,
+			path TEXT NOT NULL,
+			target TEXT NOT NULL DEFAULT '',
+			detail TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_file_log_path ON file_log(path);
+		CREATE INDEX IF NOT EXISTS idx_file_log_target ON file_log(target);
+	`)
+	return err
+}
+
+// LogFileOperation appends an operation to the file log. The log is never
+// pruned with the queue, it outlives the items it mentions.
+func (q *Queue) LogFileOperation(op FileOperation, path, target, detail string) {
+	path = normalizePath(path)
+	if target != "" {
+		target = normalizePath(target)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, err := q.db.Exec(
+		"INSERT INTO file_log (at, operation, path, target, detail) VALUES (?, ?, ?, ?, ?)",
+		time.Now(), op, path, target, detail,
+	)
+	if err != nil {
+		slog.Error("Failed to record file operation", "operation", op, "path", path, "error", err)
+	}
+}
+
+// FileLog returns the latest recorded operations, oldest first. With a path
+// only the operations on it, or moving a file to it, are returned.
+func (q *Queue) FileLog(path string, limit int) ([]FileLogEntry, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	query := "SELECT id, at, operation, path, target, detail FROM file_log"
+	var args []any
+	if path != "" {
+		path = normalizePath(path)
+		query += " WHERE path = ? OR target = ?"
+		args = append(args, path, path)
+	}
+	query += " ORDER BY id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := q.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var entries []FileLogEntry
+	for rows.Next() {
+		var e FileLogEntry
+		if err := rows.Scan(&e.ID, &e.Time, &e.Operation, &e.Path, &e.Target, &e.Detail); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Oldest first, as the operations happened
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, nil
+}
+
+// logFileEvent records the queued and checked NZBs in the file log
+func (s *DirectoryScanner) logFileEvent(_ context.Context, e events.Event) {
+	switch e.Type {
+	case events.NZBQueued:
+		s.queue.LogFileOperation(FileQueued, e.Path, "", "")
+	case events.CheckFinished:
+		// A check interrupted by the shutdown did not happen, it runs again
+		if errors.Is(e.Err, context.Canceled) {
+			return
+		}
+
+		detail := "passed"
+		if e.Err != nil {
+			detail = "failed: " + strings.ReplaceAll(e.Err.Error(), "\n", "; ")
+		}
+		if result := eventResult(e); result != nil {
+			detail += fmt.Sprintf(" (health %.1f%%)", result.Health())
+		}
+		s.queue.LogFileOperation(FileChecked, e.Path, "", detail)
+	}
+}
+
+// feedDownloaded records an NZB downloaded from a feed and queues it
+func (s *DirectoryScanner) feedDownloaded(ctx context.Context, path string) {
+	s.queue.LogFileOperation(FileWritten, path, "", "downloaded from a feed")
+	s.queueFile(ctx, path)
+}
@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// prioritySidecarExt is the extension of the file next to an NZB giving its
+// priority, e.g. "movie.nzb.priority"
+const prioritySidecarExt = ".priority"
+
+// priorityNames are the named priorities accepted in file names and sidecars
+var priorityNames = map[string]int{
+	"low":    -50,
+	"normal": 0,
+	"high":   50,
+	"urgent": manualPriority,
+}
+
+// parsePriority parses a named ("high") or numeric ("20", "-5") priority
+func parsePriority(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if priority, ok := priorityNames[s]; ok {
+		return priority, nil
+	}
+
+	priority, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %q, expected low, normal, high, urgent or a number", s)
+	}
+
+	return priority, nil
+}
+
+// filePriority returns the priority an NZB asks for, from a sidecar file
+// named after it ("movie.nzb.priority") or else from a "!" suffix of its name
+// ("movie!high.nzb"). Without either, or with an invalid one, it is 0.
+func filePriority(ctx context.Context, path string) int {
+	sidecar := path + prioritySidecarExt
+	if data, err := os.ReadFile(sidecar); err == nil {
+		priority, err := parsePriority(string(data))
+		if err == nil {
+			return priority
+		}
+
+		slog.WarnContext(ctx, "Ignoring priority sidecar", "path", sidecar, "error", err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if i := strings.LastIndex(name, "!"); i >= 0 {
+		if priority, err := parsePriority(name[i+1:]); err == nil {
+			return priority
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+	"github.com/javi11/nzb-touch/internal/handoff"
+	"github.com/javi11/nzb-touch/internal/hook"
+)
+
+// WithSuccessActions sets the actions handing NZBs that pass their check over
+// to downstream systems
+func WithSuccessActions(actions []handoff.Action) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.successActions = actions
+	}
+}
+
+// handOff applies the post-success actions to an NZB that passed its check.
+// They run in order on the NZB, or on its copy once a copy action ran; the
+// first failing action stops the others.
+func (s *DirectoryScanner) handOff(ctx context.Context, e events.Event) {
+	result := eventResult(e)
+	if len(s.successActions) == 0 || e.Err != nil || result == nil {
+		return
+	}
+
+	path := e.Path
+	for _, action := range s.successActions {
+		next, err := s.applySuccessAction(ctx, action, path, result)
+		if err != nil {
+			slog.ErrorContext(ctx, "Post-success action failed, skipping the remaining ones",
+				"action", action.Type,
+				"path", path,
+				"error", err)
+			return
+		}
+
+		slog.DebugContext(ctx, "Post-success action applied", "action", action.Type, "path", path)
+		path = next
+	}
+}
+
+// applySuccessAction applies an action to path and returns the path the
+// following actions apply to
+func (s *DirectoryScanner) applySuccessAction(ctx context.Context, action handoff.Action, path string, result *Result) (string, error) {
+	switch action.Type {
+	case handoff.ActionCopy:
+		// A copy handed off by a previous check is replaced
+		target := filepath.Join(action.Target, s.watchRelative(path))
+		if err := fsutil.Copy(path, target); err != nil {
+			return path, err
+		}
+
+		s.queue.LogFileOperation(FileWritten, target, "", "hand-off copy of "+path)
+		return target, nil
+	case handoff.ActionChown:
+		uid, gid, err := handoff.ParseOwner(action.Owner)
+		if err != nil {
+			return path, err
+		}
+
+		return path, os.Chown(path, uid, gid)
+	case handoff.ActionChmod:
+		mode, err := handoff.ParseMode(action.Mode)
+		if err != nil {
+			return path, err
+		}
+
+		return path, os.Chmod(path, mode)
+	case handoff.ActionMtime:
+		mtime := time.Now()
+		if action.Time == handoff.TimePosted && !result.OldestPost.IsZero() {
+			mtime = result.OldestPost
+		}
+
+		return path, os.Chtimes(path, time.Time{}, mtime)
+	case handoff.ActionCommand:
+		info := result.HookInfo(path, nil)
+		return path, hook.Exec(ctx, action.Target, 0, hook.EventOnSuccess, info, path)
+	default:
+		return path, fmt.Errorf("unknown action %q", action.Type)
+	}
+}
@@ -0,0 +1,272 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+)
+
+// HeaderCheck tunes the headers check mode, which confirms the articles of
+// an NZB posted in few groups by listing the message-ids of the group around
+// the posting dates instead of asking for every message-id
+type HeaderCheck struct {
+	MaxGroups   int           // NZBs posted in more groups are checked with STAT (default: 2)
+	MaxArticles int           // Largest range of articles listed in a group (default: 500000)
+	DateSlack   time.Duration // Margin around the posting dates of the NZB (default: 1h)
+}
+
+var headerCheckDefault = HeaderCheck{MaxGroups: 2, MaxArticles: 500000, DateSlack: time.Hour}
+
+const (
+	// headerChunk is the number of articles listed per command
+	headerChunk = 10000
+	// dateProbe is the number of articles listed to find a dated article
+	// from a position, bridging the gaps left by expired articles
+	dateProbe = 100
+)
+
+// headerLister lists the headers of article ranges, the connections dialed
+// by nntp.Dialer with headers enabled implement it
+type headerLister interface {
+	Group(group string) (low, high int, err error)
+	Headers(field string, low, high int, fn func(number int, value string)) error
+}
+
+// WithHeaderCheck tunes the headers check mode, zero values keep the defaults
+func WithHeaderCheck(check HeaderCheck) Option {
+	return func(p *Processor) {
+		if check.MaxGroups > 0 {
+			p.headerCheck.MaxGroups = check.MaxGroups
+		}
+		if check.MaxArticles > 0 {
+			p.headerCheck.MaxArticles = check.MaxArticles
+		}
+		if check.DateSlack > 0 {
+			p.headerCheck.DateSlack = check.DateSlack
+		}
+	}
+}
+
+// listedSegments holds the segments confirmed by a header listing and the provider listing them
+type listedSegments struct {
+	ids      map[string]bool
+	provider string
+}
+
+// found reports whether a segment was confirmed by the listing
+func (l *listedSegments) found(id string) bool {
+	return l != nil && l.ids[id]
+}
+
+// listSegments confirms the segments of an NZB in bulk from the message-ids
+// listed in its groups on one connection. Segments it does not confirm are
+// checked one by one, so a failed or skipped listing only costs time.
+func (p *Processor) listSegments(ctx context.Context, files []nzbparser.NzbFile) *listedSegments {
+	if !p.headerListing || p.replay != nil {
+		return nil
+	}
+
+	wanted := make(map[string]bool)
+	groupSet := make(map[string]bool)
+	var first, last time.Time
+	for _, file := range files {
+		if file.Date <= 0 {
+			slog.DebugContext(ctx, "NZB file without a posting date, checking with STAT", "file", file.Filename)
+			return nil
+		}
+
+		posted := time.Unix(int64(file.Date), 0)
+		if first.IsZero() || posted.Before(first) {
+			first = posted
+		}
+		if posted.After(last) {
+			last = posted
+		}
+
+		for _, group := range file.Groups {
+			groupSet[group] = true
+		}
+		for _, seg := range file.Segments {
+			wanted[seg.Id] = true
+		}
+	}
+
+	groups := make([]string, 0, len(groupSet))
+	for group := range groupSet {
+		groups = append(groups, group)
+	}
+	if len(groups) == 0 || len(groups) > p.headerCheck.MaxGroups {
+		slog.DebugContext(ctx, "NZB posted in too many groups for a header listing, checking with STAT",
+			"groups", len(groups), "max_groups", p.headerCheck.MaxGroups)
+		return nil
+	}
+
+	if err := p.budget.acquire(ctx); err != nil {
+		return nil
+	}
+	defer p.budget.release()
+
+	conn, err := p.nntpClient.GetConnection(ctx, p.members(append(p.notCarrying(groups), p.unscheduled()...)), false)
+	if err != nil {
+		return nil
+	}
+
+	lister, ok := conn.Connection().(headerLister)
+	if !ok {
+		_ = conn.Free()
+		slog.WarnContext(ctx, "The connection cannot list headers, checking with STAT")
+		return nil
+	}
+
+	listed := &listedSegments{ids: make(map[string]bool), provider: p.logical(conn.Provider().ID())}
+	from, to := first.Add(-p.headerCheck.DateSlack), last.Add(p.headerCheck.DateSlack)
+	start := time.Now()
+
+	healthy := true
+	for _, group := range groups {
+		if len(listed.ids) == len(wanted) || ctx.Err() != nil {
+			break
+		}
+
+		if err := p.listGroup(ctx, lister, group, from, to, wanted, listed.ids); err != nil {
+			slog.WarnContext(ctx, "Failed to list the headers of a group, checking the rest with STAT",
+				"group", group, "provider", listed.provider, "error", err)
+
+			// The connection stays usable after a server answer or a refused range
+			var protoErr *textproto.Error
+			var rangeErr *rangeError
+			if !errors.As(err, &protoErr) && !errors.As(err, &rangeErr) {
+				healthy = false
+				break
+			}
+		}
+	}
+
+	if healthy {
+		_ = conn.Free()
+	} else {
+		_ = conn.Close()
+	}
+
+	slog.InfoContext(ctx, "Segments confirmed by header listing",
+		"found", len(listed.ids), "segments", len(wanted), "provider", listed.provider,
+		"duration", time.Since(start).Round(time.Millisecond))
+
+	return listed
+}
+
+// listGroup marks the wanted message-ids listed in a group between two dates
+func (p *Processor) listGroup(ctx context.Context, lister headerLister, group string, from, to time.Time, wanted, found map[string]bool) error {
+	low, high, err := lister.Group(group)
+	if err != nil {
+		return err
+	}
+	if high < low {
+		return nil
+	}
+
+	begin, err := firstPostedSince(lister, low, high+1, from)
+	if err != nil {
+		return err
+	}
+	end, err := firstPostedSince(lister, begin, high+1, to)
+	if err != nil {
+		return err
+	}
+	if end <= begin {
+		return nil
+	}
+
+	if end-begin > p.headerCheck.MaxArticles {
+		return &rangeError{group: group, articles: end - begin, max: p.headerCheck.MaxArticles}
+	}
+
+	slog.DebugContext(ctx, "Listing message-ids", "group", group, "first", begin, "last", end-1)
+
+	for low := begin; low < end; low += headerChunk {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		high := min(low+headerChunk, end) - 1
+		err := lister.Headers("Message-ID", low, high, func(_ int, value string) {
+			id := strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+			if wanted[id] {
+				found[id] = true
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(found) == len(wanted) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// rangeError is a group whose articles around the posting dates are too many to list
+type rangeError struct {
+	group    string
+	articles int
+	max      int
+}
+
+func (e *rangeError) Error() string {
+	return fmt.Sprintf("%s has %d articles around the posting dates, more than max_articles (%d)", e.group, e.articles, e.max)
+}
+
+// firstPostedSince returns the number of the first article dated at or after
+// since among the articles numbered from low to high (excluded), high when
+// there is none. Article dates only roughly follow their numbers, which the
+// date slack makes up for.
+func firstPostedSince(lister headerLister, low, high int, since time.Time) (int, error) {
+	for low < high {
+		mid := low + (high-low)/2
+
+		number, posted, err := firstDated(lister, mid, high)
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case number < 0:
+			// No dated article left from mid on
+			high = mid
+		case posted.Before(since):
+			low = number + 1
+		default:
+			high = mid
+		}
+	}
+
+	return low, nil
+}
+
+// firstDated returns the first article with a valid date numbered from low
+// on, -1 when none is found before high or within the probe
+func firstDated(lister headerLister, low, high int) (int, time.Time, error) {
+	number := -1
+	var posted time.Time
+
+	err := lister.Headers("Date", low, min(low+dateProbe, high)-1, func(n int, value string) {
+		if number >= 0 {
+			return
+		}
+
+		if date, err := mail.ParseDate(value); err == nil {
+			number, posted = n, date
+		}
+	})
+
+	return number, posted, err
+}
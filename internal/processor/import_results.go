@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/importer"
+)
+
+// ImportResult seeds the queue with the check of an NZB by another tool, as
+// if nzb-touch had checked it then: it is checked again on the reprocess
+// interval only. An NZB already checked by nzb-touch, or skipped as a
+// duplicate, keeps its own history, false is returned then.
+func (q *Queue) ImportResult(r importer.Result, source string) bool {
+	filePath := normalizePath(r.Path)
+
+	checked := r.Checked
+	if checked.IsZero() || checked.After(time.Now()) {
+		checked = time.Now()
+	}
+
+	status, failedChecks, outcome := StatusCompleted, 0, "passed"
+	var failingSince any
+	if !r.Passed {
+		status, failedChecks, outcome, failingSince = StatusFailed, 1, "failed", checked
+	}
+
+	var health any
+	if r.Health >= 0 {
+		health = r.Health
+		outcome += fmt.Sprintf(" (health %.1f%%)", r.Health)
+	}
+
+	q.mu.Lock()
+	imported, err := q.importResult(filePath, checked, status, health, failedChecks, failingSince)
+	q.mu.Unlock()
+	if err != nil {
+		slog.Error("Failed to import check result", "path", filePath, "error", err)
+		return false
+	}
+
+	if imported {
+		q.LogFileOperation(FileChecked, filePath, "", "imported from "+source+": "+outcome)
+	}
+
+	return imported
+}
+
+// importResult stores an imported check unless the NZB was already checked
+func (q *Queue) importResult(filePath string, checked time.Time, status string, health any, failedChecks int, failingSince any) (bool, error) {
+	tx, err := q.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var stored, current, duplicateOf string
+	var count int
+	err = tx.QueryRow(
+		"SELECT file_path, process_count, status, duplicate_of FROM queue WHERE file_path = ? OR path_key = ? ORDER BY file_path = ? DESC LIMIT 1",
+		filePath, pathKey(filePath), filePath,
+	).Scan(&stored, &count, &current, &duplicateOf)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.Exec(`
+			INSERT INTO queue (file_path, added, processed, processed_at, process_count, path_key, status, last_health, failed_checks, failing_since)
+			VALUES (?, ?, 1, ?, 1, ?, ?, ?, ?, ?)`,
+			filePath, time.Now(), checked, pathKey(filePath), status, health, failedChecks, failingSince,
+		)
+	case err != nil:
+		return false, err
+	case count > 0 || current == StatusProcessing || duplicateOf != "":
+		return false, nil
+	default:
+		_, err = tx.Exec(`
+			UPDATE queue SET processed = 1, processed_at = ?, process_count = 1, status = ?, last_health = ?, failed_checks = ?, failing_since = ?
+			WHERE file_path = ?`,
+			checked, status, health, failedChecks, failingSince, stored,
+		)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
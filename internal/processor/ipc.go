@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// ipcTimeout bounds how long a client may take to send its requests
+var ipcTimeout = time.Minute
+
+// WithIPCListener accepts NZB paths and payloads from local tools on a unix
+// socket. Payloads are saved in the submit directory before being queued.
+func WithIPCListener(socketPath string) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.ipcSocket = socketPath
+	}
+}
+
+// listenIPC opens the ingestion socket, replacing a stale one left by a previous run
+func (s *DirectoryScanner) listenIPC() (net.Listener, error) {
+	if info, err := os.Lstat(s.ipcSocket); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		_ = os.Remove(s.ipcSocket)
+	}
+
+	ln, err := net.Listen("unix", s.ipcSocket)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the owner and its group may queue NZBs
+	if err := os.Chmod(s.ipcSocket, 0o660); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
+
+// serveIPC accepts ingestion clients until ctx is done
+func (s *DirectoryScanner) serveIPC(ctx context.Context, ln net.Listener) {
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+
+	slog.InfoContext(ctx, "Accepting NZBs on the ingestion socket", "socket", s.ipcSocket)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				slog.ErrorContext(ctx, "Ingestion socket failed", "error", err)
+			}
+			return
+		}
+
+		go s.handleIPC(ctx, conn)
+	}
+}
+
+// handleIPC serves a client. Every line is the path of an NZB to queue, except
+// "NZB <name>" which is followed by the NZB itself until the client closes its
+// side. Each request is answered with "OK <path>" or "ERR <reason>".
+func (s *DirectoryScanner) handleIPC(ctx context.Context, conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetDeadline(time.Now().Add(ipcTimeout))
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line != "" {
+			var (
+				path    string
+				reqErr  error
+				payload = strings.HasPrefix(line, "NZB ")
+			)
+			if payload {
+				path, reqErr = s.Upload(ctx, strings.TrimSpace(strings.TrimPrefix(line, "NZB ")), r)
+			} else {
+				path, reqErr = s.Submit(ctx, line)
+			}
+
+			if reqErr != nil {
+				slog.WarnContext(ctx, "Rejected NZB from the ingestion socket", "request", line, "error", reqErr)
+				fmt.Fprintf(conn, "ERR %s\n", reqErr)
+			} else {
+				fmt.Fprintf(conn, "OK %s\n", path)
+			}
+
+			// The payload was read until the end of the stream
+			if payload {
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
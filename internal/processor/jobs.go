@@ -0,0 +1,245 @@
+package processor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/api"
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/nzb"
+)
+
+// Role selects which part of the work an instance does
+type Role string
+
+const (
+	// RoleAll scans the watch directories and checks the NZBs found
+	RoleAll Role = "all"
+	// RoleScanner scans the watch directories and hands the checks to checker
+	// nodes pulling them over the API, it needs no NNTP provider
+	RoleScanner Role = "scanner"
+	// RoleChecker checks the jobs pulled from a scanner node, see RunChecker
+	RoleChecker Role = "checker"
+)
+
+// ParseRole parses a role name, empty means all
+func ParseRole(s string) (Role, error) {
+	switch role := Role(s); role {
+	case "":
+		return RoleAll, nil
+	case RoleAll, RoleScanner, RoleChecker:
+		return role, nil
+	default:
+		return "", fmt.Errorf("unknown scanner role %q, expected all, scanner or checker", s)
+	}
+}
+
+// WithRole sets the role of the scanner, RoleScanner hands the checks to
+// checker nodes instead of running them
+func WithRole(role Role) ScannerOption {
+	return func(s *DirectoryScanner) {
+		if role == RoleScanner {
+			s.jobs = &jobBoard{
+				waiting: make(chan *job),
+				claimed: make(map[string]*job),
+			}
+		}
+	}
+}
+
+// jobBoard holds the checks handed to checker nodes
+type jobBoard struct {
+	waiting chan *job // Jobs waiting for a checker node, one per dispatching worker
+	mu      sync.Mutex
+	claimed map[string]*job // Jobs being checked by a checker node, by ID
+}
+
+// job is a check handed to a checker node
+type job struct {
+	api.Job
+	worker  string              // Checker node running the check
+	expires time.Time           // End of the lease, renewed by the checker node
+	done    chan api.JobOutcome // Receives the outcome reported by the checker node
+}
+
+// expired takes a job back from its checker node once its lease expired
+func (b *jobBoard) expired(j *job) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.claimed[j.ID] != j || time.Now().Before(j.expires) {
+		return false
+	}
+
+	delete(b.claimed, j.ID)
+	return true
+}
+
+// release forgets a job, its outcome is not waited for anymore
+func (b *jobBoard) release(j *job) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.claimed[j.ID] == j {
+		delete(b.claimed, j.ID)
+	}
+}
+
+// check runs the check of an NZB, on a checker node in the scanner role
+func (s *DirectoryScanner) check(ctx context.Context, filePath string, nzbData *nzb.NZB, opts CheckOptions) (*Result, error) {
+	if s.jobs != nil {
+		return s.remoteCheck(ctx, filePath, opts)
+	}
+
+	return s.processor.ProcessNZB(ctx, nzbData.Nzb, opts)
+}
+
+// remoteCheck hands the check of an NZB to the next checker node claiming a
+// job and waits for its outcome. A job whose lease expires, e.g. its checker
+// node crashed, is handed out again.
+func (s *DirectoryScanner) remoteCheck(ctx context.Context, filePath string, opts CheckOptions) (*Result, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errcode.Wrap(errcode.NZBUnreadable, fmt.Errorf("failed to read NZB file: %w", err))
+	}
+
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return nil, errcode.Wrap(errcode.InvalidOptions, err)
+	}
+
+	j := &job{
+		Job:  api.Job{Path: filePath, NZB: data, Options: options},
+		done: make(chan api.JobOutcome, 1),
+	}
+
+	ticker := time.NewTicker(leaseDuration / 4)
+	defer ticker.Stop()
+
+	for {
+		// Every hand-out gets its own ID, so the checker node whose lease
+		// expired can neither renew nor complete the new claim
+		j.ID = newJobID()
+		slog.DebugContext(ctx, "Waiting for a checker node", "path", filePath, "job", j.ID)
+
+		select {
+		case s.jobs.waiting <- j:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		claimed := true
+		for claimed {
+			select {
+			case outcome := <-j.done:
+				slog.InfoContext(ctx, "Job checked by checker node", "path", filePath, "job", j.ID, "worker", j.worker, "error", outcome.Error)
+				return jobResult(outcome)
+			case <-ctx.Done():
+				s.jobs.release(j)
+				return nil, ctx.Err()
+			case <-ticker.C:
+				if s.jobs.expired(j) {
+					slog.WarnContext(ctx, "Checker node stopped renewing its job, handing it out again", "path", filePath, "job", j.ID, "worker", j.worker)
+					claimed = false
+				}
+			}
+		}
+	}
+}
+
+// newJobID returns a random job ID
+func newJobID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// jobResult converts the outcome reported by a checker node to the result
+// and error of a local check
+func jobResult(outcome api.JobOutcome) (*Result, error) {
+	var result *Result
+	if len(outcome.Result) > 0 {
+		result = new(Result)
+		if err := json.Unmarshal(outcome.Result, result); err != nil {
+			return nil, fmt.Errorf("invalid result from checker node: %w", err)
+		}
+	}
+
+	switch {
+	case outcome.Error == "":
+		return result, nil
+	case outcome.Code == errcode.ProvidersDown:
+		return result, errcode.Wrap(errcode.ProvidersDown, fmt.Errorf("%w: %s", ErrProvidersDown, outcome.Error))
+	case outcome.Code == "":
+		return result, errcode.New(errcode.Unknown, outcome.Error)
+	default:
+		return result, errcode.New(outcome.Code, outcome.Error)
+	}
+}
+
+// ClaimJob hands the next check to a checker node, waiting until ctx is
+// done for one, nil when none came
+func (s *DirectoryScanner) ClaimJob(ctx context.Context, worker string) (*api.Job, error) {
+	if s.jobs == nil {
+		return nil, errcode.New(errcode.JobsDisabled, "this scanner checks its NZBs itself, set scanner.role to scanner to hand them to checker nodes")
+	}
+
+	select {
+	case j := <-s.jobs.waiting:
+		s.jobs.mu.Lock()
+		j.worker, j.expires = worker, time.Now().Add(leaseDuration)
+		s.jobs.claimed[j.ID] = j
+		s.jobs.mu.Unlock()
+
+		slog.InfoContext(ctx, "Job claimed by checker node", "path", j.Path, "job", j.ID, "worker", worker)
+		claimed := j.Job
+		return &claimed, nil
+	case <-ctx.Done():
+		return nil, nil
+	}
+}
+
+// RenewJob extends the lease of a job claimed by a checker node
+func (s *DirectoryScanner) RenewJob(id string) error {
+	if s.jobs == nil {
+		return errcode.New(errcode.JobsDisabled, "this scanner does not hand jobs out")
+	}
+
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+
+	j, ok := s.jobs.claimed[id]
+	if !ok {
+		return errcode.New(errcode.UnknownJob, "job "+id+" is not claimed, it may have been handed out again")
+	}
+
+	j.expires = time.Now().Add(leaseDuration)
+	return nil
+}
+
+// CompleteJob reports the outcome of a job claimed by a checker node
+func (s *DirectoryScanner) CompleteJob(id string, outcome api.JobOutcome) error {
+	if s.jobs == nil {
+		return errcode.New(errcode.JobsDisabled, "this scanner does not hand jobs out")
+	}
+
+	s.jobs.mu.Lock()
+	j, ok := s.jobs.claimed[id]
+	delete(s.jobs.claimed, id)
+	s.jobs.mu.Unlock()
+
+	if !ok {
+		return errcode.New(errcode.UnknownJob, "job "+id+" is not claimed, it may have been handed out again")
+	}
+
+	j.done <- outcome
+	return nil
+}
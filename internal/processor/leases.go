@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// leaseDuration is how long a file stays claimed by the instance checking it
+// without being renewed, after that another instance may check it again
+const leaseDuration = 2 * time.Minute
+
+// newLeaseOwner returns an identifier of this instance, unique among the
+// instances sharing a queue database
+func newLeaseOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// RenewLeases extends the leases of the files this instance is checking
+func (q *Queue) RenewLeases() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, err := q.db.Exec(
+		"UPDATE queue SET lease_until = ? WHERE lease_owner = ? AND status = ?",
+		time.Now().Add(leaseDuration), q.owner, StatusProcessing,
+	)
+
+	return err
+}
+
+// renewLeases keeps the files being checked claimed until the context is
+// done, and requeues the ones whose instance stopped renewing them
+func (s *DirectoryScanner) renewLeases(ctx context.Context) {
+	ticker := time.NewTicker(leaseDuration / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.queue.RenewLeases(); err != nil {
+				slog.ErrorContext(ctx, "Failed to renew leases", "error", err)
+			}
+
+			s.recoverInterrupted(ctx)
+		}
+	}
+}
+
+// recoverInterrupted requeues the files left processing by a stopped run or instance
+func (s *DirectoryScanner) recoverInterrupted(ctx context.Context) {
+	for _, item := range s.queue.RecoverInterrupted() {
+		slog.WarnContext(ctx, "Requeued item interrupted while processing", "path", item.FilePath, "retries", item.Retries)
+	}
+}
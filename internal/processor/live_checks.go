@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/api"
+)
+
+// liveCheck counts the segments of a check in progress, shown by the API
+type liveCheck struct {
+	path     string
+	started  time.Time
+	segments atomic.Int64 // Segments to check in the files started so far
+	checked  atomic.Int64
+	failed   atomic.Int64
+}
+
+// liveCheckKey carries the liveCheck of a check in its context
+type liveCheckKey struct{}
+
+// liveCheckOf returns the liveCheck carried by ctx, nil when the check is
+// not followed
+func liveCheckOf(ctx context.Context) *liveCheck {
+	c, _ := ctx.Value(liveCheckKey{}).(*liveCheck)
+	return c
+}
+
+// startFile accounts for the segments to check in a file
+func (c *liveCheck) startFile(segments int) {
+	if c != nil {
+		c.segments.Add(int64(segments))
+	}
+}
+
+// record accounts for a checked segment, err is nil on success
+func (c *liveCheck) record(err error) {
+	if c == nil {
+		return
+	}
+
+	c.checked.Add(1)
+	if err != nil {
+		c.failed.Add(1)
+	}
+}
+
+// followCheck lists the check of an NZB among the checks in progress until
+// the returned function is called, the processor counting its segments
+// through the returned context
+func (s *DirectoryScanner) followCheck(ctx context.Context, filePath string) (context.Context, func()) {
+	c := &liveCheck{path: filePath, started: time.Now()}
+
+	s.liveMu.Lock()
+	s.live[c] = struct{}{}
+	s.liveMu.Unlock()
+
+	return context.WithValue(ctx, liveCheckKey{}, c), func() {
+		s.liveMu.Lock()
+		delete(s.live, c)
+		s.liveMu.Unlock()
+	}
+}
+
+// Checks returns the checks in progress, the oldest first
+func (s *DirectoryScanner) Checks() []api.Check {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+
+	checks := make([]api.Check, 0, len(s.live))
+	for c := range s.live {
+		checks = append(checks, api.Check{
+			Path:     c.path,
+			Started:  c.started,
+			Segments: c.segments.Load(),
+			Checked:  c.checked.Load(),
+			Failed:   c.failed.Load(),
+		})
+	}
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Started.Before(checks[j].Started) })
+
+	return checks
+}
@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadSampler measures the load of other work from the kernel counters
+type loadSampler struct {
+	iface      string
+	downloaded func() int64 // Article bytes downloaded by the checks so far
+
+	at                     time.Time
+	total, busy, own       uint64
+	traffic, ownDownloaded int64
+}
+
+// newLoadSampler creates a sampler of the CPU and, when iface is set, of the
+// traffic of a network interface. downloaded returns the bytes downloaded by
+// the checks, removed from the traffic.
+func newLoadSampler(iface string, downloaded func() int64) (*loadSampler, error) {
+	s := &loadSampler{iface: iface, downloaded: downloaded}
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// read takes the counters of the sample to come
+func (s *loadSampler) read() error {
+	total, busy, err := readCPUTicks()
+	if err != nil {
+		return err
+	}
+
+	own, err := readOwnCPUTicks()
+	if err != nil {
+		return err
+	}
+
+	var traffic int64
+	if s.iface != "" {
+		if traffic, err = readInterfaceBytes(s.iface); err != nil {
+			return err
+		}
+	}
+
+	s.at, s.total, s.busy, s.own, s.traffic, s.ownDownloaded = time.Now(), total, busy, own, traffic, s.downloaded()
+	return nil
+}
+
+// sample returns the load since the previous sample
+func (s *loadSampler) sample() (hostLoad, error) {
+	prev := *s
+	if err := s.read(); err != nil {
+		return hostLoad{}, err
+	}
+
+	var load hostLoad
+	if total := s.total - prev.total; total > 0 {
+		others := float64(s.busy-prev.busy) - float64(s.own-prev.own)
+		load.CPUPercent = max(0, others*100/float64(total))
+	}
+
+	if elapsed := s.at.Sub(prev.at).Seconds(); s.iface != "" && elapsed > 0 {
+		others := (s.traffic - prev.traffic) - (s.ownDownloaded - prev.ownDownloaded)
+		load.NetworkMbps = max(0, float64(others)*8/1e6/elapsed)
+	}
+
+	return load, nil
+}
+
+// readCPUTicks returns the ticks spent by every core, and the busy ones among them
+func readCPUTicks() (total, busy uint64, err error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected /proc/stat line %q", line)
+	}
+
+	for i, field := range fields[1:] {
+		ticks, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unexpected /proc/stat line %q", line)
+		}
+
+		total += ticks
+		// idle and iowait
+		if i != 3 && i != 4 {
+			busy += ticks
+		}
+	}
+
+	return total, busy, nil
+}
+
+// readOwnCPUTicks returns the user and system ticks spent by this process
+func readOwnCPUTicks() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, err
+	}
+
+	// The command name may hold spaces, the fields after it start with the state
+	_, rest, ok := strings.Cut(string(data), ") ")
+	fields := strings.Fields(rest)
+	if !ok || len(fields) < 13 {
+		return 0, fmt.Errorf("unexpected /proc/self/stat content")
+	}
+
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return utime + stime, nil
+}
+
+// readInterfaceBytes returns the bytes received and sent on a network interface
+func readInterfaceBytes(iface string) (int64, error) {
+	var sum int64
+	for _, counter := range []string{"rx_bytes", "tx_bytes"} {
+		data, err := os.ReadFile(filepath.Join("/sys/class/net", iface, "statistics", counter))
+		if err != nil {
+			return 0, fmt.Errorf("network interface %s: %w", iface, err)
+		}
+
+		n, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("network interface %s: %w", iface, err)
+		}
+		sum += n
+	}
+
+	return sum, nil
+}
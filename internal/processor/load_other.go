@@ -0,0 +1,17 @@
+//go:build !linux
+
+package processor
+
+import "errors"
+
+// loadSampler is not supported on this platform
+type loadSampler struct{}
+
+// newLoadSampler fails, the load is read from Linux kernel counters
+func newLoadSampler(iface string, downloaded func() int64) (*loadSampler, error) {
+	return nil, errors.New("load throttling is only supported on Linux")
+}
+
+func (s *loadSampler) sample() (hostLoad, error) {
+	return hostLoad{}, errors.ErrUnsupported
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// NZBReport is the machine readable outcome of the check of an NZB
+type NZBReport struct {
+	Path      string    `json:"path"`
+	CheckedAt time.Time `json:"checked_at"`
+	Healthy   bool      `json:"healthy"` // The check passed
+	Health    float64   `json:"health"`  // Percentage of the segments not found missing
+	Error     string    `json:"error,omitempty"`
+	ErrorCode string    `json:"error_code,omitempty"`
+	Result    *Result   `json:"result,omitempty"`
+}
+
+// NewNZBReport returns the report of a check of the NZB at path
+func NewNZBReport(path string, result *Result, err error) NZBReport {
+	report := NZBReport{
+		Path:      path,
+		CheckedAt: time.Now().UTC(),
+		Healthy:   err == nil,
+		Result:    result,
+	}
+	if result != nil {
+		report.Health = result.Health()
+	}
+	if err != nil {
+		report.Error = err.Error()
+		report.ErrorCode = string(errcode.Of(err))
+	}
+
+	return report
+}
+
+// WriteNZBReport writes a report as indented JSON to file, replacing it atomically
+func WriteNZBReport(file string, report NZBReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	return fsutil.WriteFile(file, append(data, '\n'), 0o644)
+}
+
+// reportFileSuffix replaces ".nzb" in the name of the report of an NZB
+const reportFileSuffix = ".report.json"
+
+// WithReports writes a JSON report of every check when enabled, next to the
+// NZB or in directory when set, mirroring the tree of the watch directories
+func WithReports(enabled bool, directory string) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.reports = enabled || directory != ""
+		s.reportDirectory = directory
+	}
+}
+
+// reportFile returns where the report of an NZB is written
+func (s *DirectoryScanner) reportFile(path string) string {
+	if s.reportDirectory != "" {
+		path = filepath.Join(s.reportDirectory, s.watchRelative(path))
+	}
+
+	return strings.TrimSuffix(path, filepath.Ext(path)) + reportFileSuffix
+}
+
+// writeReport writes the report of a finished check
+func (s *DirectoryScanner) writeReport(ctx context.Context, e events.Event) {
+	// A check interrupted by the shutdown did not happen, it runs again
+	if !s.reports || errors.Is(e.Err, context.Canceled) {
+		return
+	}
+
+	file := s.reportFile(e.Path)
+	if err := WriteNZBReport(file, NewNZBReport(e.Path, eventResult(e), e.Err)); err != nil {
+		slog.ErrorContext(ctx, "Failed to write the NZB report", "path", e.Path, "report", file, "error", err)
+		return
+	}
+
+	slog.DebugContext(ctx, "NZB report written", "path", e.Path, "report", file)
+}
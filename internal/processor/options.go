@@ -0,0 +1,195 @@
+package processor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/groupstats"
+	"github.com/javi11/nzb-touch/internal/usage"
+)
+
+// Option configures optional behaviour of a Processor
+type Option func(*Processor)
+
+// CheckMode selects how the availability of a segment is verified
+type CheckMode int
+
+const (
+	// CheckModeBody downloads the full article body and discards it
+	CheckModeBody CheckMode = iota
+	// CheckModeStat only asks the provider whether the article exists
+	CheckModeStat
+	// CheckModePartial reads the first bytes of the body, enough to confirm
+	// the article and its yEnc header, then drops the connection to abort
+	// the transfer. It saves bandwidth at the cost of reconnecting.
+	CheckModePartial
+	// CheckModeHeaders confirms the articles of NZBs posted in few groups by
+	// listing the message-ids of their groups around the posting dates, the
+	// articles not listed and the other NZBs are checked with STAT
+	CheckModeHeaders
+	// CheckModeHead asks for the article headers with HEAD, which unlike STAT
+	// makes the server read the article instead of trusting its index
+	CheckModeHead
+)
+
+// String returns the config/flag name of the check mode
+func (m CheckMode) String() string {
+	switch m {
+	case CheckModeStat:
+		return "stat"
+	case CheckModePartial:
+		return "partial"
+	case CheckModeHeaders:
+		return "headers"
+	case CheckModeHead:
+		return "head"
+	default:
+		return "body"
+	}
+}
+
+// ParseCheckMode parses a check mode name, an empty name selects body
+func ParseCheckMode(name string) (CheckMode, error) {
+	switch name {
+	case "", "body":
+		return CheckModeBody, nil
+	case "stat":
+		return CheckModeStat, nil
+	case "partial":
+		return CheckModePartial, nil
+	case "headers":
+		return CheckModeHeaders, nil
+	case "head":
+		return CheckModeHead, nil
+	default:
+		return CheckModeBody, fmt.Errorf("unknown check mode %q", name)
+	}
+}
+
+// RetryPolicy controls how many times a failed segment is retried before
+// counting it as missing
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts per segment (values below 1 are treated as 1)
+	Delay       time.Duration // Wait time between attempts
+}
+
+var (
+	concurrencyDefault     = 10
+	retryPolicyDefault     = RetryPolicy{MaxAttempts: 1}
+	partialReadSizeDefault = int64(8 * 1024)
+)
+
+// WithConcurrency sets the number of segments checked in parallel
+func WithConcurrency(concurrency int) Option {
+	return func(p *Processor) {
+		if concurrency > 0 {
+			p.concurrency = concurrency
+		}
+	}
+}
+
+// WithCheckMode sets how segment availability is verified
+func WithCheckMode(mode CheckMode) Option {
+	return func(p *Processor) {
+		// The segments a header listing does not confirm are checked with STAT
+		p.headerListing = mode == CheckModeHeaders
+		if p.headerListing {
+			mode = CheckModeStat
+		}
+		p.checkMode = mode
+	}
+}
+
+// WithRetryPolicy sets how failed segments are retried
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(p *Processor) {
+		if policy.MaxAttempts < 1 {
+			policy.MaxAttempts = 1
+		}
+		p.retryPolicy = policy
+	}
+}
+
+// WithReporter sets the reporter notified about processing progress
+func WithReporter(reporter Reporter) Option {
+	return func(p *Processor) {
+		if reporter != nil {
+			p.reporter = reporter
+		}
+	}
+}
+
+// WithRoutingStrategy sets how segment requests are distributed among providers
+func WithRoutingStrategy(strategy RoutingStrategy) Option {
+	return func(p *Processor) {
+		if strategy == "" || strategy == RoutingPool {
+			p.router = nil
+		} else {
+			p.router = newProviderRouter(strategy)
+		}
+	}
+}
+
+// WithProviderWeights sets the share of requests of each provider in
+// weighted routing, keyed by provider ID (providers missing weigh 1)
+func WithProviderWeights(weights map[string]int) Option {
+	return func(p *Processor) {
+		p.providerWeights = weights
+	}
+}
+
+// WithStatBatchSize sets how many message-ids are verified on one connection
+// before it is returned to the pool in STAT mode (1 disables batching)
+func WithStatBatchSize(size int) Option {
+	return func(p *Processor) {
+		if size > 0 {
+			p.statBatchSize = size
+		}
+	}
+}
+
+// WithProviderRateLimits caps the requests per second sent to each provider, keyed by provider ID
+func WithProviderRateLimits(limits map[string]float64) Option {
+	return func(p *Processor) {
+		p.rateLimiters = make(map[string]*rateLimiter, len(limits))
+		for id, perSecond := range limits {
+			if perSecond > 0 {
+				p.rateLimiters[id] = newRateLimiter(perSecond)
+			}
+		}
+	}
+}
+
+// WithUsageLedger counts the bytes downloaded from and the requests sent to
+// every provider in a persistent ledger and stops using depleted block accounts
+func WithUsageLedger(ledger *usage.Ledger) Option {
+	return func(p *Processor) {
+		p.usage = ledger
+	}
+}
+
+// WithResultSpill records every segment outcome in an on-disk store, the
+// results then keep no missing message-ids
+func WithResultSpill(store *SpillStore[SegmentRecord]) Option {
+	return func(p *Processor) {
+		p.spill = store
+	}
+}
+
+// WithPartialReadSize sets how many bytes of each article are read in partial check mode
+func WithPartialReadSize(size int64) Option {
+	return func(p *Processor) {
+		if size > 0 {
+			p.partialReadSize = size
+		}
+	}
+}
+
+// WithGroupStats collects article availability per newsgroup and provider.
+// Segments are then checked on connections acquired by the processor so
+// the provider answering each request is known.
+func WithGroupStats(stats *groupstats.Collector) Option {
+	return func(p *Processor) {
+		p.groupStats = stats
+	}
+}
@@ -0,0 +1,188 @@
+package processor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nzb-touch/internal/events"
+)
+
+// ErrProvidersDown is returned by a check interrupted because no provider could be reached
+var ErrProvidersDown = errors.New("every provider is unreachable")
+
+var (
+	// outageProbeTimeout bounds the connection attempt probing a provider
+	outageProbeTimeout = 15 * time.Second
+	// outageProbeTTL is how long a probe result answers the segments failing meanwhile
+	outageProbeTTL = 10 * time.Second
+	// outageRetryIntervalDefault is how long the scanner stays paused during an outage
+	outageRetryIntervalDefault = 5 * time.Minute
+)
+
+// outageProbe caches the latest probe of the providers
+type outageProbe struct {
+	mu   sync.Mutex
+	at   time.Time
+	down bool
+}
+
+// WithOutageRetryInterval sets how long the scanner pauses when every provider
+// is unreachable before checking again
+func WithOutageRetryInterval(interval time.Duration) ScannerOption {
+	return func(s *DirectoryScanner) {
+		if interval > 0 {
+			s.outageRetry = interval
+		}
+	}
+}
+
+// isNetworkError reports whether err comes from the network rather than from
+// the provider answering, e.g. DNS, connect or TLS handshake failures
+func isNetworkError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var (
+		netErr     net.Error
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+		verifyErr  *tls.CertificateVerificationError
+		unknownCA  x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+	)
+
+	return errors.As(err, &netErr) ||
+		errors.As(err, &recordErr) ||
+		errors.As(err, &alertErr) ||
+		errors.As(err, &verifyErr) ||
+		errors.As(err, &unknownCA) ||
+		errors.As(err, &hostErr) ||
+		errors.As(err, &invalidErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// providersDown reports whether a segment failed because no provider can be
+// reached at all, in which case it says nothing about the NZB. After a network
+// error every provider is probed, the result is shared by the segments failing
+// meanwhile.
+func (p *Processor) providersDown(ctx context.Context, err error) bool {
+	switch {
+	case errors.Is(err, nntppool.ErrArticleNotFoundInProviders):
+		// The pool also answers this way when no provider accepts connections
+		return p.providersOffline()
+	case !isNetworkError(err):
+		return false
+	}
+
+	p.outage.mu.Lock()
+	defer p.outage.mu.Unlock()
+
+	if time.Since(p.outage.at) < outageProbeTTL {
+		return p.outage.down
+	}
+
+	infos := p.Providers()
+	down := len(infos) > 0
+	for _, info := range p.logicalProviders(infos) {
+		if p.providerReachable(ctx, info.ID(), infos) {
+			down = false
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	p.outage.at, p.outage.down = time.Now(), down
+
+	return down
+}
+
+// providersOffline reports whether the pool marked every provider as unusable
+func (p *Processor) providersOffline() bool {
+	infos := p.Providers()
+	for _, info := range infos {
+		if info.State == nntppool.ProviderStateActive {
+			return false
+		}
+	}
+
+	return len(infos) > 0
+}
+
+// providerReachable opens, or reuses, a connection to a provider and pings it.
+// A provider too busy to hand out a connection in time is considered reachable.
+func (p *Processor) providerReachable(ctx context.Context, providerID string, infos []nntppool.ProviderInfo) bool {
+	var skip []string
+	for _, info := range infos {
+		if p.logical(info.ID()) != providerID {
+			skip = append(skip, info.ID())
+		}
+	}
+
+	// An idle connection may have died with the network, the second attempt dials
+	for range 2 {
+		probeCtx, cancel := context.WithTimeout(ctx, outageProbeTimeout)
+		conn, err := p.nntpClient.GetConnection(probeCtx, skip, true)
+		cancel()
+		if err != nil {
+			return errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil
+		}
+
+		if err := pingConnection(conn.Connection()); err != nil {
+			slog.DebugContext(ctx, "Provider probe failed", "provider", providerID, "error", err)
+			_ = conn.Close()
+			continue
+		}
+
+		_ = conn.Free()
+		return true
+	}
+
+	return false
+}
+
+// pauseForOutage pauses the scanner while every provider is unreachable and
+// resumes it after the retry interval, unless it was resumed by hand meanwhile.
+// A scanner already paused stays paused.
+func (s *DirectoryScanner) pauseForOutage(ctx context.Context, cause error) {
+	if !s.Pause() {
+		return
+	}
+
+	s.pauseMu.Lock()
+	resumed := s.resumed
+	s.pauseMu.Unlock()
+
+	slog.WarnContext(ctx, "Every provider is unreachable, pausing the scanner", "retry_in", s.outageRetry, "error", cause)
+	s.bus.Publish(ctx, events.Event{Type: events.ProvidersDown, Err: cause})
+
+	go func() {
+		select {
+		case <-time.After(s.outageRetry):
+			slog.InfoContext(ctx, "Retrying after the provider outage")
+			if s.Resume() {
+				s.dispatchPending(ctx)
+			}
+		case <-resumed:
+		case <-s.stopChan:
+		case <-ctx.Done():
+		}
+	}()
+}
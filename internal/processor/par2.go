@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Tensai75/nzbparser"
+)
+
+// par2MinPercentDefault is the recovery data, as a percentage of the payload,
+// below which a release is flagged as having thin parity coverage
+var par2MinPercentDefault = 5.0
+
+// par2RecoveryVolume matches PAR2 recovery volumes like "movie.vol07+08.par2".
+// The index file without a "volN+M" part holds no recovery data.
+var par2RecoveryVolume = regexp.MustCompile(`(?i)\.vol\d+[+-]\d+\.par2$`)
+
+// fileBytes returns the size of a file, summing its segments when the NZB scan did not
+func fileBytes(file nzbparser.NzbFile) int64 {
+	if file.Bytes > 0 {
+		return file.Bytes
+	}
+
+	var total int64
+	for _, seg := range file.Segments {
+		total += int64(seg.Bytes)
+	}
+
+	return total
+}
+
+// par2Coverage returns the payload and PAR2 recovery bytes of the NZB
+func par2Coverage(nzb *nzbparser.Nzb) (payload, recovery int64) {
+	for _, file := range nzb.Files {
+		name := fileName(file)
+		switch {
+		case par2RecoveryVolume.MatchString(name):
+			recovery += fileBytes(file)
+		case strings.HasSuffix(strings.ToLower(name), ".par2"):
+			// The PAR2 index is neither payload nor recovery data
+		default:
+			payload += fileBytes(file)
+		}
+	}
+
+	return payload, recovery
+}
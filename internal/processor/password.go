@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nzb-touch/internal/events"
+)
+
+// PasswordHint tells that a release is likely password protected
+type PasswordHint struct {
+	Password string `json:"password,omitempty"` // The password when it is known
+	Source   string `json:"source"`             // Where the hint was found: "meta", "nzb_name", "filename" or "rar_header"
+}
+
+var (
+	// nzbNamePassword matches the "name{{password}}.nzb" naming convention
+	nzbNamePassword = regexp.MustCompile(`\{\{(.+?)\}\}`)
+	// filePasswordHint matches file names or subjects announcing a password
+	filePasswordHint = regexp.MustCompile(`(?i)(^|[^a-z])(password|passwort|passwd|pw)([^a-z]|$)`)
+)
+
+// detectPassword looks for password hints in the NZB meta data, the name
+// of the NZB file and the names of the files it contains
+func detectPassword(nzb *nzbparser.Nzb, nzbPath string) *PasswordHint {
+	for key, value := range nzb.Meta {
+		if strings.EqualFold(key, "password") && value != "" {
+			return &PasswordHint{Password: value, Source: "meta"}
+		}
+	}
+
+	if m := nzbNamePassword.FindStringSubmatch(filepath.Base(nzbPath)); m != nil {
+		return &PasswordHint{Password: m[1], Source: "nzb_name"}
+	}
+
+	for _, file := range nzb.Files {
+		if filePasswordHint.MatchString(fileName(file)) {
+			return &PasswordHint{Source: "filename"}
+		}
+	}
+
+	return nil
+}
+
+// WithPasswordTagging marks password protected NZBs in the queue database
+func WithPasswordTagging(enabled bool) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.tagPasswords = enabled
+	}
+}
+
+// tagPassword records in the queue whether a checked NZB is password protected
+func (s *DirectoryScanner) tagPassword(ctx context.Context, e events.Event) {
+	result := eventResult(e)
+	if !s.tagPasswords || result == nil {
+		return
+	}
+
+	s.queue.SetPasswordProtected(e.Path, result.Password != nil)
+}
@@ -0,0 +1,167 @@
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javi11/nzb-touch/internal/fsutil"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizePath cleans a path, dropping trailing separators and the Windows
+// extended-length prefix, and converts it to Unicode NFC, macOS and some
+// network shares hand out decomposed names
+func normalizePath(path string) string {
+	return norm.NFC.String(fsutil.CleanPath(path))
+}
+
+// pathKey returns the key identifying a path in the queue, every spelling of
+// the same file shares it, relative or absolute
+func pathKey(path string) string {
+	key := normalizePath(path)
+	if abs, err := filepath.Abs(key); err == nil {
+		key = abs
+	}
+
+	if fsutil.FoldCase {
+		key = strings.ToLower(key)
+	}
+
+	return key
+}
+
+// canonicalPath returns the spelling of path the queue knows it by, in NFC
+// form whatever the form of its name on disk. When the queued spelling no
+// longer exists on disk, e.g. after a mount remap, the queue item follows
+// the new spelling instead of being orphaned.
+func (s *DirectoryScanner) canonicalPath(ctx context.Context, path string) string {
+	path = normalizePath(path)
+
+	stored, ok := s.queue.Resolve(path)
+	if !ok || stored == path {
+		return path
+	}
+
+	if _, err := os.Stat(fsutil.DiskPath(stored)); err == nil {
+		return stored
+	}
+
+	if !s.queue.Rename(stored, path) {
+		return stored
+	}
+
+	slog.InfoContext(ctx, "Queued NZB is now seen under another path, following it", "from", stored, "to", path)
+	s.queue.LogFileOperation(FileRenamed, stored, path, "seen under another path")
+
+	return path
+}
+
+// normalizeStoredPaths converts the paths stored before normalization to
+// their normal form. An item queued under both forms, e.g. by a library
+// shared between macOS and Linux, keeps the row of the normal form.
+func normalizeStoredPaths(tx *sql.Tx) error {
+	paths, err := unnormalizedPaths(tx, "queue", "file_path")
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM queue WHERE file_path = ?)", normalizePath(path)).Scan(&exists); err != nil {
+			return err
+		}
+
+		if exists {
+			_, err = tx.Exec("DELETE FROM queue WHERE file_path = ?", path)
+		} else {
+			_, err = tx.Exec("UPDATE queue SET file_path = ? WHERE file_path = ?", normalizePath(path), path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, column := range []struct{ table, name string }{
+		{"queue", "duplicate_of"},
+		{"queue", "moved_to"},
+		{"file_log", "path"},
+		{"file_log", "target"},
+		{"trash", "original"},
+		{"trash", "location"},
+	} {
+		paths, err := unnormalizedPaths(tx, column.table, column.name)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			if _, err := tx.Exec("UPDATE "+column.table+" SET "+column.name+" = ? WHERE "+column.name+" = ?", normalizePath(path), path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// unnormalizedPaths returns the paths of a column that are not in normal form
+func unnormalizedPaths(tx *sql.Tx, table, column string) ([]string, error) {
+	rows, err := tx.Query("SELECT DISTINCT " + column + " FROM " + table + " WHERE " + column + " != ''")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		if path != normalizePath(path) {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, rows.Err()
+}
+
+// fillPathKeys sets the key of the rows queued before keys existed, restored
+// from a dump or keyed by an older version of pathKey
+func fillPathKeys(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT file_path, path_key FROM queue")
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for rows.Next() {
+		var path, key string
+		if err := rows.Scan(&path, &key); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if key != pathKey(path) {
+			paths = append(paths, path)
+		}
+	}
+	_ = rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if _, err := tx.Exec("UPDATE queue SET path_key = ? WHERE file_path = ?", pathKey(path), path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
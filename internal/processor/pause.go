@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Pause stops the workers from starting new checks, checks already running
+// finish and discovery keeps queueing new NZBs. It returns false when the
+// scanner was already paused.
+func (s *DirectoryScanner) Pause() bool {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	if s.resumed != nil {
+		return false
+	}
+
+	s.resumed = make(chan struct{})
+	slog.Info("Scanner paused, no new checks will start")
+
+	return true
+}
+
+// Resume lets the workers start checks again, returning false when the scanner was not paused
+func (s *DirectoryScanner) Resume() bool {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	if s.resumed == nil {
+		return false
+	}
+
+	close(s.resumed)
+	s.resumed = nil
+	slog.Info("Scanner resumed")
+
+	return true
+}
+
+// Paused reports whether the scanner is paused
+func (s *DirectoryScanner) Paused() bool {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	return s.resumed != nil
+}
+
+// waitResumed blocks while the scanner is paused, returning false when it
+// is stopped in the meantime
+func (s *DirectoryScanner) waitResumed(ctx context.Context) bool {
+	s.pauseMu.Lock()
+	resumed := s.resumed
+	s.pauseMu.Unlock()
+
+	if resumed == nil {
+		return true
+	}
+
+	select {
+	case <-resumed:
+		return true
+	case <-s.stopChan:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
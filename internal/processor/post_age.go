@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nzb-touch/internal/nzb"
+)
+
+// WithMinPostAge postpones the check of NZBs whose newest article was posted
+// less than age ago, so propagation lag is not mistaken for missing articles
+func WithMinPostAge(age time.Duration) ScannerOption {
+	return func(s *DirectoryScanner) {
+		if age > 0 {
+			s.minPostAge = age
+		}
+	}
+}
+
+// newestPost returns the post date of the newest file in the NZB, zero when no file is dated
+func newestPost(nzb *nzbparser.Nzb) time.Time {
+	var newest time.Time
+	for _, file := range nzb.Files {
+		if file.Date <= 0 {
+			continue
+		}
+
+		posted := time.Unix(int64(file.Date), 0)
+		if posted.After(newest) {
+			newest = posted
+		}
+	}
+
+	return newest
+}
+
+// postponeYoung postpones the check of an NZB posted less than the minimum
+// post age ago, reporting whether it was postponed. NZBs that cannot be read
+// or carry no post date are checked right away.
+func (s *DirectoryScanner) postponeYoung(ctx context.Context, filePath string) bool {
+	if s.minPostAge <= 0 {
+		return false
+	}
+
+	nzbData, err := nzb.LoadFromFile(filePath)
+	if err != nil {
+		return false
+	}
+
+	posted := newestPost(nzbData.Nzb)
+	if posted.IsZero() {
+		return false
+	}
+
+	due := posted.Add(s.minPostAge)
+	if !time.Now().Before(due) {
+		return false
+	}
+
+	s.queue.Postpone(filePath, due)
+	slog.InfoContext(ctx, "NZB posted too recently, postponing check", "path", filePath, "posted", posted, "check_after", due)
+
+	return true
+}
@@ -6,13 +6,16 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Tensai75/nzbparser"
 	"github.com/javi11/nntppool/v2"
-	"github.com/k0kubun/go-ansi"
-	"github.com/schollz/progressbar/v3"
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/groupstats"
+	"github.com/javi11/nzb-touch/internal/schedule"
+	"github.com/javi11/nzb-touch/internal/usage"
 	"github.com/sourcegraph/conc/pool"
 )
 
@@ -30,196 +33,519 @@ func (e *SegmentError) Error() string {
 type Processor struct {
 	nntpClient  nntppool.UsenetConnectionPool
 	concurrency int
+	checkMode   CheckMode
+	retryPolicy RetryPolicy
+	reporter    Reporter
+	router      *providerRouter
+	// Share of requests of each provider in weighted routing
+	providerWeights map[string]int
+	// Message-ids verified per connection in STAT mode
+	statBatchSize int
+	// Request rate limiters keyed by provider ID
+	rateLimiters map[string]*rateLimiter
+	// Download speed caps of every check together, nil for none, and of each provider keyed by provider ID
+	speedLimit     *speedLimiter
+	providerSpeeds map[string]*speedLimiter
+	// Retry behavior of each provider keyed by provider ID
+	providerRetries map[string]ProviderRetry
+	// Persistent downloaded bytes and requests per provider, nil unless block accounts or costs are declared
+	usage *usage.Ledger
+	// Optional on-disk store receiving every segment outcome
+	spill *SpillStore[SegmentRecord]
+	// Request slots shared by every NZB processed concurrently
+	budget *connectionBudget
+	// Bytes read from each article in partial check mode
+	partialReadSize int64
+	// Optional availability statistics per newsgroup and provider
+	groupStats *groupstats.Collector
+	// Newsgroup patterns carried by each restricted provider
+	providerGroups map[string][]string
+	// Request outcomes of each provider, nil unless provider alerts are enabled
+	errors *errorTracker
+	// Daily time windows of each scheduled provider
+	providerSchedules map[string][]schedule.Window
+	// Tier of every primary provider when they are tiered, and the distinct tiers in order
+	providerTiers map[string]int
+	tierOrder     []int
+	// Count the requests sent to each provider in the results
+	providerResults bool
+	// Logical provider ID of every extra account pooled with a provider
+	accountAliases map[string]string
+	// Interval at which the idle connections of each provider are pinged
+	healthChecks map[string]time.Duration
+	// Latest probe of the providers after a network error
+	outage outageProbe
+	// Classifies segment errors, ClassifyError when nil
+	classifier ErrorClassifier
+	// Optional recording of every segment response
+	recorder *SessionRecorder
+	// Answers segment requests from a recording instead of the providers when set
+	replay *SessionReplay
+	// Confirms segments in bulk with header listings before checking the rest with STAT
+	headerListing bool
+	headerCheck   HeaderCheck
+	// Reduces the requests in flight while the host or its network is busy
+	throttle LoadThrottle
+	// Article bytes downloaded by the checks, watched by the load throttle
+	downloaded atomic.Int64
 }
 
-// New creates a new processor with the specified configuration
-func New(nntpClient nntppool.UsenetConnectionPool, totalSegments int, concurrency int) *Processor {
-	if concurrency <= 0 {
-		concurrency = 10
+// New creates a new processor, behaviour can be tuned with options
+func New(nntpClient nntppool.UsenetConnectionPool, opts ...Option) *Processor {
+	p := &Processor{
+		nntpClient:      nntpClient,
+		concurrency:     concurrencyDefault,
+		checkMode:       CheckModeBody,
+		retryPolicy:     retryPolicyDefault,
+		statBatchSize:   statBatchSizeDefault,
+		partialReadSize: partialReadSizeDefault,
+		headerCheck:     headerCheckDefault,
 	}
 
-	return &Processor{
-		nntpClient:  nntpClient,
-		concurrency: concurrency,
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.reporter == nil {
+		p.reporter = NewProgressBarReporter()
+	}
+
+	p.budget = newConnectionBudget(p.concurrency)
+	if p.router != nil {
+		p.router.weights = p.providerWeights
+	}
+
+	return p
+}
+
+// checkSegment verifies a single segment, or answers it from the session
+// replay. The provider missedIn already did not have the article and is not
+// asked again, unless it is "".
+func (p *Processor) checkSegment(ctx context.Context, segmentID string, groups []string, missedIn string) (int64, error) {
+	if p.replay != nil {
+		return p.replay.next(ctx, segmentID)
+	}
+
+	if err := p.speedLimit.wait(ctx); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	bytes, err := p.fetchSegment(ctx, segmentID, groups, missedIn)
+	p.speedLimit.take(bytes)
+	p.downloaded.Add(bytes)
+	p.recordResponse(ctx, segmentID, bytes, time.Since(start), err)
+
+	return bytes, err
+}
+
+// fetchSegment verifies a single segment according to the check mode and
+// retry policy, never asking the provider missedIn unless it is ""
+func (p *Processor) fetchSegment(ctx context.Context, segmentID string, groups []string, missedIn string) (int64, error) {
+	var (
+		bytes int64
+		err   error
+	)
+
+	for attempt := 1; attempt <= p.retryPolicy.MaxAttempts; attempt++ {
+		if attempt > 1 && p.retryPolicy.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(p.retryPolicy.Delay):
+			}
+		}
+
+		// A provider the routed request did not find the article on is not
+		// asked again by the fallback
+		missed := missedIn
+		if p.router != nil && missed == "" {
+			routedBytes, ok, routedMiss := p.routedCheck(ctx, segmentID, groups)
+			if ok {
+				return routedBytes, nil
+			}
+			missed = routedMiss
+		}
+
+		switch {
+		case p.directFetch() || missed != "":
+			bytes, err = p.fetchDirect(ctx, segmentID, groups, missed)
+		case p.checkMode == CheckModeStat:
+			_, err = p.nntpClient.Stat(ctx, segmentID, groups)
+			bytes = 0
+		default:
+			bytes, err = p.nntpClient.Body(ctx, segmentID, io.Discard, groups)
+		}
+
+		if err == nil || errors.Is(err, context.Canceled) {
+			return bytes, err
+		}
+	}
+
+	return bytes, err
+}
+
+// spillSegment writes a segment outcome to the spill store when configured
+func (p *Processor) spillSegment(ctx context.Context, source, fileName, segmentID string, bytes int64, err error) {
+	if p.spill == nil {
+		return
+	}
+
+	rec := SegmentRecord{
+		Source:    source,
+		File:      fileName,
+		SegmentID: segmentID,
+		Bytes:     bytes,
+		Missing:   err != nil,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	if spillErr := p.spill.Append(rec); spillErr != nil {
+		slog.WarnContext(ctx, "Failed to spill segment result", "segment", segmentID, "error", spillErr)
 	}
 }
 
-// ProcessNZB downloads all articles in the NZB file
-func (p *Processor) ProcessNZB(ctx context.Context, nzb *nzbparser.Nzb, checkPercent int, missingPercent int) (err error) {
-	// Create a new worker pool with the configured concurrency
-	workerPool := pool.New().WithMaxGoroutines(p.concurrency).WithContext(ctx).WithCancelOnError()
-	defer func() {
-		err = workerPool.Wait()
-	}()
+// ProcessNZB downloads all articles in the NZB file and returns a summary of the check.
+// The result is populated even when an error is returned, unless the options are invalid.
+func (p *Processor) ProcessNZB(ctx context.Context, nzb *nzbparser.Nzb, opts CheckOptions) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errcode.Wrap(errcode.InvalidOptions, err)
+	}
+
+	// Message-ids listed more than once are checked and counted once
+	nzb, duplicates := uniqueSegments(nzb)
+	if duplicates > 0 {
+		slog.InfoContext(ctx, "NZB lists some message-ids more than once, checking them once", "duplicates", duplicates)
+	}
+
+	// Once the time budget is spent no new segments are submitted, while the
+	// outstanding requests finish and health is computed from the sample so far
+	var deadline time.Time
+	if opts.Timeout > 0 {
+		deadline = time.Now().Add(opts.Timeout)
+	}
+	timedOut := false
+	outOfTime := func() bool {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			timedOut = true
+		}
+
+		return timedOut
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	ctx, tally := p.withProviderTally(ctx)
+	live := liveCheckOf(ctx)
+
+	// Create a new worker pool sized to this NZB's share of the connection budget
+	share, leave := p.budget.join()
+	defer leave()
+
+	workerPool := pool.New().WithMaxGoroutines(share).WithContext(ctx).WithCancelOnError()
+
+	// Only the files selected by the file patterns take part in the check
+	files := opts.selectFiles(nzb.Files)
+	if len(files) < len(nzb.Files) {
+		slog.InfoContext(ctx, "Checking files selected by the file patterns, sample and proof files excluded", "files", len(files), "total_files", len(nzb.Files))
+	}
+
+	result := &Result{
+		Files:             len(files),
+		DuplicateSegments: duplicates,
+		StartedAt:         time.Now(),
+		spilled:           p.spill != nil,
+	}
 
 	// Calculate total segments in entire NZB
 	totalSegmentsInNZB := 0
-	for _, file := range nzb.Files {
+	for _, file := range files {
 		totalSegmentsInNZB += len(file.Segments)
 	}
-
-	// Calculate how many segments we will check based on checkPercent
-	totalSegmentsToCheck := 0
-	for _, file := range nzb.Files {
-		totalSegments := len(file.Segments)
-		segmentsToCheck := totalSegments
-		if checkPercent < 100 {
-			segmentsToCheck = (totalSegments * checkPercent) / 100
-			if segmentsToCheck == 0 {
-				segmentsToCheck = 1 // Always check at least one segment
-			}
-		}
-		totalSegmentsToCheck += segmentsToCheck
+	result.TotalSegments = totalSegmentsInNZB
+	result.OldestPost = oldestPost(nzb)
+	result.Password = detectPassword(nzb, opts.Source)
+	if opts.EncryptionProbe {
+		var probed int64
+		result.Password, probed = p.probePassword(ctx, nzb.Files, result.Password)
+		result.BytesDownloaded += probed
+	}
+	result.PayloadBytes, result.Par2Bytes = par2Coverage(nzb)
+	if result.PayloadBytes > 0 {
+		result.Par2Percent = float64(result.Par2Bytes) * 100 / float64(result.PayloadBytes)
+		result.Par2Thin = result.Par2Percent < opts.minPar2Percent()
+	}
+	if result.Par2Thin {
+		slog.WarnContext(ctx, "NZB parity coverage is too thin to survive typical article loss",
+			"par2_percent", fmt.Sprintf("%.1f%%", result.Par2Percent))
+	}
+	if result.Password != nil {
+		slog.InfoContext(ctx, "NZB looks password protected", "source", result.Password.Source)
 	}
 
 	// Calculate allowed missing segments based on TOTAL segments in NZB
-	allowedMissingSegments := (totalSegmentsInNZB * missingPercent) / 100
+	allowedMissingSegments := (totalSegmentsInNZB * opts.MissingPercent) / 100
 
 	slog.InfoContext(ctx, "Total allowed missing segments", "allowedMissingSegments", allowedMissingSegments)
 
-	// Track failed segments across entire NZB
-	var failedSegments int
-	var mu sync.Mutex
+	// In headers mode the segments found in the group listings need no request
+	listed := p.listSegments(ctx, files)
+
+	// Track checked and failed segments across entire NZB
+	var (
+		mu          sync.Mutex
+		unconfirmed []unconfirmedSegment
+	)
 
 	// Process each file
-	for _, file := range nzb.Files {
-		if ctx.Err() != nil {
-			return ctx.Err()
+	for _, file := range files {
+		if ctx.Err() != nil || outOfTime() {
+			break
 		}
 
 		slog.InfoContext(ctx, fmt.Sprintf("Checking file %s", file.Filename))
 
 		// Determine which segments to check based on checkPercent
 		totalSegments := len(file.Segments)
-		segmentsToCheck := totalSegments
-		if checkPercent < 100 {
-			segmentsToCheck = (totalSegments * checkPercent) / 100
-			if segmentsToCheck == 0 {
-				segmentsToCheck = 1 // Always check at least one segment
+		segmentsToCheck := opts.segmentsToCheck(totalSegments)
+		selector := opts.newSegmentSelector(totalSegments)
+
+		slog.InfoContext(ctx, fmt.Sprintf("Checking %d of %d segments (%d%%)", segmentsToCheck, totalSegments, opts.CheckPercent))
+
+		p.reporter.FileStarted(file, segmentsToCheck)
+		live.startFile(segmentsToCheck)
+
+		fileInfo := file
+		mu.Lock()
+		fileIndex := len(result.FileResults)
+		result.FileResults = append(result.FileResults, FileResult{File: fileName(file), Segments: totalSegments})
+		mu.Unlock()
+
+		// record accounts for a checked segment and aborts the check once
+		// the allowed missing segments are exceeded
+		record := func(ctx context.Context, seg nzbparser.NzbSegment, bytesDownloaded int64, err error) error {
+			// Unreachable providers abort the check instead of counting the segment as missing
+			if p.replay == nil && p.providersDown(ctx, err) {
+				cancel()
+				return errcode.Wrap(errcode.ProvidersDown, fmt.Errorf("%w: %w", ErrProvidersDown, err))
 			}
+
+			p.reporter.SegmentChecked(fileInfo, seg, bytesDownloaded, err)
+			live.record(err)
+			p.spillSegment(ctx, opts.Source, fileInfo.Filename, seg.Id, bytesDownloaded, err)
+
+			var class ErrorClass
+			if err != nil {
+				class = p.classify(err)
+			}
+
+			mu.Lock()
+			result.CheckedSegments++
+			result.BytesDownloaded += bytesDownloaded
+			result.FileResults[fileIndex].Checked++
+			if err != nil {
+				result.recordFailure(seg.Id, class)
+				result.FileResults[fileIndex].Failed++
+			}
+			currentFailed := result.FailedSegments
+			failure, failed := opts.failure(result, totalSegmentsInNZB)
+			warnings := opts.warnings(result, totalSegmentsInNZB)
+			for _, w := range warnings {
+				result.warn(w.Class, w.describe(totalSegmentsInNZB))
+			}
+			mu.Unlock()
+
+			if err == nil {
+				return nil
+			}
+
+			for _, w := range warnings {
+				slog.WarnContext(ctx, "Error class above its warning threshold",
+					"class", w.Class,
+					"file", fileInfo.Filename,
+					"detail", w.describe(totalSegmentsInNZB))
+			}
+
+			// Check if we've exceeded the allowed failed segments
+			if failed {
+				slog.ErrorContext(ctx, "Too many failed segments",
+					"segment", seg.Id,
+					"file", fileInfo.Filename,
+					"failed", currentFailed,
+					"total_in_nzb", totalSegmentsInNZB,
+					"allowed_missing", allowedMissingSegments,
+					"missing_percent", opts.MissingPercent,
+					"class", class,
+					"error", err)
+
+				cancel()
+
+				return errcode.Wrap(failure.code(), &SegmentError{
+					SegmentID: seg.Id,
+					Err:       fmt.Errorf("exceeded allowed failed segments: %s", failure.describe(totalSegmentsInNZB)),
+				})
+			}
+
+			// Log warning but continue
+			slog.WarnContext(ctx, "Segment download failed",
+				"segment", seg.Id,
+				"file", fileInfo.Filename,
+				"failed_count", currentFailed,
+				"class", class,
+				"error", err)
+
+			return nil
 		}
 
-		// Select random segment indices without duplicates
-		selectedIndices := make(map[int]bool)
-		if segmentsToCheck < totalSegments {
-			// Generate random indices without duplicates
-			for len(selectedIndices) < segmentsToCheck {
-				idx := rand.Intn(totalSegments)
-				selectedIndices[idx] = true
+		// observe records a checked segment, holding back the segments reported
+		// missing until their confirmations are done
+		observe := func(ctx context.Context, seg nzbparser.NzbSegment, bytesDownloaded int64, err error) error {
+			if err != nil && opts.Confirmations.enabled() && p.classify(err) == ErrorMissing {
+				mu.Lock()
+				unconfirmed = append(unconfirmed, unconfirmedSegment{seg: seg, groups: fileInfo.Groups, record: record})
+				mu.Unlock()
+
+				return nil
 			}
-		} else {
-			// Check all segments
-			for i := 0; i < totalSegments; i++ {
-				selectedIndices[i] = true
+
+			return record(ctx, seg, bytesDownloaded, err)
+		}
+
+		// In STAT mode segments are verified in batches on a single connection
+		batchSize := 1
+		if p.checkMode == CheckModeStat && p.statBatchSize > 1 && p.replay == nil {
+			batchSize = p.statBatchSize
+		}
+		batch := make([]nzbparser.NzbSegment, 0, batchSize)
+
+		flush := func() {
+			if len(batch) == 0 {
+				return
 			}
+
+			segments := batch
+			batch = make([]nzbparser.NzbSegment, 0, batchSize)
+
+			workerPool.Go(func(ctx context.Context) error {
+				if err := p.budget.acquire(ctx); err != nil {
+					return nil
+				}
+				defer p.budget.release()
+
+				return p.statBatch(ctx, segments, fileInfo.Groups, observe)
+			})
 		}
 
-		slog.InfoContext(ctx, fmt.Sprintf("Checking %d of %d segments (%d%%)", segmentsToCheck, totalSegments, checkPercent))
-
-		bar := progressbar.NewOptions(int(file.Bytes),
-			progressbar.OptionSetWriter(ansi.NewAnsiStdout()), //you should install "github.com/k0kubun/go-ansi"
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionSetWidth(15),
-			progressbar.OptionShowBytes(true),
-			progressbar.OptionShowTotalBytes(true),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "[green]=[reset]",
-				SaucerHead:    "[green]>[reset]",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}))
-
-		// Process each segment
-		for segIdx, segment := range file.Segments {
+		// Process each segment. Submitting blocks while all workers are busy,
+		// so at most this NZB's share of tasks is in flight regardless of its size.
+		for _, segment := range file.Segments {
+			if ctx.Err() != nil || outOfTime() {
+				break
+			}
+
 			// Skip segments that are not selected
-			if !selectedIndices[segIdx] {
+			if !selector.next() {
+				continue
+			}
+
+			if listed.found(segment.Id) {
+				p.groupStats.Record(fileInfo.Groups, listed.provider, false)
+				p.recordResponse(ctx, segment.Id, 0, 0, nil)
+				_ = observe(ctx, segment, 0, nil)
+
+				continue
+			}
+
+			if batchSize > 1 {
+				batch = append(batch, segment)
+				if len(batch) == batchSize {
+					flush()
+				}
+
 				continue
 			}
 
 			// Create local variables to avoid closure problems
-			fileInfo := file
 			seg := segment
 
 			// Submit task to worker pool
 			workerPool.Go(func(ctx context.Context) error {
+				if err := p.budget.acquire(ctx); err != nil {
+					return nil
+				}
+				defer p.budget.release()
+
 				// Process segment
-				bytesDownloaded, err := p.nntpClient.Body(ctx, seg.Id, io.Discard, fileInfo.Groups)
-				if err != nil {
-					if errors.Is(err, context.Canceled) {
-						return nil
-					}
-
-					// Increment failed count (thread-safe)
-					mu.Lock()
-					failedSegments++
-					currentFailed := failedSegments
-					mu.Unlock()
-
-					// Check if we've exceeded the allowed missing segments
-					if currentFailed > allowedMissingSegments {
-						slog.ErrorContext(ctx, "Too many failed segments",
-							"segment", seg.Id,
-							"file", fileInfo.Filename,
-							"failed", currentFailed,
-							"total_in_nzb", totalSegmentsInNZB,
-							"allowed_missing", allowedMissingSegments,
-							"missing_percent", missingPercent,
-							"error", err)
-
-						cancel()
-
-						return &SegmentError{
-							SegmentID: seg.Id,
-							Err: fmt.Errorf("exceeded allowed missing segments: %d/%d total (%.1f%% > %d%%)",
-								currentFailed, totalSegmentsInNZB,
-								float64(currentFailed)*100/float64(totalSegmentsInNZB),
-								missingPercent),
-						}
-					}
-
-					// Log warning but continue
-					slog.WarnContext(ctx, "Segment download failed",
-						"segment", seg.Id,
-						"file", fileInfo.Filename,
-						"failed_count", currentFailed,
-						"error", err)
-				} else {
-					// Update statistics
-					_ = bar.Add(int(bytesDownloaded))
+				bytesDownloaded, err := p.checkSegment(ctx, seg.Id, fileInfo.Groups, "")
+				if errors.Is(err, context.Canceled) {
+					return nil
 				}
-				return nil
+
+				return observe(ctx, seg, bytesDownloaded, err)
 			})
 		}
+		flush()
 
 		slog.InfoContext(ctx, fmt.Sprintf("File %s checked", file.Filename))
-		_ = bar.Finish()
+		p.reporter.FileFinished(file)
 	}
 
-	// Final summary
-	mu.Lock()
-	finalFailed := failedSegments
-	mu.Unlock()
+	// Wait for all submitted segments before summarizing
+	err := workerPool.Wait()
+	if err == nil && len(unconfirmed) > 0 {
+		err = p.confirmMissing(ctx, opts.Confirmations, unconfirmed, share, outOfTime)
+	}
+	if ctx.Err() == nil && !timedOut {
+		result.FileHeaders = p.readFileHeaders(ctx, files, opts.HeaderSamples)
+	}
+	result.Duration = time.Since(result.StartedAt)
+	result.Providers = tally.results()
+	for i := range result.FileResults {
+		result.FileResults[i].complete()
+	}
 
-	failureRate := float64(0)
-	if totalSegmentsInNZB > 0 {
-		failureRate = float64(finalFailed) * 100 / float64(totalSegmentsInNZB)
+	if saveErr := p.usage.Save(); saveErr != nil {
+		slog.ErrorContext(ctx, "Failed to save provider usage", "error", saveErr)
+	}
+	result.Partial = timedOut
+
+	if result.Partial {
+		slog.WarnContext(ctx, "NZB time budget exceeded, health computed from the segments checked so far",
+			"budget", opts.Timeout,
+			"segments_checked", result.CheckedSegments)
 	}
 
 	slog.InfoContext(ctx, "NZB check completed",
-		"total_segments_in_nzb", totalSegmentsInNZB,
-		"segments_checked", totalSegmentsToCheck,
-		"failed_segments", finalFailed,
-		"failure_rate", fmt.Sprintf("%.1f%%", failureRate),
-		"allowed_missing_percent", missingPercent)
+		"total_segments_in_nzb", result.TotalSegments,
+		"segments_checked", result.CheckedSegments,
+		"failed_segments", result.FailedSegments,
+		"failure_rate", fmt.Sprintf("%.1f%%", result.FailureRate()),
+		"allowed_missing_percent", opts.MissingPercent)
+
+	if err != nil {
+		return result, err
+	}
+
+	if failure, failed := opts.failure(result, result.TotalSegments); failed {
+		return result, errcode.Wrap(failure.code(), fmt.Errorf("NZB check failed: %s", failure.describe(result.TotalSegments)))
+	}
+
+	if result.Partial {
+		if result.CheckedSegments == 0 {
+			return result, errcode.Wrap(errcode.TimeBudget, fmt.Errorf("time budget of %s exceeded before any segment was checked", opts.Timeout))
+		}
+
+		if failure, failed := opts.failure(result, result.CheckedSegments); failed {
+			return result, errcode.Wrap(failure.code(), fmt.Errorf("NZB check failed: %s checked", failure.describe(result.CheckedSegments)))
+		}
+	}
 
-	if finalFailed > allowedMissingSegments {
-		return fmt.Errorf("NZB check failed: %d/%d total segments failed (%.1f%% > %d%%)",
-			finalFailed, totalSegmentsInNZB, failureRate, missingPercent)
+	// The check was interrupted before all segments were verified
+	if ctx.Err() != nil {
+		return result, ctx.Err()
 	}
 
-	return nil
+	return result, nil
 }
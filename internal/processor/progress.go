@@ -0,0 +1,32 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/progress"
+)
+
+// progressLogInterval is how often the progress of the backlog is logged
+var progressLogInterval = time.Minute
+
+// Progress returns how far the checks of the backlog, the items pending or
+// being checked, got and when they should be done
+func (s *DirectoryScanner) Progress() progress.Snapshot {
+	return s.progress.Snapshot(s.queue.CountUnfinished())
+}
+
+// recordProgress accounts for a finished check in the backlog progress
+func (s *DirectoryScanner) recordProgress(_ context.Context, e events.Event) {
+	var (
+		took  time.Duration
+		bytes int64
+	)
+	if result := eventResult(e); result != nil {
+		took, bytes = result.Duration, result.BytesDownloaded
+	}
+
+	// The file just checked is still being checked in the queue
+	s.progress.Record(took, bytes, max(s.queue.CountUnfinished()-1, 0))
+}
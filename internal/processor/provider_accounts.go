@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"slices"
+
+	"github.com/javi11/nntppool/v2"
+)
+
+// WithProviderAccounts pools several accounts on the same backbone as one
+// logical provider. aliases maps the pool ID of every extra account to the
+// ID of its logical provider, under which policies, usage and statistics
+// are kept. A segment missing on one account is not asked to the others.
+func WithProviderAccounts(aliases map[string]string) Option {
+	return func(p *Processor) {
+		p.accountAliases = aliases
+	}
+}
+
+// logical returns the ID of the logical provider a pool provider belongs to
+func (p *Processor) logical(poolID string) string {
+	if id, ok := p.accountAliases[poolID]; ok {
+		return id
+	}
+
+	return poolID
+}
+
+// members returns the pool IDs of the accounts of the logical providers
+func (p *Processor) members(ids []string) []string {
+	if len(p.accountAliases) == 0 || len(ids) == 0 {
+		return ids
+	}
+
+	members := slices.Clone(ids)
+	for poolID, id := range p.accountAliases {
+		if slices.Contains(ids, id) {
+			members = append(members, poolID)
+		}
+	}
+
+	return members
+}
+
+// logicalProviders merges the accounts of each logical provider into one
+// entry, adding up the connections of the active accounts
+func (p *Processor) logicalProviders(providers []nntppool.ProviderInfo) []nntppool.ProviderInfo {
+	if len(p.accountAliases) == 0 {
+		return providers
+	}
+
+	merged := make([]nntppool.ProviderInfo, 0, len(providers))
+	index := make(map[string]int)
+	for _, info := range providers {
+		id := p.logical(info.ID())
+		i, ok := index[id]
+		if !ok {
+			i = len(merged)
+			index[id] = i
+			merged = append(merged, nntppool.ProviderInfo{State: nntppool.ProviderStateOffline})
+		}
+
+		if info.ID() == id {
+			// The logical provider is identified by its main account
+			merged[i].Host, merged[i].Username = info.Host, info.Username
+		}
+
+		if info.State == nntppool.ProviderStateActive {
+			merged[i].State = nntppool.ProviderStateActive
+			merged[i].UsedConnections += info.UsedConnections
+			merged[i].MaxConnections += info.MaxConnections
+		}
+	}
+
+	return merged
+}
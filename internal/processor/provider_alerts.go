@@ -0,0 +1,199 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/hook"
+	"github.com/javi11/nzb-touch/internal/plugin"
+)
+
+var (
+	// alertBuckets is the number of slices the alert window is divided into
+	alertBuckets = 30
+	// alertMinRequests avoids alerting on a handful of requests
+	alertMinRequests = 10
+)
+
+// ProviderAlertPolicy raises an alert when the share of failed requests of a
+// provider exceeds ErrorRate over Window. Requests failing with an error other
+// than a missing article count as failed, and so does every sample taken while
+// the provider is offline, so a provider down for good keeps alerting.
+type ProviderAlertPolicy struct {
+	ErrorRate float64       // Percentage of failed requests raising the alert (0 disables alerts)
+	Window    time.Duration // Period over which the error rate is computed
+}
+
+// ProviderAlert describes a provider whose error rate crossed the alert threshold
+type ProviderAlert struct {
+	Provider  string  `json:"provider"`
+	ErrorRate float64 `json:"error_rate"` // Percentage of failed requests over the window
+	Requests  int     `json:"requests"`
+	Failures  int     `json:"failures"`
+	Window    string  `json:"window"`
+}
+
+// errorBucket counts the requests of a provider during a slice of the window
+type errorBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// errorTracker keeps the request outcomes of each provider over a sliding
+// window. A nil tracker ignores every record.
+type errorTracker struct {
+	policy ProviderAlertPolicy
+	slice  time.Duration
+
+	mu      sync.Mutex
+	buckets map[string][]errorBucket
+}
+
+// newErrorTracker returns a tracker for the policy, nil when alerts are disabled
+func newErrorTracker(policy ProviderAlertPolicy) *errorTracker {
+	if policy.ErrorRate <= 0 || policy.Window <= 0 {
+		return nil
+	}
+
+	return &errorTracker{
+		policy:  policy,
+		slice:   max(policy.Window/time.Duration(alertBuckets), time.Second),
+		buckets: make(map[string][]errorBucket),
+	}
+}
+
+// WithProviderAlerts alerts when the error rate of a provider exceeds the policy threshold
+func WithProviderAlerts(policy ProviderAlertPolicy) Option {
+	return func(p *Processor) {
+		p.errors = newErrorTracker(policy)
+	}
+}
+
+// Record accounts for a request to a provider
+func (t *errorTracker) Record(provider string, failed bool) {
+	if t == nil {
+		return
+	}
+
+	now := time.Now()
+	start := now.Truncate(t.slice)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buckets := t.prune(t.buckets[provider], now)
+	if len(buckets) == 0 || !buckets[len(buckets)-1].start.Equal(start) {
+		buckets = append(buckets, errorBucket{start: start})
+	}
+
+	last := &buckets[len(buckets)-1]
+	last.requests++
+	if failed {
+		last.failures++
+	}
+
+	t.buckets[provider] = buckets
+}
+
+// rate returns the requests and failures of a provider over the window
+func (t *errorTracker) rate(provider string) (requests, failures int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buckets := t.prune(t.buckets[provider], time.Now())
+	t.buckets[provider] = buckets
+	for _, b := range buckets {
+		requests += b.requests
+		failures += b.failures
+	}
+
+	return requests, failures
+}
+
+// prune drops the buckets that left the window
+func (t *errorTracker) prune(buckets []errorBucket, now time.Time) []errorBucket {
+	cutoff := now.Add(-t.policy.Window)
+	i := 0
+	for i < len(buckets) && !buckets[i].start.After(cutoff) {
+		i++
+	}
+
+	return buckets[i:]
+}
+
+// recordOutcome accounts for a request to a provider, a missing article is a valid answer
+func (p *Processor) recordOutcome(providerID string, err error) {
+	p.errors.Record(providerID, err != nil && !nntpcli.IsArticleNotFoundError(err))
+}
+
+// watchProviderErrors samples the provider states and raises an alert when the
+// error rate of a provider crosses the threshold, and a recovery once it drops
+// below it again
+func (s *DirectoryScanner) watchProviderErrors(ctx context.Context) {
+	tracker := s.processor.errors
+	if tracker == nil {
+		return
+	}
+
+	ticker := time.NewTicker(tracker.slice)
+	defer ticker.Stop()
+
+	alerting := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, info := range s.processor.logicalProviders(s.processor.Providers()) {
+			id := info.ID()
+			if info.State != nntppool.ProviderStateActive {
+				tracker.Record(id, true)
+			}
+
+			requests, failures := tracker.rate(id)
+			if requests < alertMinRequests {
+				continue
+			}
+
+			errorRate := float64(failures) * 100 / float64(requests)
+			switch {
+			case errorRate > tracker.policy.ErrorRate && !alerting[id]:
+				alerting[id] = true
+				s.raiseProviderAlert(ctx, ProviderAlert{
+					Provider:  id,
+					ErrorRate: errorRate,
+					Requests:  requests,
+					Failures:  failures,
+					Window:    tracker.policy.Window.String(),
+				})
+			case errorRate <= tracker.policy.ErrorRate && alerting[id]:
+				delete(alerting, id)
+				slog.InfoContext(ctx, "Provider error rate back below the alert threshold", "provider", id, "error_rate", errorRate)
+				s.bus.Publish(ctx, events.Event{Type: events.ProviderAlertCleared, Provider: id})
+			}
+		}
+	}
+}
+
+// raiseProviderAlert logs the alert, runs the provider_alert hook and
+// dispatches the provider_alert plugin event
+func (s *DirectoryScanner) raiseProviderAlert(ctx context.Context, alert ProviderAlert) {
+	slog.WarnContext(ctx, "Provider error rate above the alert threshold",
+		"provider", alert.Provider,
+		"error_rate", alert.ErrorRate,
+		"failures", alert.Failures,
+		"requests", alert.Requests,
+		"window", alert.Window)
+
+	_ = s.hooks.Run(ctx, hook.EventProviderAlert, hook.Info{Provider: alert.Provider, ProviderErrorRate: alert.ErrorRate})
+	_ = s.plugins.Dispatch(ctx, plugin.Payload{Event: plugin.EventProviderAlert, Result: alert})
+	s.bus.Publish(ctx, events.Event{Type: events.ProviderAlert, Provider: alert.Provider, Result: alert})
+}
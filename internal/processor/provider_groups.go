@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// errGroupsNotCarried is returned for segments posted only to newsgroups no provider carries
+var errGroupsNotCarried = errors.New("no provider carries the newsgroups of the segment")
+
+// WithProviderGroups restricts providers to the newsgroups matching their
+// patterns, keyed by provider ID. Segments posted to other groups are never
+// requested from them. Providers without patterns carry every group.
+func WithProviderGroups(groups map[string][]string) Option {
+	return func(p *Processor) {
+		p.providerGroups = groups
+	}
+}
+
+// notCarrying returns the providers that carry none of the newsgroups
+func (p *Processor) notCarrying(groups []string) []string {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for id, patterns := range p.providerGroups {
+		if !carriesAny(patterns, groups) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// carriesAny reports whether a newsgroup pattern matches any of the groups, case-insensitively
+func carriesAny(patterns, groups []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for _, group := range groups {
+			if ok, _ := path.Match(pattern, strings.ToLower(group)); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+)
+
+// WithProviderResults counts the requests sent to each provider in the
+// result of every check. Segments are then checked on connections acquired
+// by the processor, as the pool does not tell which provider answered.
+func WithProviderResults() Option {
+	return func(p *Processor) {
+		p.providerResults = true
+	}
+}
+
+// providerTally counts the requests of a single check per provider
+type providerTally struct {
+	mu        sync.Mutex
+	providers map[string]*ProviderResult
+}
+
+type providerTallyKey struct{}
+
+// withProviderTally returns a context counting the requests of a check, the
+// tally is nil unless provider results are enabled
+func (p *Processor) withProviderTally(ctx context.Context) (context.Context, *providerTally) {
+	if !p.providerResults {
+		return ctx, nil
+	}
+
+	tally := &providerTally{providers: make(map[string]*ProviderResult)}
+	return context.WithValue(ctx, providerTallyKey{}, tally), tally
+}
+
+// tallyRequest counts a request sent to a provider in the tally of the check of ctx
+func tallyRequest(ctx context.Context, providerID string, bytes int64, err error) {
+	tally, _ := ctx.Value(providerTallyKey{}).(*providerTally)
+	if tally == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	tally.mu.Lock()
+	defer tally.mu.Unlock()
+
+	counts, ok := tally.providers[providerID]
+	if !ok {
+		counts = &ProviderResult{}
+		tally.providers[providerID] = counts
+	}
+
+	counts.Requests++
+	counts.Bytes += bytes
+	switch {
+	case err == nil:
+		counts.Found++
+	case nntpcli.IsArticleNotFoundError(err):
+		counts.Missing++
+	default:
+		counts.Errors++
+	}
+}
+
+// results returns the counts of every provider asked, nil without a tally
+func (t *providerTally) results() map[string]*ProviderResult {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.providers) == 0 {
+		return nil
+	}
+
+	return t.providers
+}
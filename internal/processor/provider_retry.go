@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"context"
+	"time"
+)
+
+// ProviderRetry controls how requests failing on a provider with an error
+// other than a missing article are handled
+type ProviderRetry struct {
+	Retries      int           // Times a failed request is retried before giving up on the provider
+	RetryDelay   time.Duration // Wait time between retries
+	SkipOnErrors bool          // Move on to the next provider instead of failing the segment
+}
+
+// WithProviderRetries sets the retry behavior of each provider, keyed by provider ID.
+// Providers without an entry fail the segment on the first error.
+func WithProviderRetries(retries map[string]ProviderRetry) Option {
+	return func(p *Processor) {
+		p.providerRetries = make(map[string]ProviderRetry, len(retries))
+		for id, retry := range retries {
+			if retry.Retries < 0 {
+				retry.Retries = 0
+			}
+			p.providerRetries[id] = retry
+		}
+	}
+}
+
+// sleepContext waits for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
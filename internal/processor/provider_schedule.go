@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"errors"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/schedule"
+)
+
+// errOutsideSchedule is returned for segments no provider may be asked for at this time of day
+var errOutsideSchedule = errors.New("no provider is scheduled at this time of day")
+
+// WithProviderSchedules restricts providers to daily time windows, keyed by
+// provider ID. Outside of its windows a provider is never asked for segments.
+// Providers without windows are always used.
+func WithProviderSchedules(schedules map[string][]schedule.Window) Option {
+	return func(p *Processor) {
+		p.providerSchedules = schedules
+	}
+}
+
+// unscheduled returns the providers outside of their time windows
+func (p *Processor) unscheduled() []string {
+	if len(p.providerSchedules) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	var ids []string
+	for id, windows := range p.providerSchedules {
+		if !schedule.Active(windows, now) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/javi11/nntppool/v2"
+)
+
+// WithProviderTiers orders the primary providers in tiers, keyed by provider
+// ID. A segment is requested from the providers of the lowest tier, spread
+// over all of their connections, and from the next tier only when none of
+// them has it. Backup providers are still asked last.
+func WithProviderTiers(tiers map[string]int) Option {
+	return func(p *Processor) {
+		p.providerTiers = tiers
+		p.tierOrder = slices.Sorted(maps.Keys(tierSet(tiers)))
+	}
+}
+
+// tierSet returns the distinct tiers of the providers
+func tierSet(tiers map[string]int) map[int]bool {
+	set := make(map[int]bool, len(tiers))
+	for _, tier := range tiers {
+		set[tier] = true
+	}
+
+	return set
+}
+
+// firstTier returns the tier whose providers are asked first
+func (p *Processor) firstTier() int {
+	if len(p.tierOrder) == 0 {
+		return 0
+	}
+
+	return p.tierOrder[0]
+}
+
+// nextTier returns the tier asked after the given one, false after the last
+func (p *Processor) nextTier(tier int) (int, bool) {
+	for _, t := range p.tierOrder {
+		if t > tier {
+			return t, true
+		}
+	}
+
+	return 0, false
+}
+
+// outsideTier returns the pool IDs of the providers of the other tiers
+func (p *Processor) outsideTier(tier int) []string {
+	var ids []string
+	for id, t := range p.providerTiers {
+		if t != tier {
+			ids = append(ids, id)
+		}
+	}
+
+	return p.members(ids)
+}
+
+// activeTier keeps the providers of the lowest tier with an active provider,
+// as routing spreads the requests within a tier
+func (p *Processor) activeTier(providers []nntppool.ProviderInfo) []nntppool.ProviderInfo {
+	if len(p.tierOrder) < 2 {
+		return providers
+	}
+
+	for _, tier := range p.tierOrder {
+		inTier := slices.DeleteFunc(slices.Clone(providers), func(info nntppool.ProviderInfo) bool {
+			t, tiered := p.providerTiers[info.ID()]
+			return tiered && t != tier
+		})
+		if slices.ContainsFunc(inTier, func(info nntppool.ProviderInfo) bool {
+			_, tiered := p.providerTiers[info.ID()]
+			return tiered && info.State == nntppool.ProviderStateActive
+		}) {
+			return inTier
+		}
+	}
+
+	return providers
+}
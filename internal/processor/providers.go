@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nzb-touch/internal/events"
+)
+
+// providerWatchInterval is how often provider states are polled
+var providerWatchInterval = time.Minute
+
+// Providers returns the current state of the configured providers
+func (p *Processor) Providers() []nntppool.ProviderInfo {
+	return p.nntpClient.GetProvidersInfo()
+}
+
+// watchProviders polls provider states and publishes degraded/recovered events on changes
+func (p *Processor) watchProviders(ctx context.Context, bus *events.Bus, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	states := make(map[string]nntppool.ProviderState)
+	for {
+		for _, info := range p.Providers() {
+			id := info.ID()
+			previous, known := states[id]
+			states[id] = info.State
+
+			if !known && info.State == nntppool.ProviderStateActive {
+				continue
+			}
+
+			if known && previous == info.State {
+				continue
+			}
+
+			eventType := events.ProviderDegraded
+			if info.State == nntppool.ProviderStateActive {
+				eventType = events.ProviderRecovered
+			}
+
+			bus.Publish(ctx, events.Event{
+				Type:     eventType,
+				Provider: id,
+				State:    info.State.String(),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
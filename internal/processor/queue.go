@@ -2,7 +2,9 @@ package processor
 
 import (
 	"database/sql"
+	"errors"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,22 +13,58 @@ import (
 
 // QueueItem represents an item in the processing queue
 type QueueItem struct {
-	FilePath     string    // Path to the NZB file
-	Added        time.Time // When the item was added to the queue
-	Processed    bool      // Whether the item has been processed
-	ProcessedAt  time.Time // When the item was processed
-	ProcessCount int       // Number of times this item has been processed
+	FilePath     string    `json:"file_path"`             // Path to the NZB file
+	Added        time.Time `json:"added"`                 // When the item was added to the queue
+	Processed    bool      `json:"processed"`             // Whether the item has been processed
+	ProcessedAt  time.Time `json:"processed_at,omitzero"` // When the item was processed
+	ProcessCount int       `json:"process_count"`         // Number of times this item has been processed
+	Priority     int       `json:"priority"`              // Higher priority items are processed first
+	LastHealth   *float64  `json:"last_health,omitempty"` // Health of the latest check, nil if never checked
+	Degradation  string    `json:"degradation,omitempty"` // How a previously healthy item degraded
+	// Whether the NZB looks password protected, only tracked when password tagging is enabled
+	PasswordProtected bool   `json:"password_protected,omitempty"`
+	Category          string `json:"category,omitempty"`     // Category inferred at the latest check
+	ContentHash       string `json:"content_hash,omitempty"` // SHA-256 of the NZB when duplicate detection is enabled
+	DuplicateOf       string `json:"duplicate_of,omitempty"` // Queued file with the same content, duplicates are never processed
+	// Pending items are not checked before this time, e.g. while their articles propagate
+	NotBefore time.Time `json:"not_before,omitzero"`
+	// Where the NZB was moved to, e.g. in the failed directory
+	MovedTo string `json:"moved_to,omitempty"`
+	Status  string `json:"status,omitempty"`  // Pending, processing, completed or failed
+	Retries int    `json:"retries,omitempty"` // Checks interrupted by a crash or a shutdown
+	// Consecutive failed checks and when the first of them ran, reset by a passing check
+	FailedChecks int       `json:"failed_checks,omitempty"`
+	FailingSince time.Time `json:"failing_since,omitzero"`
 }
 
-// Queue manages the processing queue with thread-safe operations
+// Queue item statuses, an item moves from pending to processing when a worker
+// picks it up and to completed or failed once checked
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+// Queue manages the processing queue with thread-safe operations. Several
+// instances may share the database, each claiming the files it checks with
+// a lease.
 type Queue struct {
-	db *sql.DB      // SQLite database connection
-	mu sync.RWMutex // Mutex for thread-safe access
+	db    *sql.DB      // SQLite database connection
+	mu    sync.RWMutex // Mutex for thread-safe access
+	owner string       // Instance holding the leases taken by this queue
 }
 
 // NewQueue creates a new processing queue with SQLite persistence
 func NewQueue(dbPath string) (*Queue, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	// Transactions take the write lock when they begin, so instances sharing
+	// the database wait for each other instead of failing to upgrade a read
+	dsn := dbPath + "?_txlock=immediate"
+	if strings.Contains(dbPath, "?") {
+		dsn = dbPath + "&_txlock=immediate"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -46,21 +84,141 @@ func NewQueue(dbPath string) (*Queue, error) {
 		return nil, err
 	}
 
+	if err := createFileLog(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	if err := createTrash(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	if err := createBandwidth(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// Add columns introduced after the initial schema
+	for _, col := range []struct{ name, definition string }{
+		{"priority", "INTEGER NOT NULL DEFAULT 0"},
+		{"last_health", "REAL"},
+		{"degradation", "TEXT NOT NULL DEFAULT ''"},
+		{"password_protected", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"category", "TEXT NOT NULL DEFAULT ''"},
+		{"content_hash", "TEXT NOT NULL DEFAULT ''"},
+		{"duplicate_of", "TEXT NOT NULL DEFAULT ''"},
+		{"not_before", "TIMESTAMP"},
+		{"moved_to", "TEXT NOT NULL DEFAULT ''"},
+		{"path_key", "TEXT NOT NULL DEFAULT ''"},
+		{"status", "TEXT NOT NULL DEFAULT ''"},
+		{"retries", "INTEGER NOT NULL DEFAULT 0"},
+		{"refresh", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"failed_checks", "INTEGER NOT NULL DEFAULT 0"},
+		{"failing_since", "TIMESTAMP"},
+		{"lease_owner", "TEXT NOT NULL DEFAULT ''"},
+		{"lease_until", "TIMESTAMP"},
+	} {
+		if err := ensureColumn(db, col.name, col.definition); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
 	// Create indexes
 	_, err = db.Exec(`
 		CREATE INDEX IF NOT EXISTS idx_queue_processed_at ON queue(processed_at);
 		CREATE INDEX IF NOT EXISTS idx_queue_processed ON queue(processed);
+		CREATE INDEX IF NOT EXISTS idx_queue_content_hash ON queue(content_hash);
+		CREATE INDEX IF NOT EXISTS idx_queue_path_key ON queue(path_key);
 	`)
 	if err != nil {
 		_ = db.Close()
 		return nil, err
 	}
 
+	if err := createReportViews(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// Normalize and key the items queued before path normalization and statuses
+	tx, err := db.Begin()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := normalizeStoredPaths(tx); err != nil {
+		_ = tx.Rollback()
+		_ = db.Close()
+		return nil, err
+	}
+	if err := fillPathKeys(tx); err != nil {
+		_ = tx.Rollback()
+		_ = db.Close()
+		return nil, err
+	}
+	if err := fillStatuses(tx); err != nil {
+		_ = tx.Rollback()
+		_ = db.Close()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
 	return &Queue{
-		db: db,
+		db:    db,
+		owner: newLeaseOwner(),
 	}, nil
 }
 
+// ensureColumn adds a column to the queue table if it does not exist yet
+func ensureColumn(db *sql.DB, name, definition string) error {
+	rows, err := db.Query("PRAGMA table_info(queue)")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var (
+			cid       int
+			colName   string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+
+		if colName == name {
+			return nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec("ALTER TABLE queue ADD COLUMN " + name + " " + definition)
+	return err
+}
+
+// fillStatuses sets the status of the rows queued before statuses existed or restored from a dump
+func fillStatuses(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		"UPDATE queue SET status = CASE WHEN processed = 1 THEN ? ELSE ? END WHERE status = ''",
+		StatusCompleted, StatusPending,
+	)
+	return err
+}
+
 // Close closes the database connection
 func (q *Queue) Close() error {
 	return q.db.Close()
@@ -68,12 +226,14 @@ func (q *Queue) Close() error {
 
 // Add adds a file to the queue if it doesn't exist
 func (q *Queue) Add(filePath string) bool {
+	filePath = normalizePath(filePath)
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	// Check if the file already exists
+	// Check if the file already exists under any spelling
 	var exists bool
-	err := q.db.QueryRow("SELECT EXISTS(SELECT 1 FROM queue WHERE file_path = ?)", filePath).Scan(&exists)
+	err := q.db.QueryRow("SELECT EXISTS(SELECT 1 FROM queue WHERE file_path = ? OR path_key = ?)", filePath, pathKey(filePath)).Scan(&exists)
 	if err != nil {
 		slog.Error("Failed to check if file exists in queue", "error", err)
 		return false
@@ -83,29 +243,99 @@ func (q *Queue) Add(filePath string) bool {
 		return false
 	}
 
-	// Add the file to the queue
-	_, err = q.db.Exec(
-		"INSERT INTO queue (file_path, added, processed, process_count) VALUES (?, ?, ?, ?)",
-		filePath, time.Now(), false, 0,
+	// Add the file to the queue, another instance may have just added it
+	result, err := q.db.Exec(
+		"INSERT OR IGNORE INTO queue (file_path, added, processed, process_count, path_key, status) VALUES (?, ?, ?, ?, ?, ?)",
+		filePath, time.Now(), false, 0, pathKey(filePath), StatusPending,
 	)
 	if err != nil {
 		slog.Error("Failed to add file to queue", "error", err)
 		return false
 	}
 
+	rows, err := result.RowsAffected()
+	return err == nil && rows > 0
+}
+
+// Start marks a file as being processed under a lease of this instance, it
+// returns false when the file is not queued or already being processed, by
+// this instance or another one. A file checked after queued, e.g. by another
+// instance, is not started either, unless queued is zero.
+func (q *Queue) Start(filePath string, queued time.Time) bool {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		slog.Error("Failed to start processing file", "error", err)
+		return false
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var status string
+	var processedAt sql.NullTime
+	err = tx.QueryRow("SELECT status, processed_at FROM queue WHERE file_path = ?", filePath).Scan(&status, &processedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to get file status", "error", err)
+		}
+		return false
+	}
+
+	if status == StatusProcessing {
+		return false
+	}
+
+	if !queued.IsZero() && processedAt.Valid && processedAt.Time.After(queued) {
+		return false
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE queue SET status = ?, lease_owner = ?, lease_until = ? WHERE file_path = ?",
+		StatusProcessing, q.owner, time.Now().Add(leaseDuration), filePath,
+	); err != nil {
+		slog.Error("Failed to start processing file", "error", err)
+		return false
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to start processing file", "error", err)
+		return false
+	}
+
 	return true
 }
 
-// MarkProcessed marks a file as processed
-func (q *Queue) MarkProcessed(filePath string) bool {
+// Finish marks a file being processed as completed, or failed when the check
+// failed, and releases its lease. The result of a check whose lease expired,
+// the file being recovered meanwhile, is discarded.
+func (q *Queue) Finish(filePath string, failed bool) bool {
+	filePath = normalizePath(filePath)
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	now := time.Now()
+	status := StatusCompleted
+	if failed {
+		status = StatusFailed
+	}
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		slog.Error("Failed to mark file as processed", "error", err)
+		return false
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
 	// Get current process count
 	var count int
-	err := q.db.QueryRow("SELECT COALESCE(process_count, 0) FROM queue WHERE file_path = ?", filePath).Scan(&count)
+	err = tx.QueryRow("SELECT COALESCE(process_count, 0) FROM queue WHERE file_path = ?", filePath).Scan(&count)
 	if err != nil {
 		slog.Error("Failed to get process count", "error", err)
 		return false
@@ -114,10 +344,15 @@ func (q *Queue) MarkProcessed(filePath string) bool {
 	// Increment process count
 	count++
 
-	// Update the record
-	result, err := q.db.Exec(
-		"UPDATE queue SET processed = 1, processed_at = ?, process_count = ? WHERE file_path = ?",
-		now, count, filePath,
+	// Update the record, counting consecutive failed checks
+	now := time.Now()
+	result, err := tx.Exec(`
+		UPDATE queue SET status = ?, processed = 1, processed_at = ?, process_count = ?, refresh = 0,
+			failed_checks = CASE WHEN ? THEN failed_checks + 1 ELSE 0 END,
+			failing_since = CASE WHEN ? THEN COALESCE(failing_since, ?) ELSE NULL END,
+			lease_owner = '', lease_until = NULL
+		WHERE file_path = ? AND lease_owner IN ('', ?)`,
+		status, now, count, failed, failed, now, filePath, q.owner,
 	)
 	if err != nil {
 		slog.Error("Failed to mark file as processed", "error", err)
@@ -130,16 +365,448 @@ func (q *Queue) MarkProcessed(filePath string) bool {
 		return false
 	}
 
+	if rows == 0 {
+		slog.Warn("Check result discarded, the file was taken over by another instance", "file", filePath)
+		return false
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to mark file as processed", "error", err)
+		return false
+	}
+
+	return true
+}
+
+// FailureStreak returns the consecutive failed checks of a file and when the
+// first of them ran, zero when its latest check passed
+func (q *Queue) FailureStreak(filePath string) (int, time.Time) {
+	filePath = normalizePath(filePath)
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var (
+		checks int
+		since  sql.NullTime
+	)
+	err := q.db.QueryRow("SELECT failed_checks, failing_since FROM queue WHERE file_path = ?", filePath).Scan(&checks, &since)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("Failed to get failed checks", "path", filePath, "error", err)
+		}
+		return 0, time.Time{}
+	}
+
+	return checks, since.Time
+}
+
+// Requeue returns a file being processed by this instance to the pending
+// items, e.g. when its check could not run
+func (q *Queue) Requeue(filePath string) bool {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec(
+		"UPDATE queue SET status = ?, processed = 0, lease_owner = '', lease_until = NULL WHERE file_path = ? AND status = ? AND lease_owner IN ('', ?)",
+		StatusPending, filePath, StatusProcessing, q.owner,
+	)
+	if err != nil {
+		slog.Error("Failed to requeue file", "error", err)
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return false
+	}
+
 	return rows > 0
 }
 
-// Contains checks if a file is in the queue
+// Retry returns a checked file to the pending items with the given priority,
+// ready to be checked again. It returns false when the file is not queued
+// or being processed.
+func (q *Queue) Retry(filePath string, priority int) bool {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec(
+		"UPDATE queue SET status = ?, processed = 0, priority = ?, not_before = NULL WHERE file_path = ? AND status != ?",
+		StatusPending, priority, filePath, StatusProcessing,
+	)
+	if err != nil {
+		slog.Error("Failed to retry file", "error", err)
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return false
+	}
+
+	return rows > 0
+}
+
+// Remove deletes a file from the queue with its check history. It returns
+// false when the file is not queued or being processed.
+func (q *Queue) Remove(filePath string) bool {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec("DELETE FROM queue WHERE file_path = ? AND status != ?", filePath, StatusProcessing)
+	if err != nil {
+		slog.Error("Failed to remove file from queue", "error", err)
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return false
+	}
+
+	return rows > 0
+}
+
+// RecoverInterrupted returns the files left processing by a previous run or
+// another instance, e.g. after a crash mid-check, to the pending items so
+// they are checked again, counting the retry. Only the files whose lease
+// expired are recovered, instances renew the leases of the files they check.
+// It returns the recovered items.
+func (q *Queue) RecoverInterrupted() []*QueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		slog.Error("Failed to recover interrupted items", "error", err)
+		return nil
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	now := time.Now()
+	rows, err := tx.Query(
+		"SELECT file_path, retries FROM queue WHERE status = ? AND (lease_until IS NULL OR lease_until < ?)",
+		StatusProcessing, now,
+	)
+	if err != nil {
+		slog.Error("Failed to query interrupted items", "error", err)
+		return nil
+	}
+
+	var recovered []*QueueItem
+	for rows.Next() {
+		item := &QueueItem{Status: StatusPending}
+		if err := rows.Scan(&item.FilePath, &item.Retries); err != nil {
+			_ = rows.Close()
+			slog.Error("Failed to scan interrupted item", "error", err)
+			return nil
+		}
+		item.Retries++
+		recovered = append(recovered, item)
+	}
+	_ = rows.Close()
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Failed to query interrupted items", "error", err)
+		return nil
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE queue SET status = ?, processed = 0, retries = retries + 1, lease_owner = '', lease_until = NULL WHERE status = ? AND (lease_until IS NULL OR lease_until < ?)",
+		StatusPending, StatusProcessing, now,
+	); err != nil {
+		slog.Error("Failed to recover interrupted items", "error", err)
+		return nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to recover interrupted items", "error", err)
+		return nil
+	}
+
+	return recovered
+}
+
+// SetPriority changes the priority of a queued file
+func (q *Queue) SetPriority(filePath string, priority int) bool {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec("UPDATE queue SET priority = ? WHERE file_path = ?", priority, filePath)
+	if err != nil {
+		slog.Error("Failed to set priority", "error", err)
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return false
+	}
+
+	return rows > 0
+}
+
+// RecordHealth stores the health of the latest check of a file and returns
+// the health of the previous check, ok is false when it was never checked
+func (q *Queue) RecordHealth(filePath string, health float64) (previous float64, ok bool) {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var last sql.NullFloat64
+	err := q.db.QueryRow("SELECT last_health FROM queue WHERE file_path = ?", filePath).Scan(&last)
+	if err != nil {
+		slog.Error("Failed to get last health", "error", err)
+		return 0, false
+	}
+
+	if _, err := q.db.Exec("UPDATE queue SET last_health = ? WHERE file_path = ?", health, filePath); err != nil {
+		slog.Error("Failed to record health", "error", err)
+	}
+
+	return last.Float64, last.Valid
+}
+
+// SetDegradation records how a previously healthy file degraded, an empty kind clears it
+func (q *Queue) SetDegradation(filePath string, kind string) bool {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec("UPDATE queue SET degradation = ? WHERE file_path = ?", kind, filePath)
+	if err != nil {
+		slog.Error("Failed to set degradation", "error", err)
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return false
+	}
+
+	return rows > 0
+}
+
+// SetPasswordProtected records whether a queued file looks password protected
+func (q *Queue) SetPasswordProtected(filePath string, protected bool) bool {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec("UPDATE queue SET password_protected = ? WHERE file_path = ?", protected, filePath)
+	if err != nil {
+		slog.Error("Failed to set password protection", "error", err)
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return false
+	}
+
+	return rows > 0
+}
+
+// SetCategory records the category of a queued file
+func (q *Queue) SetCategory(filePath string, category string) bool {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec("UPDATE queue SET category = ? WHERE file_path = ?", category, filePath)
+	if err != nil {
+		slog.Error("Failed to set category", "error", err)
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return false
+	}
+
+	return rows > 0
+}
+
+// Category returns the category recorded for a queued file, empty when it has none
+func (q *Queue) Category(filePath string) string {
+	filePath = normalizePath(filePath)
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var category string
+	err := q.db.QueryRow("SELECT category FROM queue WHERE file_path = ?", filePath).Scan(&category)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("Failed to get category", "error", err)
+	}
+
+	return category
+}
+
+// Status returns the status of a queued file, empty when it is not queued
+func (q *Queue) Status(filePath string) string {
+	filePath = normalizePath(filePath)
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var status string
+	err := q.db.QueryRow("SELECT status FROM queue WHERE file_path = ?", filePath).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("Failed to get status", "error", err)
+	}
+
+	return status
+}
+
+// SetContentHash records the content hash of a queued file
+func (q *Queue) SetContentHash(filePath string, hash string) bool {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec("UPDATE queue SET content_hash = ? WHERE file_path = ?", hash, filePath)
+	if err != nil {
+		slog.Error("Failed to set content hash", "error", err)
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return false
+	}
+
+	return rows > 0
+}
+
+// FindByHash returns the queued files, other than duplicates, with the given content hash
+func (q *Queue) FindByHash(hash string) []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	rows, err := q.db.Query("SELECT file_path FROM queue WHERE content_hash = ? AND duplicate_of = '' ORDER BY added ASC", hash)
+	if err != nil {
+		slog.Error("Failed to query items by content hash", "error", err)
+		return nil
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			slog.Error("Failed to scan row", "error", err)
+			continue
+		}
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+// AddDuplicate records a file with the same content as original. It is
+// marked as processed without a processing date, so it is never checked,
+// reprocessed or pruned, and scans do not pick it up again.
+func (q *Queue) AddDuplicate(filePath, original, hash string) bool {
+	filePath, original = normalizePath(filePath), normalizePath(original)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, err := q.db.Exec(
+		"INSERT OR IGNORE INTO queue (file_path, added, processed, process_count, path_key, status, content_hash, duplicate_of) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		filePath, time.Now(), true, 0, pathKey(filePath), StatusCompleted, hash, original,
+	)
+	if err != nil {
+		slog.Error("Failed to add duplicate to queue", "error", err)
+		return false
+	}
+
+	return true
+}
+
+// SetMovedTo records where a file was moved to
+func (q *Queue) SetMovedTo(filePath, destination string) bool {
+	filePath = normalizePath(filePath)
+	if destination != "" {
+		destination = normalizePath(destination)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec("UPDATE queue SET moved_to = ? WHERE file_path = ?", destination, filePath)
+	if err != nil {
+		slog.Error("Failed to record moved item", "error", err)
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return false
+	}
+
+	return rows > 0
+}
+
+// Postpone keeps a pending file from being checked before the given time
+func (q *Queue) Postpone(filePath string, until time.Time) bool {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec("UPDATE queue SET not_before = ? WHERE file_path = ?", until, filePath)
+	if err != nil {
+		slog.Error("Failed to postpone item", "error", err)
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return false
+	}
+
+	return rows > 0
+}
+
+// Contains checks if a file is in the queue under any spelling of its path
 func (q *Queue) Contains(filePath string) bool {
+	filePath = normalizePath(filePath)
+
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 
 	var exists bool
-	err := q.db.QueryRow("SELECT EXISTS(SELECT 1 FROM queue WHERE file_path = ?)", filePath).Scan(&exists)
+	err := q.db.QueryRow("SELECT EXISTS(SELECT 1 FROM queue WHERE file_path = ? OR path_key = ?)", filePath, pathKey(filePath)).Scan(&exists)
 	if err != nil {
 		slog.Error("Failed to check if file exists in queue", "error", err)
 		return false
@@ -148,12 +815,67 @@ func (q *Queue) Contains(filePath string) bool {
 	return exists
 }
 
+// Resolve returns the path a file is queued under, which may be spelled
+// differently from filePath
+func (q *Queue) Resolve(filePath string) (string, bool) {
+	filePath = normalizePath(filePath)
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var stored string
+	err := q.db.QueryRow(
+		"SELECT file_path FROM queue WHERE file_path = ? OR path_key = ? ORDER BY file_path = ? DESC LIMIT 1",
+		filePath, pathKey(filePath), filePath,
+	).Scan(&stored)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to resolve queued path", "error", err)
+		}
+		return "", false
+	}
+
+	return stored, true
+}
+
+// Rename moves a queue item to a new path, keeping its history
+func (q *Queue) Rename(oldPath, newPath string) bool {
+	oldPath, newPath = normalizePath(oldPath), normalizePath(newPath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		slog.Error("Failed to rename queue item", "error", err)
+		return false
+	}
+
+	result, err := tx.Exec("UPDATE queue SET file_path = ?, path_key = ? WHERE file_path = ?", newPath, pathKey(newPath), oldPath)
+	if err == nil {
+		_, err = tx.Exec("UPDATE queue SET duplicate_of = ? WHERE duplicate_of = ?", newPath, oldPath)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		slog.Error("Failed to rename queue item", "error", err)
+		return false
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to rename queue item", "error", err)
+		return false
+	}
+
+	rows, _ := result.RowsAffected()
+	return rows > 0
+}
+
 // GetPendingItems returns a list of items that haven't been processed
 func (q *Queue) GetPendingItems() []*QueueItem {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 
-	rows, err := q.db.Query("SELECT file_path, added FROM queue WHERE processed = 0")
+	rows, err := q.db.Query("SELECT file_path, added, priority FROM queue WHERE processed = 0 AND status != 'processing' AND (not_before IS NULL OR not_before <= ?) ORDER BY priority DESC, added ASC", time.Now())
 	if err != nil {
 		slog.Error("Failed to query pending items", "error", err)
 		return nil
@@ -165,7 +887,7 @@ func (q *Queue) GetPendingItems() []*QueueItem {
 	var pendingItems []*QueueItem
 	for rows.Next() {
 		item := &QueueItem{}
-		err := rows.Scan(&item.FilePath, &item.Added)
+		err := rows.Scan(&item.FilePath, &item.Added, &item.Priority)
 		if err != nil {
 			slog.Error("Failed to scan row", "error", err)
 			continue
@@ -176,6 +898,35 @@ func (q *Queue) GetPendingItems() []*QueueItem {
 	return pendingItems
 }
 
+// CountPending returns the number of items that haven't been processed and are due
+func (q *Queue) CountPending() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var count int
+	if err := q.db.QueryRow("SELECT COUNT(*) FROM queue WHERE processed = 0 AND status != 'processing' AND (not_before IS NULL OR not_before <= ?)", time.Now()).Scan(&count); err != nil {
+		slog.Error("Failed to count pending items", "error", err)
+		return 0
+	}
+
+	return count
+}
+
+// CountUnfinished returns the number of items pending or being checked, by
+// this instance or another one sharing the queue
+func (q *Queue) CountUnfinished() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var count int
+	if err := q.db.QueryRow("SELECT COUNT(*) FROM queue WHERE (processed = 0 AND (not_before IS NULL OR not_before <= ?)) OR status = 'processing'", time.Now()).Scan(&count); err != nil {
+		slog.Error("Failed to count unfinished items", "error", err)
+		return 0
+	}
+
+	return count
+}
+
 // GetItemsDueForReprocessing returns processed items that need to be reprocessed based on a time interval
 func (q *Queue) GetItemsDueForReprocessing(reprocessInterval time.Duration) []*QueueItem {
 	// If reprocessInterval is 0 or negative, don't reprocess anything
@@ -191,10 +942,12 @@ func (q *Queue) GetItemsDueForReprocessing(reprocessInterval time.Duration) []*Q
 
 	// Query for items that were processed before the cutoff time
 	rows, err := q.db.Query(`
-		SELECT file_path, added, processed_at, process_count 
-		FROM queue 
-		WHERE processed = 1 
+		SELECT file_path, added, processed_at, process_count, priority, category
+		FROM queue
+		WHERE processed = 1
+		AND status != 'processing'
 		AND processed_at < ?
+		ORDER BY priority DESC, processed_at ASC
 	`, cutoffTime)
 
 	if err != nil {
@@ -208,7 +961,7 @@ func (q *Queue) GetItemsDueForReprocessing(reprocessInterval time.Duration) []*Q
 	var reprocessItems []*QueueItem
 	for rows.Next() {
 		item := &QueueItem{Processed: true}
-		err := rows.Scan(&item.FilePath, &item.Added, &item.ProcessedAt, &item.ProcessCount)
+		err := rows.Scan(&item.FilePath, &item.Added, &item.ProcessedAt, &item.ProcessCount, &item.Priority, &item.Category)
 		if err != nil {
 			slog.Error("Failed to scan row for reprocessing", "error", err)
 			continue
@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// WithArchiveDirectory archives pruned queue items to compressed NDJSON files
+// in dir instead of deleting them
+func WithArchiveDirectory(dir string) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.archiveDirectory = dir
+	}
+}
+
+// ArchiveOldItems moves items processed before olderThan out of the database
+// into a new gzip compressed NDJSON file in dir, one item per line. The items
+// are only deleted once the archive was written. It returns the number of
+// archived items.
+func (q *Queue) ArchiveOldItems(olderThan time.Duration, dir string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	items, err := scanItems(tx.Query(
+		"SELECT "+queueItemColumns+" FROM queue WHERE processed = 1 AND processed_at < ? ORDER BY processed_at ASC",
+		cutoff,
+	))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return 0, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+
+	name := fmt.Sprintf("queue-archive-%s.ndjson.gz", time.Now().Format("20060102-150405"))
+	if err := fsutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM queue WHERE processed = 1 AND processed_at < ?", cutoff); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(items), nil
+}
@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// Retry checks a queued NZB again ahead of the backlog, returning the path
+// it is queued under
+func (s *DirectoryScanner) Retry(ctx context.Context, path string) (string, error) {
+	queued, err := s.queuedPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(fsutil.DiskPath(queued)); err != nil {
+		return "", errcode.Wrap(errcode.InvalidRequest, fmt.Errorf("the NZB cannot be checked again: %w", err))
+	}
+
+	if !s.queue.Retry(queued, manualPriority) {
+		return "", errcode.New(errcode.CheckInProgress, queued+" is being checked")
+	}
+
+	slog.InfoContext(ctx, "Retrying NZB", "path", queued)
+	if !s.enqueue(queued, manualPriority) {
+		slog.InfoContext(ctx, "Processing queue is full, file will be processed later", "path", queued)
+	}
+
+	return queued, nil
+}
+
+// Remove deletes an NZB from the queue with its check history, and the NZB
+// itself when deleteFile is set, into the trash when there is one. An NZB
+// left in a watch directory is queued again by the next scan.
+func (s *DirectoryScanner) Remove(ctx context.Context, path string, deleteFile bool) (string, error) {
+	queued, err := s.queuedPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	// The row goes first, the queue refuses to remove an NZB being checked,
+	// so a check starting meanwhile never loses its file
+	if !s.queue.Remove(queued) {
+		return "", errcode.New(errcode.CheckInProgress, queued+" is being checked")
+	}
+
+	if deleteFile {
+		if _, err := s.deleteFile(fsutil.DiskPath(queued), "removed from the queue"); err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("removed from the queue but failed to delete the NZB: %w", err)
+		}
+	}
+
+	slog.InfoContext(ctx, "Removed NZB from the queue", "path", queued, "file_deleted", deleteFile)
+	return queued, nil
+}
+
+// queuedPath returns the path an NZB is queued under
+func (s *DirectoryScanner) queuedPath(path string) (string, error) {
+	if path == "" {
+		return "", errcode.New(errcode.InvalidRequest, "missing path")
+	}
+
+	queued, ok := s.queue.Resolve(path)
+	if !ok {
+		return "", errcode.New(errcode.NotQueued, path+" is not queued")
+	}
+
+	return queued, nil
+}
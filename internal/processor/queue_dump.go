@@ -0,0 +1,194 @@
+package processor
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// queueDumpVersion is the format version of JSON queue dumps
+const queueDumpVersion = 1
+
+// QueueDump is the portable JSON representation of the queue and its history
+type QueueDump struct {
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exported_at"`
+	Items      []*QueueItem `json:"items"`
+}
+
+// queueItemColumns are the columns scanned by scanItems, in order
+const queueItemColumns = "file_path, added, processed, processed_at, process_count, priority, last_health, degradation, password_protected, category, content_hash, duplicate_of, not_before, moved_to, status, retries, failed_checks, failing_since"
+
+// Items returns every item of the queue, processed or not
+func (q *Queue) Items() ([]*QueueItem, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return scanItems(q.db.Query("SELECT " + queueItemColumns + " FROM queue ORDER BY added ASC"))
+}
+
+// scanItems reads every column of the queue items returned by a query
+func scanItems(rows *sql.Rows, err error) ([]*QueueItem, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var items []*QueueItem
+	for rows.Next() {
+		var (
+			item        = &QueueItem{}
+			processedAt sql.NullTime
+			notBefore   sql.NullTime
+			failing     sql.NullTime
+			lastHealth  sql.NullFloat64
+		)
+		if err := rows.Scan(&item.FilePath, &item.Added, &item.Processed, &processedAt,
+			&item.ProcessCount, &item.Priority, &lastHealth, &item.Degradation, &item.PasswordProtected, &item.Category, &item.ContentHash, &item.DuplicateOf, &notBefore, &item.MovedTo, &item.Status, &item.Retries, &item.FailedChecks, &failing); err != nil {
+			return nil, err
+		}
+
+		item.ProcessedAt = processedAt.Time
+		item.NotBefore = notBefore.Time
+		item.FailingSince = failing.Time
+		if lastHealth.Valid {
+			item.LastHealth = &lastHealth.Float64
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// Restore inserts the items into the queue, replacing existing items with
+// the same path. It returns the number of restored items.
+func (q *Queue) Restore(items []*QueueItem) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO queue (" + queueItemColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	for _, item := range items {
+		var processedAt any
+		if !item.ProcessedAt.IsZero() {
+			processedAt = item.ProcessedAt
+		}
+
+		var notBefore any
+		if !item.NotBefore.IsZero() {
+			notBefore = item.NotBefore
+		}
+
+		var failingSince any
+		if !item.FailingSince.IsZero() {
+			failingSince = item.FailingSince
+		}
+
+		if _, err := stmt.Exec(item.FilePath, item.Added, item.Processed, processedAt,
+			item.ProcessCount, item.Priority, item.LastHealth, item.Degradation, item.PasswordProtected, item.Category, item.ContentHash, item.DuplicateOf, notBefore, item.MovedTo, item.Status, item.Retries, item.FailedChecks, failingSince); err != nil {
+			_ = tx.Rollback()
+			return 0, fmt.Errorf("failed to restore %s: %w", item.FilePath, err)
+		}
+	}
+
+	if err := normalizeStoredPaths(tx); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if err := fillPathKeys(tx); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if err := fillStatuses(tx); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(items), nil
+}
+
+// ExportJSON writes the whole queue as a JSON dump
+func (q *Queue) ExportJSON(w io.Writer) (int, error) {
+	items, err := q.Items()
+	if err != nil {
+		return 0, err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	dump := QueueDump{Version: queueDumpVersion, ExportedAt: time.Now(), Items: items}
+	if dump.Items == nil {
+		dump.Items = []*QueueItem{}
+	}
+
+	return len(items), enc.Encode(dump)
+}
+
+// ImportJSON restores the items of a JSON dump into the queue
+func (q *Queue) ImportJSON(r io.Reader) (int, error) {
+	var dump QueueDump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return 0, fmt.Errorf("invalid queue dump: %w", err)
+	}
+
+	if dump.Version > queueDumpVersion {
+		return 0, fmt.Errorf("unsupported queue dump version %d", dump.Version)
+	}
+
+	return q.Restore(dump.Items)
+}
+
+// ExportSQLite writes a compacted copy of the queue database to path, which must not exist
+func (q *Queue) ExportSQLite(path string) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	_, err := q.db.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// ImportSQLite restores the items of another queue database into the queue
+func (q *Queue) ImportSQLite(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	// Opening the source brings databases of older versions to the current schema
+	src, err := NewQueue(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	items, err := src.Items()
+	if err != nil {
+		return 0, err
+	}
+
+	return q.Restore(items)
+}
@@ -0,0 +1,282 @@
+package processor
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/api"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// dayLayout formats the days of the check history
+const dayLayout = "2006-01-02"
+
+// List returns the items of the queue with the given status and a path
+// containing search, both ignored when empty, the most recently checked or
+// added first
+func (q *Queue) List(status, search string, limit int) ([]*QueueItem, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var (
+		where []string
+		args  []any
+	)
+	if status != "" {
+		where = append(where, "status = ?")
+		args = append(args, status)
+	}
+	if search != "" {
+		where = append(where, "file_path LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+likeEscaper.Replace(search)+"%")
+	}
+
+	query := "SELECT " + queueItemColumns + " FROM queue"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY COALESCE(processed_at, added) DESC LIMIT ?"
+	args = append(args, limit)
+
+	return scanItems(q.db.Query(query, args...))
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Stats counts the items of the queue per status and the checks of each of
+// the last days, today included. Only the latest check of an item is kept,
+// so an item checked again counts on the day of its latest check.
+func (q *Queue) Stats(days int) (*api.Stats, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	stats := &api.Stats{ByStatus: make(map[string]int)}
+
+	rows, err := q.db.Query(`
+		SELECT status, COUNT(*), SUM(degradation != ''), COALESCE(SUM(last_health), 0), COUNT(last_health)
+		FROM queue
+		GROUP BY status
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count queue items: %w", err)
+	}
+
+	var healthSum float64
+	var healthCount int
+	for rows.Next() {
+		var (
+			status             string
+			count, degraded, n int
+			sum                float64
+		)
+		if err := rows.Scan(&status, &count, &degraded, &sum, &n); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to count queue items: %w", err)
+		}
+
+		stats.ByStatus[status] = count
+		stats.Items += count
+		stats.Degraded += degraded
+		healthSum += sum
+		healthCount += n
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count queue items: %w", err)
+	}
+
+	if healthCount > 0 {
+		stats.AverageHealth = healthSum / float64(healthCount)
+	}
+
+	stats.Days, err = q.dailyChecks(days)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// dailyChecks returns the checks of each of the last days, oldest first
+func (q *Queue) dailyChecks(days int) ([]api.DayStats, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from := today.AddDate(0, 0, 1-days)
+
+	result := make([]api.DayStats, days)
+	index := make(map[string]int, days)
+	for i := range result {
+		result[i].Day = from.AddDate(0, 0, i).Format(dayLayout)
+		index[result[i].Day] = i
+	}
+
+	rows, err := q.db.Query(`
+		SELECT processed_at, status, last_health
+		FROM queue
+		WHERE processed = 1 AND processed_at >= ?
+	`, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checked items: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	healthSums := make([]float64, days)
+	healthCounts := make([]int, days)
+	for rows.Next() {
+		var (
+			processedAt time.Time
+			status      string
+			health      sql.NullFloat64
+		)
+		if err := rows.Scan(&processedAt, &status, &health); err != nil {
+			return nil, fmt.Errorf("failed to read checked item: %w", err)
+		}
+
+		i, ok := index[processedAt.In(now.Location()).Format(dayLayout)]
+		if !ok {
+			continue
+		}
+
+		result[i].Checked++
+		if status == StatusFailed {
+			result[i].Failed++
+		}
+		if health.Valid {
+			healthSums[i] += health.Float64
+			healthCounts[i]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checked items: %w", err)
+	}
+
+	for i := range result {
+		if healthCounts[i] > 0 {
+			result[i].AverageHealth = healthSums[i] / float64(healthCounts[i])
+		}
+	}
+
+	return result, nil
+}
+
+// QueueItems lists the items of the queue matching a filter, for the API
+func (s *DirectoryScanner) QueueItems(filter api.QueueFilter) ([]api.QueueItem, error) {
+	items, err := s.queue.List(filter.Status, filter.Search, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queue items: %w", err)
+	}
+
+	result := make([]api.QueueItem, 0, len(items))
+	for _, item := range items {
+		result = append(result, api.QueueItem{
+			Path:         item.FilePath,
+			Status:       item.Status,
+			Added:        item.Added,
+			CheckedAt:    item.ProcessedAt,
+			Checks:       item.ProcessCount,
+			Health:       item.LastHealth,
+			Degradation:  item.Degradation,
+			FailedChecks: item.FailedChecks,
+			Priority:     item.Priority,
+			Category:     item.Category,
+			NotBefore:    item.NotBefore,
+			DuplicateOf:  item.DuplicateOf,
+			MovedTo:      item.MovedTo,
+		})
+	}
+
+	return result, nil
+}
+
+// Directories rolls the latest checks of the NZBs queued below the roots up
+// by directory, up to depth levels deep. A directory counts the NZBs of its
+// whole subtree, NZBs directly in a root are only part of the totals.
+func (q *Queue) Directories(roots []string, depth int) (map[string]*api.DirectoryStats, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	rows, err := q.db.Query("SELECT file_path, status, last_health, degradation FROM queue")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue items: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	dirs := make(map[string]*api.DirectoryStats)
+	healthSums := make(map[string]float64)
+	for rows.Next() {
+		var (
+			path, status, degradation string
+			health                    sql.NullFloat64
+		)
+		if err := rows.Scan(&path, &status, &health, &degradation); err != nil {
+			return nil, fmt.Errorf("failed to read queue item: %w", err)
+		}
+
+		var keys []string
+		for _, root := range roots {
+			if rel, ok := fsutil.RelativePath(root, filepath.Dir(path)); ok {
+				keys = fsutil.DirectoryKeys(rel, depth)
+				break
+			}
+		}
+
+		for _, key := range keys {
+			d := dirs[key]
+			if d == nil {
+				d = &api.DirectoryStats{}
+				dirs[key] = d
+			}
+
+			d.NZBs++
+			if status == StatusFailed {
+				d.Failed++
+			}
+			if degradation != "" {
+				d.Degraded++
+			}
+			if status == StatusFailed || degradation != "" || health.Valid && health.Float64 < 100 {
+				d.AtRisk++
+			}
+			if health.Valid {
+				d.Checked++
+				healthSums[key] += health.Float64
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read queue items: %w", err)
+	}
+
+	for key, d := range dirs {
+		if d.Checked > 0 {
+			d.AverageHealth = healthSums[key] / float64(d.Checked)
+		}
+	}
+
+	return dirs, nil
+}
+
+// Stats summarizes the queue, the checks of the last days and the
+// directories up to depth levels below the watch directories, for the API
+func (s *DirectoryScanner) Stats(days, depth int) (*api.Stats, error) {
+	stats, err := s.queue.Stats(days)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Directories, err = s.queue.Directories(s.watchDirs, depth)
+	if err != nil {
+		return nil, err
+	}
+	stats.DirectoryDepth = depth
+
+	return stats, nil
+}
@@ -0,0 +1,301 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+)
+
+var (
+	rar4Signature = []byte("Rar!\x1a\x07\x00")
+	rar5Signature = []byte("Rar!\x1a\x07\x01\x00")
+
+	// rarVolume matches the volumes of a RAR set, "name.rar" or "name.partN.rar"
+	rarVolume = regexp.MustCompile(`(?i)(\.part([0-9]+))?\.rar$`)
+)
+
+// rarEncryption tells what the headers of a RAR archive reveal about its
+// encryption
+type rarEncryption int
+
+const (
+	rarUnknown   rarEncryption = iota // Not a RAR archive, or no file header in the data read
+	rarPlain                          // The first file of the archive is not encrypted
+	rarEncrypted                      // The headers or the first file are encrypted
+)
+
+// probePassword checks the password hint against the archive headers. An
+// encrypted archive is reported unless the hint already knows the password,
+// an unencrypted one drops a hint guessed from the file names. It returns
+// the bytes downloaded by the probe.
+func (p *Processor) probePassword(ctx context.Context, files []nzbparser.NzbFile, hint *PasswordHint) (*PasswordHint, int64) {
+	encryption, bytes := p.probeEncryption(ctx, files)
+	switch encryption {
+	case rarEncrypted:
+		if hint == nil || hint.Password == "" {
+			hint = &PasswordHint{Source: "rar_header"}
+		}
+	case rarPlain:
+		if hint != nil && hint.Source == "filename" {
+			slog.InfoContext(ctx, "RAR archive is not encrypted, ignoring the password hint of the file names")
+			hint = nil
+		}
+	}
+
+	return hint, bytes
+}
+
+// probeEncryption downloads and decodes the first article of the first RAR
+// volume of the NZB and reads the archive headers it starts with, which tell
+// whether the release is password protected before anyone downloads it. The
+// article is downloaded like the segments of a check, with the policies of
+// every provider, and the bytes downloaded are returned.
+func (p *Processor) probeEncryption(ctx context.Context, files []nzbparser.NzbFile) (rarEncryption, int64) {
+	if p.replay != nil {
+		return rarUnknown, 0
+	}
+
+	file, ok := firstRarFile(files)
+	if !ok {
+		return rarUnknown, 0
+	}
+
+	if err := p.budget.acquire(ctx); err != nil {
+		return rarUnknown, 0
+	}
+	defer p.budget.release()
+
+	if err := p.speedLimit.wait(ctx); err != nil {
+		return rarUnknown, 0
+	}
+
+	var data bytes.Buffer
+	segmentID := firstSegment(file).Id
+	n, err := p.fetchOnProviders(ctx, segmentID, file.Groups, "", func(conn nntpcli.Connection) (int64, error) {
+		// A provider missing the article leaves nothing of it behind
+		data.Reset()
+		if err := joinGroups(conn, file.Groups); err != nil {
+			return 0, err
+		}
+
+		return conn.BodyDecoded(segmentID, &data, 0)
+	})
+	p.speedLimit.take(n)
+	p.downloaded.Add(n)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to download the first article of the RAR archive", "file", file.Filename, "error", err)
+		return rarUnknown, n
+	}
+
+	encryption := rarHeaderEncryption(data.Bytes())
+	slog.DebugContext(ctx, "RAR archive headers probed", "file", file.Filename, "encrypted", encryption == rarEncrypted, "known", encryption != rarUnknown)
+
+	return encryption, n
+}
+
+// firstRarFile returns the first volume of the RAR set of the NZB, the
+// "name.part1.rar" volume, or else the "name.rar" one
+func firstRarFile(files []nzbparser.NzbFile) (nzbparser.NzbFile, bool) {
+	var first nzbparser.NzbFile
+	found, firstIsPart := false, false
+	for _, file := range files {
+		m := rarVolume.FindStringSubmatch(fileName(file))
+		if m == nil || len(file.Segments) == 0 {
+			continue
+		}
+
+		isPart := m[1] != ""
+		if isPart && strings.TrimLeft(m[2], "0") != "1" {
+			continue
+		}
+
+		if !found || (isPart && !firstIsPart) || (isPart == firstIsPart && fileName(file) < fileName(first)) {
+			first, found, firstIsPart = file, true, isPart
+		}
+	}
+
+	return first, found
+}
+
+// firstSegment returns the segment starting a file
+func firstSegment(file nzbparser.NzbFile) nzbparser.NzbSegment {
+	return slices.MinFunc(file.Segments, func(a, b nzbparser.NzbSegment) int { return a.Number - b.Number })
+}
+
+// rarHeaderEncryption reads the headers at the start of a RAR 4 or RAR 5
+// archive up to the first file header
+func rarHeaderEncryption(data []byte) rarEncryption {
+	switch {
+	case bytes.HasPrefix(data, rar5Signature):
+		return rar5Encryption(data[len(rar5Signature):])
+	case bytes.HasPrefix(data, rar4Signature):
+		return rar4Encryption(data[len(rar4Signature):])
+	default:
+		return rarUnknown
+	}
+}
+
+// RAR 4 block types and flags
+const (
+	rar4MainHeader     = 0x73
+	rar4FileHeader     = 0x74
+	rar4HeadersCrypted = 0x0080 // Main header flag, every block header is encrypted
+	rar4FileCrypted    = 0x0004 // File header flag, the file data is encrypted
+	rar4LongBlock      = 0x8000 // Block flag, the header is followed by data
+)
+
+// rar4Encryption walks the blocks of a RAR 4 archive: CRC (2 bytes), type (1),
+// flags (2) and header size (2), the size including those 7 bytes
+func rar4Encryption(data []byte) rarEncryption {
+	for len(data) >= 7 {
+		kind := data[2]
+		flags := binary.LittleEndian.Uint16(data[3:])
+		size := int(binary.LittleEndian.Uint16(data[5:]))
+		if size < 7 {
+			return rarUnknown
+		}
+
+		switch kind {
+		case rar4MainHeader:
+			if flags&rar4HeadersCrypted != 0 {
+				return rarEncrypted
+			}
+		case rar4FileHeader:
+			if flags&rar4FileCrypted != 0 {
+				return rarEncrypted
+			}
+			return rarPlain
+		}
+
+		skip := uint64(size)
+		if flags&rar4LongBlock != 0 && len(data) >= 11 {
+			skip += uint64(binary.LittleEndian.Uint32(data[7:]))
+		}
+		if skip > uint64(len(data)) {
+			return rarUnknown
+		}
+		data = data[skip:]
+	}
+
+	return rarUnknown
+}
+
+// RAR 5 header types, flags and extra records
+const (
+	rar5FileHeader       = 2
+	rar5EncryptionHeader = 4 // Archive encryption header, every following header is encrypted
+	rar5HasExtra         = 0x0001
+	rar5HasData          = 0x0002
+	rar5FileEncryption   = 0x01 // Extra record of an encrypted file
+)
+
+// rar5Encryption walks the headers of a RAR 5 archive: CRC (4 bytes) then
+// the header size, type and flags as variable length integers, the size
+// counting the bytes after its own field. The sizes come from untrusted
+// articles and are checked against the data before any use.
+func rar5Encryption(data []byte) rarEncryption {
+	for len(data) > 4 {
+		r := vintReader{data: data[4:]}
+		size := r.next()
+		start := r.pos
+		kind, flags := r.next(), r.next()
+		if r.err || size > uint64(len(r.data)-start) {
+			return rarUnknown
+		}
+
+		var extraSize, dataSize uint64
+		if flags&rar5HasExtra != 0 {
+			extraSize = r.next()
+		}
+		if flags&rar5HasData != 0 {
+			dataSize = r.next()
+		}
+
+		// The fields read must lie within the header
+		end := start + int(size)
+		if r.err || end < r.pos {
+			return rarUnknown
+		}
+
+		switch kind {
+		case rar5EncryptionHeader:
+			return rarEncrypted
+		case rar5FileHeader:
+			if extraSize == 0 || extraSize > uint64(end-start) {
+				return rarPlain
+			}
+			if rar5Encrypted(r.data[end-int(extraSize) : end]) {
+				return rarEncrypted
+			}
+			return rarPlain
+		}
+
+		if dataSize > uint64(len(r.data)-end) {
+			return rarUnknown
+		}
+		data = r.data[end+int(dataSize):]
+	}
+
+	return rarUnknown
+}
+
+// rar5Encrypted looks for a file encryption record in the extra area of a
+// RAR 5 file header, a list of records of size and type
+func rar5Encrypted(extra []byte) bool {
+	r := vintReader{data: extra}
+	for r.pos < len(r.data) {
+		size := r.next()
+		start := r.pos
+		kind := r.next()
+		if r.err || size == 0 {
+			return false
+		}
+
+		if kind == rar5FileEncryption {
+			return true
+		}
+
+		if size > uint64(len(r.data)-start) {
+			return false
+		}
+		r.pos = start + int(size)
+	}
+
+	return false
+}
+
+// vintReader reads the variable length integers of RAR 5 headers, 7 bits per
+// byte with the high bit set on every byte but the last
+type vintReader struct {
+	data []byte
+	pos  int
+	err  bool
+}
+
+// next reads the next integer, err is set when the data ends before it does
+func (r *vintReader) next() uint64 {
+	var v uint64
+	for shift := 0; shift < 64; shift += 7 {
+		if r.pos >= len(r.data) {
+			r.err = true
+			return 0
+		}
+
+		b := r.data[r.pos]
+		r.pos++
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+
+	r.err = true
+	return 0
+}
@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces requests evenly to stay under a requests-per-second cap
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next request slot, or until ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	slot := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// waitProvider blocks until the provider's rate limit and speed cap allow
+// another request
+func (p *Processor) waitProvider(ctx context.Context, providerID string) error {
+	if limiter, ok := p.rateLimiters[providerID]; ok {
+		if err := limiter.wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	return p.providerSpeeds[providerID].wait(ctx)
+}
@@ -0,0 +1,204 @@
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// refreshPoll is how often the library refresh looks for an idle queue
+const refreshPoll = 30 * time.Second
+
+// RequestRefresh flags every checked item in the queue for a refresh
+func (q *Queue) RequestRefresh() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec("UPDATE queue SET refresh = 1 WHERE processed = 1 AND duplicate_of = ''")
+	if err != nil {
+		slog.Error("Failed to flag items for a refresh", "error", err)
+		return 0
+	}
+
+	rows, _ := result.RowsAffected()
+	return int(rows)
+}
+
+// NextRefresh returns the item flagged for a refresh checked the longest ago
+func (q *Queue) NextRefresh() (string, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var path string
+	err := q.db.QueryRow(
+		"SELECT file_path FROM queue WHERE refresh = 1 AND processed = 1 AND status != ? ORDER BY processed_at ASC LIMIT 1",
+		StatusProcessing,
+	).Scan(&path)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("Failed to query items to refresh", "error", err)
+		}
+		return "", false
+	}
+
+	return path, true
+}
+
+// ClearRefresh removes the refresh flag of an item, a finished check clears it too
+func (q *Queue) ClearRefresh(filePath string) {
+	filePath = normalizePath(filePath)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.db.Exec("UPDATE queue SET refresh = 0 WHERE file_path = ?", filePath); err != nil {
+		slog.Error("Failed to clear the refresh flag", "path", filePath, "error", err)
+	}
+}
+
+// RequestRefresh re-checks every item of the library regardless of the
+// reprocess interval. The items are checked one at a time while no other
+// file is pending or being checked, keeping the average download rate of the
+// refresh under bytesPerSecond (0 = no cap). The flags are kept in the queue,
+// so a refresh interrupted by a restart goes on where it stopped.
+func (s *DirectoryScanner) RequestRefresh(ctx context.Context, bytesPerSecond int64) int {
+	flagged := s.queue.RequestRefresh()
+
+	s.refreshMu.Lock()
+	s.refreshRate = bytesPerSecond
+	s.refreshMu.Unlock()
+
+	select {
+	case s.refreshChan <- struct{}{}:
+	default:
+	}
+
+	slog.InfoContext(ctx, "Library refresh requested", "items", flagged, "bytes_per_second", bytesPerSecond)
+
+	return flagged
+}
+
+// runRefresh checks the items flagged for a refresh whenever the queue is idle
+func (s *DirectoryScanner) runRefresh(ctx context.Context) {
+	ticker := time.NewTicker(refreshPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.refreshChan:
+		case <-s.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		var last string
+		for {
+			path, ok := s.refreshNext(ctx, last)
+			if !ok {
+				break
+			}
+			last = path
+		}
+	}
+}
+
+// refreshNext checks the next item flagged for a refresh and waits for the
+// pace of the refresh. It returns false when the queue is busy, nothing is
+// left or the item was not checked, e.g. because the daily limit or the
+// bandwidth budget was reached.
+func (s *DirectoryScanner) refreshNext(ctx context.Context, last string) (string, bool) {
+	if ctx.Err() != nil || s.Paused() || !s.idle() || s.limitReached(ctx) {
+		return "", false
+	}
+
+	path, ok := s.queue.NextRefresh()
+	if !ok || path == last {
+		return "", false
+	}
+
+	if _, err := os.Stat(fsutil.DiskPath(path)); os.IsNotExist(err) {
+		slog.InfoContext(ctx, "File no longer exists, skipping refresh", "path", path)
+		s.queue.ClearRefresh(path)
+		return path, true
+	}
+
+	s.refreshMu.Lock()
+	s.refreshing, s.refreshBytes = path, 0
+	rate := s.refreshRate
+	s.refreshMu.Unlock()
+
+	slog.InfoContext(ctx, "Refreshing item", "path", path)
+
+	start := time.Now()
+	if !s.enqueue(path, 0) {
+		return "", false
+	}
+
+	// Wait for the worker to be done with the file
+	for s.isInFlight(path) {
+		select {
+		case <-ctx.Done():
+			return "", false
+		case <-time.After(time.Second):
+		}
+	}
+
+	s.refreshMu.Lock()
+	bytes := s.refreshBytes
+	s.refreshing = ""
+	s.refreshMu.Unlock()
+
+	// Spread the refresh checks so their average rate stays under the cap
+	if rate > 0 {
+		pause := time.Duration(float64(bytes)/float64(rate)*float64(time.Second)) - time.Since(start)
+		if pause > 0 {
+			select {
+			case <-ctx.Done():
+				return "", false
+			case <-time.After(pause):
+			}
+		}
+	}
+
+	return path, true
+}
+
+// countRefreshBytes adds the bytes downloaded by the refresh check in progress
+func (s *DirectoryScanner) countRefreshBytes(_ context.Context, e events.Event) {
+	result := eventResult(e)
+	if result == nil {
+		return
+	}
+
+	s.refreshMu.Lock()
+	if e.Path == s.refreshing {
+		s.refreshBytes += result.BytesDownloaded
+	}
+	s.refreshMu.Unlock()
+}
+
+// idle reports whether no file is pending or being checked
+func (s *DirectoryScanner) idle() bool {
+	s.inFlightMu.Lock()
+	busy := len(s.inFlight) > 0
+	s.inFlightMu.Unlock()
+
+	return !busy && s.queue.CountPending() == 0
+}
+
+// isInFlight reports whether a file was sent to the workers and is not processed yet
+func (s *DirectoryScanner) isInFlight(filePath string) bool {
+	s.inFlightMu.Lock()
+	defer s.inFlightMu.Unlock()
+
+	_, ok := s.inFlight[filePath]
+	return ok
+}
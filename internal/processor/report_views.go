@@ -0,0 +1,209 @@
+package processor
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ReportType is the type of the values of a report column
+type ReportType int
+
+const (
+	ReportText    ReportType = iota // string
+	ReportInteger                   // int64
+	ReportReal                      // float64
+	ReportBool                      // bool
+	ReportTime                      // time.Time
+)
+
+// ReportColumn is a column of a reporting view
+type ReportColumn struct {
+	Name string
+	Type ReportType
+	expr string // SQL expression of the column
+}
+
+// ReportView is a reporting view of the queue database. The views are named
+// report_<Name> and their columns are kept stable across versions, so BI
+// tools such as Metabase can query them without knowing the schema.
+type ReportView struct {
+	Name    string
+	Columns []ReportColumn
+	from    string // FROM clause, with its WHERE and GROUP BY
+}
+
+// ReportViews are the reporting views created in every queue database
+var ReportViews = []ReportView{
+	{
+		Name: "results",
+		Columns: []ReportColumn{
+			{"path", ReportText, "file_path"},
+			{"category", ReportText, "category"},
+			{"status", ReportText, "status"},
+			{"healthy", ReportBool, "process_count > 0 AND failed_checks = 0 AND status != '" + StatusFailed + "'"},
+			{"health", ReportReal, "last_health"},
+			{"checks", ReportInteger, "process_count"},
+			{"failed_checks", ReportInteger, "failed_checks"},
+			{"failing_since", ReportTime, "failing_since"},
+			{"degradation", ReportText, "degradation"},
+			{"password_protected", ReportBool, "password_protected"},
+			{"priority", ReportInteger, "priority"},
+			{"added", ReportTime, "added"},
+			{"last_checked", ReportTime, "processed_at"},
+			{"duplicate_of", ReportText, "duplicate_of"},
+			{"moved_to", ReportText, "moved_to"},
+		},
+		from: "FROM queue",
+	},
+	{
+		Name: "history",
+		Columns: []ReportColumn{
+			{"id", ReportInteger, "id"},
+			{"time", ReportTime, "at"},
+			{"operation", ReportText, "operation"},
+			{"path", ReportText, "path"},
+			{"target", ReportText, "target"},
+			{"detail", ReportText, "detail"},
+		},
+		from: "FROM file_log",
+	},
+	{
+		Name: "categories",
+		Columns: []ReportColumn{
+			{"category", ReportText, "category"},
+			{"nzbs", ReportInteger, "COUNT(*)"},
+			{"checked", ReportInteger, "SUM(process_count > 0)"},
+			{"failed", ReportInteger, "SUM(status = '" + StatusFailed + "')"},
+			{"degraded", ReportInteger, "SUM(degradation != '')"},
+			{"average_health", ReportReal, "AVG(last_health)"},
+			{"last_checked", ReportTime, "MAX(processed_at)"},
+		},
+		from: "FROM queue WHERE duplicate_of = '' GROUP BY category",
+	},
+}
+
+// LookupReportView returns the reporting view of the given name
+func LookupReportView(name string) (ReportView, bool) {
+	for _, view := range ReportViews {
+		if view.Name == name {
+			return view, true
+		}
+	}
+
+	return ReportView{}, false
+}
+
+// createReportViews (re)creates the reporting views, so they follow the
+// schema of the running version
+func createReportViews(db *sql.DB) error {
+	for _, view := range ReportViews {
+		columns := make([]string, len(view.Columns))
+		for i, column := range view.Columns {
+			columns[i] = column.expr + " AS " + column.Name
+		}
+
+		_, err := db.Exec("DROP VIEW IF EXISTS report_" + view.Name + ";" +
+			"CREATE VIEW report_" + view.Name + " AS SELECT " + strings.Join(columns, ", ") + " " + view.from)
+		if err != nil {
+			return fmt.Errorf("failed to create view report_%s: %w", view.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Report calls fn with every row of a reporting view. The values have the Go
+// type of their column, or are nil.
+func (q *Queue) Report(view ReportView, fn func(values []any) error) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	names := make([]string, len(view.Columns))
+	for i, column := range view.Columns {
+		names[i] = column.Name
+	}
+
+	rows, err := q.db.Query("SELECT " + strings.Join(names, ", ") + " FROM report_" + view.Name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	raw := make([]any, len(view.Columns))
+	dest := make([]any, len(view.Columns))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		values := make([]any, len(raw))
+		for i, column := range view.Columns {
+			if values[i], err = reportValue(column.Type, raw[i]); err != nil {
+				return fmt.Errorf("column %s: %w", column.Name, err)
+			}
+		}
+
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// reportValue converts a value read from SQLite to the Go type of its column
+func reportValue(typ ReportType, v any) (any, error) {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	switch typ {
+	case ReportText:
+		return fmt.Sprint(v), nil
+	case ReportInteger:
+		if n, ok := v.(int64); ok {
+			return n, nil
+		}
+	case ReportReal:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int64:
+			return float64(n), nil
+		}
+	case ReportBool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case int64:
+			return b != 0, nil
+		}
+	case ReportTime:
+		switch t := v.(type) {
+		case time.Time:
+			return t, nil
+		case string:
+			// Aggregates lose the declared type, SQLite returns the stored text
+			for _, layout := range sqlite3.SQLiteTimestampFormats {
+				if parsed, err := time.Parse(layout, t); err == nil {
+					return parsed, nil
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected value %v (%T)", v, v)
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"sync"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/k0kubun/go-ansi"
+	"github.com/schollz/progressbar/v3"
+)
+
+// Reporter receives progress notifications while an NZB is processed.
+// Implementations must be safe for concurrent use since segments are
+// checked in parallel.
+type Reporter interface {
+	// FileStarted is called before the segments of a file are checked
+	FileStarted(file nzbparser.NzbFile, segmentsToCheck int)
+	// SegmentChecked is called after each checked segment, err is nil on success
+	SegmentChecked(file nzbparser.NzbFile, segment nzbparser.NzbSegment, bytes int64, err error)
+	// FileFinished is called once all segments of a file have been submitted
+	FileFinished(file nzbparser.NzbFile)
+}
+
+// progressBarReporter renders a progress bar per file on stdout
+type progressBarReporter struct {
+	mu   sync.Mutex
+	bars map[string]*progressbar.ProgressBar
+}
+
+// NewProgressBarReporter creates the default terminal progress bar reporter
+func NewProgressBarReporter() Reporter {
+	return &progressBarReporter{
+		bars: make(map[string]*progressbar.ProgressBar),
+	}
+}
+
+func (r *progressBarReporter) FileStarted(file nzbparser.NzbFile, _ int) {
+	bar := progressbar.NewOptions(int(file.Bytes),
+		progressbar.OptionSetWriter(ansi.NewAnsiStdout()), //you should install "github.com/k0kubun/go-ansi"
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionShowTotalBytes(true),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}))
+
+	r.mu.Lock()
+	r.bars[file.Filename] = bar
+	r.mu.Unlock()
+}
+
+func (r *progressBarReporter) SegmentChecked(file nzbparser.NzbFile, _ nzbparser.NzbSegment, bytes int64, err error) {
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	bar := r.bars[file.Filename]
+	r.mu.Unlock()
+
+	if bar != nil {
+		_ = bar.Add(int(bytes))
+	}
+}
+
+func (r *progressBarReporter) FileFinished(file nzbparser.NzbFile) {
+	r.mu.Lock()
+	bar := r.bars[file.Filename]
+	delete(r.bars, file.Filename)
+	r.mu.Unlock()
+
+	if bar != nil {
+		_ = bar.Finish()
+	}
+}
+
+// nopReporter discards every progress notification
+type nopReporter struct{}
+
+// NewNopReporter creates a reporter that prints nothing, used when many NZBs
+// are checked at once and per-file progress bars would be unreadable
+func NewNopReporter() Reporter {
+	return nopReporter{}
+}
+
+func (nopReporter) FileStarted(nzbparser.NzbFile, int) {}
+
+func (nopReporter) SegmentChecked(nzbparser.NzbFile, nzbparser.NzbSegment, int64, error) {}
+
+func (nopReporter) FileFinished(nzbparser.NzbFile) {}
@@ -0,0 +1,223 @@
+package processor
+
+import (
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/hook"
+)
+
+// Result summarizes the outcome of an NZB check
+type Result struct {
+	Files            int           `json:"files"`
+	TotalSegments    int           `json:"total_segments"`
+	CheckedSegments  int           `json:"checked_segments"`
+	FailedSegments   int           `json:"failed_segments"`
+	MissingSegments  []string      `json:"missing_segments,omitempty"`  // Message-IDs of the segments that could not be retrieved, capped at maxMissingSegmentIDs, empty when spilled
+	MissingTruncated bool          `json:"missing_truncated,omitempty"` // Whether MissingSegments was capped
+	BytesDownloaded  int64         `json:"bytes_downloaded"`
+	OldestPost       time.Time     `json:"oldest_post,omitzero"` // Post date of the oldest file, zero when the NZB has no dates
+	Password         *PasswordHint `json:"password,omitempty"`   // Set when the release looks password protected
+	PayloadBytes     int64         `json:"payload_bytes"`        // Size of the files that are not PAR2
+	Par2Bytes        int64         `json:"par2_bytes"`           // Size of the PAR2 recovery volumes
+	Par2Percent      float64       `json:"par2_percent"`         // Recovery data as a percentage of the payload
+	Par2Thin         bool          `json:"par2_thin,omitempty"`  // Parity coverage below the configured minimum
+	Partial          bool          `json:"partial,omitempty"`    // The time budget ran out, health reflects the segments checked so far
+	StartedAt        time.Time     `json:"started_at"`
+	Duration         time.Duration `json:"duration"`
+	// Repeated message-ids of the NZB, checked and counted once
+	DuplicateSegments int `json:"duplicate_segments,omitempty"`
+	// Failed segments by error class
+	ErrorClasses map[ErrorClass]int `json:"error_classes,omitempty"`
+	// Error classes beyond their warning threshold, with the detail
+	Warnings map[ErrorClass]string `json:"warnings,omitempty"`
+	// Metadata read from the article headers of each file, set when HeaderSamples is
+	FileHeaders []FileHeaders `json:"file_headers,omitempty"`
+	// Outcome of the segments of each file checked
+	FileResults []FileResult `json:"file_results,omitempty"`
+	// Requests answered by each provider, set with WithProviderResults
+	Providers map[string]*ProviderResult `json:"providers,omitempty"`
+
+	// The segment outcomes go to the spill store, MissingSegments stays empty
+	spilled bool
+}
+
+// FileResult is the outcome of the segments of a file
+type FileResult struct {
+	File       string  `json:"file"`
+	Segments   int     `json:"segments"` // Segments of the file in the NZB
+	Checked    int     `json:"checked"`
+	Failed     int     `json:"failed"`
+	Completion float64 `json:"completion"` // Percentage of the checked segments that were found
+}
+
+// complete computes the completion of the file from its counts
+func (f *FileResult) complete() {
+	f.Completion = 100
+	if f.Checked > 0 {
+		f.Completion = float64(f.Checked-f.Failed) * 100 / float64(f.Checked)
+	}
+}
+
+// ProviderResult counts the requests of a check sent to a provider
+type ProviderResult struct {
+	Requests int   `json:"requests"`
+	Found    int   `json:"found"`
+	Missing  int   `json:"missing"`
+	Errors   int   `json:"errors"` // Requests failing with an error other than a missing article
+	Bytes    int64 `json:"bytes"`
+}
+
+// add adds the counts of another check
+func (pr *ProviderResult) add(other *ProviderResult) {
+	pr.Requests += other.Requests
+	pr.Found += other.Found
+	pr.Missing += other.Missing
+	pr.Errors += other.Errors
+	pr.Bytes += other.Bytes
+}
+
+// maxMissingSegmentIDs bounds the missing message-ids kept per result so badly
+// damaged NZBs with millions of segments do not exhaust memory
+var maxMissingSegmentIDs = 1000
+
+// recordMissing counts a failed segment and keeps its message-id while under
+// the cap, unless the segment outcomes are spilled
+func (r *Result) recordMissing(segmentID string) {
+	r.FailedSegments++
+	switch {
+	case r.spilled:
+	case len(r.MissingSegments) < maxMissingSegmentIDs:
+		r.MissingSegments = append(r.MissingSegments, segmentID)
+	default:
+		r.MissingTruncated = true
+	}
+}
+
+// recordFailure counts a failed segment of the given class
+func (r *Result) recordFailure(segmentID string, class ErrorClass) {
+	r.recordMissing(segmentID)
+	if r.ErrorClasses == nil {
+		r.ErrorClasses = make(map[ErrorClass]int)
+	}
+	r.ErrorClasses[class]++
+}
+
+// warn records that an error class went beyond its warning threshold
+func (r *Result) warn(class ErrorClass, detail string) {
+	if r.Warnings == nil {
+		r.Warnings = make(map[ErrorClass]string)
+	}
+	r.Warnings[class] = detail
+}
+
+// warned reports whether an error class went beyond its warning threshold
+func (r *Result) warned(class ErrorClass) bool {
+	_, ok := r.Warnings[class]
+	return ok
+}
+
+// merge adds the outcome of another check, e.g. of a companion NZB, to the
+// result. Parity coverage stays the one of the main release.
+func (r *Result) merge(other *Result) {
+	if other == nil {
+		return
+	}
+
+	r.Files += other.Files
+	r.TotalSegments += other.TotalSegments
+	r.CheckedSegments += other.CheckedSegments
+	r.DuplicateSegments += other.DuplicateSegments
+	r.BytesDownloaded += other.BytesDownloaded
+	r.Partial = r.Partial || other.Partial
+	r.Duration += other.Duration
+	for _, id := range other.MissingSegments {
+		r.recordMissing(id)
+	}
+	// Failures beyond the kept message-ids
+	r.FailedSegments += other.FailedSegments - len(other.MissingSegments)
+	r.MissingTruncated = r.MissingTruncated || other.MissingTruncated
+	for class, failed := range other.ErrorClasses {
+		if r.ErrorClasses == nil {
+			r.ErrorClasses = make(map[ErrorClass]int)
+		}
+		r.ErrorClasses[class] += failed
+	}
+	for class, detail := range other.Warnings {
+		r.warn(class, detail)
+	}
+	r.FileHeaders = append(r.FileHeaders, other.FileHeaders...)
+	r.FileResults = append(r.FileResults, other.FileResults...)
+	for id, counts := range other.Providers {
+		if r.Providers == nil {
+			r.Providers = make(map[string]*ProviderResult)
+		}
+		if r.Providers[id] == nil {
+			r.Providers[id] = &ProviderResult{}
+		}
+		r.Providers[id].add(counts)
+	}
+
+	if !other.OldestPost.IsZero() && (r.OldestPost.IsZero() || other.OldestPost.Before(r.OldestPost)) {
+		r.OldestPost = other.OldestPost
+	}
+}
+
+// FailureRate returns the percentage of failed segments over the total segments
+// in the NZB, or over the checked segments when the result is partial
+func (r *Result) FailureRate() float64 {
+	if r == nil {
+		return 0
+	}
+
+	total := r.TotalSegments
+	if r.Partial {
+		total = r.CheckedSegments
+	}
+	if total == 0 {
+		return 0
+	}
+
+	return float64(r.FailedSegments) * 100 / float64(total)
+}
+
+// Health returns the percentage of segments that were not found missing
+func (r *Result) Health() float64 {
+	return 100 - r.FailureRate()
+}
+
+// Payload returns the result for inclusion in plugin payloads, nil when no check ran
+func (r *Result) Payload() any {
+	if r == nil {
+		return nil
+	}
+
+	return r
+}
+
+// HookInfo returns the hook script variables describing this result
+func (r *Result) HookInfo(nzbPath string, err error) hook.Info {
+	info := hook.Info{NzbPath: nzbPath}
+	if err != nil {
+		info.Error = err.Error()
+		info.ErrorCode = string(errcode.Of(err))
+	}
+
+	if r == nil {
+		return info
+	}
+
+	info.Health = r.Health()
+	info.TotalSegments = r.TotalSegments
+	info.CheckedSegments = r.CheckedSegments
+	info.FailedSegments = r.FailedSegments
+	info.MissingSegments = r.MissingSegments
+	info.Par2Percent = r.Par2Percent
+	info.Partial = r.Partial
+	if r.Password != nil {
+		info.PasswordProtected = true
+		info.Password = r.Password.Password
+	}
+
+	return info
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/hook"
+	"github.com/javi11/nzb-touch/internal/plugin"
+)
+
+// RetentionPolicy flags NZBs whose oldest articles are about to pass the
+// retention of the providers, so they can be re-uploaded in time
+type RetentionPolicy struct {
+	Retention time.Duration // Shortest provider retention (0 disables the alerts)
+	Warning   time.Duration // How long before the retention horizon an NZB is flagged
+}
+
+// Expiring reports whether the oldest articles of the result are within the
+// warning window of the retention horizon, and how long is left until then
+func (p RetentionPolicy) Expiring(r *Result, now time.Time) (time.Duration, bool) {
+	if p.Retention <= 0 || r == nil || r.OldestPost.IsZero() {
+		return 0, false
+	}
+
+	left := r.OldestPost.Add(p.Retention).Sub(now)
+
+	return left, left <= p.Warning
+}
+
+// RetentionAlert logs, runs the retention_warning hook and dispatches the
+// retention_warning plugin event when the result is close to the retention
+// horizon. It returns whether an alert was raised.
+func RetentionAlert(ctx context.Context, policy RetentionPolicy, nzbPath string, r *Result, hooks *hook.Runner, plugins *plugin.Manager) bool {
+	left, expiring := policy.Expiring(r, time.Now())
+	if !expiring {
+		return false
+	}
+
+	daysLeft := int(left.Hours() / 24)
+	slog.WarnContext(ctx, "NZB is close to the provider retention horizon, consider re-uploading it",
+		"path", nzbPath,
+		"oldest_post", r.OldestPost,
+		"days_left", daysLeft)
+
+	info := r.HookInfo(nzbPath, nil)
+	info.RetentionDaysLeft = daysLeft
+	_ = hooks.Run(ctx, hook.EventRetentionWarning, info)
+	_ = plugins.Dispatch(ctx, plugin.Payload{Event: plugin.EventRetentionWarning, NzbPath: nzbPath, Result: r})
+
+	return true
+}
+
+// WithRetentionPolicy raises retention warnings for checked NZBs approaching the provider retention
+func WithRetentionPolicy(policy RetentionPolicy) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.retention = policy
+	}
+}
+
+// checkRetention raises a retention warning for a finished check when needed
+func (s *DirectoryScanner) checkRetention(ctx context.Context, e events.Event) {
+	result := eventResult(e)
+	if RetentionAlert(ctx, s.retention, e.Path, result, s.hooks, s.plugins) {
+		s.bus.Publish(ctx, events.Event{Type: events.RetentionWarning, Path: e.Path, Result: result})
+	}
+}
+
+// oldestPost returns the post date of the oldest file in the NZB, zero when no file is dated
+func oldestPost(nzb *nzbparser.Nzb) time.Time {
+	var oldest time.Time
+	for _, file := range nzb.Files {
+		if file.Date <= 0 {
+			continue
+		}
+
+		posted := time.Unix(int64(file.Date), 0)
+		if oldest.IsZero() || posted.Before(oldest) {
+			oldest = posted
+		}
+	}
+
+	return oldest
+}
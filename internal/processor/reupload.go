@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/reupload"
+)
+
+// reuploadPriority is the queue priority of NZBs produced by a re-upload so
+// they are verified before other pending items
+var reuploadPriority = 100
+
+// WithReuploader re-uploads the local data of failed NZBs and queues the new NZB for verification
+func WithReuploader(u *reupload.Uploader) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.reuploader = u
+	}
+}
+
+// reuploadFailed starts a re-upload for a failed check when its data is available locally
+func (s *DirectoryScanner) reuploadFailed(ctx context.Context, e events.Event) {
+	// Only re-upload NZBs whose articles are missing, not unreadable NZB files
+	if s.reuploader == nil || e.Err == nil || eventResult(e) == nil || eventResult(e).FailedSegments == 0 {
+		return
+	}
+
+	source, ok := s.reuploader.Source(e.Path)
+	if !ok {
+		slog.InfoContext(ctx, "No local data found to re-upload the NZB", "path", e.Path)
+		return
+	}
+
+	// Uploads take long, do not block the processing worker
+	go func() {
+		output, err := s.reuploader.Upload(ctx, e.Path, source)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to re-upload NZB", "path", e.Path, "source", source, "error", err)
+			return
+		}
+
+		slog.InfoContext(ctx, "Re-uploaded NZB, queued for verification", "path", e.Path, "new_nzb", output)
+		s.queue.LogFileOperation(FileWritten, output, "", "re-upload of "+e.Path)
+
+		if s.queue.Add(output) {
+			s.bus.Publish(ctx, events.Event{Type: events.NZBQueued, Path: output})
+		}
+		s.queue.SetPriority(output, reuploadPriority)
+		s.enqueue(output, reuploadPriority)
+	}()
+}
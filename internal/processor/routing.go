@@ -0,0 +1,327 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/javi11/nntppool/v2"
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+)
+
+// RoutingStrategy selects how segment requests are distributed among providers
+type RoutingStrategy string
+
+const (
+	// RoutingPool lets the connection pool pick providers in configuration order
+	RoutingPool RoutingStrategy = "pool"
+	// RoutingSpeed prefers the providers measured as fastest during the run
+	RoutingSpeed RoutingStrategy = "speed"
+	// RoutingRoundRobin sends each request to the next provider in turn
+	RoutingRoundRobin RoutingStrategy = "round_robin"
+	// RoutingLeastLoaded prefers the provider with the lowest share of its connections in use
+	RoutingLeastLoaded RoutingStrategy = "least_loaded"
+	// RoutingWeighted spreads requests among providers in proportion to their weight
+	RoutingWeighted RoutingStrategy = "weighted"
+)
+
+// ParseRoutingStrategy parses a routing strategy name, an empty name or
+// "failover" selects the pool's configuration order
+func ParseRoutingStrategy(name string) (RoutingStrategy, error) {
+	switch strategy := RoutingStrategy(name); strategy {
+	case "", "failover":
+		return RoutingPool, nil
+	case RoutingPool, RoutingSpeed, RoutingRoundRobin, RoutingLeastLoaded, RoutingWeighted:
+		return strategy, nil
+	default:
+		return RoutingPool, fmt.Errorf("unknown provider routing %q", name)
+	}
+}
+
+var (
+	// routingExploreSamples is the number of measurements taken from every
+	// provider before it is ranked by speed
+	routingExploreSamples = 5
+	// routingSmoothing is the weight of the newest sample in the moving averages
+	routingSmoothing = 0.2
+	// routingFailurePenalty is the least a request that missed or failed
+	// counts for, moving no bytes, so such providers lose their rank
+	routingFailurePenalty = 5 * time.Second
+)
+
+// providerStats holds moving averages of a provider's performance
+type providerStats struct {
+	samples    int
+	latency    float64 // Seconds per request
+	throughput float64 // Bytes per second
+	unroutable bool    // Provider cannot be selected directly (e.g. backup provider)
+	credit     int     // Smooth weighted round-robin credit
+}
+
+// providerRouter selects the provider of each request following a strategy
+type providerRouter struct {
+	mu       sync.Mutex
+	strategy RoutingStrategy
+	stats    map[string]*providerStats
+	weights  map[string]int // Provider weights in weighted routing, 1 when missing
+	next     int            // Index after the provider last picked in round-robin routing
+}
+
+func newProviderRouter(strategy RoutingStrategy) *providerRouter {
+	return &providerRouter{strategy: strategy, stats: make(map[string]*providerStats)}
+}
+
+// observe records a successful request served by a provider
+func (r *providerRouter) observe(providerID string, elapsed time.Duration, bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seconds := elapsed.Seconds()
+	throughput := 0.0
+	if seconds > 0 {
+		throughput = float64(bytes) / seconds
+	}
+
+	r.stat(providerID).sample(seconds, throughput)
+}
+
+// observeFailure records a request a provider did not have the article for
+// or failed, as a sample at least as slow as the failure penalty
+func (r *providerRouter) observeFailure(providerID string, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stat(providerID).sample(max(elapsed, routingFailurePenalty).Seconds(), 0)
+}
+
+// sample adds a measurement to the moving averages
+func (st *providerStats) sample(seconds, throughput float64) {
+	if st.samples == 0 {
+		st.latency = seconds
+		st.throughput = throughput
+	} else {
+		st.latency = routingSmoothing*seconds + (1-routingSmoothing)*st.latency
+		st.throughput = routingSmoothing*throughput + (1-routingSmoothing)*st.throughput
+	}
+	st.samples++
+}
+
+// markUnroutable excludes a provider from direct selection
+func (r *providerRouter) markUnroutable(providerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stat(providerID).unroutable = true
+}
+
+// stat returns the stats of a provider, the caller must hold the lock
+func (r *providerRouter) stat(providerID string) *providerStats {
+	st, ok := r.stats[providerID]
+	if !ok {
+		st = &providerStats{}
+		r.stats[providerID] = st
+	}
+
+	return st
+}
+
+// pick returns the active provider with a free connection selected by the routing strategy
+func (r *providerRouter) pick(providers []nntppool.ProviderInfo, mode CheckMode) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.strategy {
+	case RoutingRoundRobin:
+		return r.pickRoundRobin(providers)
+	case RoutingLeastLoaded:
+		return r.pickLeastLoaded(providers)
+	case RoutingWeighted:
+		return r.pickWeighted(providers)
+	default:
+		return r.pickFastest(providers, mode)
+	}
+}
+
+// routable reports whether a request can be sent to a provider right now,
+// the caller must hold the lock
+func (r *providerRouter) routable(info nntppool.ProviderInfo) bool {
+	return info.State == nntppool.ProviderStateActive &&
+		info.UsedConnections < info.MaxConnections &&
+		!r.stat(info.ID()).unroutable
+}
+
+// pickRoundRobin returns the next routable provider after the last one picked
+func (r *providerRouter) pickRoundRobin(providers []nntppool.ProviderInfo) (string, bool) {
+	for i := range providers {
+		idx := (r.next + i) % len(providers)
+		if r.routable(providers[idx]) {
+			r.next = idx + 1
+			return providers[idx].ID(), true
+		}
+	}
+
+	return "", false
+}
+
+// pickLeastLoaded returns the routable provider with the lowest share of its connections in use
+func (r *providerRouter) pickLeastLoaded(providers []nntppool.ProviderInfo) (string, bool) {
+	var (
+		best     string
+		bestLoad float64
+		found    bool
+	)
+
+	for _, info := range providers {
+		if !r.routable(info) {
+			continue
+		}
+
+		load := float64(info.UsedConnections) / float64(info.MaxConnections)
+		if !found || load < bestLoad {
+			best, bestLoad, found = info.ID(), load, true
+		}
+	}
+
+	return best, found
+}
+
+// pickWeighted spreads requests in proportion to the provider weights with
+// smooth weighted round-robin, so heavy providers are not picked in bursts
+func (r *providerRouter) pickWeighted(providers []nntppool.ProviderInfo) (string, bool) {
+	var (
+		best      string
+		bestStats *providerStats
+		total     int
+	)
+
+	for _, info := range providers {
+		if !r.routable(info) {
+			continue
+		}
+
+		id := info.ID()
+		weight, ok := r.weights[id]
+		if !ok {
+			weight = 1
+		}
+
+		st := r.stat(id)
+		st.credit += weight
+		total += weight
+		if bestStats == nil || st.credit > bestStats.credit {
+			best, bestStats = id, st
+		}
+	}
+
+	if bestStats == nil {
+		return "", false
+	}
+
+	bestStats.credit -= total
+
+	return best, true
+}
+
+// pickFastest returns the fastest routable provider. Providers with too few
+// samples are picked first so every provider gets measured.
+func (r *providerRouter) pickFastest(providers []nntppool.ProviderInfo, mode CheckMode) (string, bool) {
+	var (
+		best      string
+		bestStats *providerStats
+	)
+
+	for _, info := range providers {
+		if !r.routable(info) {
+			continue
+		}
+
+		id := info.ID()
+		st := r.stat(id)
+		if st.samples < routingExploreSamples {
+			return id, true
+		}
+
+		if bestStats == nil || faster(st, bestStats, mode) {
+			best, bestStats = id, st
+		}
+	}
+
+	return best, bestStats != nil
+}
+
+// faster reports whether a outperforms b for the given check mode
+func faster(a, b *providerStats, mode CheckMode) bool {
+	if mode == CheckModeStat || mode == CheckModeHead {
+		return a.latency < b.latency
+	}
+
+	return a.throughput > b.throughput
+}
+
+// routedCheck tries to verify a segment on the provider picked by the routing
+// strategy. It returns ok=false when the segment must be checked through the
+// pool instead, which also retries misses on the other providers, along with
+// the provider that did not have the article, "" when none was asked or it
+// failed otherwise.
+func (p *Processor) routedCheck(ctx context.Context, segmentID string, groups []string) (bytes int64, ok bool, missedIn string) {
+	providers := p.nntpClient.GetProvidersInfo()
+	// Providers that cannot be used are never picked, so the strategy keeps
+	// spreading the checks over the others
+	excluded := slices.Concat(p.usage.Stopped(), p.notCarrying(groups), p.unscheduled())
+	candidates := p.activeTier(slices.DeleteFunc(p.logicalProviders(providers), func(info nntppool.ProviderInfo) bool {
+		return slices.Contains(excluded, info.ID())
+	}))
+	providerID, found := p.router.pick(candidates, p.checkMode)
+	if !found {
+		return 0, false, ""
+	}
+
+	// The pool picks among the accounts of the chosen provider
+	skip := make([]string, 0, len(providers)-1)
+	for _, info := range providers {
+		if p.logical(info.ID()) != providerID {
+			skip = append(skip, info.ID())
+		}
+	}
+
+	conn, err := p.nntpClient.GetConnection(ctx, skip, false)
+	if err != nil {
+		if errors.Is(err, nntppool.ErrArticleNotFoundInProviders) {
+			// No provider matched the selection, it is a backup provider
+			p.router.markUnroutable(providerID)
+		}
+
+		return 0, false, ""
+	}
+
+	if err := p.waitProvider(ctx, providerID); err != nil {
+		_ = conn.Free()
+		return 0, false, ""
+	}
+
+	start := time.Now()
+	bytes, err = p.checkOnConnection(conn.Connection(), segmentID, groups)
+	p.releaseConnection(conn, err)
+	p.providerSpeeds[providerID].take(bytes)
+	p.recordOutcome(providerID, err)
+	tallyRequest(ctx, providerID, bytes, err)
+	p.usage.Record(providerID, bytes, err == nil)
+	if err != nil && ctx.Err() == nil {
+		p.router.observeFailure(providerID, time.Since(start))
+	}
+	if nntpcli.IsArticleNotFoundError(err) {
+		p.groupStats.Record(groups, providerID, true)
+		return 0, false, providerID
+	}
+	if err != nil {
+		return 0, false, ""
+	}
+
+	p.router.observe(providerID, time.Since(start), bytes)
+	p.groupStats.Record(groups, providerID, false)
+
+	return bytes, true, ""
+}
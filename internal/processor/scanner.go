@@ -1,31 +1,140 @@
 package processor
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
 	"io/fs"
 	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/javi11/nzb-touch/internal/category"
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/feed"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+	"github.com/javi11/nzb-touch/internal/handoff"
+	"github.com/javi11/nzb-touch/internal/hook"
 	"github.com/javi11/nzb-touch/internal/nzb"
+	"github.com/javi11/nzb-touch/internal/plugin"
+	"github.com/javi11/nzb-touch/internal/progress"
+	"github.com/javi11/nzb-touch/internal/reupload"
+	"github.com/javi11/nzb-touch/internal/rules"
+	"github.com/javi11/nzb-touch/internal/schedule"
 	"github.com/opencontainers/selinux/pkg/pwalkdir"
 )
 
 // DirectoryScanner handles scanning directories for NZB files
 type DirectoryScanner struct {
-	queue             *Queue
-	processor         *Processor
-	watchDirs         []string
-	interval          time.Duration
-	maxFilesPerDay    int
-	reprocessInterval time.Duration
-	failedDirectory   string
-	checkPercent      int
-	missingPercent    int
-	processingQueue   chan string
-	stopChan          chan struct{}
+	queue                    *Queue
+	processor                *Processor
+	watchDirs                []string
+	interval                 time.Duration
+	scanSchedules            []schedule.Cron // Times of the directory scans, replacing interval when set
+	maxFilesPerDay           int
+	reprocessInterval        time.Duration
+	failedDirectory          string
+	collisionPolicy          CollisionPolicy // What happens when a moved NZB lands on an existing file
+	checkOptions             CheckOptions
+	plugins                  *plugin.Manager
+	hooks                    *hook.Runner
+	rules                    []rules.Rule
+	bus                      *events.Bus
+	retention                RetentionPolicy
+	takedownDrop             float64 // Health drop between checks reported as a takedown
+	reuploader               *reupload.Uploader
+	usenetDrive              bool          // Check companion NZBs with their main NZB and never relocate files
+	companionExts            []string      // Inner extensions of companion NZBs
+	archiveDirectory         string        // Where pruned items are archived, deleted when empty
+	tagPasswords             bool          // Mark password protected NZBs in the queue
+	skipDuplicates           bool          // Skip NZBs with the same content as a queued file
+	minPostAge               time.Duration // Articles younger than this are not checked yet
+	outageRetry              time.Duration // Pause while every provider is unreachable
+	feeds                    *feed.Watcher
+	ipcSocket                string // Unix socket accepting NZBs from local tools
+	submitDirectory          string // Where NZBs uploaded over the socket or the API are saved
+	categories               []category.Category
+	quotaMu                  sync.Mutex
+	quotaReachedDay          string // Day for which QuotaReached was last published
+	bandwidthLimit           BandwidthLimit
+	bandwidthExhaustedPeriod string // Start of the period for which BandwidthExhausted was last published
+	processingQueue          chan string
+	priorityQueue            chan string // Files with a positive priority, drained before processingQueue
+	stopChan                 chan struct{}
+	rescanChan               chan struct{} // Immediate scans requested outside the interval
+	pauseMu                  sync.Mutex
+	resumed                  chan struct{} // Closed on resume, nil while the scanner is running
+	minWorkers               int           // Workers kept while the queue is idle
+	maxWorkers               int           // Workers started when the queue is deep
+	workers                  atomic.Int32  // Running processing workers
+	shrinkChan               chan struct{}
+	jobs                     *jobBoard // Checks handed to checker nodes, nil unless the role is RoleScanner
+	progress                 *progress.Tracker
+	inFlightMu               sync.Mutex
+	inFlight                 map[string]time.Time // Files sent to the workers and not processed yet, with when they were sent
+	refreshChan              chan struct{}        // Library refreshes requested
+	refreshMu                sync.Mutex
+	refreshRate              int64         // Average bytes per second of the library refresh (0 = no cap)
+	refreshing               string        // Item of the library refresh being checked
+	refreshBytes             int64         // Bytes downloaded by the refresh check in progress
+	trashDirectory           string        // Where deleted NZBs are kept, empty to delete them
+	trashRetention           time.Duration // How long trashed NZBs can be restored
+	successActions           []handoff.Action
+	touchMtime               bool   // Set the modification time of NZBs passing their check
+	touchXattr               string // Extended attribute receiving the verification time, empty to disable
+	verifiedView             string // Tree of symlinks to the NZBs whose latest check passed, empty to disable
+	viewMu                   sync.Mutex
+	reports                  bool   // Write a JSON report of every check
+	reportDirectory          string // Where the reports are written, next to the NZBs when empty
+	liveMu                   sync.Mutex
+	live                     map[*liveCheck]struct{} // Checks in progress, shown by the API
+}
+
+// ScannerOption configures optional behaviour of a DirectoryScanner
+type ScannerOption func(*DirectoryScanner)
+
+// WithPlugins sets the plugins invoked around each NZB check
+func WithPlugins(plugins *plugin.Manager) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.plugins = plugins
+	}
+}
+
+// WithHooks sets the hook scripts executed around each NZB check
+func WithHooks(hooks *hook.Runner) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.hooks = hooks
+	}
+}
+
+// WithRules sets the rules evaluated after each NZB check
+func WithRules(r []rules.Rule) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.rules = r
+	}
+}
+
+// WithEventBus sets the bus on which scanner events are published
+func WithEventBus(bus *events.Bus) ScannerOption {
+	return func(s *DirectoryScanner) {
+		if bus != nil {
+			s.bus = bus
+		}
+	}
+}
+
+// WithScanSchedules scans the directories at the times of the cron
+// expressions instead of at the scan interval
+func WithScanSchedules(crons []schedule.Cron) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.scanSchedules = crons
+	}
 }
 
 // NewDirectoryScanner creates a new directory scanner
@@ -38,8 +147,8 @@ func NewDirectoryScanner(
 	dbPath string,
 	reprocessInterval time.Duration,
 	failedDirectory string,
-	checkPercent int,
-	missingPercent int,
+	checkOptions CheckOptions,
+	opts ...ScannerOption,
 ) (*DirectoryScanner, error) {
 	if concurrentProcessing <= 0 {
 		concurrentProcessing = 1
@@ -51,7 +160,7 @@ func NewDirectoryScanner(
 		return nil, err
 	}
 
-	return &DirectoryScanner{
+	s := &DirectoryScanner{
 		queue:             queue,
 		processor:         processor,
 		watchDirs:         watchDirs,
@@ -59,31 +168,126 @@ func NewDirectoryScanner(
 		maxFilesPerDay:    maxFilesPerDay,
 		reprocessInterval: reprocessInterval,
 		failedDirectory:   failedDirectory,
-		checkPercent:      checkPercent,
-		missingPercent:    missingPercent,
+		checkOptions:      checkOptions,
 		processingQueue:   make(chan string, concurrentProcessing),
+		priorityQueue:     make(chan string, concurrentProcessing),
 		stopChan:          make(chan struct{}),
-	}, nil
+		rescanChan:        make(chan struct{}, 1),
+		bus:               events.NewBus(),
+		minWorkers:        concurrentProcessing,
+		maxWorkers:        concurrentProcessing,
+		shrinkChan:        make(chan struct{}),
+		inFlight:          make(map[string]time.Time),
+		live:              make(map[*liveCheck]struct{}),
+		refreshChan:       make(chan struct{}, 1),
+		takedownDrop:      takedownDropDefault,
+		outageRetry:       outageRetryIntervalDefault,
+		progress:          progress.NewTracker(),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.minWorkers > s.maxWorkers {
+		s.minWorkers = s.maxWorkers
+	}
+
+	// The file log records what happened before any reaction moves the file
+	s.bus.Subscribe(s.logFileEvent, events.NZBQueued, events.CheckFinished)
+	s.bus.Subscribe(s.countRefreshBytes, events.CheckFinished)
+	s.bus.Subscribe(s.recordProgress, events.CheckFinished)
+	s.bus.Subscribe(s.recordBandwidth, events.CheckFinished)
+	s.bus.Subscribe(s.writeReport, events.CheckFinished)
+
+	// Plugins, hooks and rules react to finished checks, in this order
+	s.bus.Subscribe(s.tagPassword, events.CheckFinished)
+	s.bus.Subscribe(s.notifyPlugins, events.CheckFinished)
+	s.bus.Subscribe(s.runHooks, events.CheckFinished)
+	s.bus.Subscribe(s.checkRetention, events.CheckFinished)
+	s.bus.Subscribe(s.detectDegradation, events.CheckFinished)
+	s.bus.Subscribe(s.reuploadFailed, events.CheckFinished)
+	s.bus.Subscribe(s.handOff, events.CheckFinished)
+	s.bus.Subscribe(s.applyRules, events.CheckFinished)
+	s.bus.Subscribe(s.touchVerified, events.CheckFinished)
+	s.bus.Subscribe(s.updateVerifiedView, events.CheckFinished)
+
+	return s, nil
+}
+
+// Events returns the bus on which the scanner publishes its events
+func (s *DirectoryScanner) Events() *events.Bus {
+	return s.bus
 }
 
-// Start begins scanning directories at the configured interval
+// Start begins scanning directories at the configured interval or scan schedules
 func (s *DirectoryScanner) Start(ctx context.Context) error {
-	// Start processor workers
-	for i := 0; i < cap(s.processingQueue); i++ {
-		go s.processFiles(ctx)
+	// Open the ingestion socket first so a bad path fails the start
+	if s.ipcSocket != "" {
+		ln, err := s.listenIPC()
+		if err != nil {
+			return fmt.Errorf("failed to open ingestion socket %s: %w", s.ipcSocket, err)
+		}
+		go s.serveIPC(ctx, ln)
+	}
+
+	// Check again the items a previous run stopped in the middle of
+	s.recoverInterrupted(ctx)
+
+	// Hold the files being checked while other instances share the queue
+	go s.renewLeases(ctx)
+
+	// Start processor workers, more are added while the queue is deep
+	for i := 0; i < s.minWorkers; i++ {
+		s.startWorker(ctx)
+	}
+
+	if s.minWorkers < s.maxWorkers {
+		go s.runWorkerScaler(ctx)
+	}
+
+	// Checker nodes talk to the providers of scanner nodes
+	if s.jobs == nil {
+		// Publish provider state changes
+		go s.processor.watchProviders(ctx, s.bus, providerWatchInterval)
+
+		// Alert when a provider keeps failing
+		go s.watchProviderErrors(ctx)
+
+		// Keep idle connections alive and drop the dead ones during long runs
+		s.processor.runHealthChecks(ctx)
+
+		// Leave the host and its network to other work while they are busy
+		s.processor.runLoadThrottle(ctx)
+	}
+
+	// Queue the NZBs found in indexer feeds as they are downloaded
+	if s.feeds != nil {
+		go s.feeds.Run(ctx, s.queue.Contains, s.feedDownloaded)
 	}
 
+	// Re-check the whole library while the queue is idle once a refresh is requested
+	go s.runRefresh(ctx)
+
+	// Log how far the backlog got and when it should be done
+	go progress.Log(ctx, progressLogInterval, "Backlog progress", s.Progress)
+
 	// Run initial scan
 	s.scanDirectories(ctx)
 
-	// Setup ticker for periodic scans
-	ticker := time.NewTicker(s.interval)
-	defer ticker.Stop()
+	// Setup timer for periodic scans
+	timer := time.NewTimer(s.untilNextScan())
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-timer.C:
+			s.scanDirectories(ctx)
+			timer.Reset(s.untilNextScan())
+		case <-s.rescanChan:
+			slog.InfoContext(ctx, "Immediate scan requested")
 			s.scanDirectories(ctx)
+			timer.Reset(s.untilNextScan())
 		case <-s.stopChan:
 			return nil
 		case <-ctx.Done():
@@ -92,6 +296,34 @@ func (s *DirectoryScanner) Start(ctx context.Context) error {
 	}
 }
 
+// untilNextScan returns the time left before the next periodic scan, the
+// next time of the scan schedules when there are any
+func (s *DirectoryScanner) untilNextScan() time.Duration {
+	if len(s.scanSchedules) == 0 {
+		return s.interval
+	}
+
+	next := schedule.NextOf(s.scanSchedules, time.Now())
+	if next.IsZero() {
+		// No scheduled time is left, only requested scans run
+		return math.MaxInt64
+	}
+
+	return time.Until(next)
+}
+
+// TriggerScan requests a directory scan outside the regular interval, which
+// then restarts from the end of that scan. It returns false when a requested
+// scan has not started yet.
+func (s *DirectoryScanner) TriggerScan() bool {
+	select {
+	case s.rescanChan <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
 // Stop stops the scanner and closes the database connection
 func (s *DirectoryScanner) Stop() {
 	close(s.stopChan)
@@ -106,15 +338,18 @@ func (s *DirectoryScanner) scanDirectories(ctx context.Context) {
 
 	// Scan watched directories for new files
 	for _, dir := range s.watchDirs {
-		err := pwalkdir.Walk(dir, func(path string, info fs.DirEntry, err error) error {
-			// Check for errors or context cancellation
-			if err != nil {
-				return err
-			}
+		// Walked in the extended-length form on Windows, deep trees are not skipped
+		err := pwalkdir.Walk(fsutil.LongPath(dir), func(path string, info fs.DirEntry, err error) error {
 			if ctx.Err() != nil {
 				return ctx.Err()
 			}
 
+			// An unreadable entry is reported and skipped, the rest of the tree is still scanned
+			if err != nil {
+				slog.WarnContext(ctx, "Skipping unreadable path", "path", normalizePath(path), "error", err)
+				return nil
+			}
+
 			// Skip directories
 			if info.IsDir() {
 				return nil
@@ -125,29 +360,19 @@ func (s *DirectoryScanner) scanDirectories(ctx context.Context) {
 				return nil
 			}
 
-			// Check if file is already in queue
+			// Check if file is already in queue, possibly under another spelling
+			path = s.canonicalPath(ctx, path)
 			if s.queue.Contains(path) {
 				return nil
 			}
 
-			// Add file to queue
-			if s.queue.Add(path) {
-				slog.InfoContext(ctx, "Found new NZB file", "path", path)
-
-				// Check if we're under the daily limit
-				if s.queue.GetProcessedToday() < s.maxFilesPerDay {
-					// Send to processing queue
-					select {
-					case s.processingQueue <- path:
-						slog.InfoContext(ctx, "Queued file for processing", "path", path)
-					default:
-						slog.InfoContext(ctx, "Processing queue is full, file will be processed later", "path", path)
-					}
-				} else {
-					slog.InfoContext(ctx, "Daily processing limit reached, file will be processed tomorrow", "path", path)
-				}
+			// Companion NZBs are checked together with their main NZB
+			if s.checkedWithMain(path) {
+				return nil
 			}
 
+			s.queueFile(ctx, path)
+
 			return nil
 		})
 
@@ -156,24 +381,115 @@ func (s *DirectoryScanner) scanDirectories(ctx context.Context) {
 		}
 	}
 
+	// Send items left pending by previous scans
+	s.dispatchPending(ctx)
+
 	// Check for items that need reprocessing
-	if s.reprocessInterval > 0 {
+	if s.shortestReprocessInterval() > 0 {
 		s.checkForReprocessItems(ctx)
 	}
 
 	// Clean up old processed items (keep for 30 days)
-	pruned := s.queue.PruneOldItems(30 * 24 * time.Hour)
-	if pruned > 0 {
+	if s.archiveDirectory != "" {
+		archived, err := s.queue.ArchiveOldItems(30*24*time.Hour, s.archiveDirectory)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to archive old items, keeping them in the queue", "dir", s.archiveDirectory, "error", err)
+		} else if archived > 0 {
+			slog.InfoContext(ctx, "Archived old items from queue", "count", archived, "dir", s.archiveDirectory)
+		}
+	} else if pruned := s.queue.PruneOldItems(30 * 24 * time.Hour); pruned > 0 {
 		slog.InfoContext(ctx, "Pruned old items from queue", "count", pruned)
 	}
 
+	if s.trashDirectory != "" {
+		s.purgeTrash(ctx)
+	}
+
+	if s.verifiedView != "" {
+		s.syncVerifiedView(ctx)
+	}
+
 	slog.InfoContext(ctx, "Directory scan completed")
 }
 
+// queueFile adds a new NZB to the queue with the priority it asks for, see
+// filePriority, and sends it to the workers while under the daily limit
+func (s *DirectoryScanner) queueFile(ctx context.Context, path string) {
+	s.queueFileWithPriority(ctx, path, filePriority(ctx, path))
+}
+
+// queueFileWithPriority queues a new NZB ahead of the items with a lower priority
+func (s *DirectoryScanner) queueFileWithPriority(ctx context.Context, path string, priority int) {
+	path = s.canonicalPath(ctx, path)
+
+	var hash string
+	if s.skipDuplicates && !s.queue.Contains(path) {
+		var duplicate bool
+		if hash, duplicate = s.skipDuplicate(ctx, path); duplicate {
+			return
+		}
+	}
+
+	if !s.queue.Add(path) {
+		return
+	}
+
+	if hash != "" {
+		s.queue.SetContentHash(path, hash)
+	}
+
+	if priority != 0 {
+		s.queue.SetPriority(path, priority)
+	}
+
+	slog.InfoContext(ctx, "Found new NZB file", "path", path, "priority", priority)
+	s.bus.Publish(ctx, events.Event{Type: events.NZBQueued, Path: path})
+
+	// Check if we're under the daily limit and the bandwidth budget
+	if s.limitReached(ctx) {
+		slog.InfoContext(ctx, "Processing limit reached, file will be processed in the next period", "path", path)
+		return
+	}
+
+	// Send to processing queue
+	if s.enqueue(path, priority) {
+		slog.InfoContext(ctx, "Queued file for processing", "path", path)
+	} else {
+		slog.InfoContext(ctx, "Processing queue is full, file will be processed later", "path", path)
+	}
+}
+
+// dailyLimitReached reports whether the daily processing limit was reached,
+// publishing QuotaReached the first time it happens each day
+func (s *DirectoryScanner) dailyLimitReached(ctx context.Context) bool {
+	if s.queue.GetProcessedToday() < s.maxFilesPerDay {
+		return false
+	}
+
+	today := time.Now().Format(time.DateOnly)
+
+	s.quotaMu.Lock()
+	alreadyPublished := s.quotaReachedDay == today
+	s.quotaReachedDay = today
+	s.quotaMu.Unlock()
+
+	if !alreadyPublished {
+		s.bus.Publish(ctx, events.Event{Type: events.QuotaReached})
+	}
+
+	return true
+}
+
 // checkForReprocessItems checks for items that need to be reprocessed
 func (s *DirectoryScanner) checkForReprocessItems(ctx context.Context) {
-	// Get items that are due for reprocessing
-	itemsToReprocess := s.queue.GetItemsDueForReprocessing(s.reprocessInterval)
+	// Get items that are due for reprocessing, following the interval of their category
+	var itemsToReprocess []*QueueItem
+	for _, item := range s.queue.GetItemsDueForReprocessing(s.shortestReprocessInterval()) {
+		interval := s.reprocessIntervalFor(item.Category)
+		if interval > 0 && item.ProcessedAt.Before(time.Now().Add(-interval)) {
+			itemsToReprocess = append(itemsToReprocess, item)
+		}
+	}
 
 	if len(itemsToReprocess) == 0 {
 		return
@@ -183,8 +499,8 @@ func (s *DirectoryScanner) checkForReprocessItems(ctx context.Context) {
 
 	// Check daily limit
 	availableSlots := s.maxFilesPerDay - s.queue.GetProcessedToday()
-	if availableSlots <= 0 {
-		slog.InfoContext(ctx, "Daily processing limit reached, items will be reprocessed tomorrow")
+	if s.limitReached(ctx) {
+		slog.InfoContext(ctx, "Processing limit reached, items will be reprocessed in the next period")
 		return
 	}
 
@@ -196,7 +512,7 @@ func (s *DirectoryScanner) checkForReprocessItems(ctx context.Context) {
 	// Queue items for reprocessing
 	for _, item := range itemsToReprocess {
 		// Check that the file still exists
-		if _, err := os.Stat(item.FilePath); os.IsNotExist(err) {
+		if _, err := os.Stat(fsutil.DiskPath(item.FilePath)); os.IsNotExist(err) {
 			slog.InfoContext(ctx, "File no longer exists, skipping reprocessing", "path", item.FilePath)
 			continue
 		}
@@ -207,10 +523,7 @@ func (s *DirectoryScanner) checkForReprocessItems(ctx context.Context) {
 			"process_count", item.ProcessCount)
 
 		// Send to processing queue
-		select {
-		case s.processingQueue <- item.FilePath:
-			// Successfully queued
-		default:
+		if !s.enqueue(item.FilePath, item.Priority) {
 			// Queue is full, stop adding more
 			slog.InfoContext(ctx, "Processing queue is full, remaining items will be reprocessed later")
 			return
@@ -222,145 +535,296 @@ func (s *DirectoryScanner) checkForReprocessItems(ctx context.Context) {
 
 // processFiles is a worker that processes files from the queue
 func (s *DirectoryScanner) processFiles(ctx context.Context) {
-	for {
-		select {
-		case filePath := <-s.processingQueue:
-			// Skip if we've hit the daily limit
-			if s.queue.GetProcessedToday() >= s.maxFilesPerDay {
-				slog.InfoContext(ctx, "Daily processing limit reached, skipping file", "path", filePath)
-				continue
-			}
+	defer s.workers.Add(-1)
 
-			// Process the file
-			err := s.processFile(ctx, filePath)
-			if err != nil {
-				slog.ErrorContext(ctx, "Error processing file", "path", filePath, "error", err)
-
-				// Move the failed file to the failed directory if configured
-				if s.failedDirectory != "" {
-					if moveErr := s.moveToFailedDirectory(filePath); moveErr != nil {
-						slog.ErrorContext(ctx, "Failed to move file to failed directory",
-							"path", filePath,
-							"target_dir", s.failedDirectory,
-							"error", moveErr)
-					}
-				}
-			}
-
-			// Mark as processed regardless of success
-			// This prevents retrying files that cause errors
-			s.queue.MarkProcessed(filePath)
-
-		case <-s.stopChan:
+	for {
+		filePath, ok := s.nextFile(ctx)
+		if !ok {
 			return
-		case <-ctx.Done():
+		}
+
+		// Hold the file while the scanner is paused
+		if !s.waitResumed(ctx) {
+			s.done(filePath)
 			return
 		}
-	}
-}
 
-// moveToFailedDirectory moves a failed NZB file to the configured failed directory
-// preserving the original directory structure
-func (s *DirectoryScanner) moveToFailedDirectory(filePath string) error {
-	// If failed directory not configured, just return
-	if s.failedDirectory == "" {
-		return nil
-	}
+		// Skip if we've hit the daily limit or the bandwidth budget
+		if s.limitReached(ctx) {
+			slog.InfoContext(ctx, "Processing limit reached, skipping file", "path", filePath)
+			s.done(filePath)
+			continue
+		}
 
-	// Create the failed directory if it doesn't exist
-	if err := os.MkdirAll(s.failedDirectory, 0755); err != nil {
-		return err
-	}
+		// Leave fresh releases pending until their articles propagated
+		if s.postponeYoung(ctx, filePath) {
+			s.done(filePath)
+			continue
+		}
 
-	// Find the base watch directory containing this file
-	var basePath string
-	for _, watchDir := range s.watchDirs {
-		absWatchDir, err := filepath.Abs(watchDir)
-		if err != nil {
+		// Claim the file, it is found processing after a crash mid-check. Another
+		// instance sharing the queue may be checking it, or have checked it since
+		if !s.queue.Start(filePath, s.queuedAt(filePath)) {
+			slog.DebugContext(ctx, "File is not queued, already processing or checked by another instance, skipping", "path", filePath)
+			s.done(filePath)
 			continue
 		}
 
-		absFilePath, err := filepath.Abs(filePath)
-		if err != nil {
+		// Process the file under its spelling on disk, the queue stores the normal form
+		diskPath := fsutil.DiskPath(filePath)
+		err := s.processFile(ctx, diskPath)
+
+		// A check interrupted by the shutdown stays processing and is recovered on the next start
+		if ctx.Err() != nil {
+			s.done(filePath)
+			return
+		}
+
+		// An outage says nothing about the NZB, check it again once the providers
+		// are back. A checker node pauses itself, the others keep checking.
+		if errors.Is(err, ErrProvidersDown) {
+			s.queue.Requeue(filePath)
+			s.done(filePath)
+			if s.jobs == nil {
+				s.pauseForOutage(ctx, err)
+			}
 			continue
 		}
 
-		if strings.HasPrefix(absFilePath, absWatchDir) {
-			basePath = absWatchDir
-			break
+		// A rejected NZB is offered again on the next scan
+		if errors.Is(err, errVetoed) {
+			s.queue.Requeue(filePath)
+			s.done(filePath)
+			continue
 		}
-	}
 
-	// If we couldn't find a matching watch directory, just use the file name
-	var targetPath string
-	if basePath != "" {
-		// Get the relative path from the watch directory
-		absFilePath, _ := filepath.Abs(filePath)
-		relPath, err := filepath.Rel(basePath, absFilePath)
 		if err != nil {
-			// Fall back to just the file name if we can't get the relative path
-			relPath = filepath.Base(filePath)
+			slog.ErrorContext(ctx, "Error processing file", "path", diskPath, "error", err)
+			s.moveFailed(ctx, diskPath)
 		}
 
-		// Create the target path with the relative structure
-		targetPath = filepath.Join(s.failedDirectory, relPath)
-	} else {
-		// Just use the file name
-		targetPath = filepath.Join(s.failedDirectory, filepath.Base(filePath))
+		// Mark as processed regardless of success
+		// This prevents retrying files that cause errors
+		s.queue.Finish(filePath, err != nil)
+		s.done(filePath)
 	}
+}
 
-	// Create parent directories if needed
-	targetDir := filepath.Dir(targetPath)
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return err
+// moveFailed moves a failed file to the failed directory if configured and it
+// was not already moved or deleted by a rule. Files of usenet-drive libraries
+// are never moved, it breaks the mount.
+func (s *DirectoryScanner) moveFailed(ctx context.Context, filePath string) {
+	failedDir := s.failedDirectoryFor(filePath)
+	if _, statErr := os.Stat(filePath); failedDir == "" || s.usenetDrive || statErr != nil {
+		return
 	}
 
-	// Move the file
-	if err := os.Rename(filePath, targetPath); err != nil {
-		// If rename fails (e.g., across different filesystems), try copy and delete
-		if err := copyFile(filePath, targetPath); err != nil {
-			return err
-		}
+	if _, err := s.moveToDirectory(filePath, failedDir, "failed check"); err != nil {
+		slog.ErrorContext(ctx, "Failed to move file to failed directory",
+			"path", filePath,
+			"target_dir", failedDir,
+			"error", err)
+	}
+}
 
-		// Delete original after successful copy
-		return os.Remove(filePath)
+// moveToDirectory moves an NZB file into targetRoot preserving its path
+// relative to the watch directory it was found in, reason is recorded in the
+// file log. It returns where the file is now.
+func (s *DirectoryScanner) moveToDirectory(filePath string, targetRoot string, reason string) (string, error) {
+	// Create the target directory if it doesn't exist
+	if err := os.MkdirAll(targetRoot, 0755); err != nil {
+		return filePath, err
 	}
 
-	slog.Info("Moved failed NZB file", "from", filePath, "to", targetPath)
-	return nil
-}
+	targetPath := filepath.Join(targetRoot, s.watchRelative(filePath))
+	targetPath, ok := resolveCollision(s.collisionPolicy, targetRoot, targetPath, time.Now())
+	if !ok {
+		slog.Warn("Target path already exists, leaving the NZB in place", "path", filePath, "target_dir", targetRoot)
+		return filePath, nil
+	}
 
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
+	// Move the file, across filesystems the copy is verified before the original is removed
+	if err := fsutil.Move(filePath, targetPath); err != nil {
+		return filePath, err
 	}
-	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
-	if err != nil {
-		return err
+	// Remember where the file went so it can be found later
+	s.queue.SetMovedTo(filePath, targetPath)
+	s.queue.LogFileOperation(FileMoved, filePath, targetPath, reason)
+	if s.trashDirectory != "" {
+		s.queue.AddTrash(FileMoved, filePath, targetPath, reason)
 	}
-	defer destFile.Close()
 
-	_, err = destFile.ReadFrom(sourceFile)
-	return err
+	slog.Info("Moved NZB file", "from", filePath, "to", targetPath)
+	return targetPath, nil
 }
 
+// watchRelative returns the path of a file relative to the watch directory
+// it was found in, or its name when it is outside every watch directory
+func (s *DirectoryScanner) watchRelative(filePath string) string {
+	for _, watchDir := range s.watchDirs {
+		if relPath, ok := fsutil.RelativePath(watchDir, filePath); ok && relPath != "." {
+			return relPath
+		}
+	}
+
+	return filepath.Base(filePath)
+}
+
+// errVetoed is returned by processFile when a pre-check plugin or hook
+// rejected the NZB, which stays pending without counting as checked
+var errVetoed = errors.New("rejected before the check")
+
 // processFile processes a single NZB file
 func (s *DirectoryScanner) processFile(ctx context.Context, filePath string) error {
 	slog.InfoContext(ctx, "Processing NZB file", "path", filePath)
 
+	// Only an explicit rejection skips the check, a failing plugin was logged
+	if err := s.plugins.Dispatch(ctx, plugin.Payload{Event: plugin.EventPreCheck, NzbPath: filePath}); errors.Is(err, plugin.ErrRejected) {
+		slog.InfoContext(ctx, "Pre-check plugin rejected file, skipping", "path", filePath)
+		return errVetoed
+	}
+
+	if err := s.hooks.Run(ctx, hook.EventPreCheck, hook.Info{NzbPath: filePath}); errors.Is(err, hook.ErrRejected) {
+		slog.InfoContext(ctx, "Pre-check hook rejected file, skipping", "path", filePath)
+		return errVetoed
+	}
+
+	s.bus.Publish(ctx, events.Event{Type: events.CheckStarted, Path: filePath})
+
 	// Load and parse NZB file
 	nzbData, err := nzb.LoadFromFile(filePath)
 	if err != nil {
+		s.bus.Publish(ctx, events.Event{Type: events.CheckFinished, Path: filePath, Err: err})
 		return err
 	}
 
 	// Display NZB information
 	nzbData.PrintInfo()
 
-	// Process the NZB file
-	return s.processor.ProcessNZB(ctx, nzbData.Nzb, s.checkPercent, s.missingPercent)
+	// Process the NZB file with the settings of its category
+	cat := category.Infer(s.categories, s.watchDirs, filePath, nzbData.Nzb.Meta)
+	if cat != nil {
+		slog.InfoContext(ctx, "NZB category", "path", filePath, "category", cat.Name)
+		s.queue.SetCategory(filePath, cat.Name)
+	}
+
+	opts := CategoryCheckOptions(s.checkOptions, cat)
+	opts.Source = filePath
+	checkCtx, done := s.followCheck(ctx, filePath)
+	result, err := s.check(checkCtx, filePath, nzbData, opts)
+	err = s.checkCompanions(checkCtx, filePath, opts, result, err)
+	done()
+	if errors.Is(err, ErrProvidersDown) {
+		return err
+	}
+	s.bus.Publish(ctx, events.Event{Type: events.CheckFinished, Path: filePath, Result: result.Payload(), Err: err})
+
+	return err
+}
+
+// eventResult extracts the check result carried by an event
+func eventResult(e events.Event) *Result {
+	result, _ := e.Result.(*Result)
+	return result
+}
+
+// notifyPlugins dispatches the post-check plugin events for a finished check
+func (s *DirectoryScanner) notifyPlugins(ctx context.Context, e events.Event) {
+	s.plugins.DispatchResult(ctx, e.Path, eventResult(e).Payload(), e.Err)
+}
+
+// runHooks runs the post-check hook scripts for a finished check
+func (s *DirectoryScanner) runHooks(ctx context.Context, e events.Event) {
+	s.hooks.RunResult(ctx, eventResult(e).HookInfo(e.Path, e.Err))
+}
+
+// applyRules evaluates the configured rules against a finished check and runs the matching actions
+func (s *DirectoryScanner) applyRules(ctx context.Context, e events.Event) {
+	if len(s.rules) == 0 {
+		return
+	}
+
+	// filePath follows the NZB as actions move it, empty once it is deleted.
+	// The queue keeps it under e.Path.
+	filePath := e.Path
+	result := eventResult(e)
+	checkErr := e.Err
+
+	facts := rules.Facts{
+		Path:     filePath,
+		Category: filepath.Base(filepath.Dir(filePath)),
+		Health:   result.Health(),
+		Failed:   checkErr != nil,
+	}
+	// An NZB that could not be checked at all has no health
+	if result == nil && checkErr != nil {
+		facts.Health = 0
+	}
+	if info, err := os.Stat(filePath); err == nil {
+		facts.ModTime = info.ModTime()
+	}
+
+	// The queue is updated after the rules ran, count the current check in
+	now := time.Now()
+	if checkErr != nil {
+		facts.FailedChecks, facts.FailingSince = s.queue.FailureStreak(e.Path)
+		facts.FailedChecks++
+		if facts.FailingSince.IsZero() {
+			facts.FailingSince = now
+		}
+	}
+
+	for _, match := range rules.Evaluate(s.rules, facts, now) {
+		action := match.Action
+		slog.InfoContext(ctx, "Applying rule action",
+			"rule", match.Rule,
+			"action", action.Type,
+			"path", cmp.Or(filePath, e.Path),
+			"failed_checks", facts.FailedChecks)
+
+		var err error
+		switch action.Type {
+		case rules.ActionMove, rules.ActionDelete:
+			if s.usenetDrive {
+				slog.WarnContext(ctx, "Skipping rule action, files of usenet-drive libraries are never moved or deleted",
+					"rule", match.Rule,
+					"action", action.Type,
+					"path", filePath)
+				continue
+			}
+
+			if filePath == "" {
+				slog.WarnContext(ctx, "Skipping rule action, the NZB was deleted by a previous action",
+					"rule", match.Rule,
+					"action", action.Type,
+					"path", e.Path)
+				continue
+			}
+
+			if action.Type == rules.ActionMove {
+				filePath, err = s.moveToDirectory(filePath, action.Target, "rule "+match.Rule)
+			} else {
+				filePath, err = s.deleteFile(filePath, "rule "+match.Rule)
+			}
+		case rules.ActionNotify, rules.ActionResearch:
+			nzbPath := cmp.Or(filePath, e.Path)
+			info := result.HookInfo(nzbPath, checkErr)
+			info.FailedChecks = facts.FailedChecks
+			info.FailingSince = facts.FailingSince
+			info.ConfirmedDead = match.Escalation
+			// Rule commands get the NZB path as their argument
+			err = hook.Exec(ctx, action.Target, 0, hook.EventRule, info, nzbPath)
+		case rules.ActionPriority:
+			s.queue.SetPriority(e.Path, action.Priority)
+		}
+
+		if err != nil {
+			slog.ErrorContext(ctx, "Rule action failed",
+				"rule", match.Rule,
+				"action", action.Type,
+				"path", cmp.Or(filePath, e.Path),
+				"error", err)
+		}
+	}
 }
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"strings"
+
+	"github.com/Tensai75/nzbparser"
+)
+
+// messageIDKey identifies a message-id regardless of surrounding spaces and
+// angle brackets, which posters are inconsistent about
+func messageIDKey(id string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(id), "<"), ">")
+}
+
+// uniqueSegments returns a copy of the NZB in which every message-id appears
+// once, keeping its first occurrence, and the number of segments dropped. The
+// parser already merges repeats within a file, this catches the message-ids
+// listed by several files or spelled differently. The sizes of the files
+// losing segments are recomputed so the file level stats match the segments
+// checked. The NZB is returned as is when it has no duplicates.
+func uniqueSegments(nzb *nzbparser.Nzb) (*nzbparser.Nzb, int) {
+	seen := make(map[string]bool)
+	duplicates := 0
+	for _, file := range nzb.Files {
+		for _, seg := range file.Segments {
+			key := messageIDKey(seg.Id)
+			if seen[key] {
+				duplicates++
+			}
+			seen[key] = true
+		}
+	}
+
+	if duplicates == 0 {
+		return nzb, 0
+	}
+
+	unique := *nzb
+	unique.Files = make(nzbparser.NzbFiles, len(nzb.Files))
+	unique.Segments, unique.Bytes = 0, 0
+	clear(seen)
+	for i, file := range nzb.Files {
+		segments := make(nzbparser.NzbSegments, 0, len(file.Segments))
+		for _, seg := range file.Segments {
+			key := messageIDKey(seg.Id)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			segments = append(segments, seg)
+		}
+
+		if len(segments) < len(file.Segments) {
+			file.Bytes = 0
+			for _, seg := range segments {
+				file.Bytes += int64(seg.Bytes)
+			}
+		}
+		file.Segments = segments
+
+		unique.Files[i] = file
+		unique.Segments += len(segments)
+		unique.Bytes += file.Bytes
+	}
+
+	return &unique, duplicates
+}
@@ -0,0 +1,205 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/textproto"
+	"os"
+	"sync"
+	"time"
+)
+
+// SessionResponse is the outcome of a segment request captured in a session
+// recording. A segment asked several times, e.g. by confirmations, has a
+// response for each request, in order.
+type SessionResponse struct {
+	SegmentID  string     `json:"segment_id"`
+	Bytes      int64      `json:"bytes"`
+	DurationMS int64      `json:"duration_ms"`
+	Class      ErrorClass `json:"class,omitempty"` // Empty when the segment was found
+	Code       int        `json:"code,omitempty"`  // NNTP status code of the error, when the server answered
+	Error      string     `json:"error,omitempty"`
+}
+
+// SessionRecorder appends the response of every segment request to a JSON
+// lines file, to reproduce odd failures offline with a SessionReplay
+type SessionRecorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+// NewSessionRecorder creates the recording file, replacing an existing one
+func NewSessionRecorder(path string) (*SessionRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session recording: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+
+	return &SessionRecorder{file: file, writer: writer, encoder: json.NewEncoder(writer)}, nil
+}
+
+// Record appends a response to the recording
+func (r *SessionRecorder) Record(resp SessionResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.encoder.Encode(resp)
+}
+
+// Close flushes and closes the recording
+func (r *SessionRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.writer.Flush(); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+
+	return r.file.Close()
+}
+
+// SessionReplay answers segment requests with the responses of a recording
+// instead of asking the providers. The responses of a segment are served in
+// recorded order, the last one is repeated once they run out.
+type SessionReplay struct {
+	mu        sync.Mutex
+	responses map[string][]SessionResponse
+	served    map[string]int
+}
+
+// LoadSession reads a session recording for replay
+func LoadSession(path string) (*SessionReplay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	replay := &SessionReplay{responses: make(map[string][]SessionResponse), served: make(map[string]int)}
+	decoder := json.NewDecoder(file)
+	for {
+		var resp SessionResponse
+		if err := decoder.Decode(&resp); err != nil {
+			if errors.Is(err, io.EOF) {
+				return replay, nil
+			}
+
+			return nil, fmt.Errorf("invalid session recording %s: %w", path, err)
+		}
+
+		replay.responses[resp.SegmentID] = append(replay.responses[resp.SegmentID], resp)
+	}
+}
+
+// Outcomes returns the final outcome of every recorded segment: an empty
+// class when any request found it, the class of its last error otherwise
+func (r *SessionReplay) Outcomes() map[string]ErrorClass {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outcomes := make(map[string]ErrorClass, len(r.responses))
+	for id, responses := range r.responses {
+		outcome := responses[len(responses)-1].Class
+		for _, resp := range responses {
+			if resp.Class == "" {
+				outcome = ""
+				break
+			}
+		}
+		outcomes[id] = outcome
+	}
+
+	return outcomes
+}
+
+// next returns the next recorded response of a segment after its recorded duration
+func (r *SessionReplay) next(ctx context.Context, segmentID string) (int64, error) {
+	r.mu.Lock()
+	responses := r.responses[segmentID]
+	i := min(r.served[segmentID], len(responses)-1)
+	r.served[segmentID]++
+	r.mu.Unlock()
+
+	if len(responses) == 0 {
+		return 0, &replayedError{msg: "segment not in the session recording", class: ErrorMissing}
+	}
+
+	resp := responses[i]
+	if err := sleepContext(ctx, time.Duration(resp.DurationMS)*time.Millisecond); err != nil {
+		return 0, err
+	}
+
+	if resp.Class == "" {
+		return resp.Bytes, nil
+	}
+
+	return resp.Bytes, &replayedError{msg: resp.Error, class: resp.Class, code: resp.Code}
+}
+
+// replayedError is a recorded segment error, classified as it was when recorded
+type replayedError struct {
+	msg   string
+	class ErrorClass
+	code  int
+}
+
+func (e *replayedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the NNTP error of the server answer, nil when there was none
+func (e *replayedError) Unwrap() error {
+	if e.code == 0 {
+		return nil
+	}
+
+	return &textproto.Error{Code: e.code, Msg: e.msg}
+}
+
+// WithSessionRecorder records the response of every segment request
+func WithSessionRecorder(recorder *SessionRecorder) Option {
+	return func(p *Processor) {
+		p.recorder = recorder
+	}
+}
+
+// WithSessionReplay answers segment requests from a recording instead of the providers
+func WithSessionReplay(replay *SessionReplay) Option {
+	return func(p *Processor) {
+		p.replay = replay
+	}
+}
+
+// recordResponse appends a segment response to the session recording when recording
+func (p *Processor) recordResponse(ctx context.Context, segmentID string, bytes int64, duration time.Duration, err error) {
+	if p.recorder == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	resp := SessionResponse{SegmentID: segmentID, Bytes: bytes, DurationMS: duration.Milliseconds()}
+	if err != nil {
+		resp.Class = p.classify(err)
+		resp.Error = err.Error()
+
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) {
+			resp.Code = protoErr.Code
+		}
+	}
+
+	if recErr := p.recorder.Record(resp); recErr != nil {
+		slog.WarnContext(ctx, "Failed to record segment response", "segment", segmentID, "error", recErr)
+	}
+}
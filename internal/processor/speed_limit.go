@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// speedPattern matches a download speed, e.g. "50MB/s"
+var speedPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-z]*)\s*(?:/\s*s)?$`)
+
+// ParseSpeed parses a download speed such as "50MB/s" or "2.5MiB/s" into
+// bytes per second, empty means no limit
+func ParseSpeed(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	m := speedPattern.FindStringSubmatch(strings.ToLower(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid speed %q, expected a size per second, e.g. 50MB/s", s)
+	}
+
+	bytes, err := parseSize(m[1], m[2])
+	if err != nil {
+		return 0, fmt.Errorf("invalid speed %q, %w", s, err)
+	}
+
+	return bytes, nil
+}
+
+// speedLimiter is a token bucket capping the bytes downloaded per second.
+// The size of an article is only known once it is downloaded, so requests
+// start while the bucket holds tokens and the downloaded bytes are taken
+// afterwards, the bucket going into debt until it refills.
+type speedLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Bytes per second
+	burst  float64 // Bytes held by a full bucket, one second of downloads
+	tokens float64
+	last   time.Time
+}
+
+func newSpeedLimiter(bytesPerSecond int64) *speedLimiter {
+	rate := float64(bytesPerSecond)
+	return &speedLimiter{rate: rate, burst: rate, tokens: rate, last: time.Now()}
+}
+
+// refill adds the tokens earned since the last refill, the lock held
+func (l *speedLimiter) refill(now time.Time) {
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// wait blocks until the bucket is out of debt, or until ctx is done
+func (l *speedLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	for {
+		l.mu.Lock()
+		l.refill(time.Now())
+		debt := -l.tokens
+		l.mu.Unlock()
+
+		if debt <= 0 {
+			return nil
+		}
+
+		if err := sleepContext(ctx, time.Duration(debt/l.rate*float64(time.Second))); err != nil {
+			return err
+		}
+	}
+}
+
+// take removes the bytes of a download from the bucket
+func (l *speedLimiter) take(bytes int64) {
+	if l == nil || bytes <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	l.refill(time.Now())
+	l.tokens -= float64(bytes)
+	l.mu.Unlock()
+}
+
+// WithMaxSpeed caps the bytes downloaded per second by every check together
+func WithMaxSpeed(bytesPerSecond int64) Option {
+	return func(p *Processor) {
+		p.speedLimit = nil
+		if bytesPerSecond > 0 {
+			p.speedLimit = newSpeedLimiter(bytesPerSecond)
+		}
+	}
+}
+
+// WithProviderSpeeds caps the bytes downloaded per second from each provider, keyed by provider ID
+func WithProviderSpeeds(speeds map[string]int64) Option {
+	return func(p *Processor) {
+		p.providerSpeeds = make(map[string]*speedLimiter, len(speeds))
+		for id, bytesPerSecond := range speeds {
+			if bytesPerSecond > 0 {
+				p.providerSpeeds[id] = newSpeedLimiter(bytesPerSecond)
+			}
+		}
+	}
+}
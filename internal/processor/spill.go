@@ -0,0 +1,127 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// SegmentRecord is the outcome of a single checked segment
+type SegmentRecord struct {
+	Source    string `json:"source"` // NZB the segment belongs to, see CheckOptions.Source
+	File      string `json:"file"`
+	SegmentID string `json:"segment_id"`
+	Bytes     int64  `json:"bytes"`
+	Missing   bool   `json:"missing"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SpillStore keeps records, e.g. per-segment results, in a temporary file
+// instead of memory so audits of very large libraries run with flat memory
+// usage
+type SpillStore[T any] struct {
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	records int
+}
+
+// NewSpillStore creates a spill file in dir, the OS temporary directory is used when dir is empty
+func NewSpillStore[T any](dir string) (*SpillStore[T], error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.CreateTemp(dir, "nzbtouch-results-*.jsonl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+
+	return &SpillStore[T]{
+		file:    file,
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+	}, nil
+}
+
+// Path returns the location of the spill file
+func (s *SpillStore[T]) Path() string {
+	return s.file.Name()
+}
+
+// Len returns the number of records appended so far
+func (s *SpillStore[T]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.records
+}
+
+// Append writes a record to the spill file
+func (s *SpillStore[T]) Append(rec T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.encoder.Encode(rec); err != nil {
+		return err
+	}
+	s.records++
+
+	return nil
+}
+
+// Iterate calls fn for every record in insertion order, stopping at the first error
+func (s *SpillStore[T]) Iterate(fn func(T) error) error {
+	s.mu.Lock()
+	err := s.writer.Flush()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(s.file.Name())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var rec T
+		if err := decoder.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes and removes the spill file
+func (s *SpillStore[T]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := errors.Join(s.writer.Flush(), s.file.Close())
+	if removeErr := os.Remove(s.file.Name()); removeErr != nil && !os.IsNotExist(removeErr) {
+		err = errors.Join(err, removeErr)
+	}
+
+	return err
+}
@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nntppool/v2/pkg/nntpcli"
+)
+
+// statBatchSizeDefault is the number of message-ids verified per connection in STAT mode
+var statBatchSizeDefault = 100
+
+// segmentRecorder accounts for a checked segment, returning an error to abort the check
+type segmentRecorder func(ctx context.Context, seg nzbparser.NzbSegment, bytes int64, err error) error
+
+// statBatch verifies a batch of segments with STAT on a single connection so
+// it is not returned to the pool after every request. Segments that are not
+// found, or that could not be checked because the connection broke, are
+// retried through the pool once the connection has been released, letting
+// the other providers confirm them. The batch provider is not asked again
+// for the segments it did not have.
+func (p *Processor) statBatch(ctx context.Context, segments []nzbparser.NzbSegment, groups []string, record segmentRecorder) error {
+	var (
+		retry []nzbparser.NzbSegment
+		// Segments the batch provider did not have, retried on the others only
+		missed     []nzbparser.NzbSegment
+		providerID string
+	)
+
+	skip := slices.Concat(p.members(slices.Concat(p.usage.Stopped(), p.notCarrying(groups), p.unscheduled())), p.outsideTier(p.firstTier()))
+	conn, err := p.nntpClient.GetConnection(ctx, skip, false)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+
+		retry = segments
+	} else {
+		healthy := true
+		providerID = p.logical(conn.Provider().ID())
+		for i, seg := range segments {
+			if ctx.Err() != nil {
+				break
+			}
+
+			if err := p.waitProvider(ctx, providerID); err != nil {
+				break
+			}
+
+			start := time.Now()
+			_, err := checkOnConnection(conn.Connection(), CheckModeStat, 0, seg.Id, groups)
+			p.recordOutcome(providerID, err)
+			tallyRequest(ctx, providerID, 0, err)
+			p.usage.Record(providerID, 0, err == nil)
+			if err == nil {
+				p.recordResponse(ctx, seg.Id, 0, time.Since(start), nil)
+				p.groupStats.Record(groups, providerID, false)
+				if recErr := record(ctx, seg, 0, nil); recErr != nil {
+					_ = conn.Free()
+					return recErr
+				}
+
+				continue
+			}
+
+			if !nntpcli.IsArticleNotFoundError(err) {
+				// The connection is no longer usable, check the rest through the pool
+				healthy = false
+				retry = append(retry, segments[i:]...)
+				break
+			}
+
+			// The retry asks the other providers only
+			p.groupStats.Record(groups, providerID, true)
+			missed = append(missed, seg)
+		}
+
+		if healthy {
+			_ = conn.Free()
+		} else {
+			_ = conn.Close()
+		}
+	}
+
+	for _, seg := range missed {
+		if err := p.retrySegment(ctx, seg, groups, providerID, record); err != nil || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	for _, seg := range retry {
+		if err := p.retrySegment(ctx, seg, groups, "", record); err != nil || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retrySegment checks a segment of a batch through the pool, without asking
+// the provider missedIn again unless it is ""
+func (p *Processor) retrySegment(ctx context.Context, seg nzbparser.NzbSegment, groups []string, missedIn string, record segmentRecorder) error {
+	bytes, err := p.checkSegment(ctx, seg.Id, groups, missedIn)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return record(ctx, seg, bytes, err)
+}
@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javi11/nzb-touch/internal/errcode"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+var (
+	// manualPriority is the queue priority of NZBs submitted by hand, over the
+	// socket, the API or the CLI, so they are checked before the backlog
+	manualPriority = 100
+	// submitMaxPayload bounds the size of uploaded NZBs
+	submitMaxPayload int64 = 64 * 1024 * 1024
+)
+
+// WithSubmitDirectory sets where NZBs uploaded over the socket or the API are saved
+func WithSubmitDirectory(directory string) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.submitDirectory = directory
+	}
+}
+
+// Submit queues an existing NZB ahead of the backlog, returning its path
+func (s *DirectoryScanner) Submit(ctx context.Context, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", errcode.New(errcode.InvalidRequest, "path must be absolute")
+	}
+
+	if !strings.EqualFold(filepath.Ext(path), ".nzb") {
+		return "", errcode.New(errcode.InvalidRequest, "not an .nzb file")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errcode.Wrap(errcode.InvalidRequest, err)
+	}
+	if info.IsDir() {
+		return "", errcode.New(errcode.InvalidRequest, "path is a directory")
+	}
+
+	path = s.canonicalPath(ctx, path)
+
+	return path, s.ingest(ctx, path)
+}
+
+// Upload saves an NZB in the submit directory and queues it ahead of the
+// backlog, returning the path it was saved to
+func (s *DirectoryScanner) Upload(ctx context.Context, name string, r io.Reader) (string, error) {
+	if s.submitDirectory == "" {
+		return "", errcode.New(errcode.UploadsDisabled, "uploads are disabled, no submit directory is configured")
+	}
+
+	name = filepath.Base(name)
+	if name == "." || name == string(filepath.Separator) || name == "" {
+		return "", errcode.New(errcode.InvalidRequest, "missing NZB name")
+	}
+	if !strings.EqualFold(filepath.Ext(name), ".nzb") {
+		name += ".nzb"
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, submitMaxPayload+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > submitMaxPayload {
+		return "", errcode.Wrap(errcode.InvalidRequest, fmt.Errorf("payload larger than %d bytes", submitMaxPayload))
+	}
+	if !bytes.Contains(data, []byte("<nzb")) {
+		return "", errcode.New(errcode.InvalidRequest, "payload is not an NZB")
+	}
+
+	path := filepath.Join(s.submitDirectory, name)
+	if _, err := os.Stat(path); err == nil {
+		return "", errcode.Wrap(errcode.FileExists, fmt.Errorf("%s already exists", path))
+	}
+
+	if err := fsutil.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	s.queue.LogFileOperation(FileWritten, path, "", "uploaded")
+
+	return path, s.ingest(ctx, path)
+}
+
+// ingest queues a submitted NZB with the manual priority unless it is already known
+func (s *DirectoryScanner) ingest(ctx context.Context, path string) error {
+	if s.queue.Contains(path) {
+		return errcode.New(errcode.AlreadyQueued, "already queued")
+	}
+
+	s.queueFileWithPriority(ctx, path, manualPriority)
+
+	return nil
+}
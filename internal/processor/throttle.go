@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// loadThrottleIntervalDefault is how often the load is sampled by default
+	loadThrottleIntervalDefault = 10 * time.Second
+	// loadIdleRatio is the share of the thresholds the load must fall under
+	// before workers are restored, so the throttle does not flap at the edge
+	loadIdleRatio = 0.75
+)
+
+// LoadThrottle reduces the segment requests in flight while other work keeps
+// the host or its network busy, and restores them once it is idle again
+type LoadThrottle struct {
+	CPUPercent  float64       // CPU usage of other processes, in percent of every core, above which requests are reduced (0 = ignored)
+	Interface   string        // Network interface whose traffic is watched, e.g. "eth0" (empty = ignored)
+	NetworkMbps float64       // Traffic on Interface other than the checks, in Mbit/s, above which requests are reduced
+	MinWorkers  int           // Requests kept in flight while throttled (default 1)
+	Interval    time.Duration // How often the load is sampled (default 10s)
+}
+
+// busy reports whether the load exceeds the thresholds scaled by ratio
+func (t LoadThrottle) busy(load hostLoad, ratio float64) bool {
+	return (t.CPUPercent > 0 && load.CPUPercent > t.CPUPercent*ratio) ||
+		(t.Interface != "" && t.NetworkMbps > 0 && load.NetworkMbps > t.NetworkMbps*ratio)
+}
+
+// enabled reports whether any load is watched
+func (t LoadThrottle) enabled() bool {
+	return t.CPUPercent > 0 || (t.Interface != "" && t.NetworkMbps > 0)
+}
+
+// hostLoad is the load of the host caused by other work than the checks
+type hostLoad struct {
+	CPUPercent  float64 // CPU usage of other processes, in percent of every core
+	NetworkMbps float64 // Traffic of the watched interface minus the downloaded articles
+}
+
+// WithLoadThrottle reduces the requests in flight while the host or its network is busy
+func WithLoadThrottle(throttle LoadThrottle) Option {
+	return func(p *Processor) {
+		if throttle.MinWorkers <= 0 {
+			throttle.MinWorkers = 1
+		}
+		if throttle.Interval <= 0 {
+			throttle.Interval = loadThrottleIntervalDefault
+		}
+		p.throttle = throttle
+	}
+}
+
+// runLoadThrottle samples the load until ctx is done, holding request slots
+// of the budget while it is high: the slots are halved on every busy sample
+// down to MinWorkers, and a quarter of them is given back on every sample
+// under loadIdleRatio of the thresholds
+func (p *Processor) runLoadThrottle(ctx context.Context) {
+	if !p.throttle.enabled() {
+		return
+	}
+
+	sampler, err := newLoadSampler(p.throttle.Interface, p.downloaded.Load)
+	if err != nil {
+		slog.WarnContext(ctx, "Load throttling disabled", "error", err)
+		return
+	}
+
+	go func() {
+		size := cap(p.budget.slots)
+		minWorkers := min(p.throttle.MinWorkers, size)
+		held := 0
+		defer func() {
+			for ; held > 0; held-- {
+				p.budget.release()
+			}
+		}()
+
+		ticker := time.NewTicker(p.throttle.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			load, err := sampler.sample()
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to sample the load", "error", err)
+				continue
+			}
+
+			busy := p.throttle.busy(load, 1)
+
+			workers := size - held
+			target := workers
+			switch {
+			case busy:
+				target = max(minWorkers, workers/2)
+			case held > 0 && !p.throttle.busy(load, loadIdleRatio):
+				target = min(size, workers+max(1, size/4))
+			}
+			if target == workers {
+				continue
+			}
+
+			// Slots are taken as the requests using them finish
+			for ; workers > target; workers-- {
+				if p.budget.acquire(ctx) != nil {
+					return
+				}
+				held++
+			}
+			for ; workers < target; workers++ {
+				p.budget.release()
+				held--
+			}
+
+			if busy {
+				slog.InfoContext(ctx, "Host busy, reducing download workers", "workers", workers, "cpu", load.CPUPercent, "network_mbps", load.NetworkMbps)
+			} else {
+				slog.InfoContext(ctx, "Host idle, restoring download workers", "workers", workers, "cpu", load.CPUPercent, "network_mbps", load.NetworkMbps)
+			}
+		}
+	}()
+}
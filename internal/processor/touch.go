@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// WithTouch marks the NZBs passing their check with the verification time:
+// as their modification time when mtime is set, and in the extended
+// attribute xattr when it is not empty
+func WithTouch(mtime bool, xattr string) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.touchMtime = mtime
+		s.touchXattr = xattr
+	}
+}
+
+// touchVerified stamps an NZB that passed its check with the verification
+// time. It runs after the rules, which see the age of the NZB before it.
+func (s *DirectoryScanner) touchVerified(ctx context.Context, e events.Event) {
+	if (!s.touchMtime && s.touchXattr == "") || e.Err != nil || eventResult(e) == nil {
+		return
+	}
+
+	// A rule may have moved or deleted the NZB
+	if _, err := os.Stat(e.Path); err != nil {
+		return
+	}
+
+	now := time.Now()
+	if s.touchMtime {
+		if err := os.Chtimes(e.Path, now, now); err != nil {
+			slog.WarnContext(ctx, "Failed to touch verified NZB", "path", e.Path, "error", err)
+		}
+	}
+
+	if s.touchXattr != "" {
+		if err := fsutil.SetXattr(e.Path, s.touchXattr, now.UTC().Format(time.RFC3339)); err != nil {
+			slog.WarnContext(ctx, "Failed to set the verification attribute", "path", e.Path, "xattr", s.touchXattr, "error", err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/fsutil"
+	"golang.org/x/text/unicode/norm"
+)
+
+// trashRetentionDefault is how long trashed NZBs can be restored by default
+const trashRetentionDefault = 30 * 24 * time.Hour
+
+// TrashEntry is an NZB deleted into the trash or moved out of its watch
+// directory, which can be restored to its original path
+type TrashEntry struct {
+	ID        int64         `json:"id"`
+	Time      time.Time     `json:"time"`
+	Operation FileOperation `json:"operation"` // FileDeleted or FileMoved
+	Original  string        `json:"original"`  // Path the NZB is restored to
+	Location  string        `json:"location"`  // Where the NZB is now, in the trash or a target directory
+	Reason    string        `json:"reason,omitempty"`
+}
+
+// WithTrash keeps deleted NZBs in dir and records the moved ones, so both can
+// be restored for retention (default: 30 days). Empty deletes NZBs for good.
+func WithTrash(dir string, retention time.Duration) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.trashDirectory = dir
+		s.trashRetention = trashRetentionDefault
+		if retention > 0 {
+			s.trashRetention = retention
+		}
+	}
+}
+
+// createTrash creates the table recording the NZBs that can be restored
+func createTrash(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS trash (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			at TIMESTAMP NOT NULL,
+			operation TEXT NOT NULL,
+			original TEXT NOT NULL,
+			location TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_trash_original ON trash(original);
+	`)
+	return err
+}
+
+// AddTrash records an NZB that left its original path and can be restored
+func (q *Queue) AddTrash(op FileOperation, original, location, reason string) {
+	original, location = normalizePath(original), normalizePath(location)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, err := q.db.Exec(
+		"INSERT INTO trash (at, operation, original, location, reason) VALUES (?, ?, ?, ?, ?)",
+		time.Now(), op, original, location, reason,
+	)
+	if err != nil {
+		slog.Error("Failed to record trashed file", "path", original, "error", err)
+	}
+}
+
+// Trash returns the entries of the trash, newest first. With a name only the
+// entries whose original path or file name is name, or whose file name
+// matches name as a glob, are returned.
+func (q *Queue) Trash(name string) ([]TrashEntry, error) {
+	entries, err := q.trashEntries("SELECT id, at, operation, original, location, reason FROM trash ORDER BY id DESC")
+	if err != nil || name == "" {
+		return entries, err
+	}
+
+	// Names typed on macOS may be decomposed
+	name = norm.NFC.String(name)
+
+	var matching []TrashEntry
+	for _, e := range entries {
+		base := filepath.Base(e.Original)
+		if matched, _ := filepath.Match(name, base); matched || e.Original == normalizePath(name) || base == name {
+			matching = append(matching, e)
+		}
+	}
+
+	return matching, nil
+}
+
+// expiredTrash returns the entries of the trash added before the given time
+func (q *Queue) expiredTrash(before time.Time) ([]TrashEntry, error) {
+	return q.trashEntries("SELECT id, at, operation, original, location, reason FROM trash WHERE at < ? ORDER BY id", before)
+}
+
+// trashEntries runs a query selecting trash entries
+func (q *Queue) trashEntries(query string, args ...any) ([]TrashEntry, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	rows, err := q.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var entries []TrashEntry
+	for rows.Next() {
+		var e TrashEntry
+		if err := rows.Scan(&e.ID, &e.Time, &e.Operation, &e.Original, &e.Location, &e.Reason); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// removeTrash forgets a trash entry
+func (q *Queue) removeTrash(id int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.db.Exec("DELETE FROM trash WHERE id = ?", id); err != nil {
+		slog.Error("Failed to remove trash entry", "id", id, "error", err)
+	}
+}
+
+// RestoreTrash moves the NZB of a trash entry back to its original path. An NZB
+// already at the original path is never overwritten.
+func (q *Queue) RestoreTrash(e TrashEntry) error {
+	if _, err := os.Lstat(fsutil.DiskPath(e.Original)); err == nil {
+		return fmt.Errorf("%s already exists", e.Original)
+	}
+
+	if _, err := os.Stat(fsutil.DiskPath(e.Location)); err != nil {
+		return fmt.Errorf("%s is gone: %w", e.Location, err)
+	}
+
+	if err := fsutil.Move(e.Location, e.Original); err != nil {
+		return err
+	}
+
+	q.removeTrash(e.ID)
+	q.SetMovedTo(e.Original, "")
+	q.LogFileOperation(FileRestored, e.Location, e.Original, "undid "+string(e.Operation)+" ("+e.Reason+")")
+
+	return nil
+}
+
+// deleteFile deletes an NZB, into the trash when there is one. It returns
+// where the file is now, empty when it is gone.
+func (s *DirectoryScanner) deleteFile(filePath, reason string) (string, error) {
+	if s.trashDirectory == "" {
+		if err := os.Remove(filePath); err != nil {
+			return filePath, err
+		}
+
+		s.queue.LogFileOperation(FileDeleted, filePath, "", reason)
+		return "", nil
+	}
+
+	// Trashed files are never overwritten, a name already taken is numbered
+	trashPath, _ := resolveCollision(CollisionSuffix, s.trashDirectory,
+		filepath.Join(s.trashDirectory, s.watchRelative(filePath)), time.Now())
+	if err := fsutil.Move(filePath, trashPath); err != nil {
+		return filePath, err
+	}
+
+	s.queue.SetMovedTo(filePath, trashPath)
+	s.queue.LogFileOperation(FileDeleted, filePath, trashPath, reason)
+	s.queue.AddTrash(FileDeleted, filePath, trashPath, reason)
+
+	slog.Info("Moved NZB file to the trash", "from", filePath, "to", trashPath)
+	return trashPath, nil
+}
+
+// purgeTrash deletes the trashed NZBs older than the retention and forgets
+// the moves that can no longer be restored
+func (s *DirectoryScanner) purgeTrash(ctx context.Context) {
+	expired, err := s.queue.expiredTrash(time.Now().Add(-s.trashRetention))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read the trash", "error", err)
+		return
+	}
+
+	purged := 0
+	for _, e := range expired {
+		if e.Operation == FileDeleted {
+			if err := os.Remove(fsutil.DiskPath(e.Location)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				slog.ErrorContext(ctx, "Failed to purge trashed file", "path", e.Location, "error", err)
+				continue
+			}
+
+			s.queue.LogFileOperation(FilePurged, e.Location, "", "trash retention expired")
+			removeEmptyParents(filepath.Dir(e.Location), s.trashDirectory)
+			purged++
+		}
+
+		s.queue.removeTrash(e.ID)
+	}
+
+	if len(expired) > 0 {
+		slog.InfoContext(ctx, "Expired trash entries", "count", len(expired), "purged_files", purged)
+	}
+}
+
+// removeEmptyParents removes dir and its parents while they are empty, up to root excluded
+func removeEmptyParents(dir, root string) {
+	root = filepath.Clean(root) + string(filepath.Separator)
+	for dir = filepath.Clean(dir); strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
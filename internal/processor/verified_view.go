@@ -0,0 +1,170 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/javi11/nzb-touch/internal/events"
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// WithVerifiedView maintains below dir a tree of symlinks to the NZBs whose
+// latest check passed, mirroring their paths below the watch directories
+func WithVerifiedView(dir string) ScannerOption {
+	return func(s *DirectoryScanner) {
+		s.verifiedView = dir
+	}
+}
+
+// PassedItems returns the files whose latest check passed. Items being
+// checked again keep the outcome of their previous check.
+func (q *Queue) PassedItems() ([]string, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	rows, err := q.db.Query(
+		"SELECT file_path FROM queue WHERE process_count > 0 AND failed_checks = 0 AND status != ? AND duplicate_of = ''",
+		StatusFailed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+// syncVerifiedView regenerates the verified view from the queue: links to the
+// NZBs whose latest check passed are created and the other links removed.
+// Only symlinks are ever removed from the view.
+func (s *DirectoryScanner) syncVerifiedView(ctx context.Context) {
+	s.viewMu.Lock()
+	defer s.viewMu.Unlock()
+
+	paths, err := s.queue.PassedItems()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to list the verified NZBs", "error", err)
+		return
+	}
+
+	want := make(map[string]string, len(paths))
+	for _, path := range paths {
+		target, err := filepath.Abs(fsutil.DiskPath(path))
+		if err != nil {
+			continue
+		}
+
+		if _, err := os.Stat(target); err == nil {
+			want[s.viewLink(path)] = target
+		}
+	}
+
+	removed := 0
+	err = filepath.WalkDir(s.verifiedView, func(link string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		if target, err := os.Readlink(link); err == nil && target == want[link] {
+			delete(want, link)
+			return nil
+		}
+
+		if err := os.Remove(link); err == nil {
+			removeEmptyParents(filepath.Dir(link), s.verifiedView)
+			removed++
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.ErrorContext(ctx, "Failed to walk the verified view", "dir", s.verifiedView, "error", err)
+	}
+
+	for link, target := range want {
+		if err := replaceLink(link, target); err != nil {
+			slog.ErrorContext(ctx, "Failed to link verified NZB", "path", target, "link", link, "error", err)
+		}
+	}
+
+	slog.DebugContext(ctx, "Verified view regenerated", "dir", s.verifiedView, "linked", len(want), "removed", removed)
+}
+
+// updateVerifiedView links the NZB of a passed check into the verified view
+// and unlinks the NZB of a failed one
+func (s *DirectoryScanner) updateVerifiedView(ctx context.Context, e events.Event) {
+	// A check interrupted by the shutdown did not happen, it runs again
+	if s.verifiedView == "" || errors.Is(e.Err, context.Canceled) {
+		return
+	}
+
+	s.viewMu.Lock()
+	defer s.viewMu.Unlock()
+
+	link := s.viewLink(e.Path)
+	target, err := filepath.Abs(e.Path)
+	if err != nil {
+		return
+	}
+
+	// A rule may have moved or deleted the NZB
+	if _, statErr := os.Stat(target); e.Err == nil && statErr == nil {
+		if err := replaceLink(link, target); err != nil {
+			slog.ErrorContext(ctx, "Failed to link verified NZB", "path", target, "link", link, "error", err)
+		}
+		return
+	}
+
+	if info, err := os.Lstat(link); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if err := os.Remove(link); err == nil {
+			removeEmptyParents(filepath.Dir(link), s.verifiedView)
+		}
+	}
+}
+
+// viewLink returns the path of the link to an NZB in the verified view, named
+// in normal form whatever the spelling of the NZB on disk
+func (s *DirectoryScanner) viewLink(path string) string {
+	return filepath.Join(s.verifiedView, s.watchRelative(normalizePath(path)))
+}
+
+// replaceLink points link at target, swapping an existing symlink atomically.
+// A file that is not a symlink is never replaced.
+func replaceLink(link, target string) error {
+	if info, err := os.Lstat(link); err == nil && info.Mode()&fs.ModeSymlink == 0 {
+		return fmt.Errorf("%s exists and is not a symlink", link)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+		return err
+	}
+
+	tmp := link + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
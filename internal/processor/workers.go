@@ -0,0 +1,156 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// workerScaleInterval is how often the number of processing workers is adjusted
+var workerScaleInterval = 15 * time.Second
+
+// WithMinWorkers sets the number of processing workers kept when the queue
+// is idle. Workers scale up to the configured concurrent jobs as the pending
+// queue grows. By default the scanner always runs every worker.
+func WithMinWorkers(n int) ScannerOption {
+	return func(s *DirectoryScanner) {
+		if n > 0 {
+			s.minWorkers = n
+		}
+	}
+}
+
+// startWorker starts a processing worker
+func (s *DirectoryScanner) startWorker(ctx context.Context) {
+	s.workers.Add(1)
+	go s.processFiles(ctx)
+}
+
+// scaleWorkers adjusts the number of processing workers to the pending queue depth
+func (s *DirectoryScanner) scaleWorkers(ctx context.Context) {
+	// Reprocessed items are not pending in the queue but are in flight
+	s.inFlightMu.Lock()
+	target := max(s.queue.CountPending(), len(s.inFlight))
+	s.inFlightMu.Unlock()
+
+	if target < s.minWorkers {
+		target = s.minWorkers
+	}
+	if target > s.maxWorkers {
+		target = s.maxWorkers
+	}
+
+	current := int(s.workers.Load())
+	switch {
+	case target > current:
+		slog.DebugContext(ctx, "Scaling processing workers up", "from", current, "to", target)
+		for i := current; i < target; i++ {
+			s.startWorker(ctx)
+		}
+	case target < current:
+		slog.DebugContext(ctx, "Scaling processing workers down", "from", current, "to", target)
+		for i := target; i < current; i++ {
+			// Only idle workers pick up the signal, busy ones are retried on the next tick
+			select {
+			case s.shrinkChan <- struct{}{}:
+			default:
+				return
+			}
+		}
+	}
+}
+
+// runWorkerScaler periodically rescales the workers and dispatches pending items
+func (s *DirectoryScanner) runWorkerScaler(ctx context.Context) {
+	ticker := time.NewTicker(workerScaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.scaleWorkers(ctx)
+			s.dispatchPending(ctx)
+		case <-s.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// enqueue sends a file to the processing workers unless it is already in
+// flight, returning false when the processing queue is full. Files with a
+// positive priority go through the priority lane, drained before the backlog.
+func (s *DirectoryScanner) enqueue(filePath string, priority int) bool {
+	s.inFlightMu.Lock()
+	defer s.inFlightMu.Unlock()
+
+	if _, ok := s.inFlight[filePath]; ok {
+		return true
+	}
+
+	lane := s.processingQueue
+	if priority > 0 {
+		lane = s.priorityQueue
+	}
+
+	select {
+	case lane <- filePath:
+		s.inFlight[filePath] = time.Now()
+		return true
+	default:
+		return false
+	}
+}
+
+// nextFile waits for the next file to process, taking priority files first.
+// It returns false when the worker must stop.
+func (s *DirectoryScanner) nextFile(ctx context.Context) (string, bool) {
+	select {
+	case filePath := <-s.priorityQueue:
+		return filePath, true
+	default:
+	}
+
+	select {
+	case filePath := <-s.priorityQueue:
+		return filePath, true
+	case filePath := <-s.processingQueue:
+		return filePath, true
+	case <-s.shrinkChan:
+		return "", false
+	case <-s.stopChan:
+		return "", false
+	case <-ctx.Done():
+		return "", false
+	}
+}
+
+// queuedAt returns when a file in flight was sent to the workers
+func (s *DirectoryScanner) queuedAt(filePath string) time.Time {
+	s.inFlightMu.Lock()
+	defer s.inFlightMu.Unlock()
+
+	return s.inFlight[filePath]
+}
+
+// done marks a file as no longer in flight
+func (s *DirectoryScanner) done(filePath string) {
+	s.inFlightMu.Lock()
+	delete(s.inFlight, filePath)
+	s.inFlightMu.Unlock()
+}
+
+// dispatchPending sends queued items that were not processed yet, e.g.
+// because the processing queue was full when they were found
+func (s *DirectoryScanner) dispatchPending(ctx context.Context) {
+	if s.limitReached(ctx) {
+		return
+	}
+
+	for _, item := range s.queue.GetPendingItems() {
+		if !s.enqueue(item.FilePath, item.Priority) {
+			return
+		}
+	}
+}
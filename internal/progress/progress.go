@@ -0,0 +1,161 @@
+// Package progress estimates when a run of checks, the scan backlog or a
+// library audit, completes from the average time and size of its checks
+package progress
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Snapshot is the progress of a run
+type Snapshot struct {
+	Active              bool      `json:"active"`                // A run is in progress
+	Started             time.Time `json:"started,omitzero"`      // Start of the run
+	Total               int       `json:"total"`                 // Items of the run, done included
+	Done                int       `json:"done"`                  // Items checked
+	Percent             float64   `json:"percent"`               // Done as a percentage of Total
+	AverageCheckSeconds float64   `json:"average_check_seconds"` // Average time of a single check
+	AverageBytes        int64     `json:"average_bytes"`         // Average bytes downloaded by a check
+	Rate                float64   `json:"rate_per_hour"`         // Items checked per hour, parallel checks included
+	RemainingSeconds    float64   `json:"remaining_seconds"`     // Time left at the rate so far, 0 when unknown
+	ETA                 time.Time `json:"eta,omitzero"`          // Expected end of the run, zero when unknown
+}
+
+// Tracker follows a run of checks. When the items left are known, as in a
+// scanner backlog, the run starts with the first check recorded and ends
+// once no item is left, the next check starting a new run. Otherwise the run
+// is started by SetTotal, as an audit is, and ends at its total.
+type Tracker struct {
+	mu      sync.Mutex
+	active  bool
+	started time.Time
+	total   int
+	done    int
+	busy    time.Duration // Sum of the check times
+	bytes   int64
+}
+
+// NewTracker creates a tracker with no run in progress
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// SetTotal starts a run of total items, or updates the total of the run in
+// progress as more items are found
+func (t *Tracker) SetTotal(total int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.active {
+		t.active, t.started, t.done, t.busy, t.bytes = true, time.Now(), 0, 0, 0
+	}
+	t.total = total
+}
+
+// Skip removes an item left unchecked from the run, e.g. deferred to a later one
+func (t *Tracker) Skip() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total--
+	if t.done >= t.total {
+		t.active = false
+	}
+}
+
+// Record accounts for a finished check, of the given duration and bytes
+// downloaded, with left items still to check (negative when unknown)
+func (t *Tracker) Record(took time.Duration, bytes int64, left int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.active {
+		// The first check of the run started before it finished
+		t.active, t.started, t.done, t.busy, t.bytes = true, time.Now().Add(-took), 0, 0, 0
+	}
+
+	t.done++
+	t.busy += took
+	t.bytes += bytes
+
+	if left >= 0 {
+		t.total = t.done + left
+		t.active = left > 0
+	} else if t.done >= t.total {
+		t.active = false
+	}
+}
+
+// Snapshot returns the progress of the current run with left items still to
+// check (negative when unknown), or of the last run when none is in progress
+func (t *Tracker) Snapshot(left int) Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	total := t.total
+	switch {
+	case left >= 0 && t.active:
+		total = t.done + left
+	case left > 0:
+		// Items were found since the last run ended, none is checked yet
+		return Snapshot{Total: left}
+	}
+
+	s := Snapshot{Active: t.active, Started: t.started, Total: max(total, t.done), Done: t.done}
+	if s.Total > 0 {
+		s.Percent = float64(s.Done) * 100 / float64(s.Total)
+	}
+	if t.done == 0 {
+		return s
+	}
+
+	s.AverageCheckSeconds = (t.busy / time.Duration(t.done)).Seconds()
+	s.AverageBytes = t.bytes / int64(t.done)
+
+	elapsed := time.Since(t.started)
+	if elapsed <= 0 {
+		return s
+	}
+	s.Rate = float64(t.done) / elapsed.Hours()
+
+	if t.active && s.Total > s.Done {
+		remaining := time.Duration(float64(elapsed) / float64(t.done) * float64(s.Total-s.Done))
+		s.RemainingSeconds = remaining.Round(time.Second).Seconds()
+		s.ETA = time.Now().Add(remaining).Round(time.Second)
+	}
+
+	return s
+}
+
+// Log logs the progress returned by snapshot every interval while a run is
+// in progress, until ctx is done
+func Log(ctx context.Context, interval time.Duration, msg string, snapshot func() Snapshot) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastDone := -1
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		s := snapshot()
+		if !s.Active || s.Done == 0 || s.Done == lastDone {
+			continue
+		}
+		lastDone = s.Done
+
+		slog.InfoContext(ctx, msg,
+			"done", s.Done,
+			"total", s.Total,
+			"percent", int(s.Percent),
+			"average_check", time.Duration(s.AverageCheckSeconds*float64(time.Second)).Round(time.Second),
+			"average_bytes", s.AverageBytes,
+			"remaining", time.Duration(s.RemainingSeconds*float64(time.Second)),
+			"eta", s.ETA.Format(time.RFC3339))
+	}
+}
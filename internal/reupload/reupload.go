@@ -0,0 +1,142 @@
+package reupload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var timeoutDefault = 6 * time.Hour
+
+// Mapping translates the location of NZBs to the location of the data they were created from
+type Mapping struct {
+	NzbPrefix    string `yaml:"nzb_prefix"`    // Directory containing the NZBs
+	SourcePrefix string `yaml:"source_prefix"` // Directory containing the original data
+}
+
+// Config describes the command re-uploading the data of a failed NZB.
+// The placeholders {source}, {nzb}, {output} and {name} are replaced in args.
+type Config struct {
+	Command         string        `yaml:"command"`
+	Args            []string      `yaml:"args"`
+	PathMappings    []Mapping     `yaml:"path_mappings"`
+	OutputDirectory string        `yaml:"output_directory"` // Where the new NZB is written (default: next to the failed NZB)
+	Timeout         time.Duration `yaml:"timeout"`          // Maximum duration of an upload (default: 6h)
+}
+
+// Uploader runs the re-upload command for NZBs whose data is available locally
+type Uploader struct {
+	cfg Config
+}
+
+// New creates an uploader, it returns nil when no command is configured
+func New(cfg Config) *Uploader {
+	if cfg.Command == "" {
+		return nil
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = timeoutDefault
+	}
+
+	return &Uploader{cfg: cfg}
+}
+
+// Validate checks the re-upload configuration
+func Validate(cfg Config) error {
+	if cfg.Command == "" {
+		return nil
+	}
+
+	if len(cfg.PathMappings) == 0 {
+		return errors.New("reupload: at least one path mapping is required")
+	}
+
+	for _, m := range cfg.PathMappings {
+		if m.NzbPrefix == "" || m.SourcePrefix == "" {
+			return errors.New("reupload: path mappings require nzb_prefix and source_prefix")
+		}
+	}
+
+	return nil
+}
+
+// Source returns the local data an NZB was created from. The NZB path is
+// translated with the first matching mapping and its .nzb extension removed,
+// ok is false when no mapping matches or the data does not exist.
+func (u *Uploader) Source(nzbPath string) (string, bool) {
+	if u == nil {
+		return "", false
+	}
+
+	for _, m := range u.cfg.PathMappings {
+		rel, err := filepath.Rel(m.NzbPrefix, nzbPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		source := filepath.Join(m.SourcePrefix, strings.TrimSuffix(rel, filepath.Ext(rel)))
+		if _, err := os.Stat(source); err == nil {
+			return source, true
+		}
+	}
+
+	return "", false
+}
+
+// Output returns the path of the NZB produced by re-uploading nzbPath
+func (u *Uploader) Output(nzbPath string) string {
+	dir := u.cfg.OutputDirectory
+	if dir == "" {
+		dir = filepath.Dir(nzbPath)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(nzbPath), filepath.Ext(nzbPath))
+
+	return filepath.Join(dir, name+".reupload.nzb")
+}
+
+// Upload runs the re-upload command for the NZB and returns the new NZB path
+func (u *Uploader) Upload(ctx context.Context, nzbPath, source string) (string, error) {
+	output := u.Output(nzbPath)
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return "", err
+	}
+
+	replacer := strings.NewReplacer(
+		"{source}", source,
+		"{nzb}", nzbPath,
+		"{output}", output,
+		"{name}", filepath.Base(source),
+	)
+
+	args := make([]string, len(u.cfg.Args))
+	for i, arg := range u.cfg.Args {
+		args[i] = replacer.Replace(arg)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.cfg.Timeout)
+	defer cancel()
+
+	slog.InfoContext(ctx, "Re-uploading NZB data", "nzb", nzbPath, "source", source, "output", output)
+
+	out, err := exec.CommandContext(ctx, u.cfg.Command, args...).CombinedOutput()
+	if len(out) > 0 {
+		slog.DebugContext(ctx, "Re-upload output", "nzb", nzbPath, "output", strings.TrimSpace(string(out)))
+	}
+	if err != nil {
+		return "", fmt.Errorf("re-upload command failed: %w", err)
+	}
+
+	if _, err := os.Stat(output); err != nil {
+		return "", fmt.Errorf("re-upload command did not create %s: %w", output, err)
+	}
+
+	return output, nil
+}
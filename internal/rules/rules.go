@@ -0,0 +1,183 @@
+package rules
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ActionType identifies what a rule does when it matches
+type ActionType string
+
+const (
+	ActionMove     ActionType = "move"     // Move the NZB into Target directory
+	ActionDelete   ActionType = "delete"   // Delete the NZB
+	ActionNotify   ActionType = "notify"   // Run the Target command with NZBTOUCH_* variables
+	ActionResearch ActionType = "research" // Run the Target command to search the release again
+	ActionPriority ActionType = "priority" // Change the queue priority of the NZB
+)
+
+// Condition holds the criteria a check result must match, unset fields are ignored
+type Condition struct {
+	HealthBelow   *float64      `yaml:"health_below"`    // Health percentage strictly below this value
+	HealthAtLeast *float64      `yaml:"health_at_least"` // Health percentage greater or equal than this value
+	Failed        *bool         `yaml:"failed"`          // Whether the check failed
+	OlderThan     time.Duration `yaml:"older_than"`      // NZB file modification time older than this
+	NewerThan     time.Duration `yaml:"newer_than"`      // NZB file modification time newer than this
+	Category      string        `yaml:"category"`        // Category of the NZB (case-insensitive)
+	PathPattern   string        `yaml:"path_pattern"`    // Glob matched against the full path and the file name
+	// Escalation of NZBs that keep failing: consecutive failed checks, the
+	// current one included, and how long ago the first of them ran
+	FailedChecks int           `yaml:"failed_checks"` // At least this many consecutive failed checks
+	FailingFor   time.Duration `yaml:"failing_for"`   // Failing for at least this long, e.g. "720h"
+}
+
+// Action is executed when a rule matches
+type Action struct {
+	Type     ActionType `yaml:"type"`
+	Target   string     `yaml:"target"`   // Directory for move, command for notify/research
+	Priority int        `yaml:"priority"` // New priority for the priority action
+}
+
+// Rule binds a condition to the actions executed when it matches
+type Rule struct {
+	Name    string    `yaml:"name"`
+	When    Condition `yaml:"when"`
+	Actions []Action  `yaml:"actions"`
+	Stop    bool      `yaml:"stop"` // Do not evaluate further rules after this one matches
+}
+
+// Facts describe a checked NZB
+type Facts struct {
+	Path         string
+	Category     string
+	Health       float64
+	Failed       bool
+	ModTime      time.Time // Zero when unknown, age conditions then never match
+	FailedChecks int       // Consecutive failed checks, the current one included
+	FailingSince time.Time // First of the consecutive failed checks, zero when the check passed
+}
+
+// Match describes an action selected by a rule
+type Match struct {
+	Rule   string
+	Action Action
+	// The rule escalates NZBs confirmed dead by their failed checks
+	Escalation bool
+}
+
+// escalates reports whether the rule matches NZBs by their failed checks
+func (r Rule) escalates() bool {
+	return r.When.FailedChecks > 0 || r.When.FailingFor > 0
+}
+
+// Validate checks rules for unknown actions and malformed patterns
+func Validate(rules []Rule) error {
+	for i, r := range rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		if len(r.Actions) == 0 {
+			return fmt.Errorf("rule %s: at least one action is required", name)
+		}
+
+		if r.When.FailedChecks < 0 || r.When.FailingFor < 0 {
+			return fmt.Errorf("rule %s: failed_checks and failing_for must not be negative", name)
+		}
+
+		if r.When.PathPattern != "" {
+			if _, err := filepath.Match(r.When.PathPattern, ""); err != nil {
+				return fmt.Errorf("rule %s: invalid path_pattern: %w", name, err)
+			}
+		}
+
+		for _, a := range r.Actions {
+			switch a.Type {
+			case ActionDelete, ActionPriority:
+			case ActionMove, ActionNotify, ActionResearch:
+				if a.Target == "" {
+					return fmt.Errorf("rule %s: action %s requires a target", name, a.Type)
+				}
+			default:
+				return fmt.Errorf("rule %s: unknown action %q", name, a.Type)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Evaluate returns the actions of every rule matching the facts, in rule order
+func Evaluate(rules []Rule, facts Facts, now time.Time) []Match {
+	var matches []Match
+	for i, r := range rules {
+		if !r.When.matches(facts, now) {
+			continue
+		}
+
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		for _, a := range r.Actions {
+			matches = append(matches, Match{Rule: name, Action: a, Escalation: r.escalates()})
+		}
+
+		if r.Stop {
+			break
+		}
+	}
+
+	return matches
+}
+
+// matches reports whether all set criteria match the facts
+func (c Condition) matches(f Facts, now time.Time) bool {
+	if c.HealthBelow != nil && f.Health >= *c.HealthBelow {
+		return false
+	}
+
+	if c.HealthAtLeast != nil && f.Health < *c.HealthAtLeast {
+		return false
+	}
+
+	if c.Failed != nil && f.Failed != *c.Failed {
+		return false
+	}
+
+	// The age of an NZB whose file could not be read is unknown
+	age := now.Sub(f.ModTime)
+	if c.OlderThan > 0 && (f.ModTime.IsZero() || age <= c.OlderThan) {
+		return false
+	}
+
+	if c.NewerThan > 0 && (f.ModTime.IsZero() || age >= c.NewerThan) {
+		return false
+	}
+
+	if c.Category != "" && !strings.EqualFold(c.Category, f.Category) {
+		return false
+	}
+
+	if c.FailedChecks > 0 && f.FailedChecks < c.FailedChecks {
+		return false
+	}
+
+	if c.FailingFor > 0 && (f.FailingSince.IsZero() || now.Sub(f.FailingSince) < c.FailingFor) {
+		return false
+	}
+
+	if c.PathPattern != "" {
+		fullMatch, _ := filepath.Match(c.PathPattern, f.Path)
+		baseMatch, _ := filepath.Match(c.PathPattern, filepath.Base(f.Path))
+		if !fullMatch && !baseMatch {
+			return false
+		}
+	}
+
+	return true
+}
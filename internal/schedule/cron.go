@@ -0,0 +1,245 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchLimit bounds the search for the next run, expressions such as
+// "0 0 30 2 *" never match
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronDescriptors are the shorthands accepted in place of the five fields
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames   = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// Cron is a parsed cron expression, matched against the local wall clock
+type Cron struct {
+	expr    string
+	minutes uint64
+	hours   uint64
+	days    uint64 // Days of the month
+	months  uint64
+	// Days of the week, and the nth weekdays of the month ("sun#1") as a bit per n
+	weekdays uint64
+	nth      [7]uint8
+	// Fields left as "*", the day matches the other day field alone
+	anyDay     bool
+	anyWeekday bool
+}
+
+// ParseCron parses a cron expression of five fields, "minute hour
+// day-of-month month day-of-week", or a shorthand such as "@daily". Fields
+// take lists, ranges and steps ("1-5", "*/15", "mon,wed"); the day of the week
+// also takes "sun#1" for the first Sunday of the month. Like in cron, a day
+// matches either day field when both are restricted.
+func ParseCron(expr string) (Cron, error) {
+	fields := strings.Fields(strings.ToLower(expr))
+	if len(fields) == 1 {
+		if expanded, ok := cronDescriptors[fields[0]]; ok {
+			fields = strings.Fields(expanded)
+		}
+	}
+	if len(fields) != 5 {
+		return Cron{}, fmt.Errorf("invalid cron expression %q, expected minute hour day-of-month month day-of-week", expr)
+	}
+
+	c := Cron{
+		expr:       strings.TrimSpace(expr),
+		anyDay:     strings.HasPrefix(fields[2], "*"),
+		anyWeekday: strings.HasPrefix(fields[4], "*"),
+	}
+
+	var err error
+	if c.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return Cron{}, fmt.Errorf("invalid cron expression %q: minute: %w", expr, err)
+	}
+	if c.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return Cron{}, fmt.Errorf("invalid cron expression %q: hour: %w", expr, err)
+	}
+	if c.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return Cron{}, fmt.Errorf("invalid cron expression %q: day of month: %w", expr, err)
+	}
+	if c.months, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return Cron{}, fmt.Errorf("invalid cron expression %q: month: %w", expr, err)
+	}
+	if err := c.parseWeekdays(fields[4]); err != nil {
+		return Cron{}, fmt.Errorf("invalid cron expression %q: day of week: %w", expr, err)
+	}
+
+	return c, nil
+}
+
+// parseWeekdays parses the day of the week field, where 7 is also Sunday
+func (c *Cron) parseWeekdays(field string) error {
+	var plain []string
+	for _, item := range strings.Split(field, ",") {
+		day, nth, ok := strings.Cut(item, "#")
+		if !ok {
+			plain = append(plain, item)
+			continue
+		}
+
+		weekday, err := parseCronValue(day, 0, 7, weekdayNames)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(nth)
+		if err != nil || n < 1 || n > 5 {
+			return fmt.Errorf("invalid nth weekday %q, expected 1 to 5", item)
+		}
+
+		c.nth[weekday%7] |= 1 << n
+	}
+
+	if len(plain) == 0 {
+		return nil
+	}
+
+	bits, err := parseCronField(strings.Join(plain, ","), 0, 7, weekdayNames)
+	if err != nil {
+		return err
+	}
+	if bits&(1<<7) != 0 {
+		bits |= 1
+	}
+	c.weekdays = bits &^ (1 << 7)
+
+	return nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps
+// into a bit per allowed value
+func parseCronField(field string, low, high int, names []string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		span, stepText, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", item)
+			}
+		}
+
+		first, last := low, high
+		switch from, to, isRange := strings.Cut(span, "-"); {
+		case span == "*":
+		case isRange:
+			var err error
+			if first, err = parseCronValue(from, low, high, names); err != nil {
+				return 0, err
+			}
+			if last, err = parseCronValue(to, low, high, names); err != nil {
+				return 0, err
+			}
+			if last < first {
+				return 0, fmt.Errorf("invalid range %q", span)
+			}
+		default:
+			var err error
+			if first, err = parseCronValue(span, low, high, names); err != nil {
+				return 0, err
+			}
+			// "5/15" runs from 5 to the end of the field
+			if !hasStep {
+				last = first
+			}
+		}
+
+		for v := first; v <= last; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+// parseCronValue parses a number or a name of the field
+func parseCronValue(s string, low, high int, names []string) (int, error) {
+	for i, name := range names {
+		if s == name {
+			return i + low, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < low || v > high {
+		return 0, fmt.Errorf("invalid value %q, expected %d to %d", s, low, high)
+	}
+
+	return v, nil
+}
+
+// Next returns the first time matching the expression after t, zero when
+// none matches within five years
+func (c Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case c.months&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hours&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// matchesDay reports whether the day of t matches the day fields
+func (c Cron) matchesDay(t time.Time) bool {
+	day := c.days&(1<<t.Day()) != 0
+	weekday := c.weekdays&(1<<int(t.Weekday())) != 0 || c.nth[t.Weekday()]&(1<<((t.Day()-1)/7+1)) != 0
+
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// String returns the expression as written
+func (c Cron) String() string {
+	return c.expr
+}
+
+// NextOf returns the earliest next run of the expressions after t, zero when none matches
+func NextOf(crons []Cron, t time.Time) time.Time {
+	var next time.Time
+	for _, c := range crons {
+		if n := c.Next(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+
+	return next
+}
@@ -0,0 +1,132 @@
+package usage
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Cost is what a provider costs, in the currency of the user
+type Cost struct {
+	PerGB    float64 // Price of every GB downloaded
+	PerMonth float64 // Subscription price, paid whether the provider is used or not
+}
+
+// ReportRow is what a provider contributed during a month and what it cost
+type ReportRow struct {
+	Month     string  `json:"month"`
+	Provider  string  `json:"provider"`
+	Requests  int64   `json:"requests"`
+	Found     int64   `json:"found"`
+	Bytes     int64   `json:"bytes"`
+	Share     float64 `json:"share"`                 // Percentage of the articles found that month found on this provider
+	Cost      float64 `json:"cost"`                  // Subscription plus downloaded GB, 0 without a declared cost
+	CostPerGB float64 `json:"cost_per_gb,omitempty"` // Effective price of the GB downloaded, 0 when nothing was
+}
+
+// Months returns the last n calendar months up to the one of now, oldest first
+func Months(now time.Time, n int) []string {
+	months := make([]string, n)
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	for i := range months {
+		months[i] = first.AddDate(0, i-n+1, 0).Format(monthLayout)
+	}
+
+	return months
+}
+
+// Report weighs the activity of every provider during the given months
+// against its cost. Providers with a cost appear in every month, even
+// without activity, since their subscription is paid anyway.
+func Report(entries []Usage, costs map[string]Cost, months []string) []ReportRow {
+	providers := make(map[string]map[string]*Month)
+	for _, u := range entries {
+		providers[u.Provider] = u.Months
+	}
+	for provider := range costs {
+		if _, ok := providers[provider]; !ok {
+			providers[provider] = nil
+		}
+	}
+
+	names := make([]string, 0, len(providers))
+	for provider := range providers {
+		names = append(names, provider)
+	}
+	sort.Strings(names)
+
+	var rows []ReportRow
+	for _, month := range months {
+		var found int64
+		for _, provider := range names {
+			if m := providers[provider][month]; m != nil {
+				found += m.Found
+			}
+		}
+
+		for _, provider := range names {
+			m := providers[provider][month]
+			cost, hasCost := costs[provider]
+			if m == nil && !hasCost {
+				continue
+			}
+
+			row := ReportRow{Month: month, Provider: provider}
+			if m != nil {
+				row.Requests, row.Found, row.Bytes = m.Requests, m.Found, m.Bytes
+			}
+			if found > 0 {
+				row.Share = float64(row.Found) / float64(found) * 100
+			}
+
+			row.Cost = cost.PerMonth + cost.PerGB*float64(row.Bytes)/GB
+			if row.Bytes > 0 {
+				row.CostPerGB = row.Cost / (float64(row.Bytes) / GB)
+			}
+
+			rows = append(rows, row)
+		}
+	}
+
+	return rows
+}
+
+// WriteReport writes a report as a table, with a total per month
+func WriteReport(w io.Writer, rows []ReportRow) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "MONTH\tPROVIDER\tREQUESTS\tFOUND\tSHARE\tDOWNLOADED\tCOST\tCOST/GB")
+	for i, row := range rows {
+		costPerGB := "-"
+		if row.CostPerGB > 0 {
+			costPerGB = fmt.Sprintf("%.2f", row.CostPerGB)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.1f%%\t%.2f GB\t%.2f\t%s\n",
+			row.Month, row.Provider, row.Requests, row.Found, row.Share, float64(row.Bytes)/GB, row.Cost, costPerGB)
+
+		if i == len(rows)-1 || rows[i+1].Month != row.Month {
+			writeMonthTotal(tw, rows, row.Month)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// writeMonthTotal writes the totals of the providers during a month
+func writeMonthTotal(w io.Writer, rows []ReportRow, month string) {
+	var total ReportRow
+	for _, row := range rows {
+		if row.Month == month {
+			total.Requests += row.Requests
+			total.Found += row.Found
+			total.Bytes += row.Bytes
+			total.Cost += row.Cost
+		}
+	}
+
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t\t%.2f GB\t%.2f\t\n",
+		month, "total", total.Requests, total.Found, float64(total.Bytes)/GB, total.Cost)
+}
@@ -0,0 +1,269 @@
+// Package usage keeps a persistent ledger of the bytes downloaded from and
+// the requests sent to each provider, month by month, tracks the balance of
+// block accounts and weighs what each provider contributed against its cost
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/javi11/nzb-touch/internal/fsutil"
+)
+
+// GB is the size of a gigabyte as sold by block account providers
+const GB = 1000 * 1000 * 1000
+
+// Account is a block account, a provider sold as a fixed amount of data
+type Account struct {
+	ProviderID string
+	Balance    int64 // Bytes left on the account when it was declared
+	Warn       int64 // Remaining bytes below which a warning is logged
+	Stop       int64 // Remaining bytes below which the provider is no longer used (0 to never stop)
+}
+
+// monthLayout formats the months the activity of providers is counted by
+const monthLayout = "2006-01"
+
+// Usage is the ledger entry of a provider
+type Usage struct {
+	Provider  string            `json:"provider"`
+	Used      int64             `json:"used_bytes"`
+	Declared  int64             `json:"declared_bytes,omitempty"` // Block account balance the usage is counted against
+	Remaining int64             `json:"remaining_bytes,omitempty"`
+	Months    map[string]*Month `json:"months,omitempty"` // Activity by month, e.g. "2026-01"
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Month is the activity of a provider during a calendar month
+type Month struct {
+	Bytes    int64 `json:"bytes"`    // Bytes downloaded
+	Requests int64 `json:"requests"` // Articles requested, found or not
+	Found    int64 `json:"found"`    // Articles the provider had
+}
+
+// Ledger counts the bytes downloaded from every provider and persists them to
+// a JSON file. It is safe for concurrent use and a nil ledger ignores everything.
+type Ledger struct {
+	mu       sync.Mutex
+	path     string
+	accounts map[string]Account
+	usage    map[string]*Usage
+	warned   map[string]bool
+	dirty    bool
+}
+
+// Open loads the ledger stored at path, creating it on the first save. The
+// usage of a block account restarts when its declared balance changes, e.g.
+// after buying a new block.
+func Open(path string, accounts []Account) (*Ledger, error) {
+	l := &Ledger{
+		path:     path,
+		accounts: make(map[string]Account, len(accounts)),
+		usage:    make(map[string]*Usage),
+		warned:   make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		var entries []*Usage
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("invalid usage file %s: %w", path, err)
+		}
+		for _, u := range entries {
+			l.usage[u.Provider] = u
+		}
+	}
+
+	for _, a := range accounts {
+		l.accounts[a.ProviderID] = a
+
+		u := l.entry(a.ProviderID)
+		if u.Declared != a.Balance {
+			u.Declared = a.Balance
+			u.Used = 0
+			l.dirty = true
+		}
+		u.Remaining = u.Declared - u.Used
+
+		if a.Stop > 0 && u.Remaining <= a.Stop {
+			slog.Warn("Block account is depleted, the provider is not used",
+				"provider", a.ProviderID,
+				"remaining_gb", fmt.Sprintf("%.2f", float64(u.Remaining)/GB))
+		}
+	}
+
+	return l, nil
+}
+
+// entry returns the usage of a provider, creating it when missing. Callers hold mu.
+func (l *Ledger) entry(providerID string) *Usage {
+	u := l.usage[providerID]
+	if u == nil {
+		u = &Usage{Provider: providerID}
+		l.usage[providerID] = u
+	}
+
+	return u
+}
+
+// Record accounts for an article requested from a provider, found or not,
+// and the bytes downloaded for it
+func (l *Ledger) Record(providerID string, bytes int64, found bool) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	u := l.entry(providerID)
+	if u.Months == nil {
+		u.Months = make(map[string]*Month)
+	}
+	month := u.Months[now.Format(monthLayout)]
+	if month == nil {
+		month = &Month{}
+		u.Months[now.Format(monthLayout)] = month
+	}
+
+	month.Requests++
+	if found {
+		month.Found++
+	}
+	u.UpdatedAt = now
+	l.dirty = true
+
+	if bytes <= 0 {
+		return
+	}
+	month.Bytes += bytes
+	u.Used += bytes
+
+	a, ok := l.accounts[providerID]
+	if !ok {
+		return
+	}
+
+	u.Remaining = u.Declared - u.Used
+	if u.Remaining <= a.Warn && !l.warned[providerID] {
+		l.warned[providerID] = true
+		slog.Warn("Block account is running out",
+			"provider", providerID,
+			"remaining_gb", fmt.Sprintf("%.2f", float64(u.Remaining)/GB),
+			"stops_at_gb", fmt.Sprintf("%.2f", float64(a.Stop)/GB))
+	}
+}
+
+// Stopped returns the block accounts whose balance fell below their stop threshold
+func (l *Ledger) Stopped() []string {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var stopped []string
+	for id, a := range l.accounts {
+		if a.Stop > 0 && l.usage[id].Remaining <= a.Stop {
+			stopped = append(stopped, id)
+		}
+	}
+
+	return stopped
+}
+
+// Snapshot returns the usage of every provider sorted by provider
+func (l *Ledger) Snapshot() []Usage {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.snapshot()
+}
+
+// snapshot copies the ledger entries. Callers hold mu.
+func (l *Ledger) snapshot() []Usage {
+	entries := make([]Usage, 0, len(l.usage))
+	for _, u := range l.usage {
+		entry := *u
+		if u.Months != nil {
+			entry.Months = make(map[string]*Month, len(u.Months))
+			for key, m := range u.Months {
+				month := *m
+				entry.Months[key] = &month
+			}
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Provider < entries[j].Provider
+	})
+
+	return entries
+}
+
+// Save persists the ledger when it changed since the last save
+func (l *Ledger) Save() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(l.snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fsutil.WriteFile(l.path, data, 0o644); err != nil {
+		return err
+	}
+	l.dirty = false
+
+	return nil
+}
+
+// WriteText writes the usage of every provider as a table
+func WriteText(w io.Writer, entries []Usage) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "PROVIDER\tUSED\tBLOCK\tREMAINING\tUPDATED")
+	for _, u := range entries {
+		block, remaining := "-", "-"
+		if u.Declared > 0 {
+			block = fmt.Sprintf("%.2f GB", float64(u.Declared)/GB)
+			remaining = fmt.Sprintf("%.2f GB", float64(u.Remaining)/GB)
+		}
+
+		updated := "-"
+		if !u.UpdatedAt.IsZero() {
+			updated = u.UpdatedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(tw, "%s\t%.2f GB\t%s\t%s\t%s\n", u.Provider, float64(u.Used)/GB, block, remaining, updated)
+	}
+
+	return tw.Flush()
+}